@@ -0,0 +1,261 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// A profile is the "profile.json" file of an export. Secrets, like the
+// GitHub access token and the calendar token, are left out.
+type profile struct {
+	ID                  int32      `json:"id"`
+	Email               string     `json:"email"`
+	Name                *string    `json:"name"`
+	Timezone            string     `json:"timezone"`
+	GitHubUserID        int32      `json:"github_user_id"`
+	IsAdmin             bool       `json:"is_admin"`
+	SuspendedAt         *time.Time `json:"suspended_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// A session is an entry of the "sessions.json" file of an export, without
+// its token.
+type session struct {
+	ID        int32     `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// An apiToken is an entry of the "api_tokens.json" file of an export,
+// without its hash.
+type apiToken struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// A project is an entry of the "projects.json" file of an export.
+type project struct {
+	ID          int32     `json:"id"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	Published   bool      `json:"published"`
+	IsTemplate  bool      `json:"is_template"`
+	State       string    `json:"state"`
+	Shared      bool      `json:"shared"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// A milestone is an entry of the "milestones.json" file of an export.
+type milestone struct {
+	ID          int32     `json:"id"`
+	ProjectID   int32     `json:"project_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	TargetDate  *string   `json:"target_date"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// A task is an entry of the "tasks.json" file of an export.
+type task struct {
+	ID          int32     `json:"id"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	Status      string    `json:"status"`
+	DueDate     *string   `json:"due_date"`
+	Recurrence  *string   `json:"recurrence"`
+	ProjectID   *int32    `json:"project_id"`
+	MilestoneID *int32    `json:"milestone_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// A timeEntry is an entry of the "time_entries.json" file of an export.
+type timeEntry struct {
+	ID        int32      `json:"id"`
+	TaskID    int32      `json:"task_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Note      string     `json:"note"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// An attachment is an entry of the "attachments.json" file of an export.
+type attachment struct {
+	ID          int32     `json:"id"`
+	TaskID      int32     `json:"task_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WriteExport writes the given data of a user to w as a ZIP file, with one
+// JSON file per kind of data, e.g. "tasks.json".
+func WriteExport(w io.Writer, data database.UserData) error {
+	z := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", newProfile(data.User)},
+		{"sessions.json", mapSlice(data.Sessions, newSession)},
+		{"api_tokens.json", mapSlice(data.APITokens, newAPIToken)},
+		{"projects.json", mapSlice(append(data.Projects, data.SharedProjects...), newProject)},
+		{"milestones.json", mapSlice(data.Milestones, newMilestone)},
+		{"tasks.json", mapSlice(data.Tasks, newTask)},
+		{"time_entries.json", mapSlice(data.TimeEntries, newTimeEntry)},
+		{"attachments.json", mapSlice(data.Attachments, newAttachment)},
+	}
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(file.v)
+		if err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func newProfile(u database.User) profile {
+	return profile{
+		ID:                  u.ID,
+		Email:               u.Email,
+		Name:                text(u.Name),
+		Timezone:            u.Timezone,
+		GitHubUserID:        u.GitHubUserID,
+		IsAdmin:             u.IsAdmin,
+		SuspendedAt:         timestamp(u.SuspendedAt),
+		DeletionScheduledAt: timestamp(u.DeletionScheduledAt),
+	}
+}
+
+func newSession(s database.Session) session {
+	return session{
+		ID:        s.ID,
+		UserAgent: s.UserAgent,
+		CreatedAt: s.CreatedAt.Time,
+	}
+}
+
+func newAPIToken(t database.APIToken) apiToken {
+	return apiToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		LastUsedAt: timestamp(t.LastUsedAt),
+		CreatedAt:  t.CreatedAt.Time,
+	}
+}
+
+func newProject(p database.Project) project {
+	return project{
+		ID:          p.ID,
+		Title:       p.Title,
+		Description: text(p.Description),
+		Published:   p.Published,
+		IsTemplate:  p.IsTemplate,
+		State:       string(p.State),
+		Shared:      p.Shared,
+		CreatedAt:   p.CreatedAt.Time,
+		UpdatedAt:   p.UpdatedAt.Time,
+	}
+}
+
+func newMilestone(m database.Milestone) milestone {
+	return milestone{
+		ID:          m.ID,
+		ProjectID:   m.ProjectID,
+		Name:        m.Name,
+		Description: m.Description,
+		TargetDate:  date(m.TargetDate),
+		CreatedAt:   m.CreatedAt.Time,
+	}
+}
+
+func newTask(t database.Task) task {
+	return task{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: text(t.Description),
+		Status:      string(t.Status),
+		DueDate:     date(t.DueDate),
+		Recurrence:  text(t.Recurrence),
+		ProjectID:   int4(t.ProjectID),
+		MilestoneID: int4(t.MilestoneID),
+		CreatedAt:   t.CreatedAt.Time,
+		UpdatedAt:   t.UpdatedAt.Time,
+	}
+}
+
+func newTimeEntry(e database.TimeEntry) timeEntry {
+	return timeEntry{
+		ID:        e.ID,
+		TaskID:    e.TaskID,
+		StartedAt: e.StartedAt.Time,
+		EndedAt:   timestamp(e.EndedAt),
+		Note:      e.Note,
+		CreatedAt: e.CreatedAt.Time,
+	}
+}
+
+func newAttachment(a database.Attachment) attachment {
+	return attachment{
+		ID:          a.ID,
+		TaskID:      a.TaskID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		CreatedAt:   a.CreatedAt.Time,
+	}
+}
+
+// mapSlice returns the result of calling f on every element of s, which is
+// never nil so that empty slices are encoded as "[]".
+func mapSlice[T, U any](s []T, f func(T) U) []U {
+	out := make([]U, 0, len(s))
+	for _, v := range s {
+		out = append(out, f(v))
+	}
+	return out
+}
+
+func text(t pgtype.Text) *string {
+	if !t.Valid {
+		return nil
+	}
+	return &t.String
+}
+
+func timestamp(t pgtype.Timestamp) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func date(d pgtype.Date) *string {
+	if !d.Valid {
+		return nil
+	}
+	s := d.Time.Format("2006-01-02")
+	return &s
+}
+
+func int4(i pgtype.Int4) *int32 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int32
+}
@@ -0,0 +1,203 @@
+// Package account deletes the accounts of users once the grace period they
+// were given to change their mind is over, and generates the exports of
+// their data they ask for.
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/storage"
+)
+
+// GracePeriod is how long after a user asks for their account to be deleted
+// it's actually deleted, during which they can cancel it.
+const GracePeriod = 14 * 24 * time.Hour
+
+const (
+	// exportBatchSize is the number of pending exports locked by each
+	// transaction of RunOnce.
+	exportBatchSize = 5
+	// deletionBatchSize is the number of due accounts locked by each
+	// transaction of RunOnce.
+	deletionBatchSize = 20
+)
+
+// A Worker generates pending data exports and deletes the accounts whose
+// grace period is over.
+//
+// It's safe to run a Worker on every instance of the app, since exports and
+// accounts are locked while they're processed, and skipped by the other
+// instances.
+type Worker struct {
+	db       *sqlx.DB
+	users    *database.UserService
+	exports  *database.DataExportService
+	storage  storage.Storage
+	interval time.Duration
+}
+
+// NewWorker returns a pointer to Worker, which keeps export files in the
+// given storage, and looks for work every given interval.
+func NewWorker(db *sqlx.DB, storage storage.Storage, interval time.Duration) *Worker {
+	return &Worker{
+		db:       db,
+		users:    database.NewUserService(db),
+		exports:  database.NewDataExportService(db),
+		storage:  storage,
+		interval: interval,
+	}
+}
+
+// Run calls RunOnce right away and then every interval, until the given
+// context is done. Errors are logged, and the next run tries again.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		exports, deletions, err := w.RunOnce(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "account work failed", "error", err)
+		}
+		if exports > 0 {
+			slog.InfoContext(ctx, "data exports generated", "count", exports)
+		}
+		if deletions > 0 {
+			slog.InfoContext(ctx, "accounts deleted", "count", deletions)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce generates every pending export, then deletes every account
+// scheduled to be deleted at or before the given time, and returns the
+// number of exports generated, successfully or not, and of accounts deleted.
+//
+// Both are processed in batches, each inside its own transaction.
+func (w *Worker) RunOnce(ctx context.Context, now time.Time) (int, int, error) {
+	exports := 0
+	for {
+		n, more, err := w.runExportBatch(ctx)
+		exports += n
+		if err != nil {
+			return exports, 0, err
+		}
+		if !more {
+			break
+		}
+	}
+	deletions := 0
+	for {
+		n, more, err := w.runDeletionBatch(ctx, now)
+		deletions += n
+		if err != nil || !more {
+			return exports, deletions, err
+		}
+	}
+}
+
+// runExportBatch generates a batch of pending exports, and reports whether
+// there may be more pending exports.
+func (w *Worker) runExportBatch(ctx context.Context) (int, bool, error) {
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+	pending, err := w.exports.GetAllPendingWithTx(ctx, tx, exportBatchSize)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, export := range pending {
+		data, err := w.exports.GetUserDataWithTx(ctx, tx, export.UserID)
+		if err != nil {
+			return 0, false, err
+		}
+		key, size, err := w.store(ctx, data)
+		if err != nil {
+			// a failed export can be asked for again, and shouldn't stop
+			// the other exports from being generated
+			slog.WarnContext(ctx, "data export failed", "export_id", export.ID, "error", err)
+			err = w.exports.FailWithTx(ctx, tx, export.ID, err.Error())
+		} else {
+			err = w.exports.CompleteWithTx(ctx, tx, export.ID, key, size)
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, false, err
+	}
+	return len(pending), len(pending) == exportBatchSize, nil
+}
+
+// store writes the given data as a ZIP file into storage, and returns its
+// key and size.
+func (w *Worker) store(ctx context.Context, data database.UserData) (string, int64, error) {
+	var buf bytes.Buffer
+	err := WriteExport(&buf, data)
+	if err != nil {
+		return "", 0, err
+	}
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", 0, err
+	}
+	key := fmt.Sprintf("exports/%d/%s.zip", data.User.ID, hex.EncodeToString(b))
+	size := int64(buf.Len())
+	err = w.storage.Put(ctx, key, &buf, size, "application/zip")
+	if err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+// runDeletionBatch deletes a batch of due accounts, and reports whether
+// there may be more due accounts.
+func (w *Worker) runDeletionBatch(ctx context.Context, now time.Time) (int, bool, error) {
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+	// timestamps are stored without a time zone, in UTC
+	due, err := w.users.GetAllDueForDeletionWithTx(ctx, tx, pgtype.Timestamp{Time: now.UTC(), Valid: true}, deletionBatchSize)
+	if err != nil {
+		return 0, false, err
+	}
+	var keys []string
+	for _, user := range due {
+		k, err := w.users.DeleteWithTx(ctx, tx, user.ID)
+		if err != nil {
+			return 0, false, err
+		}
+		keys = append(keys, k...)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, false, err
+	}
+	// files are only removed once nothing points at them anymore
+	for _, key := range keys {
+		err := w.storage.Delete(ctx, key)
+		if err != nil {
+			slog.ErrorContext(ctx, "file of deleted account not deleted", "error", err, "key", key)
+		}
+	}
+	return len(due), len(due) == deletionBatchSize, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/account"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestAccount(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	worker := account.NewWorker(handler.DB, handler.Storage, time.Minute)
+
+	t.Run("download my data", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/exports")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("Generating…", doc.Find(".data-export-status").Text())
+
+		exports, _, err := worker.RunOnce(context.Background(), time.Now())
+		assert.NoError(err)
+		assert.Equal(1, exports)
+
+		var id int32
+		handler.DB.Get(&id, "select id from data_exports where user_id = 1 and status = 'ready'")
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/profile/exports/%d", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("application/zip", res.Header.Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(err)
+		z, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if !assert.NoError(err) {
+			return
+		}
+		files := map[string][]byte{}
+		for _, f := range z.File {
+			r, err := f.Open()
+			assert.NoError(err)
+			files[f.Name], _ = io.ReadAll(r)
+			r.Close()
+		}
+		var tasks []map[string]any
+		assert.NoError(json.Unmarshal(files["tasks.json"], &tasks))
+		assert.Len(tasks, 4)
+		var profile map[string]any
+		assert.NoError(json.Unmarshal(files["profile.json"], &profile))
+		assert.Equal("hello@webdevfuel.com", profile["email"])
+		assert.NotContains(string(files["profile.json"]), "token")
+
+		// other users can't download it
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/profile/exports/%d", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		res = test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+	})
+
+	deleteAccount := func(email string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/delete")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "email", Value: email}),
+		)
+		return test.Do(req)
+	}
+
+	t.Run("confirm with email address", func(t *testing.T) {
+		res := deleteAccount("hello@webdevfuel.com")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("doesn't match your email address", doc.Find("#account-deletion .text-red-600").Text())
+		assert.Equal(0, doc.Find(".account-deletion-scheduled").Length())
+		// the projects that are deleted with the account are listed
+		assert.Equal(2, doc.Find(".account-deletion-project").Length())
+	})
+
+	t.Run("cancel deletion", func(t *testing.T) {
+		res := deleteAccount("johndoe@gmail.com")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(1, doc.Find(".account-deletion-scheduled").Length())
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/delete")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Delete),
+		)
+		res = test.Do(req)
+		doc = test.Doc(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(0, doc.Find(".account-deletion-scheduled").Length())
+	})
+
+	t.Run("delete account after grace period", func(t *testing.T) {
+		// user 2 has a task in project 1, shared with them by user 1
+		handler.DB.MustExec("insert into projects_users (project_id, user_id) values (1, 2)")
+		handler.DB.MustExec("insert into tasks (id, title, owner_id, project_id) values (100, 'Shared task', 2, 1)")
+		// and user 1 has a task in project 3, owned by user 2
+		handler.DB.MustExec("insert into tasks (id, title, owner_id, project_id) values (101, 'Task of user 1', 1, 3)")
+		// user 2 tracked time on the shared task, and is still tracking it
+		handler.DB.MustExec(`
+			insert into time_entries (task_id, user_id, started_at, ended_at) values
+			    (100, 2, '2026-03-01 09:00', '2026-03-01 10:00'),
+			    (100, 2, '2026-03-02 09:00', null)
+		`)
+
+		deleteAccount("johndoe@gmail.com")
+
+		assert := assert.New(t)
+		_, deletions, err := worker.RunOnce(context.Background(), time.Now())
+		assert.NoError(err)
+		assert.Equal(0, deletions)
+
+		_, deletions, err = worker.RunOnce(context.Background(), time.Now().Add(account.GracePeriod+time.Hour))
+		assert.NoError(err)
+		assert.Equal(1, deletions)
+
+		var count int
+		handler.DB.Get(&count, "select count(*) from users where id = 2")
+		assert.Equal(0, count)
+		handler.DB.Get(&count, "select count(*) from projects where owner_id = 2")
+		assert.Equal(0, count)
+
+		// the task in the shared project is kept, credited to a deleted
+		// user, along with the time tracked on it
+		var ownerID int32
+		handler.DB.Get(&ownerID, "select owner_id from tasks where id = 100")
+		assert.Equal(database.DeletedUserID, ownerID)
+		handler.DB.Get(&count, "select count(*) from time_entries where task_id = 100 and user_id = $1 and ended_at is not null", database.DeletedUserID)
+		assert.Equal(2, count)
+		var name string
+		handler.DB.Get(&name, "select name from users where id = $1", database.DeletedUserID)
+		assert.Equal("Deleted user", name)
+
+		// tasks of other users in deleted projects are kept, without one
+		var projectID *int32
+		handler.DB.Get(&projectID, "select project_id from tasks where id = 101")
+		assert.Nil(projectID)
+	})
+}
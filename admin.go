@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+const adminUsage = `usage: projectmotor admin <command>
+
+commands:
+  users [SEARCH]              list users, by name or email address
+  projects [SEARCH]           list projects, by title or owner's email address
+  sessions [SEARCH]           list sessions, by email address or user agent
+  grant EMAIL                 make a user an admin
+  revoke EMAIL                make an admin a regular user again
+  suspend EMAIL               suspend a user, deleting all of their sessions
+  unsuspend EMAIL             let a suspended user log in again
+  transfer PROJECT_ID EMAIL   make a user the owner of a project`
+
+// runAdmin runs the "admin" subcommand with the given arguments, for
+// managing users and projects from scripts, or before there's an admin who
+// can use the admin area.
+func runAdmin(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		os.Exit(2)
+	}
+	db, err := database.OpenDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	admin := database.NewAdminService(db)
+	users := database.NewUserService(db)
+	ctx := context.Background()
+	// search returns the optional search argument of the list commands
+	search := func() string {
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, adminUsage)
+			os.Exit(2)
+		}
+		if len(args) == 2 {
+			return args[1]
+		}
+		return ""
+	}
+	// user returns the user of the email address argument at the given
+	// position
+	user := func(i int) database.User {
+		if len(args) != i+1 {
+			fmt.Fprintln(os.Stderr, adminUsage)
+			os.Exit(2)
+		}
+		u, err := users.GetUserByEmail(ctx, args[i])
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("there's no user with the email address %s", args[i])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return u
+	}
+	switch args[0] {
+	case "users":
+		err = printAdminUsers(ctx, admin, search())
+	case "projects":
+		err = printAdminProjects(ctx, admin, search())
+	case "sessions":
+		err = printAdminSessions(ctx, admin, search())
+	case "grant":
+		_, err = users.SetAdmin(ctx, user(1).ID, true)
+		if err == nil {
+			log.Printf("%s is an admin", args[1])
+		}
+	case "revoke":
+		_, err = users.SetAdmin(ctx, user(1).ID, false)
+		if err == nil {
+			log.Printf("%s isn't an admin anymore", args[1])
+		}
+	case "suspend":
+		_, err = admin.SuspendUser(ctx, user(1).ID)
+		if err == nil {
+			log.Printf("%s is suspended and logged out of all sessions", args[1])
+		}
+	case "unsuspend":
+		_, err = users.Unsuspend(ctx, user(1).ID)
+		if err == nil {
+			log.Printf("%s isn't suspended anymore", args[1])
+		}
+	case "transfer":
+		owner := user(2)
+		projectID, parseErr := strconv.ParseInt(args[1], 10, 32)
+		if parseErr != nil {
+			log.Fatalf("project id must be a number: %v", parseErr)
+		}
+		var project database.Project
+		project, err = admin.TransferProject(ctx, int32(projectID), owner.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("there's no project with the id %d", projectID)
+		}
+		if err == nil {
+			log.Printf("%q is owned by %s", project.Title, owner.Email)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, adminUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printAdminUsers(ctx context.Context, admin *database.AdminService, search string) error {
+	users, err := admin.SearchUsers(ctx, search)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tADMIN\tSUSPENDED\tPROJECTS\tSESSIONS")
+	for _, user := range users {
+		suspended := "-"
+		if user.Suspended() {
+			suspended = user.SuspendedAt.Time.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%s\t%d\t%d\n", user.ID, user.Email, user.Name.String, user.IsAdmin, suspended, user.Projects, user.Sessions)
+	}
+	return w.Flush()
+}
+
+func printAdminProjects(ctx context.Context, admin *database.AdminService, search string) error {
+	projects, err := admin.SearchProjects(ctx, search)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tOWNER\tSTATE\tCREATED")
+	for _, project := range projects {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", project.ID, project.Title, project.OwnerEmail, project.State, project.CreatedAt.Time.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+func printAdminSessions(ctx context.Context, admin *database.AdminService, search string) error {
+	sessions, err := admin.SearchSessions(ctx, search)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tCREATED\tUSER AGENT")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", session.ID, session.UserEmail, session.CreatedAt.Time.Format("2006-01-02 15:04"), session.UserAgent)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/auth"
+	"github.com/webdevfuel/projectmotor/client"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestAdmin(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	handler.DB.MustExec("update users set is_admin = true where id = 1")
+	handler.DB.MustExec("insert into sessions (user_id, token, user_agent) values (2, 'laptop', 'Mozilla/5.0'), (2, 'phone', 'Mozilla/5.0')")
+
+	t.Run("admin area is hidden from other users", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/users")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		res := test.Do(req)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("search users", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/users?q=JOHN")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, doc.Find(".admin-user").Length())
+		assert.Equal("johndoe@gmail.com", doc.Find(".admin-user-email").Text())
+	})
+
+	t.Run("search projects and sessions", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/projects?q=johndoe")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc := test.Doc(test.Do(req))
+		assert := assert.New(t)
+		assert.Equal(2, doc.Find(".admin-project").Length())
+		assert.NotContains(doc.Find(".admin-project-owner").Text(), "hello@webdevfuel.com")
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/sessions?q=johndoe")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc = test.Doc(test.Do(req))
+		assert.Equal(2, doc.Find(".admin-session").Length())
+	})
+
+	t.Run("admins can't suspend themselves", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/users/1/suspend")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	token, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Errorf("error generating api token %s", err)
+		return
+	}
+	_, err = handler.APITokenService.Create(context.Background(), 2, "Scripts", auth.HashAPIToken(token))
+	if err != nil {
+		t.Errorf("error creating api token %s", err)
+		return
+	}
+	c := client.New(server.URL, token, client.WithHTTPClient(server.Client()))
+
+	t.Run("suspend user", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/users/2/suspend")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, doc.Find("#admin-user-2 .admin-user-suspended").Length())
+
+		// sessions are invalidated
+		var count int
+		handler.DB.Get(&count, "select count(*) from sessions where user_id = 2")
+		assert.Equal(0, count)
+
+		// and API tokens stop working
+		_, err := c.Projects.GetAll(context.Background())
+		var apiErr *client.Error
+		if assert.ErrorAs(err, &apiErr) {
+			assert.Equal(http.StatusForbidden, apiErr.StatusCode)
+		}
+	})
+
+	t.Run("suspended users' feeds, pages and webhooks are paused", func(t *testing.T) {
+		handler.DB.MustExec(`
+			update users set calendar_token = 'token-2' where id = 2;
+			insert into project_pages (project_id, token, enabled) values (4, 'page-4', true);
+			insert into webhooks (project_id, url, secret, events) values (4, 'https://example.com/hook', 'secret', 'task.created');
+			insert into webhook_deliveries (webhook_id, event, payload) select id, 'task.created', '{}' from webhooks where project_id = 4;
+		`)
+		assert := assert.New(t)
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-2/tasks.ics")),
+		)
+		res := test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "p/page-4")),
+		)
+		res = test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+
+		now := time.Now().UTC()
+		claimed, err := handler.WebhookService.ClaimDue(
+			context.Background(),
+			pgtype.Timestamp{Time: now, Valid: true},
+			pgtype.Timestamp{Time: now.Add(15 * time.Minute), Valid: true},
+			20,
+		)
+		assert.Nil(err)
+		assert.Len(claimed, 0)
+	})
+
+	t.Run("unsuspend user", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/users/2/unsuspend")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(0, doc.Find("#admin-user-2 .admin-user-suspended").Length())
+		_, err := c.Projects.GetAll(context.Background())
+		assert.NoError(err)
+
+		// feeds and pages are served again
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-2/tasks.ics")),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "p/page-4")),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+	})
+
+	t.Run("transfer project", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/projects/3/transfer")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "email", Value: "nobody@example.com"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "admin/projects/3/transfer")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "email", Value: "hello@webdevfuel.com"},
+			),
+		)
+		res = test.Do(req)
+		doc := test.Doc(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("hello@webdevfuel.com", doc.Find(".admin-project-owner").Text())
+
+		var ownerID int32
+		handler.DB.Get(&ownerID, "select owner_id from projects where id = 3")
+		assert.Equal(int32(1), ownerID)
+		// the previous owner keeps access
+		var count int
+		handler.DB.Get(&count, "select count(*) from projects_users where project_id = 3 and user_id = 2")
+		assert.Equal(1, count)
+	})
+}
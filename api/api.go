@@ -0,0 +1,118 @@
+// Package api defines the JSON bodies of the requests and responses of the
+// API served under "/api/v1", which is shared by the server and the client
+// package.
+//
+// Requests are authenticated with an API token of a user, created on their
+// profile, which is sent in the "Authorization" header as "Bearer <token>".
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Prefix is the path every route of the API starts with.
+const Prefix = "/api/v1"
+
+// A Project is a project the user owns.
+type Project struct {
+	ID          int32     `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Published   bool      `json:"published"`
+	Archived    bool      `json:"archived"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// A CreateProject is the body of a request creating a project.
+type CreateProject struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// A ShareProject is the body of a request sharing a project with the user
+// with the given email address.
+type ShareProject struct {
+	Email string `json:"email"`
+}
+
+// A Share is a user a project is shared with.
+type Share struct {
+	ProjectID int32  `json:"project_id"`
+	UserID    int32  `json:"user_id"`
+	Email     string `json:"email"`
+}
+
+// Task statuses, as returned and accepted by the API.
+const (
+	TaskStatusTodo       = "todo"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusDone       = "done"
+)
+
+// A Task is a task the user owns.
+type Task struct {
+	ID          int32  `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	// DueDate is in the format "2006-01-02", and nil when the task isn't
+	// due.
+	DueDate     *string   `json:"due_date"`
+	ProjectID   *int32    `json:"project_id"`
+	MilestoneID *int32    `json:"milestone_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// A CreateTask is the body of a request creating a task.
+type CreateTask struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// DueDate is in the format "2006-01-02", or empty.
+	DueDate   string `json:"due_date,omitempty"`
+	ProjectID *int32 `json:"project_id,omitempty"`
+}
+
+// An UpdateTask is the body of a request updating a task. Nil fields are
+// left unchanged.
+type UpdateTask struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// DueDate is in the format "2006-01-02", or empty to clear it.
+	DueDate *string `json:"due_date,omitempty"`
+	Status  *string `json:"status,omitempty"`
+}
+
+// A TaskFilter narrows down the tasks listed. Its zero value doesn't filter
+// anything.
+type TaskFilter struct {
+	ProjectID int32
+	Status    string
+	// DueBefore keeps the tasks due on or before the given date, in the
+	// format "2006-01-02".
+	DueBefore string
+}
+
+// Query returns the url query the filter is sent as.
+func (f TaskFilter) Query() url.Values {
+	query := url.Values{}
+	if f.ProjectID != 0 {
+		query.Set("project", strconv.Itoa(int(f.ProjectID)))
+	}
+	if f.Status != "" {
+		query.Set("status", f.Status)
+	}
+	if f.DueBefore != "" {
+		query.Set("due_before", f.DueBefore)
+	}
+	return query
+}
+
+// An Error is the body of every response with a status other than 2xx.
+type Error struct {
+	Message string `json:"error"`
+	// Fields holds the validation errors of the fields of the request body,
+	// or of the url query, by their name.
+	Fields map[string]string `json:"fields,omitempty"`
+}
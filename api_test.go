@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/api"
+	"github.com/webdevfuel/projectmotor/auth"
+	"github.com/webdevfuel/projectmotor/client"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestAPI(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	ctx := context.Background()
+
+	var token string
+
+	t.Run("create token", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/tokens")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: "Work laptop"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("Work laptop", doc.Find("li.api-token .api-token-name").Text())
+		token, _ = doc.Find("#api_token").Attr("value")
+		assert.Regexp("^pm_", token)
+
+		// only the hash of the token is stored
+		var count int
+		handler.DB.Get(&count, "select count(*) from api_tokens where token_hash = $1", auth.HashAPIToken(token))
+		assert.Equal(1, count)
+	})
+
+	c := client.New(server.URL, token, client.WithHTTPClient(server.Client()))
+
+	statusCode := func(err error) int {
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			return apiErr.StatusCode
+		}
+		return 0
+	}
+
+	t.Run("requests need a valid token", func(t *testing.T) {
+		_, err := client.New(server.URL, "").Projects.GetAll(ctx)
+		assert.Equal(t, http.StatusUnauthorized, statusCode(err))
+		_, err = client.New(server.URL, "pm_not-a-token").Projects.GetAll(ctx)
+		assert.Equal(t, http.StatusUnauthorized, statusCode(err))
+	})
+
+	t.Run("list projects", func(t *testing.T) {
+		projects, err := c.Projects.GetAll(ctx)
+		assert := assert.New(t)
+		assert.NoError(err)
+		ids := []int32{}
+		for _, project := range projects {
+			ids = append(ids, project.ID)
+		}
+		assert.ElementsMatch([]int32{1, 2}, ids)
+	})
+
+	t.Run("create project", func(t *testing.T) {
+		_, err := c.Projects.Create(ctx, "", "")
+		assert := assert.New(t)
+		var apiErr *client.Error
+		if assert.ErrorAs(err, &apiErr) {
+			assert.Equal(http.StatusBadRequest, apiErr.StatusCode)
+			assert.Equal("cannot be blank", apiErr.Fields["title"])
+		}
+
+		project, err := c.Projects.Create(ctx, "Launch", "Everything for the launch")
+		assert.NoError(err)
+		assert.Equal("Launch", project.Title)
+		assert.Equal("Everything for the launch", project.Description)
+		assert.False(project.Archived)
+	})
+
+	t.Run("share project", func(t *testing.T) {
+		share, err := c.Projects.Share(ctx, 1, "johndoe@gmail.com")
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal(int32(2), share.UserID)
+
+		_, err = c.Projects.Share(ctx, 1, "johndoe@gmail.com")
+		assert.Equal(http.StatusConflict, statusCode(err))
+		_, err = c.Projects.Share(ctx, 1, "nobody@example.com")
+		assert.Equal(http.StatusNotFound, statusCode(err))
+		// project 3 belongs to another user
+		_, err = c.Projects.Share(ctx, 3, "johndoe@gmail.com")
+		assert.Equal(http.StatusNotFound, statusCode(err))
+	})
+
+	var taskID int32
+
+	t.Run("add task", func(t *testing.T) {
+		projectID := int32(1)
+		task, err := c.Tasks.Create(ctx, api.CreateTask{
+			Title:     "Write the changelog",
+			DueDate:   "2024-05-01",
+			ProjectID: &projectID,
+		})
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal("Write the changelog", task.Title)
+		assert.Equal(api.TaskStatusTodo, task.Status)
+		if assert.NotNil(task.DueDate) {
+			assert.Equal("2024-05-01", *task.DueDate)
+		}
+		taskID = task.ID
+
+		// projects of others can't be used
+		otherProjectID := int32(3)
+		_, err = c.Tasks.Create(ctx, api.CreateTask{Title: "Sneaky", ProjectID: &otherProjectID})
+		assert.Equal(http.StatusBadRequest, statusCode(err))
+	})
+
+	t.Run("list tasks with filters", func(t *testing.T) {
+		assert := assert.New(t)
+		tasks, err := c.Tasks.GetAll(ctx, api.TaskFilter{ProjectID: 1})
+		assert.NoError(err)
+		for _, task := range tasks {
+			assert.Equal(int32(1), *task.ProjectID)
+		}
+
+		tasks, err = c.Tasks.GetAll(ctx, api.TaskFilter{DueBefore: "2024-05-01"})
+		assert.NoError(err)
+		if assert.Len(tasks, 1) {
+			assert.Equal(taskID, tasks[0].ID)
+		}
+
+		_, err = c.Tasks.GetAll(ctx, api.TaskFilter{Status: "later"})
+		var apiErr *client.Error
+		if assert.ErrorAs(err, &apiErr) {
+			assert.Equal(http.StatusBadRequest, apiErr.StatusCode)
+			assert.Contains(apiErr.Fields, "status")
+		}
+	})
+
+	t.Run("edit task", func(t *testing.T) {
+		title := "Write the changelog for 2.0"
+		task, err := c.Tasks.Update(ctx, taskID, api.UpdateTask{Title: &title})
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal(title, task.Title)
+		// fields that weren't given are kept
+		if assert.NotNil(task.DueDate) {
+			assert.Equal("2024-05-01", *task.DueDate)
+		}
+
+		noDueDate := ""
+		task, err = c.Tasks.Update(ctx, taskID, api.UpdateTask{DueDate: &noDueDate})
+		assert.NoError(err)
+		assert.Nil(task.DueDate)
+		assert.Equal(title, task.Title)
+
+		// tasks of others can't be edited
+		_, err = c.Tasks.Update(ctx, 5, api.UpdateTask{Title: &title})
+		assert.Equal(http.StatusNotFound, statusCode(err))
+	})
+
+	t.Run("complete task", func(t *testing.T) {
+		task, err := c.Tasks.Done(ctx, taskID)
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal(api.TaskStatusDone, task.Status)
+
+		tasks, err := c.Tasks.GetAll(ctx, api.TaskFilter{Status: api.TaskStatusDone})
+		assert.NoError(err)
+		assert.Len(tasks, 1)
+	})
+
+	t.Run("deleted tokens stop working", func(t *testing.T) {
+		var id int32
+		handler.DB.Get(&id, "select id from api_tokens where token_hash = $1", auth.HashAPIToken(token))
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/profile/tokens/%d", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		_, err := c.Projects.GetAll(ctx)
+		assert.Equal(http.StatusUnauthorized, statusCode(err))
+	})
+}
@@ -0,0 +1,206 @@
+package attachment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxSize is the largest file, in bytes, that can be attached to a task.
+const MaxSize = 10 << 20
+
+// ThumbnailSize is the largest width and height, in pixels, of a thumbnail.
+const ThumbnailSize = 320
+
+// AvatarMaxSize is the largest image, in bytes, that can be uploaded as the
+// avatar of a user.
+const AvatarMaxSize = 2 << 20
+
+// AvatarSize is the largest width and height, in pixels, of an avatar.
+const AvatarSize = 256
+
+// maxPixels is the largest image, in pixels, that's decoded to make a
+// thumbnail, so that a small file claiming huge dimensions can't exhaust
+// memory.
+const maxPixels = 50_000_000
+
+// ErrNotImage is returned by Thumbnail when the data isn't an image it can
+// decode.
+var ErrNotImage = errors.New("attachment: not a supported image")
+
+// contentTypes are the allowed content types, as detected from the contents
+// of a file.
+var contentTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+	"application/zip":           true,
+}
+
+// officeTypes are the content types of documents that are ZIP archives,
+// by file extension.
+var officeTypes = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+}
+
+// ContentType returns the content type of the given file, and false if it
+// isn't allowed.
+//
+// The type is detected from the first bytes of the contents, rather than
+// trusting the browser, so that e.g. HTML can't be uploaded as an image.
+// ZIP archives with the extension of an office document get the type of
+// that document.
+func ContentType(filename string, head []byte) (string, bool) {
+	contentType := http.DetectContentType(head)
+	if !contentTypes[contentType] {
+		return contentType, false
+	}
+	if contentType == "application/zip" {
+		if t, ok := officeTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+			return t, true
+		}
+	}
+	return contentType, true
+}
+
+// Allowed is a human readable list of the allowed file types.
+const Allowed = "images (PNG, JPEG, GIF, WebP), PDF, text files and office documents"
+
+// IsImage reports whether the given content type is an image a thumbnail
+// can be made of.
+func IsImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// Inline reports whether a file with the given content type is safe to show
+// in the browser, rather than being downloaded.
+func Inline(contentType string) bool {
+	return IsImage(contentType) || contentType == "application/pdf"
+}
+
+// Thumbnail returns a PNG of the given image, scaled down to fit within
+// ThumbnailSize, or ErrNotImage if it can't be decoded.
+//
+// Images that are already small enough keep their size.
+func Thumbnail(data []byte) ([]byte, error) {
+	return scale(data, ThumbnailSize)
+}
+
+// Avatar returns a PNG of the given image, scaled down to fit within
+// AvatarSize, or ErrNotImage if it can't be decoded.
+//
+// Re-encoding the image also drops whatever metadata it carried.
+func Avatar(data []byte) ([]byte, error) {
+	return scale(data, AvatarSize)
+}
+
+// scale returns a PNG of the given image, scaled down to fit within a square
+// of the given size, or ErrNotImage if it can't be decoded.
+func scale(data []byte, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrNotImage
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	width, height := fit(config.Width, config.Height, size)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	var buf bytes.Buffer
+	err = png.Encode(&buf, dst)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit returns the given dimensions scaled down to fit within a square of the
+// given size, keeping the aspect ratio.
+func fit(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// NewKey returns a new random storage key for a file of the given task.
+func NewKey(taskID int32) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tasks/%d/%s", taskID, hex.EncodeToString(b)), nil
+}
+
+// NewAvatarKey returns a new random storage key for the avatar of the given
+// user.
+func NewAvatarKey(userID int32) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("avatars/%d/%s.png", userID, hex.EncodeToString(b)), nil
+}
+
+// Filename returns the given file name cleaned up to be stored and sent back
+// in a Content-Disposition header: without directories, control characters
+// or quotes, and at most 255 bytes.
+func Filename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// Size returns the given number of bytes formatted for humans, e.g. "1.5 MB".
+func Size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/attachment"
+	"github.com/webdevfuel/projectmotor/storage"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestAttachments(t *testing.T) {
+	s3 := test.NewS3Server()
+	defer s3.Close()
+
+	files, err := storage.NewS3(storage.S3Options{
+		Endpoint:  s3.URL,
+		Bucket:    "attachments",
+		AccessKey: test.S3AccessKey,
+		SecretKey: test.S3SecretKey,
+	})
+	if err != nil {
+		t.Errorf("error creating s3 storage %s", err)
+		return
+	}
+
+	handler, server := test.NewServer(test.WithStorage(files))
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	screenshot := newPNG(640, 480)
+
+	t.Run("upload stores image and thumbnail", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/attachments")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("file", "screenshot.png", screenshot),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// body assertions
+		assert.Equal("screenshot.png", doc.Find("li.attachment .attachment-link").Text())
+		assert.Equal(1, doc.Find("li.attachment img.attachment-thumbnail").Length())
+
+		// storage and database assertions
+		assert.Equal(2, s3.Len())
+		var contentType string
+		handler.DB.Get(&contentType, "select content_type from attachments where task_id = 3")
+		assert.Equal("image/png", contentType)
+	})
+
+	t.Run("upload rejects disallowed types", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/attachments")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("file", "image.png", []byte("<html><script>alert(1)</script></html>")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+		assert.Equal(415, res.StatusCode)
+		assert.Contains(body, "Only images")
+		assert.Equal(2, s3.Len())
+	})
+
+	t.Run("upload rejects large files", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/attachments")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("file", "notes.txt", bytes.Repeat([]byte("a"), attachment.MaxSize+1)),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 413, res.StatusCode)
+		assert.Equal(t, 2, s3.Len())
+	})
+
+	t.Run("upload requires owning the task", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/attachments")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFile("file", "screenshot.png", screenshot),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("download serves file and thumbnail", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "attachments/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		body, _ := io.ReadAll(res.Body)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("image/png", res.Header.Get("Content-Type"))
+		assert.Equal(`inline; filename=screenshot.png`, res.Header.Get("Content-Disposition"))
+		assert.Equal("nosniff", res.Header.Get("X-Content-Type-Options"))
+		assert.Equal(screenshot, body)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "attachments/1/thumbnail")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		thumbnail, err := png.DecodeConfig(res.Body)
+		assert.Nil(err)
+		assert.Equal(attachment.ThumbnailSize, thumbnail.Width)
+		assert.Equal(240, thumbnail.Height)
+	})
+
+	t.Run("download checks project access", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "attachments/1")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+
+		// task 3 belongs to published project 2
+		_, err := handler.DB.Exec("insert into projects_users (project_id, user_id) values (2, 2)")
+		if err != nil {
+			t.Errorf("error sharing project %s", err)
+			return
+		}
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "attachments/1")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		res = test.Do(req)
+		assert.Equal(t, 200, res.StatusCode)
+	})
+
+	t.Run("deleting the task removes its files", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/tasks", res.Header.Get("HX-Redirect"))
+		assert.Equal(0, s3.Len())
+		var count int
+		handler.DB.Get(&count, "select count(*) from attachments")
+		assert.Equal(0, count)
+	})
+
+	t.Run("s3 storage rejects unknown credentials", func(t *testing.T) {
+		s, err := storage.NewS3(storage.S3Options{
+			Endpoint:  s3.URL,
+			Bucket:    "attachments",
+			AccessKey: "unknown",
+			SecretKey: "unknown",
+		})
+		if err != nil {
+			t.Errorf("error creating s3 storage %s", err)
+			return
+		}
+		err = s.Put(context.Background(), "tasks/1/key", strings.NewReader("a"), 1, "text/plain")
+		assert.ErrorContains(t, err, "AccessDenied")
+	})
+}
+
+// newPNG returns a PNG image of the given size.
+func newPNG(width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
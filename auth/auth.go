@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/gorilla/sessions"
@@ -43,3 +45,44 @@ func GenerateSessionToken() (string, error) {
 	s := base64.StdEncoding.EncodeToString(b)
 	return s, nil
 }
+
+// GenerateCalendarToken returns a random token that is safe to use inside
+// urls, for usage with calendar feeds.
+func GenerateCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	s := base64.RawURLEncoding.EncodeToString(b)
+	return s, nil
+}
+
+// GeneratePublicPageToken returns a random token that is safe to use inside
+// urls, for usage with public project pages.
+func GeneratePublicPageToken() (string, error) {
+	return GenerateCalendarToken()
+}
+
+// APITokenPrefix is the start of every API token, which makes them easy to
+// recognize, e.g. by secret scanners.
+const APITokenPrefix = "pm_"
+
+// GenerateAPIToken returns a random token for usage with the API, which is
+// sent in the "Authorization" header as "Bearer <token>".
+func GenerateAPIToken() (string, error) {
+	s, err := GenerateCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	return APITokenPrefix + s, nil
+}
+
+// HashAPIToken returns the hash of the given API token, which is what's
+// stored instead of the token itself.
+//
+// Tokens are random enough that a fast hash is as good as a slow one.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestCalendar(t *testing.T) {
+	handler, server := test.NewServer(test.WithPublicURL("https://projectmotor.example.com/"))
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	// give user 1 a calendar token, some tasks a due date and share
+	// user 2's published project 4 and unpublished project 3 with user 1
+	_, err = handler.DB.Exec(`
+		update users set calendar_token = 'token-1' where id = 1;
+		update tasks set due_date = '2026-03-01' where title in ('Task 1', 'Task 5', 'Task 7');
+		update tasks set status = 'done' where title = 'Task 1';
+		insert into projects_users (project_id, user_id) values (3, 1), (4, 1);
+	`)
+	if err != nil {
+		t.Errorf("error preparing calendar data %s", err)
+		return
+	}
+
+	t.Run("user feed lists visible tasks with due dates", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/tasks.ics")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+
+		// status code and header assertions
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("text/calendar; charset=utf-8", res.Header.Get("Content-Type"))
+		assert.Equal("private, max-age=900", res.Header.Get("Cache-Control"))
+		assert.NotEmpty(res.Header.Get("ETag"))
+
+		// body assertions
+		assert.Contains(body, "BEGIN:VCALENDAR\r\n")
+		assert.Contains(body, "SUMMARY:Task 1\r\n")
+		assert.Contains(body, "DTSTART;VALUE=DATE:20260301\r\n")
+		assert.Contains(body, "SUMMARY:Task 7\r\n")
+		assert.NotContains(body, "SUMMARY:Task 5\r\n")
+		assert.NotContains(body, "SUMMARY:Task 2\r\n")
+	})
+
+	t.Run("user feed replies not modified with matching etag", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/tasks.ics")),
+		)
+		res := test.Do(req)
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/tasks.ics")),
+		)
+		req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+		res = test.Do(req)
+		assert.Equal(t, 304, res.StatusCode)
+	})
+
+	t.Run("user feed lists todos when asked to", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/tasks.ics?component=todo")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+
+		// body assertions
+		assert.Contains(body, "BEGIN:VTODO\r\n")
+		assert.Contains(body, "DUE;VALUE=DATE:20260301\r\n")
+		assert.Contains(body, "STATUS:COMPLETED\r\n")
+		assert.NotContains(body, "BEGIN:VEVENT")
+	})
+
+	t.Run("project feed respects sharing visibility", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/projects/4/tasks.ics")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Contains(body, "X-WR-CALNAME:ProjectMotor - Project 4\r\n")
+		assert.Contains(body, "SUMMARY:Task 7\r\n")
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/projects/3/tasks.ics")),
+		)
+		res = test.Do(req)
+		assert.Equal(404, res.StatusCode)
+	})
+
+	t.Run("unknown token is not found", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/unknown/tasks.ics")),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("feed links use the public url", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc := test.Doc(test.Do(req))
+		value, _ := doc.Find("#calendar_url").Attr("value")
+		assert.Equal(t, "https://projectmotor.example.com/calendar/token-1/tasks.ics", value)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/edit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		body := test.Body(test.Do(req))
+		assert.Contains(t, body, "https://projectmotor.example.com/calendar/token-1/projects/1/tasks.ics")
+	})
+
+	t.Run("feeds don't depend on the active workspace", func(t *testing.T) {
+		// switch user 1 to a new workspace, away from projects 1 and 2
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "name", Value: "Acme"}),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/tasks.ics")),
+		)
+		body := test.Body(test.Do(req))
+		assert.Contains(body, "SUMMARY:Task 1\r\n")
+		assert.Contains(body, "SUMMARY:Task 7\r\n")
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "calendar/token-1/projects/1/tasks.ics")),
+		)
+		res = test.Do(req)
+		body = test.Body(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Contains(body, "SUMMARY:Task 1\r\n")
+	})
+}
@@ -0,0 +1,127 @@
+// Package client is a Go client of the API of ProjectMotor, as defined by
+// the api package.
+//
+// Its services mirror the operations of the services of the database
+// package, on behalf of the user the API token belongs to:
+//
+//	c := client.New("https://projectmotor.example.com", token)
+//	projects, err := c.Projects.GetAll(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/api"
+)
+
+// A Client sends requests to the API with the API token of a user.
+type Client struct {
+	Projects *ProjectService
+	Tasks    *TaskService
+
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New returns a pointer to Client, sending requests to the server at the
+// given base url with the given API token, and configured with the given
+// options.
+//
+// By default, requests time out after 30 seconds.
+func New(baseURL string, token string, options ...func(*Client)) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, o := range options {
+		o(c)
+	}
+	c.Projects = &ProjectService{client: c}
+	c.Tasks = &TaskService{client: c}
+	return c
+}
+
+// WithHTTPClient returns a function that sets the client requests are sent
+// with.
+func WithHTTPClient(httpClient *http.Client) func(*Client) {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// An Error is a response of the API with a status other than 2xx.
+type Error struct {
+	StatusCode int
+	Message    string
+	// Fields holds the validation errors of the fields of the request, by
+	// their name.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s %s", key, e.Fields[key]))
+	}
+	return fmt.Sprintf("%s %s", e.Message, strings.Join(fields, "; "))
+}
+
+// do sends a request with the given method to the given path of the API,
+// with the given url query and body encoded as JSON if they aren't nil, and
+// decodes the JSON response into v.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, v any) error {
+	u := c.baseURL + api.Prefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var body api.Error
+		err = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+		if err != nil || body.Message == "" {
+			body.Message = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: body.Message, Fields: body.Fields}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
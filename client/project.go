@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/webdevfuel/projectmotor/api"
+)
+
+// A ProjectService sends requests about the projects of the user.
+type ProjectService struct {
+	client *Client
+}
+
+// GetAll returns the active projects the user owns, newest first.
+func (s *ProjectService) GetAll(ctx context.Context) ([]api.Project, error) {
+	var projects []api.Project
+	err := s.client.do(ctx, http.MethodGet, "/projects", nil, nil, &projects)
+	return projects, err
+}
+
+// GetAllArchived returns the archived projects the user owns, newest first.
+func (s *ProjectService) GetAllArchived(ctx context.Context) ([]api.Project, error) {
+	var projects []api.Project
+	err := s.client.do(ctx, http.MethodGet, "/projects", url.Values{"archived": {"true"}}, nil, &projects)
+	return projects, err
+}
+
+// Create returns the project created with the given title and description.
+func (s *ProjectService) Create(ctx context.Context, title string, description string) (api.Project, error) {
+	var project api.Project
+	body := api.CreateProject{Title: title, Description: description}
+	err := s.client.do(ctx, http.MethodPost, "/projects", nil, body, &project)
+	return project, err
+}
+
+// Share shares the project with the given id with the user with the given
+// email address.
+func (s *ProjectService) Share(ctx context.Context, projectID int32, email string) (api.Share, error) {
+	var share api.Share
+	body := api.ShareProject{Email: email}
+	err := s.client.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/share", projectID), nil, body, &share)
+	return share, err
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/webdevfuel/projectmotor/api"
+)
+
+// A TaskService sends requests about the tasks of the user.
+type TaskService struct {
+	client *Client
+}
+
+// GetAll returns the tasks the user owns that match the given filter,
+// oldest first.
+func (s *TaskService) GetAll(ctx context.Context, filter api.TaskFilter) ([]api.Task, error) {
+	var tasks []api.Task
+	err := s.client.do(ctx, http.MethodGet, "/tasks", filter.Query(), nil, &tasks)
+	return tasks, err
+}
+
+// Get returns the task with the given id.
+func (s *TaskService) Get(ctx context.Context, taskID int32) (api.Task, error) {
+	var task api.Task
+	err := s.client.do(ctx, http.MethodGet, fmt.Sprintf("/tasks/%d", taskID), nil, nil, &task)
+	return task, err
+}
+
+// Create returns the task created with the given data.
+func (s *TaskService) Create(ctx context.Context, data api.CreateTask) (api.Task, error) {
+	var task api.Task
+	err := s.client.do(ctx, http.MethodPost, "/tasks", nil, data, &task)
+	return task, err
+}
+
+// Update returns the task with the given id after updating the given
+// fields.
+func (s *TaskService) Update(ctx context.Context, taskID int32, data api.UpdateTask) (api.Task, error) {
+	var task api.Task
+	err := s.client.do(ctx, http.MethodPatch, fmt.Sprintf("/tasks/%d", taskID), nil, data, &task)
+	return task, err
+}
+
+// Done returns the task with the given id after marking it as done.
+func (s *TaskService) Done(ctx context.Context, taskID int32) (api.Task, error) {
+	status := api.TaskStatusDone
+	return s.Update(ctx, taskID, api.UpdateTask{Status: &status})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/webdevfuel/projectmotor/client"
+)
+
+// A config is the content of the config file of pm.
+type config struct {
+	// Server is the base url of the ProjectMotor server, e.g.
+	// "https://projectmotor.example.com".
+	Server string `json:"server"`
+	// Token is the API token requests are authenticated with.
+	Token string `json:"token"`
+}
+
+// configPath returns the path of the config file, which is the PM_CONFIG
+// environment variable if set, and "pm/config.json" inside the user config
+// directory otherwise, e.g. "~/.config/pm/config.json" on Linux.
+func configPath() (string, error) {
+	if path := os.Getenv("PM_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pm", "config.json"), nil
+}
+
+// loadConfig returns the config in the config file, if any, overridden by
+// the PM_SERVER and PM_TOKEN environment variables.
+func loadConfig() (config, error) {
+	var c config
+	path, err := configPath()
+	if err != nil {
+		return config{}, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config{}, err
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			return config{}, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	if server := os.Getenv("PM_SERVER"); server != "" {
+		c.Server = server
+	}
+	if token := os.Getenv("PM_TOKEN"); token != "" {
+		c.Token = token
+	}
+	return c, nil
+}
+
+// saveConfig writes the given config to the config file, which only the
+// user can read since it holds their token.
+func saveConfig(c config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// newClient returns a client.Client configured with the config, and an
+// error if it's missing the server or the token.
+func newClient() (*client.Client, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.Server == "" || c.Token == "" {
+		return nil, errors.New(`not logged in, run "pm login --server URL --token TOKEN" first`)
+	}
+	return client.New(c.Server, c.Token), nil
+}
@@ -0,0 +1,167 @@
+// Command pm manages the projects and tasks of a ProjectMotor user from the
+// terminal, through the API.
+//
+// Requests are authenticated with an API token, created on the profile page.
+// "pm login" saves the url of the server and the token to the config file,
+// and the PM_SERVER and PM_TOKEN environment variables take precedence over
+// it.
+//
+// Usage:
+//
+//	pm login --server URL --token TOKEN
+//	pm project list [--archived] [--json]
+//	pm project create [--description TEXT] [--json] TITLE
+//	pm project share [--json] ID EMAIL
+//	pm task list [--project ID] [--status STATUS] [--due-before DATE] [--json]
+//	pm task add [--description TEXT] [--due DATE] [--project ID] [--json] TITLE
+//	pm task edit [--title TEXT] [--description TEXT] [--due DATE] [--status STATUS] [--json] ID
+//	pm task done [--json] ID
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+)
+
+const usage = `pm manages your ProjectMotor projects and tasks.
+
+Usage:
+  pm login --server URL --token TOKEN
+  pm project list [--archived] [--json]
+  pm project create [--description TEXT] [--json] TITLE
+  pm project share [--json] ID EMAIL
+  pm task list [--project ID] [--status STATUS] [--due-before DATE] [--json]
+  pm task add [--description TEXT] [--due DATE] [--project ID] [--json] TITLE
+  pm task edit [--title TEXT] [--description TEXT] [--due DATE] [--status STATUS] [--json] ID
+  pm task done [--json] ID
+
+Statuses are todo, in_progress and done, and dates are formatted as 2006-01-02.
+Create an API token on your profile page.
+`
+
+// errUsage is returned by commands called with invalid arguments, after the
+// problem was reported.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command of the given arguments, and returns the exit code of
+// the program.
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	cmd := &command{stdout: stdout, stderr: stderr}
+	err := cmd.dispatch(ctx, args)
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "pm: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// A command holds where the output of commands is written to.
+type command struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (cmd *command) dispatch(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(cmd.stderr, usage)
+		return errUsage
+	}
+	name, args := args[0], args[1:]
+	var sub string
+	if len(args) > 0 {
+		sub = args[0]
+		args = args[1:]
+	}
+	switch {
+	case name == "login":
+		// login has no subcommand
+		if sub != "" {
+			args = append([]string{sub}, args...)
+		}
+		return cmd.login(ctx, args)
+	case name == "project" && sub == "list":
+		return cmd.projectList(ctx, args)
+	case name == "project" && sub == "create":
+		return cmd.projectCreate(ctx, args)
+	case name == "project" && sub == "share":
+		return cmd.projectShare(ctx, args)
+	case name == "task" && sub == "list":
+		return cmd.taskList(ctx, args)
+	case name == "task" && sub == "add":
+		return cmd.taskAdd(ctx, args)
+	case name == "task" && sub == "edit":
+		return cmd.taskEdit(ctx, args)
+	case name == "task" && sub == "done":
+		return cmd.taskDone(ctx, args)
+	case name == "help" || name == "-h" || name == "--help":
+		fmt.Fprint(cmd.stdout, usage)
+		return nil
+	}
+	fmt.Fprintf(cmd.stderr, "pm: unknown command %q\n\n%s", join(name, sub), usage)
+	return errUsage
+}
+
+// flagSet returns a flag.FlagSet for the command with the given name, which
+// reports errors to stderr.
+func (cmd *command) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("pm "+name, flag.ContinueOnError)
+	fs.SetOutput(cmd.stderr)
+	return fs
+}
+
+// parse parses the given arguments with the given flag set, and returns the
+// positional arguments, which may come before, between or after flags.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usageError reports the given problem with the arguments of the command of
+// the given flag set, along with its flags.
+func (cmd *command) usageError(fs *flag.FlagSet, format string, a ...any) error {
+	fmt.Fprintf(cmd.stderr, "%s: %s\n", fs.Name(), fmt.Sprintf(format, a...))
+	fs.Usage()
+	return errUsage
+}
+
+// parseID returns the id in the given argument.
+func parseID(s string) (int32, error) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q isn't an id", s)
+	}
+	return int32(id), nil
+}
+
+func join(name string, sub string) string {
+	if sub == "" {
+		return name
+	}
+	return name + " " + sub
+}
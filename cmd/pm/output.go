@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/webdevfuel/projectmotor/api"
+)
+
+// writeJSON writes the given value as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+// writeTable writes the given rows as a table, with the given header, and
+// columns aligned with spaces.
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeProjects writes the given projects as a table, or as JSON.
+func writeProjects(w io.Writer, projects []api.Project, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, projects)
+	}
+	rows := make([][]string, 0, len(projects))
+	for _, p := range projects {
+		published := "no"
+		if p.Published {
+			published = "yes"
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(p.ID),
+			p.Title,
+			published,
+			p.CreatedAt.Format("2006-01-02"),
+		})
+	}
+	return writeTable(w, []string{"ID", "TITLE", "PUBLISHED", "CREATED"}, rows)
+}
+
+// writeTasks writes the given tasks as a table, or as JSON.
+func writeTasks(w io.Writer, tasks []api.Task, asJSON bool) error {
+	if asJSON {
+		return writeJSON(w, tasks)
+	}
+	rows := make([][]string, 0, len(tasks))
+	for _, t := range tasks {
+		due := "-"
+		if t.DueDate != nil {
+			due = *t.DueDate
+		}
+		project := "-"
+		if t.ProjectID != nil {
+			project = fmt.Sprint(*t.ProjectID)
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(t.ID),
+			t.Title,
+			t.Status,
+			due,
+			project,
+		})
+	}
+	return writeTable(w, []string{"ID", "TITLE", "STATUS", "DUE", "PROJECT"}, rows)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/webdevfuel/projectmotor/api"
+	"github.com/webdevfuel/projectmotor/client"
+)
+
+// login checks the given server and token, and saves them to the config
+// file.
+func (cmd *command) login(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("login")
+	server := fs.String("server", "", "base url of the server, e.g. https://projectmotor.example.com")
+	token := fs.String("token", "", "API token, created on your profile page")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) > 0 {
+		return cmd.usageError(fs, "unexpected arguments %q", positional)
+	}
+	if *server == "" || *token == "" {
+		return cmd.usageError(fs, "--server and --token are required")
+	}
+	_, err = client.New(*server, *token).Projects.GetAll(ctx)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		return fmt.Errorf("logging in: %s", apiErr.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+	path, err := saveConfig(config{Server: *server, Token: *token})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.stdout, "Logged in to %s, saved to %s\n", *server, path)
+	return nil
+}
+
+func (cmd *command) projectList(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("project list")
+	archived := fs.Bool("archived", false, "list archived projects instead of active ones")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) > 0 {
+		return cmd.usageError(fs, "unexpected arguments %q", positional)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	var projects []api.Project
+	if *archived {
+		projects, err = c.Projects.GetAllArchived(ctx)
+	} else {
+		projects, err = c.Projects.GetAll(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return writeProjects(cmd.stdout, projects, *asJSON)
+}
+
+func (cmd *command) projectCreate(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("project create")
+	description := fs.String("description", "", "description of the project")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) == 0 {
+		return cmd.usageError(fs, "a title is required")
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	project, err := c.Projects.Create(ctx, strings.Join(positional, " "), *description)
+	if err != nil {
+		return err
+	}
+	return writeProjects(cmd.stdout, []api.Project{project}, *asJSON)
+}
+
+func (cmd *command) projectShare(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("project share")
+	asJSON := fs.Bool("json", false, "write JSON instead of a message")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) != 2 {
+		return cmd.usageError(fs, "a project id and an email address are required")
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return cmd.usageError(fs, "%s", err)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	share, err := c.Projects.Share(ctx, id, positional[1])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(cmd.stdout, share)
+	}
+	fmt.Fprintf(cmd.stdout, "Shared project %d with %s\n", share.ProjectID, share.Email)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/webdevfuel/projectmotor/api"
+)
+
+func (cmd *command) taskList(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("task list")
+	project := fs.String("project", "", "only list the tasks of the project with this id")
+	status := fs.String("status", "", "only list the tasks with this status")
+	dueBefore := fs.String("due-before", "", "only list the tasks due on or before this date")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) > 0 {
+		return cmd.usageError(fs, "unexpected arguments %q", positional)
+	}
+	filter := api.TaskFilter{
+		Status:    *status,
+		DueBefore: *dueBefore,
+	}
+	if *project != "" {
+		filter.ProjectID, err = parseID(*project)
+		if err != nil {
+			return cmd.usageError(fs, "%s", err)
+		}
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	tasks, err := c.Tasks.GetAll(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return writeTasks(cmd.stdout, tasks, *asJSON)
+}
+
+func (cmd *command) taskAdd(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("task add")
+	description := fs.String("description", "", "description of the task")
+	due := fs.String("due", "", "due date of the task")
+	project := fs.String("project", "", "id of the project of the task")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) == 0 {
+		return cmd.usageError(fs, "a title is required")
+	}
+	data := api.CreateTask{
+		Title:       strings.Join(positional, " "),
+		Description: *description,
+		DueDate:     *due,
+	}
+	if *project != "" {
+		id, err := parseID(*project)
+		if err != nil {
+			return cmd.usageError(fs, "%s", err)
+		}
+		data.ProjectID = &id
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	task, err := c.Tasks.Create(ctx, data)
+	if err != nil {
+		return err
+	}
+	return writeTasks(cmd.stdout, []api.Task{task}, *asJSON)
+}
+
+func (cmd *command) taskEdit(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("task edit")
+	title := fs.String("title", "", "new title of the task")
+	description := fs.String("description", "", "new description of the task")
+	due := fs.String("due", "", `new due date of the task, or "" to clear it`)
+	status := fs.String("status", "", "new status of the task")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) != 1 {
+		return cmd.usageError(fs, "a task id is required")
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return cmd.usageError(fs, "%s", err)
+	}
+	// only the flags that were given are updated
+	var data api.UpdateTask
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title":
+			data.Title = title
+		case "description":
+			data.Description = description
+		case "due":
+			data.DueDate = due
+		case "status":
+			data.Status = status
+		}
+	})
+	if data == (api.UpdateTask{}) {
+		return cmd.usageError(fs, "nothing to change")
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	task, err := c.Tasks.Update(ctx, id, data)
+	if err != nil {
+		return err
+	}
+	return writeTasks(cmd.stdout, []api.Task{task}, *asJSON)
+}
+
+func (cmd *command) taskDone(ctx context.Context, args []string) error {
+	fs := cmd.flagSet("task done")
+	asJSON := fs.Bool("json", false, "write JSON instead of a table")
+	positional, err := parse(fs, args)
+	if err != nil {
+		return errUsage
+	}
+	if len(positional) != 1 {
+		return cmd.usageError(fs, "a task id is required")
+	}
+	id, err := parseID(positional[0])
+	if err != nil {
+		return cmd.usageError(fs, "%s", err)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	task, err := c.Tasks.Done(ctx, id)
+	if err != nil {
+		return err
+	}
+	return writeTasks(cmd.stdout, []api.Task{task}, *asJSON)
+}
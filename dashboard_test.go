@@ -43,7 +43,7 @@ func TestDashboard(t *testing.T) {
 		body := test.Body(res)
 		assert := assert.New(t)
 		assert.Equal(200, res.StatusCode)
-		assert.Contains(body, "Welcome back, hello@webdevfuel.com")
+		assert.Contains(body, "Welcome back, Web Dev Fuel")
 		assert.Contains(body, "Dashboard")
 		assert.Contains(body, "Projects")
 		assert.Contains(body, "Tasks")
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AdminSearchLimit is the most rows returned by the searches of
+// AdminService.
+const AdminSearchLimit = 100
+
+// An AdminUser is a User along with counts of what they have, as listed in
+// the admin area.
+type AdminUser struct {
+	User
+	// Projects is the number of projects the user owns.
+	Projects int `db:"projects"`
+	// Sessions is the number of sessions the user is logged in with.
+	Sessions int `db:"sessions"`
+}
+
+// An AdminProject is a Project along with the email address of its owner,
+// as listed in the admin area.
+type AdminProject struct {
+	Project
+	OwnerEmail string `db:"owner_email"`
+}
+
+// An AdminSession is a Session along with the email address of its user,
+// as listed in the admin area.
+type AdminSession struct {
+	Session
+	UserEmail string `db:"user_email"`
+}
+
+// An AdminService is a connection to the database with methods for the
+// admin area, which see the rows of every user.
+type AdminService struct {
+	db *sqlx.DB
+}
+
+// NewAdminService returns a pointer to AdminService.
+func NewAdminService(db *sqlx.DB) *AdminService {
+	return &AdminService{
+		db: db,
+	}
+}
+
+// adminUserQuery selects the columns of AdminUser, to be followed by the
+// rest of the query.
+const adminUserQuery = `
+	SELECT
+	    users.*,
+	    (
+	        SELECT
+	            count(*)
+	        FROM
+	            projects
+	        WHERE
+	            projects.owner_id = users.id) AS projects,
+	    (
+	        SELECT
+	            count(*)
+	        FROM
+	            sessions
+	        WHERE
+	            sessions.user_id = users.id) AS sessions
+	FROM
+	    users
+`
+
+// GetUser returns an AdminUser and returns an error from the Get method.
+func (s *AdminService) GetUser(ctx context.Context, userID int32) (AdminUser, error) {
+	ctx, end := startQuery(ctx, "AdminService", "GetUser")
+	defer end()
+	var user AdminUser
+	err := s.db.GetContext(ctx, &user, adminUserQuery+"WHERE users.id = $1", userID)
+	if err != nil {
+		return AdminUser{}, err
+	}
+	return user, nil
+}
+
+// SearchUsers returns a slice of AdminUser and returns an error from the
+// Select method.
+//
+// It returns the users whose name or email address contains the given
+// search, or the most recent ones if it's empty, up to AdminSearchLimit.
+func (s *AdminService) SearchUsers(ctx context.Context, search string) ([]AdminUser, error) {
+	ctx, end := startQuery(ctx, "AdminService", "SearchUsers")
+	defer end()
+	var users []AdminUser
+	err := s.db.SelectContext(ctx, &users, adminUserQuery+`
+		WHERE
+		    users.id <> $3
+		    AND ($1 = ''
+		        OR users.email ILIKE '%' || $1 || '%'
+		        OR users.name ILIKE '%' || $1 || '%')
+		ORDER BY
+		    users.id DESC
+		LIMIT $2
+	`, search, AdminSearchLimit, DeletedUserID)
+	if err != nil {
+		return []AdminUser{}, err
+	}
+	return users, nil
+}
+
+// SearchProjects returns a slice of AdminProject and returns an error from
+// the Select method.
+//
+// It returns the projects whose title or owner's email address contains the
+// given search, or the most recent ones if it's empty, up to
+// AdminSearchLimit.
+func (s *AdminService) SearchProjects(ctx context.Context, search string) ([]AdminProject, error) {
+	ctx, end := startQuery(ctx, "AdminService", "SearchProjects")
+	defer end()
+	var projects []AdminProject
+	err := s.db.SelectContext(ctx, &projects, `
+		SELECT
+		    projects.*,
+		    users.email AS owner_email
+		FROM
+		    projects
+		    JOIN users ON users.id = projects.owner_id
+		WHERE
+		    $1 = ''
+		    OR projects.title ILIKE '%' || $1 || '%'
+		    OR users.email ILIKE '%' || $1 || '%'
+		ORDER BY
+		    projects.created_at DESC,
+		    projects.id DESC
+		LIMIT $2
+	`, search, AdminSearchLimit)
+	if err != nil {
+		return []AdminProject{}, err
+	}
+	return projects, nil
+}
+
+// SearchSessions returns a slice of AdminSession and returns an error from
+// the Select method.
+//
+// It returns the sessions whose user's email address or user agent contains
+// the given search, or the most recent ones if it's empty, up to
+// AdminSearchLimit.
+func (s *AdminService) SearchSessions(ctx context.Context, search string) ([]AdminSession, error) {
+	ctx, end := startQuery(ctx, "AdminService", "SearchSessions")
+	defer end()
+	var sessions []AdminSession
+	err := s.db.SelectContext(ctx, &sessions, `
+		SELECT
+		    sessions.*,
+		    users.email AS user_email
+		FROM
+		    sessions
+		    JOIN users ON users.id = sessions.user_id
+		WHERE
+		    $1 = ''
+		    OR users.email ILIKE '%' || $1 || '%'
+		    OR sessions.user_agent ILIKE '%' || $1 || '%'
+		ORDER BY
+		    sessions.created_at DESC,
+		    sessions.id DESC
+		LIMIT $2
+	`, search, AdminSearchLimit)
+	if err != nil {
+		return []AdminSession{}, err
+	}
+	return sessions, nil
+}
+
+// SuspendUser returns a User and returns the first encountered error.
+//
+// If successful, it suspends the user with the given id and deletes all of
+// their sessions inside one transaction, so that they're logged out
+// everywhere right away.
+func (s *AdminService) SuspendUser(ctx context.Context, userID int32) (User, error) {
+	ctx, end := startQuery(ctx, "AdminService", "SuspendUser")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+	user, err := NewUserService(s.db).Suspend(ctx, tx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	err = NewSessionService(s.db).DeleteAllUserTokens(ctx, tx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit()
+}
+
+// TransferProject returns a Project and returns the first encountered error.
+//
+// If successful, it makes the user with the given id the owner of the
+// project with the given id, of any user, inside one transaction. The
+// previous owner keeps access to the project as a shared user.
+//
+// sql.ErrNoRows is returned if the project doesn't exist.
+func (s *AdminService) TransferProject(ctx context.Context, projectID int32, ownerID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "AdminService", "TransferProject")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+	var previousOwnerID int32
+	err = tx.GetContext(ctx, &previousOwnerID, "SELECT owner_id FROM projects WHERE id = $1 FOR UPDATE", projectID)
+	if err != nil {
+		return Project{}, err
+	}
+	project, err := NewProjectService(s.db).TransferWithTx(ctx, tx, projectID, previousOwnerID, ownerID, false, true)
+	if err != nil {
+		return Project{}, err
+	}
+	return project, tx.Commit()
+}
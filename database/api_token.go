@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// An APIToken lets a user authenticate requests to the API, e.g. from the
+// command-line client, without a session.
+//
+// Only the hash of the token is stored, so that it's shown to the user once,
+// when it's created.
+//
+// table: "api_tokens"
+type APIToken struct {
+	ID     int32 `db:"id"`
+	UserID int32 `db:"user_id"`
+	// Name is what the user calls the token, e.g. the machine it's used on.
+	Name      string `db:"name"`
+	TokenHash string `db:"token_hash"`
+	// LastUsedAt is when the token last authenticated a request, and is null
+	// until it does.
+	LastUsedAt pgtype.Timestamp `db:"last_used_at"`
+	CreatedAt  pgtype.Timestamp `db:"created_at"`
+}
+
+// An APITokenService is a connection to the database with methods
+// for interacting with the "api_tokens" table.
+type APITokenService struct {
+	db *sqlx.DB
+}
+
+// NewAPITokenService returns a pointer to APITokenService.
+func NewAPITokenService(db *sqlx.DB) *APITokenService {
+	return &APITokenService{
+		db: db,
+	}
+}
+
+// Create returns an APIToken and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "api_tokens" table with the
+// given name and token hash.
+func (s *APITokenService) Create(ctx context.Context, userID int32, name string, tokenHash string) (APIToken, error) {
+	ctx, end := startQuery(ctx, "APITokenService", "Create")
+	defer end()
+	var token APIToken
+	err := s.db.GetContext(ctx, &token, `
+		INSERT INTO api_tokens (user_id, name, token_hash)
+		    VALUES ($1, $2, $3)
+		RETURNING
+		    *
+	`, userID, name, tokenHash)
+	return token, err
+}
+
+// GetAll returns a slice of APIToken and returns an error from the Select
+// method.
+//
+// It returns the tokens of the given user, newest first.
+func (s *APITokenService) GetAll(ctx context.Context, userID int32) ([]APIToken, error) {
+	ctx, end := startQuery(ctx, "APITokenService", "GetAll")
+	defer end()
+	var tokens []APIToken
+	err := s.db.SelectContext(ctx, &tokens, `
+		SELECT
+		    *
+		FROM
+		    api_tokens
+		WHERE
+		    user_id = $1
+		ORDER BY
+		    created_at DESC,
+		    id DESC
+	`, userID)
+	return tokens, err
+}
+
+// Delete returns an error from the Get method.
+//
+// If successful, it deletes the "api_tokens" table row that matches the
+// given token id and user id, which stops authenticating requests right
+// away. It returns sql.ErrNoRows if no row was deleted.
+func (s *APITokenService) Delete(ctx context.Context, tokenID int32, userID int32) error {
+	ctx, end := startQuery(ctx, "APITokenService", "Delete")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		DELETE FROM api_tokens
+		WHERE id = $1
+		    AND user_id = $2
+		RETURNING
+		    id
+	`, tokenID, userID)
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// An Attachment is a file uploaded to a task. Its contents are kept in
+// storage at StorageKey, and images also have a thumbnail at ThumbnailKey.
+//
+// table: "attachments"
+type Attachment struct {
+	ID           int32            `db:"id"`
+	TaskID       int32            `db:"task_id"`
+	UploaderID   int32            `db:"uploader_id"`
+	Filename     string           `db:"filename"`
+	ContentType  string           `db:"content_type"`
+	Size         int64            `db:"size"`
+	StorageKey   string           `db:"storage_key"`
+	ThumbnailKey pgtype.Text      `db:"thumbnail_key"`
+	CreatedAt    pgtype.Timestamp `db:"created_at"`
+}
+
+// Keys returns the storage keys of the attachment, including the thumbnail
+// if it has one.
+func (a Attachment) Keys() []string {
+	keys := []string{a.StorageKey}
+	if a.ThumbnailKey.Valid {
+		keys = append(keys, a.ThumbnailKey.String)
+	}
+	return keys
+}
+
+// An AttachmentService is a connection to the database with methods
+// for interacting with the "attachments" table.
+type AttachmentService struct {
+	db *sqlx.DB
+}
+
+// NewAttachmentService returns a pointer to AttachmentService.
+func NewAttachmentService(db *sqlx.DB) *AttachmentService {
+	return &AttachmentService{
+		db: db,
+	}
+}
+
+// Create returns an Attachment and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "attachments" table with the
+// given data.
+func (s *AttachmentService) Create(
+	ctx context.Context,
+	taskID int32,
+	uploaderID int32,
+	filename string,
+	contentType string,
+	size int64,
+	storageKey string,
+	thumbnailKey pgtype.Text,
+) (Attachment, error) {
+	ctx, end := startQuery(ctx, "AttachmentService", "Create")
+	defer end()
+	var attachment Attachment
+	err := s.db.GetContext(ctx, &attachment, `
+		INSERT INTO attachments (task_id, uploader_id, filename, content_type, size, storage_key, thumbnail_key)
+		    VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING
+		    *
+	`, taskID, uploaderID, filename, contentType, size, storageKey, thumbnailKey)
+	return attachment, err
+}
+
+// GetAllByTaskID returns a slice of Attachment and returns an error from the
+// Select method.
+func (s *AttachmentService) GetAllByTaskID(ctx context.Context, taskID int32) ([]Attachment, error) {
+	ctx, end := startQuery(ctx, "AttachmentService", "GetAllByTaskID")
+	defer end()
+	var attachments []Attachment
+	err := s.db.SelectContext(ctx, &attachments, `
+		SELECT
+		    *
+		FROM
+		    attachments
+		WHERE
+		    task_id = $1
+		ORDER BY
+		    created_at,
+		    id
+	`, taskID)
+	return attachments, err
+}
+
+// GetVisible returns an Attachment and returns an error from the Get method.
+//
+// It only returns the attachment if the given user can see its task, which
+// follows the same rules as TaskService.GetVisible.
+func (s *AttachmentService) GetVisible(ctx context.Context, attachmentID int32, userID int32) (Attachment, error) {
+	ctx, end := startQuery(ctx, "AttachmentService", "GetVisible")
+	defer end()
+	var attachment Attachment
+	err := s.db.GetContext(ctx, &attachment, `
+		SELECT
+		    attachments.*
+		FROM
+		    attachments
+		    JOIN tasks ON tasks.id = attachments.task_id
+		    LEFT JOIN projects ON projects.id = tasks.project_id
+		WHERE
+		    attachments.id = $1
+		    AND (tasks.id IN (
+		            SELECT
+		                task_id
+		            FROM
+		                workspace_tasks
+		            WHERE
+		                user_id = $2)
+		        OR (projects.published
+		            AND EXISTS (
+		                SELECT
+		                    1
+		                FROM
+		                    projects_users
+		                WHERE
+		                    projects_users.project_id = projects.id
+		                    AND projects_users.user_id = $2)))
+	`, attachmentID, userID)
+	return attachment, err
+}
+
+// Delete returns an Attachment and returns an error from the Get method.
+//
+// If successful, it deletes the "attachments" table row that matches the
+// given attachment id, if the given user owns its task and the project of
+// the task isn't archived, and returns the deleted row so that its files can
+// be removed from storage.
+func (s *AttachmentService) Delete(ctx context.Context, attachmentID int32, userID int32) (Attachment, error) {
+	ctx, end := startQuery(ctx, "AttachmentService", "Delete")
+	defer end()
+	var attachment Attachment
+	err := s.db.GetContext(ctx, &attachment, `
+		DELETE FROM attachments
+		USING tasks
+		WHERE attachments.id = $1
+		    AND tasks.id = attachments.task_id
+		    AND tasks.owner_id = $2
+		    AND tasks.id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $2)
+		    AND NOT EXISTS (
+		        SELECT
+		            1
+		        FROM
+		            projects
+		        WHERE
+		            projects.id = tasks.project_id
+		            AND projects.state = 'archived')
+		RETURNING
+		    attachments.*
+	`, attachmentID, userID)
+	return attachment, err
+}
@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A DataExport is a copy of the data of a user, which they asked for and
+// download as a ZIP file once it's generated in the background.
+//
+// table: "data_exports"
+type DataExport struct {
+	ID     int32            `db:"id"`
+	UserID int32            `db:"user_id"`
+	Status DataExportStatus `db:"status"`
+	// StorageKey is where the ZIP file is kept in storage, and is null
+	// until the export is ready.
+	StorageKey pgtype.Text `db:"storage_key"`
+	Size       pgtype.Int8 `db:"size"`
+	// Error is why the export failed, and is null unless it did.
+	Error       pgtype.Text      `db:"error"`
+	CreatedAt   pgtype.Timestamp `db:"created_at"`
+	CompletedAt pgtype.Timestamp `db:"completed_at"`
+}
+
+// A DataExportStatus is the state of a data export, stored in the "status"
+// column of the "data_exports" table.
+type DataExportStatus string
+
+const (
+	DataExportPending DataExportStatus = "pending"
+	DataExportReady   DataExportStatus = "ready"
+	DataExportFailed  DataExportStatus = "failed"
+)
+
+// UserData is everything kept about a user, as included in their data
+// exports.
+type UserData struct {
+	User     User
+	Sessions []Session
+	// APITokens only hold the hash of each token.
+	APITokens []APIToken
+	// Projects are the projects the user owns, including archived ones and
+	// templates, and SharedProjects those shared with them.
+	Projects       []Project
+	SharedProjects []Project
+	Milestones     []Milestone
+	// Tasks are the tasks the user owns, in any project.
+	Tasks       []Task
+	TimeEntries []TimeEntry
+	// Attachments are the attachments the user uploaded. Only their
+	// metadata is included, not their contents.
+	Attachments []Attachment
+}
+
+// A DataExportService is a connection to the database with methods
+// for interacting with the "data_exports" table.
+type DataExportService struct {
+	db *sqlx.DB
+}
+
+// NewDataExportService returns a pointer to DataExportService.
+func NewDataExportService(db *sqlx.DB) *DataExportService {
+	return &DataExportService{
+		db: db,
+	}
+}
+
+// Create returns a DataExport and returns an error from the Get method.
+//
+// If successful, it inserts a new pending export of the data of the user
+// with the given id, or returns their pending export if there's one.
+func (s *DataExportService) Create(ctx context.Context, userID int32) (DataExport, error) {
+	ctx, end := startQuery(ctx, "DataExportService", "Create")
+	defer end()
+	var export DataExport
+	err := s.db.GetContext(ctx, &export, `
+		WITH pending AS (
+		    SELECT
+		        *
+		    FROM
+		        data_exports
+		    WHERE
+		        user_id = $1
+		        AND status = 'pending'
+		),
+		created AS (
+		    INSERT INTO data_exports (user_id)
+		    SELECT
+		        $1
+		    WHERE
+		        NOT EXISTS (
+		            SELECT
+		                1
+		            FROM
+		                pending)
+		    RETURNING
+		        *
+		)
+		SELECT
+		    *
+		FROM
+		    pending
+		UNION ALL
+		SELECT
+		    *
+		FROM
+		    created
+	`, userID)
+	return export, err
+}
+
+// GetAll returns a slice of DataExport and returns an error from the Select
+// method.
+//
+// It returns the exports of the user with the given id, newest first.
+func (s *DataExportService) GetAll(ctx context.Context, userID int32) ([]DataExport, error) {
+	ctx, end := startQuery(ctx, "DataExportService", "GetAll")
+	defer end()
+	var exports []DataExport
+	err := s.db.SelectContext(ctx, &exports, `
+		SELECT
+		    *
+		FROM
+		    data_exports
+		WHERE
+		    user_id = $1
+		ORDER BY
+		    created_at DESC,
+		    id DESC
+	`, userID)
+	if err != nil {
+		return []DataExport{}, err
+	}
+	return exports, nil
+}
+
+// Get returns a DataExport and returns an error from the Get method.
+//
+// It returns the export with the given id of the user with the given id.
+func (s *DataExportService) Get(ctx context.Context, exportID int32, userID int32) (DataExport, error) {
+	ctx, end := startQuery(ctx, "DataExportService", "Get")
+	defer end()
+	var export DataExport
+	err := s.db.GetContext(ctx, &export, `
+		SELECT
+		    *
+		FROM
+		    data_exports
+		WHERE
+		    id = $1
+		    AND user_id = $2
+	`, exportID, userID)
+	return export, err
+}
+
+// GetAllPendingWithTx returns a slice of DataExport and returns an error
+// from the Select method.
+//
+// It returns up to the given limit of pending exports, oldest first. The
+// rows are locked until the given transaction ends, and rows locked by
+// other transactions are skipped, so that several instances of the app can
+// generate exports at the same time without generating one twice.
+func (s *DataExportService) GetAllPendingWithTx(ctx context.Context, tx *sqlx.Tx, limit int) ([]DataExport, error) {
+	ctx, end := startQuery(ctx, "DataExportService", "GetAllPendingWithTx")
+	defer end()
+	var exports []DataExport
+	err := tx.SelectContext(ctx, &exports, `
+		SELECT
+		    *
+		FROM
+		    data_exports
+		WHERE
+		    status = 'pending'
+		ORDER BY
+		    created_at,
+		    id
+		LIMIT $1
+		FOR UPDATE
+		    SKIP LOCKED
+	`, limit)
+	return exports, err
+}
+
+// CompleteWithTx returns an error from the Exec method.
+//
+// If successful, it marks the export with the given id as ready inside the
+// given transaction, with the storage key and size of its file.
+func (s *DataExportService) CompleteWithTx(ctx context.Context, tx *sqlx.Tx, exportID int32, storageKey string, size int64) error {
+	ctx, end := startQuery(ctx, "DataExportService", "CompleteWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+		    data_exports
+		SET
+		    status = 'ready',
+		    storage_key = $1,
+		    size = $2,
+		    completed_at = now()
+		WHERE
+		    id = $3
+	`, storageKey, size, exportID)
+	return err
+}
+
+// FailWithTx returns an error from the Exec method.
+//
+// If successful, it marks the export with the given id as failed inside the
+// given transaction, with the reason it failed.
+func (s *DataExportService) FailWithTx(ctx context.Context, tx *sqlx.Tx, exportID int32, reason string) error {
+	ctx, end := startQuery(ctx, "DataExportService", "FailWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+		    data_exports
+		SET
+		    status = 'failed',
+		    error = $1,
+		    completed_at = now()
+		WHERE
+		    id = $2
+	`, reason, exportID)
+	return err
+}
+
+// GetUserDataWithTx returns a UserData and returns the first encountered
+// error.
+//
+// It returns everything kept about the user with the given id, read inside
+// the given transaction so that it's consistent.
+func (s *DataExportService) GetUserDataWithTx(ctx context.Context, tx *sqlx.Tx, userID int32) (UserData, error) {
+	ctx, end := startQuery(ctx, "DataExportService", "GetUserDataWithTx")
+	defer end()
+	data := UserData{
+		Sessions:       []Session{},
+		APITokens:      []APIToken{},
+		Projects:       []Project{},
+		SharedProjects: []Project{},
+		Milestones:     []Milestone{},
+		Tasks:          []Task{},
+		TimeEntries:    []TimeEntry{},
+		Attachments:    []Attachment{},
+	}
+	err := tx.GetContext(ctx, &data.User, "SELECT * FROM users WHERE id = $1", userID)
+	if err != nil {
+		return UserData{}, err
+	}
+	queries := []struct {
+		dest  any
+		query string
+	}{
+		{&data.Sessions, "SELECT * FROM sessions WHERE user_id = $1 ORDER BY id"},
+		{&data.APITokens, "SELECT * FROM api_tokens WHERE user_id = $1 ORDER BY id"},
+		{&data.Projects, "SELECT * FROM projects WHERE owner_id = $1 ORDER BY id"},
+		{&data.SharedProjects, `
+			SELECT
+			    projects.*
+			FROM
+			    projects
+			    JOIN projects_users ON projects_users.project_id = projects.id
+			WHERE
+			    projects_users.user_id = $1
+			ORDER BY
+			    projects.id
+		`},
+		{&data.Milestones, `
+			SELECT
+			    milestones.*
+			FROM
+			    milestones
+			    JOIN projects ON projects.id = milestones.project_id
+			WHERE
+			    projects.owner_id = $1
+			ORDER BY
+			    milestones.id
+		`},
+		{&data.Tasks, "SELECT * FROM tasks WHERE owner_id = $1 ORDER BY id"},
+		{&data.TimeEntries, "SELECT * FROM time_entries WHERE user_id = $1 ORDER BY id"},
+		{&data.Attachments, "SELECT * FROM attachments WHERE uploader_id = $1 ORDER BY id"},
+	}
+	for _, q := range queries {
+		err = tx.SelectContext(ctx, q.dest, q.query, userID)
+		if err != nil {
+			return UserData{}, err
+		}
+	}
+	for i := range data.SharedProjects {
+		data.SharedProjects[i].Shared = true
+	}
+	return data, nil
+}
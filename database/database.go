@@ -1,10 +1,13 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"os"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/metrics"
+	"github.com/webdevfuel/projectmotor/tracing"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -24,3 +27,15 @@ func OpenDB() (*sqlx.DB, error) {
 	}
 	return conn, nil
 }
+
+// startQuery returns a copy of the given context with a span for the given
+// service method, and a function that ends the span and records the query
+// duration, meant to be deferred at the start of the method.
+func startQuery(ctx context.Context, service string, method string) (context.Context, func()) {
+	ctx, span := tracing.StartQuery(ctx, service, method)
+	observe := metrics.ObserveQuery(service, method)
+	return ctx, func() {
+		observe()
+		span.End()
+	}
+}
@@ -0,0 +1,510 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A GitHubRepo is the GitHub repository a project is linked to, whose issues
+// are kept in sync with the tasks of the project.
+//
+// table: "github_repos"
+type GitHubRepo struct {
+	// ProjectID is the primary key, and a foreign key to the "projects"
+	// table.
+	ProjectID int32  `db:"project_id"`
+	Owner     string `db:"owner"`
+	Name      string `db:"name"`
+	// UserID is the user who linked the repository, whose access token is
+	// used to update its issues.
+	UserID int32 `db:"user_id"`
+	// WebhookSecret is the secret GitHub signs the webhook deliveries of the
+	// repository with.
+	WebhookSecret string           `db:"webhook_secret"`
+	CreatedAt     pgtype.Timestamp `db:"created_at"`
+	// CompleteTasksOnMerge reports whether the tasks referenced by a pull
+	// request are moved to done when it's merged.
+	CompleteTasksOnMerge bool `db:"complete_tasks_on_merge"`
+}
+
+// FullName returns the repository as it's written on GitHub, e.g.
+// "webdevfuel/projectmotor".
+func (r GitHubRepo) FullName() string {
+	return fmt.Sprintf("%s/%s", r.Owner, r.Name)
+}
+
+// A GitHubPullRequest is a pull request of the repository of a project that
+// references a task of the project.
+//
+// table: "github_pull_requests"
+type GitHubPullRequest struct {
+	ID        int32  `db:"id"`
+	TaskID    int32  `db:"task_id"`
+	ProjectID int32  `db:"project_id"`
+	Number    int32  `db:"number"`
+	Title     string `db:"title"`
+	URL       string `db:"url"`
+	// State is either "open", "merged" or "closed".
+	State     string           `db:"state"`
+	CreatedAt pgtype.Timestamp `db:"created_at"`
+	UpdatedAt pgtype.Timestamp `db:"updated_at"`
+}
+
+// A GitHubCommit is a commit pushed to the repository of a project that
+// references a task of the project.
+//
+// table: "github_commits"
+type GitHubCommit struct {
+	ID        int32            `db:"id"`
+	TaskID    int32            `db:"task_id"`
+	ProjectID int32            `db:"project_id"`
+	SHA       string           `db:"sha"`
+	Message   string           `db:"message"`
+	URL       string           `db:"url"`
+	CreatedAt pgtype.Timestamp `db:"created_at"`
+}
+
+// ShortSHA returns the first 7 characters of the sha of the commit, as
+// GitHub shows it.
+func (c GitHubCommit) ShortSHA() string {
+	if len(c.SHA) < 7 {
+		return c.SHA
+	}
+	return c.SHA[:7]
+}
+
+// A GitHubIssueTarget is an issue linked to a task, with the repository it
+// belongs to and the access token to update it with.
+type GitHubIssueTarget struct {
+	Number      int32  `db:"number"`
+	Owner       string `db:"owner"`
+	Name        string `db:"name"`
+	AccessToken string `db:"gh_access_token"`
+}
+
+// A GitHubService is a connection to the database with methods for
+// interacting with the "github_repos" and "github_issues" tables.
+type GitHubService struct {
+	db *sqlx.DB
+}
+
+// NewGitHubService returns a pointer to GitHubService.
+func NewGitHubService(db *sqlx.DB) *GitHubService {
+	return &GitHubService{
+		db: db,
+	}
+}
+
+// GetRepo returns a GitHubRepo, reports whether the project with the given
+// id is linked to a repository, and returns an error from the Get method.
+func (s *GitHubService) GetRepo(ctx context.Context, projectID int32) (GitHubRepo, bool, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetRepo")
+	defer end()
+	var repo GitHubRepo
+	err := s.db.GetContext(ctx, &repo, "select * from github_repos where project_id = $1", projectID)
+	if err == sql.ErrNoRows {
+		return GitHubRepo{}, false, nil
+	}
+	if err != nil {
+		return GitHubRepo{}, false, err
+	}
+	return repo, true, nil
+}
+
+// LinkRepo returns a GitHubRepo and returns an error from the Get method.
+//
+// If successful, it links the project with the given id to the repository
+// with the given owner and name, on behalf of the user with the given id.
+func (s *GitHubService) LinkRepo(ctx context.Context, projectID int32, userID int32, owner string, name string, webhookSecret string) (GitHubRepo, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "LinkRepo")
+	defer end()
+	var repo GitHubRepo
+	err := s.db.GetContext(ctx, &repo, `
+		INSERT INTO github_repos (project_id, owner, name, user_id, webhook_secret)
+		    VALUES ($1, $2, $3, $4, $5)
+		RETURNING
+		    *
+	`, projectID, owner, name, userID, webhookSecret)
+	return repo, err
+}
+
+// UnlinkRepo returns an error from the Exec method.
+//
+// If successful, it unlinks the project with the given id from its
+// repository, and its tasks from their issues, pull requests and commits.
+// The tasks are kept.
+func (s *GitHubService) UnlinkRepo(ctx context.Context, projectID int32) error {
+	ctx, end := startQuery(ctx, "GitHubService", "UnlinkRepo")
+	defer end()
+	_, err := s.db.ExecContext(ctx, `
+		WITH issues AS (
+		    DELETE FROM github_issues
+		    WHERE project_id = $1),
+		pull_requests AS (
+		    DELETE FROM github_pull_requests
+		    WHERE project_id = $1),
+		commits AS (
+		    DELETE FROM github_commits
+		    WHERE project_id = $1)
+		DELETE FROM github_repos
+		WHERE project_id = $1
+	`, projectID)
+	return err
+}
+
+// SetCompleteTasksOnMerge returns a GitHubRepo and returns an error from the
+// Get method.
+//
+// If successful, it sets whether the tasks referenced by a pull request of
+// the repository of the project with the given id are moved to done when
+// it's merged.
+func (s *GitHubService) SetCompleteTasksOnMerge(ctx context.Context, projectID int32, complete bool) (GitHubRepo, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "SetCompleteTasksOnMerge")
+	defer end()
+	var repo GitHubRepo
+	err := s.db.GetContext(ctx, &repo, `
+		UPDATE
+		    github_repos
+		SET
+		    complete_tasks_on_merge = $2
+		WHERE
+		    project_id = $1
+		RETURNING
+		    *
+	`, projectID, complete)
+	return repo, err
+}
+
+// GetIssueNumbers returns the numbers of the issues linked to tasks of the
+// project with the given id, and returns an error from the Select method.
+func (s *GitHubService) GetIssueNumbers(ctx context.Context, projectID int32) ([]int32, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetIssueNumbers")
+	defer end()
+	var numbers []int32
+	err := s.db.SelectContext(ctx, &numbers, `
+		SELECT
+		    number
+		FROM
+		    github_issues
+		WHERE
+		    project_id = $1
+		ORDER BY
+		    number
+	`, projectID)
+	return numbers, err
+}
+
+// CreateTaskFromIssueWithTx returns a Task and returns an error from the Get
+// method.
+//
+// If successful, it inserts a new row into the "tasks" table with the given
+// data, linked to the issue with the given number of the repository of the
+// project, inside the given transaction.
+func (s *GitHubService) CreateTaskFromIssueWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	projectID int32,
+	ownerID int32,
+	number int32,
+	title string,
+	description string,
+	status TaskStatus,
+) (Task, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "CreateTaskFromIssueWithTx")
+	defer end()
+	var task Task
+	err := tx.GetContext(ctx, &task, `
+		WITH task AS (
+		INSERT INTO tasks (title, description, status, owner_id, project_id)
+		        VALUES ($1, $2, $3, $4, $5)
+		    RETURNING
+		        *), issue AS (
+		INSERT INTO github_issues (task_id, project_id, number)
+		    SELECT
+		        id,
+		        project_id,
+		        $6
+		    FROM
+		        task)
+		SELECT
+		    *
+		FROM
+		    task
+	`, title, description, status, ownerID, projectID, number)
+	return task, err
+}
+
+// GetTaskByIssue returns a Task, reports whether the issue with the given
+// number is linked to a task of the project with the given id, and returns
+// an error from the Get method.
+func (s *GitHubService) GetTaskByIssue(ctx context.Context, projectID int32, number int32) (Task, bool, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetTaskByIssue")
+	defer end()
+	var task Task
+	err := s.db.GetContext(ctx, &task, `
+		SELECT
+		    tasks.*
+		FROM
+		    tasks
+		    JOIN github_issues ON github_issues.task_id = tasks.id
+		WHERE
+		    github_issues.project_id = $1
+		    AND github_issues.number = $2
+	`, projectID, number)
+	if err == sql.ErrNoRows {
+		return Task{}, false, nil
+	}
+	if err != nil {
+		return Task{}, false, err
+	}
+	return task, true, nil
+}
+
+// UpdateTaskFromIssueWithTx returns a Task and returns an error from the Get
+// method.
+//
+// If successful, it updates the title, description and status of the task
+// with the given id, as changed on its issue, inside the given transaction.
+func (s *GitHubService) UpdateTaskFromIssueWithTx(ctx context.Context, tx *sqlx.Tx, taskID int32, title string, description string, status TaskStatus) (Task, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "UpdateTaskFromIssueWithTx")
+	defer end()
+	var task Task
+	err := tx.GetContext(ctx, &task, `
+		UPDATE
+		    tasks
+		SET
+		    title = $2,
+		    description = $3,
+		    status = $4
+		WHERE
+		    id = $1
+		RETURNING
+		    *
+	`, taskID, title, description, status)
+	return task, err
+}
+
+// UnlinkIssue returns an error from the Exec method.
+//
+// If successful, it unlinks the issue with the given number from the task of
+// the project with the given id. The task is kept.
+func (s *GitHubService) UnlinkIssue(ctx context.Context, projectID int32, number int32) error {
+	ctx, end := startQuery(ctx, "GitHubService", "UnlinkIssue")
+	defer end()
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM github_issues
+		WHERE project_id = $1
+		    AND number = $2
+	`, projectID, number)
+	return err
+}
+
+// GetIssueTarget returns a GitHubIssueTarget, reports whether the task with
+// the given id is linked to an issue, and returns an error from the Get
+// method.
+func (s *GitHubService) GetIssueTarget(ctx context.Context, taskID int32) (GitHubIssueTarget, bool, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetIssueTarget")
+	defer end()
+	var target GitHubIssueTarget
+	err := s.db.GetContext(ctx, &target, `
+		SELECT
+		    github_issues.number,
+		    github_repos.owner,
+		    github_repos.name,
+		    users.gh_access_token
+		FROM
+		    github_issues
+		    JOIN github_repos ON github_repos.project_id = github_issues.project_id
+		    JOIN users ON users.id = github_repos.user_id
+		WHERE
+		    github_issues.task_id = $1
+	`, taskID)
+	if err == sql.ErrNoRows {
+		return GitHubIssueTarget{}, false, nil
+	}
+	if err != nil {
+		return GitHubIssueTarget{}, false, err
+	}
+	return target, true, nil
+}
+
+// LinkPullRequest reports whether the pull request with the given number was
+// linked to the task with the given id, and returns an error from the Exec
+// method.
+//
+// The pull request is only linked if the task belongs to the project with
+// the given id. If it's linked already, its title, url and state are
+// updated.
+func (s *GitHubService) LinkPullRequest(
+	ctx context.Context,
+	projectID int32,
+	taskID int32,
+	number int32,
+	title string,
+	url string,
+	state string,
+) (bool, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "LinkPullRequest")
+	defer end()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO github_pull_requests (task_id, project_id, number, title, url, state)
+		SELECT
+		    id,
+		    project_id,
+		    $3,
+		    $4,
+		    $5,
+		    $6
+		FROM
+		    tasks
+		WHERE
+		    id = $1
+		    AND project_id = $2
+		ON CONFLICT (task_id,
+		    number)
+		    DO UPDATE SET
+		        title = excluded.title,
+		        url = excluded.url,
+		        state = excluded.state,
+		        updated_at = now()
+	`, taskID, projectID, number, title, url, state)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UpdatePullRequest returns an error from the Exec method.
+//
+// If successful, it updates the title, url and state of the pull request
+// with the given number of the repository of the project with the given id,
+// for every task it's linked to.
+func (s *GitHubService) UpdatePullRequest(ctx context.Context, projectID int32, number int32, title string, url string, state string) error {
+	ctx, end := startQuery(ctx, "GitHubService", "UpdatePullRequest")
+	defer end()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE
+		    github_pull_requests
+		SET
+		    title = $3,
+		    url = $4,
+		    state = $5,
+		    updated_at = now()
+		WHERE
+		    project_id = $1
+		    AND number = $2
+	`, projectID, number, title, url, state)
+	return err
+}
+
+// CompletePullRequestTasksWithTx returns a slice of Task and returns an error from
+// the Select method.
+//
+// If successful, it moves the tasks linked to the pull request with the
+// given number of the repository of the project with the given id to done,
+// inside the given transaction, and returns those that weren't done already.
+func (s *GitHubService) CompletePullRequestTasksWithTx(ctx context.Context, tx *sqlx.Tx, projectID int32, number int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "CompletePullRequestTasksWithTx")
+	defer end()
+	var tasks []Task
+	err := tx.SelectContext(ctx, &tasks, `
+		UPDATE
+		    tasks
+		SET
+		    status = 'done'
+		WHERE
+		    status <> 'done'
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            github_pull_requests
+		        WHERE
+		            project_id = $1
+		            AND number = $2)
+		RETURNING
+		    *
+	`, projectID, number)
+	return tasks, err
+}
+
+// LinkCommit reports whether the commit with the given sha was linked to the
+// task with the given id, and returns an error from the Exec method.
+//
+// The commit is only linked if the task belongs to the project with the
+// given id, and isn't linked to it already.
+func (s *GitHubService) LinkCommit(ctx context.Context, projectID int32, taskID int32, sha string, message string, url string) (bool, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "LinkCommit")
+	defer end()
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO github_commits (task_id, project_id, sha, message, url)
+		SELECT
+		    id,
+		    project_id,
+		    $3,
+		    $4,
+		    $5
+		FROM
+		    tasks
+		WHERE
+		    id = $1
+		    AND project_id = $2
+		ON CONFLICT (task_id,
+		    sha)
+		    DO NOTHING
+	`, taskID, projectID, sha, message, url)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetPullRequestsByTaskID returns a slice of GitHubPullRequest and returns
+// an error from the Select method.
+//
+// It returns the pull requests linked to the task with the given id, the
+// latest first.
+func (s *GitHubService) GetPullRequestsByTaskID(ctx context.Context, taskID int32) ([]GitHubPullRequest, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetPullRequestsByTaskID")
+	defer end()
+	var pullRequests []GitHubPullRequest
+	err := s.db.SelectContext(ctx, &pullRequests, `
+		SELECT
+		    *
+		FROM
+		    github_pull_requests
+		WHERE
+		    task_id = $1
+		ORDER BY
+		    number DESC
+	`, taskID)
+	return pullRequests, err
+}
+
+// GetCommitsByTaskID returns a slice of GitHubCommit and returns an error
+// from the Select method.
+//
+// It returns the commits linked to the task with the given id, the latest
+// first.
+func (s *GitHubService) GetCommitsByTaskID(ctx context.Context, taskID int32) ([]GitHubCommit, error) {
+	ctx, end := startQuery(ctx, "GitHubService", "GetCommitsByTaskID")
+	defer end()
+	var commits []GitHubCommit
+	err := s.db.SelectContext(ctx, &commits, `
+		SELECT
+		    *
+		FROM
+		    github_commits
+		WHERE
+		    task_id = $1
+		ORDER BY
+		    id DESC
+	`, taskID)
+	return commits, err
+}
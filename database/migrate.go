@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID is the key passed to pg_advisory_lock, so that only one
+// process at a time is able to run migrations against the same database.
+const migrationLockID int64 = 4823176011
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// ErrSchemaBehind is returned by CheckSchema when the database schema is at
+// a lower version than the latest embedded migration.
+var ErrSchemaBehind = errors.New("database schema is behind the latest migration")
+
+// A Migration is a pair of "up" and "down" statements that move the database
+// schema from one version to the next and back.
+type Migration struct {
+	// Version is the numeric prefix of the migration files.
+	Version uint
+	// Name is the part of the file name between the version and direction.
+	Name string
+	// Up holds the statements that apply the migration.
+	Up string
+	// Down holds the statements that revert the migration.
+	Down string
+}
+
+// A MigrationStatus is a representation of whether a migration has been
+// applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrations returns a slice of Migration sorted by version in asc order, and
+// the first error encountered when reading the embedded migration files.
+//
+// Migration files are expected to follow the "000001_name.up.sql" format,
+// and each version must have both an "up" and a "down" file.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("migration file %q doesn't match the expected format", entry.Name())
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(migrationsFS, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: matches[2]}
+			byVersion[uint(version)] = migration
+		}
+		if matches[3] == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LatestVersion returns the highest version of the embedded migrations.
+func LatestVersion() (uint, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion returns the version currently applied to the database,
+// reports whether the last migration was left dirty, and returns an error
+// from the Get method.
+//
+// It reads the "schema_migrations" table. sql.ErrNoRows or a missing table
+// aren't treated as errors, but rather make the function return version 0.
+func SchemaVersion(ctx context.Context, db sqlx.QueryerContext) (uint, bool, error) {
+	var exists bool
+	err := sqlx.GetContext(ctx, db, &exists, "select to_regclass('schema_migrations') is not null")
+	if err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, nil
+	}
+	var row struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	err = sqlx.GetContext(ctx, db, &row, "select version, dirty from schema_migrations limit 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(row.Version), row.Dirty, nil
+}
+
+// CheckSchema returns an error if the database schema is behind the latest
+// embedded migration, or if the last migration was left dirty.
+//
+// A schema ahead of the embedded migrations isn't treated as an error, so that
+// instances running the previous release keep serving during a deploy.
+func CheckSchema(ctx context.Context, db *sqlx.DB) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	version, dirty, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", version)
+	}
+	if version < latest {
+		return fmt.Errorf("%w: version %d, latest %d", ErrSchemaBehind, version, latest)
+	}
+	return nil
+}
+
+// A Migrator is a connection to the database with methods for applying and
+// reverting the embedded migrations.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a pointer to Migrator and an error from the
+// Migrations function.
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies all migrations that haven't been applied yet.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		version, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		return m.migrate(ctx, conn, version, m.previousVersion(version))
+	})
+}
+
+// To applies or reverts migrations until the schema is at the given version.
+//
+// Version 0 reverts all migrations.
+func (m *Migrator) To(ctx context.Context, target uint) error {
+	if target != 0 && !m.hasVersion(target) {
+		return fmt.Errorf("migration %d doesn't exist", target)
+	}
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		version, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.migrate(ctx, conn, version, target)
+	})
+}
+
+// Force records the given version as the clean version of the schema
+// without applying or reverting any migration, to recover once a dirty
+// schema was fixed manually.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && !m.hasVersion(version) {
+		return fmt.Errorf("migration %d doesn't exist", version)
+	}
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// Status returns a slice of MigrationStatus for every embedded migration,
+// the version currently applied to the database, and whether it's dirty.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, uint, bool, error) {
+	version, dirty, err := SchemaVersion(ctx, m.db)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   migration.Version <= version,
+		})
+	}
+	return statuses, version, dirty, nil
+}
+
+// withLock runs fn on a dedicated connection while holding the migration
+// advisory lock, so that concurrent starts wait for each other instead of
+// applying the same migration twice.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", migrationLockID)
+	_, err = conn.ExecContext(ctx, "create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)")
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) currentVersion(ctx context.Context, conn *sqlx.Conn) (uint, error) {
+	version, dirty, err := SchemaVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("schema version %d is dirty and must be fixed manually (then run \"projectmotor migrate force N\")", version)
+	}
+	return version, nil
+}
+
+// migrate applies each migration between from and to inside its own
+// transaction, together with the update of the "schema_migrations" table.
+//
+// Before each migration, the version of the migration is recorded as dirty
+// outside of its transaction, so that a migration that fails, or doesn't
+// finish because the process stops, leaves the schema dirty for someone to
+// fix manually instead of being retried on the next start.
+func (m *Migrator) migrate(ctx context.Context, conn *sqlx.Conn, from uint, to uint) error {
+	if to > from {
+		for _, migration := range m.migrations {
+			if migration.Version <= from || migration.Version > to {
+				continue
+			}
+			err := m.apply(ctx, conn, migration.Up, migration.Version, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d up: %w", migration.Version, err)
+			}
+		}
+	}
+	if to < from {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > from || migration.Version <= to {
+				continue
+			}
+			err := m.apply(ctx, conn, migration.Down, migration.Version, m.previousVersion(migration.Version))
+			if err != nil {
+				return fmt.Errorf("migration %d down: %w", migration.Version, err)
+			}
+		}
+	}
+	return nil
+}
+
+// apply records dirtyVersion as dirty, then runs the statements and records
+// version as clean in a transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, statements string, dirtyVersion uint, version uint) error {
+	err := m.setVersion(ctx, conn, dirtyVersion, true)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Statements are sent without arguments, so they run with the simple
+	// protocol and a file may contain more than one statement.
+	_, err = tx.ExecContext(ctx, statements)
+	if err != nil {
+		return err
+	}
+	err = m.setVersion(ctx, tx, version, false)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setVersion replaces the row of the "schema_migrations" table with the
+// given version and dirty flag, or removes it for a clean version 0.
+func (m *Migrator) setVersion(ctx context.Context, db sqlx.ExecerContext, version uint, dirty bool) error {
+	_, err := db.ExecContext(ctx, "delete from schema_migrations")
+	if err != nil {
+		return err
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, "insert into schema_migrations (version, dirty) values ($1, $2)", version, dirty)
+	return err
+}
+
+func (m *Migrator) hasVersion(version uint) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) previousVersion(version uint) uint {
+	var previous uint
+	for _, migration := range m.migrations {
+		if migration.Version < version && migration.Version > previous {
+			previous = migration.Version
+		}
+	}
+	return previous
+}
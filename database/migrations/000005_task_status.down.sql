@@ -0,0 +1,4 @@
+-- The column is kept, so that reverting the migration doesn't lose the
+-- status of any task, and only the constraint on its values is removed.
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS tasks_status_check;
@@ -0,0 +1,10 @@
+-- The column may already exist on databases that added it by hand, whose
+-- statuses are kept.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS "status" text NOT NULL DEFAULT 'todo';
+
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS tasks_status_check;
+
+ALTER TABLE tasks
+    ADD CONSTRAINT tasks_status_check CHECK (status IN ('todo', 'in_progress', 'done'));
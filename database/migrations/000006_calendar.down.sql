@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS users_calendar_token_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "calendar_token";
+
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS "due_date";
@@ -0,0 +1,7 @@
+ALTER TABLE tasks
+    ADD COLUMN "due_date" date;
+
+ALTER TABLE users
+    ADD COLUMN "calendar_token" text;
+
+CREATE UNIQUE INDEX users_calendar_token_idx ON users (calendar_token);
@@ -0,0 +1,15 @@
+CREATE TABLE attachments (
+    "id" serial PRIMARY KEY,
+    "task_id" integer NOT NULL,
+    "uploader_id" integer NOT NULL,
+    "filename" text NOT NULL,
+    "content_type" text NOT NULL,
+    "size" bigint NOT NULL,
+    "storage_key" text NOT NULL,
+    "thumbnail_key" text,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_uploader FOREIGN KEY (uploader_id) REFERENCES users (id)
+);
+
+CREATE INDEX attachments_task_id_idx ON attachments (task_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS tasks_recurrence_due_date_idx;
+
+ALTER TABLE tasks
+    DROP COLUMN IF EXISTS "recurred_at",
+    DROP COLUMN IF EXISTS "recurrence";
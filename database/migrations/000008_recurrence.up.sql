@@ -0,0 +1,7 @@
+ALTER TABLE tasks
+    ADD COLUMN "recurrence" text,
+    ADD COLUMN "recurred_at" timestamp;
+
+CREATE INDEX tasks_recurrence_due_date_idx ON tasks (due_date)
+WHERE
+    recurrence IS NOT NULL AND recurred_at IS NULL;
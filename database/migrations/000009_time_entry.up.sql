@@ -0,0 +1,20 @@
+CREATE TABLE time_entries (
+    "id" serial PRIMARY KEY,
+    "task_id" integer NOT NULL,
+    "user_id" integer NOT NULL,
+    "started_at" timestamp NOT NULL,
+    "ended_at" timestamp,
+    "note" text NOT NULL DEFAULT '',
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT time_entries_ended_at_check CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+CREATE UNIQUE INDEX time_entries_running_user_id_idx ON time_entries (user_id)
+WHERE
+    ended_at IS NULL;
+
+CREATE INDEX time_entries_task_id_idx ON time_entries (task_id);
+
+CREATE INDEX time_entries_started_at_idx ON time_entries (started_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS tasks_milestone_id_idx;
+
+ALTER TABLE tasks
+    DROP CONSTRAINT IF EXISTS fk_milestone,
+    DROP COLUMN IF EXISTS "milestone_id";
+
+DROP TABLE IF EXISTS milestones;
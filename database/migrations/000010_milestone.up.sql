@@ -0,0 +1,17 @@
+CREATE TABLE milestones (
+    "id" serial PRIMARY KEY,
+    "project_id" integer NOT NULL,
+    "name" text NOT NULL,
+    "description" text NOT NULL DEFAULT '',
+    "target_date" date,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX milestones_project_id_idx ON milestones (project_id);
+
+ALTER TABLE tasks
+    ADD COLUMN "milestone_id" integer,
+    ADD CONSTRAINT fk_milestone FOREIGN KEY (milestone_id) REFERENCES milestones (id) ON DELETE SET NULL;
+
+CREATE INDEX tasks_milestone_id_idx ON tasks (milestone_id);
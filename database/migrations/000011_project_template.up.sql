@@ -0,0 +1,2 @@
+ALTER TABLE projects
+    ADD COLUMN "is_template" boolean NOT NULL DEFAULT FALSE;
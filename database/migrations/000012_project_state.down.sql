@@ -0,0 +1,5 @@
+ALTER TABLE projects
+    DROP CONSTRAINT IF EXISTS projects_state_check;
+
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS "state";
@@ -0,0 +1,5 @@
+ALTER TABLE projects
+    ADD COLUMN "state" text NOT NULL DEFAULT 'active';
+
+ALTER TABLE projects
+    ADD CONSTRAINT projects_state_check CHECK (state IN ('active', 'archived'));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS project_pages_token_idx;
+
+DROP TABLE IF EXISTS project_pages;
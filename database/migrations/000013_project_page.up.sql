@@ -0,0 +1,15 @@
+CREATE TABLE project_pages (
+    "project_id" integer PRIMARY KEY,
+    "token" text NOT NULL,
+    "enabled" boolean NOT NULL DEFAULT FALSE,
+    "show_description" boolean NOT NULL DEFAULT TRUE,
+    "show_status" boolean NOT NULL DEFAULT TRUE,
+    "show_due_dates" boolean NOT NULL DEFAULT TRUE,
+    "show_task_descriptions" boolean NOT NULL DEFAULT FALSE,
+    "views" integer NOT NULL DEFAULT 0,
+    "last_viewed_at" timestamp,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX project_pages_token_idx ON project_pages (token);
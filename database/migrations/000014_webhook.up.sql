@@ -0,0 +1,33 @@
+CREATE TABLE webhooks (
+    "id" serial PRIMARY KEY,
+    "project_id" integer NOT NULL,
+    "url" text NOT NULL,
+    "secret" text NOT NULL,
+    "events" text NOT NULL,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhooks_project_id_idx ON webhooks (project_id);
+
+CREATE TABLE webhook_deliveries (
+    "id" serial PRIMARY KEY,
+    "webhook_id" integer NOT NULL,
+    "event" text NOT NULL,
+    "payload" jsonb NOT NULL,
+    "status" text NOT NULL DEFAULT 'pending',
+    "attempts" integer NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamp NOT NULL DEFAULT now(),
+    "last_status_code" integer,
+    "last_error" text NOT NULL DEFAULT '',
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    "delivered_at" timestamp,
+    CONSTRAINT fk_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE,
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at)
+WHERE
+    status = 'pending';
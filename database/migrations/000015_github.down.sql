@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS github_issues;
+
+DROP TABLE IF EXISTS github_repos;
@@ -0,0 +1,21 @@
+CREATE TABLE github_repos (
+    "project_id" integer PRIMARY KEY,
+    "owner" text NOT NULL,
+    "name" text NOT NULL,
+    "user_id" integer NOT NULL,
+    "webhook_secret" text NOT NULL,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE github_issues (
+    "task_id" integer PRIMARY KEY,
+    "project_id" integer NOT NULL,
+    "number" integer NOT NULL,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX github_issues_project_id_number_idx ON github_issues (project_id, number);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS github_commits;
+
+DROP TABLE IF EXISTS github_pull_requests;
+
+ALTER TABLE github_repos
+    DROP COLUMN IF EXISTS "complete_tasks_on_merge";
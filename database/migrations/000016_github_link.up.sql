@@ -0,0 +1,37 @@
+ALTER TABLE github_repos
+    ADD COLUMN "complete_tasks_on_merge" boolean NOT NULL DEFAULT FALSE;
+
+CREATE TABLE github_pull_requests (
+    "id" serial PRIMARY KEY,
+    "task_id" integer NOT NULL,
+    "project_id" integer NOT NULL,
+    "number" integer NOT NULL,
+    "title" text NOT NULL,
+    "url" text NOT NULL,
+    "state" text NOT NULL DEFAULT 'open',
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    "updated_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    CONSTRAINT github_pull_requests_state_check CHECK (state IN ('open', 'merged', 'closed'))
+);
+
+CREATE UNIQUE INDEX github_pull_requests_task_id_number_idx ON github_pull_requests (task_id, number);
+
+CREATE INDEX github_pull_requests_project_id_number_idx ON github_pull_requests (project_id, number);
+
+CREATE TABLE github_commits (
+    "id" serial PRIMARY KEY,
+    "task_id" integer NOT NULL,
+    "project_id" integer NOT NULL,
+    "sha" text NOT NULL,
+    "message" text NOT NULL,
+    "url" text NOT NULL,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX github_commits_task_id_sha_idx ON github_commits (task_id, sha);
+
+CREATE INDEX github_commits_project_id_idx ON github_commits (project_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS api_tokens_user_id_idx;
+
+DROP INDEX IF EXISTS api_tokens_token_hash_idx;
+
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,13 @@
+CREATE TABLE api_tokens (
+    "id" serial PRIMARY KEY,
+    "user_id" integer NOT NULL,
+    "name" text NOT NULL,
+    "token_hash" text NOT NULL,
+    "last_used_at" timestamp,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX api_tokens_token_hash_idx ON api_tokens (token_hash);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens (user_id);
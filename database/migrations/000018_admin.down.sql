@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "suspended_at";
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "is_admin";
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN "is_admin" boolean NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+    ADD COLUMN "suspended_at" timestamp;
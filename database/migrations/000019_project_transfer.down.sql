@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS project_transfers_to_user_id_idx;
+
+DROP INDEX IF EXISTS project_transfers_project_id_idx;
+
+DROP TABLE IF EXISTS project_transfers;
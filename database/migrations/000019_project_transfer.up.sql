@@ -0,0 +1,16 @@
+CREATE TABLE project_transfers (
+    "id" serial PRIMARY KEY,
+    "project_id" integer NOT NULL,
+    "from_user_id" integer NOT NULL,
+    "to_user_id" integer NOT NULL,
+    "reassign_tasks" boolean NOT NULL DEFAULT FALSE,
+    "keep_access" boolean NOT NULL DEFAULT FALSE,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    CONSTRAINT fk_from_user FOREIGN KEY (from_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_to_user FOREIGN KEY (to_user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX project_transfers_project_id_idx ON project_transfers (project_id);
+
+CREATE INDEX project_transfers_to_user_id_idx ON project_transfers (to_user_id);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS data_exports_pending_idx;
+
+DROP INDEX IF EXISTS data_exports_user_id_idx;
+
+DROP TABLE IF EXISTS data_exports;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "deletion_scheduled_at";
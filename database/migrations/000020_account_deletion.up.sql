@@ -0,0 +1,21 @@
+ALTER TABLE users
+    ADD COLUMN "deletion_scheduled_at" timestamp;
+
+CREATE TABLE data_exports (
+    "id" serial PRIMARY KEY,
+    "user_id" integer NOT NULL,
+    "status" text NOT NULL DEFAULT 'pending',
+    "storage_key" text,
+    "size" bigint,
+    "error" text,
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    "completed_at" timestamp,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT data_exports_status_check CHECK (status IN ('pending', 'ready', 'failed'))
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+
+CREATE INDEX data_exports_pending_idx ON data_exports (created_at)
+WHERE
+    status = 'pending';
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN "timezone" text NOT NULL DEFAULT 'UTC',
+    ADD COLUMN "avatar_url" text,
+    ADD COLUMN "avatar_key" text;
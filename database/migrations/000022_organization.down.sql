@@ -0,0 +1,21 @@
+DROP VIEW IF EXISTS workspace_tasks;
+
+DROP VIEW IF EXISTS workspace_projects;
+
+DROP VIEW IF EXISTS active_organizations;
+
+DROP INDEX IF EXISTS projects_organization_id_idx;
+
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS "organization_id";
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS "active_organization_id";
+
+DROP INDEX IF EXISTS organization_members_user_id_idx;
+
+DROP TABLE IF EXISTS organization_members;
+
+DROP INDEX IF EXISTS organizations_personal_user_id_idx;
+
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,117 @@
+CREATE TABLE organizations (
+    "id" serial PRIMARY KEY,
+    "name" text NOT NULL,
+    "personal_user_id" integer,
+    "default_access" text NOT NULL DEFAULT 'view',
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    CONSTRAINT fk_personal_user FOREIGN KEY (personal_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT organizations_default_access_check CHECK (default_access IN ('none', 'view', 'edit'))
+);
+
+CREATE UNIQUE INDEX organizations_personal_user_id_idx ON organizations (personal_user_id);
+
+CREATE TABLE organization_members (
+    "organization_id" integer NOT NULL,
+    "user_id" integer NOT NULL,
+    "role" text NOT NULL DEFAULT 'member',
+    "created_at" timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (organization_id, user_id),
+    CONSTRAINT fk_organization FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT organization_members_role_check CHECK (role IN ('owner', 'admin', 'member'))
+);
+
+CREATE INDEX organization_members_user_id_idx ON organization_members (user_id);
+
+ALTER TABLE users
+    ADD COLUMN "active_organization_id" integer,
+    ADD CONSTRAINT fk_active_organization FOREIGN KEY (active_organization_id) REFERENCES organizations (id) ON DELETE SET NULL;
+
+ALTER TABLE projects
+    ADD COLUMN "organization_id" integer,
+    ADD CONSTRAINT fk_organization FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE;
+
+INSERT INTO organizations (name, personal_user_id)
+SELECT
+    'Personal',
+    id
+FROM
+    users;
+
+INSERT INTO organization_members (organization_id, user_id, role)
+SELECT
+    id,
+    personal_user_id,
+    'owner'
+FROM
+    organizations;
+
+UPDATE
+    projects
+SET
+    organization_id = organizations.id
+FROM
+    organizations
+WHERE
+    organizations.personal_user_id = projects.owner_id;
+
+ALTER TABLE projects
+    ALTER COLUMN "organization_id" SET NOT NULL;
+
+CREATE INDEX projects_organization_id_idx ON projects (organization_id);
+
+-- active_organizations holds the workspace every user works in, which is
+-- their personal workspace unless they switched to another one they're a
+-- member of.
+CREATE VIEW active_organizations AS
+SELECT
+    organization_members.user_id,
+    organization_members.organization_id,
+    organization_members.role
+FROM
+    users
+    JOIN organizations AS personal ON personal.personal_user_id = users.id
+    JOIN organization_members ON organization_members.user_id = users.id
+        AND organization_members.organization_id = coalesce(users.active_organization_id, personal.id);
+
+-- workspace_projects holds the projects of the active workspace of every
+-- user that they can see, and whether they can edit them. Owners and admins
+-- of the workspace can edit all of them, and members the ones they created,
+-- while the others depend on the default access of the workspace.
+CREATE VIEW workspace_projects AS
+SELECT
+    active_organizations.user_id,
+    projects.id AS project_id,
+    (projects.owner_id = active_organizations.user_id
+        OR active_organizations.role IN ('owner', 'admin')
+        OR organizations.default_access = 'edit') AS can_edit
+FROM
+    active_organizations
+    JOIN organizations ON organizations.id = active_organizations.organization_id
+    JOIN projects ON projects.organization_id = organizations.id
+WHERE
+    projects.owner_id = active_organizations.user_id
+    OR active_organizations.role IN ('owner', 'admin')
+    OR organizations.default_access IN ('view', 'edit');
+
+-- workspace_tasks holds the tasks of the active workspace of every user
+-- that they can see, which are the tasks of the projects they can see, and
+-- their own tasks without a project while they're in their personal
+-- workspace.
+CREATE VIEW workspace_tasks AS
+SELECT
+    workspace_projects.user_id,
+    tasks.id AS task_id
+FROM
+    workspace_projects
+    JOIN tasks ON tasks.project_id = workspace_projects.project_id
+UNION ALL
+SELECT
+    active_organizations.user_id,
+    tasks.id AS task_id
+FROM
+    active_organizations
+    JOIN organizations ON organizations.id = active_organizations.organization_id
+        AND organizations.personal_user_id = active_organizations.user_id
+    JOIN tasks ON tasks.owner_id = active_organizations.user_id
+        AND tasks.project_id IS NULL;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN "gh_scopes" text NOT NULL DEFAULT '';
+
+-- users who logged in so far were asked for access to their repositories too
+UPDATE
+    users
+SET
+    gh_scopes = 'read:user,repo,user:email';
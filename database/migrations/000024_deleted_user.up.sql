@@ -0,0 +1,5 @@
+-- What deleted users authored inside projects of others is kept, and credited
+-- to this user, who can't log in: its email address is empty and no GitHub
+-- account has the id 0.
+INSERT INTO users ("id", "name", "email", "gh_access_token", "gh_user_id")
+    VALUES (0, 'Deleted user', '', '', 0);
@@ -0,0 +1,19 @@
+-- member_projects holds the projects of every workspace a user is a member
+-- of that they can see, and whether they can edit them, by the same rules as
+-- workspace_projects, for what doesn't depend on the workspace the user
+-- works in, such as their calendar feeds.
+CREATE VIEW member_projects AS
+SELECT
+    organization_members.user_id,
+    projects.id AS project_id,
+    (projects.owner_id = organization_members.user_id
+        OR organization_members.role IN ('owner', 'admin')
+        OR organizations.default_access = 'edit') AS can_edit
+FROM
+    organization_members
+    JOIN organizations ON organizations.id = organization_members.organization_id
+    JOIN projects ON projects.organization_id = organizations.id
+WHERE
+    projects.owner_id = organization_members.user_id
+    OR organization_members.role IN ('owner', 'admin')
+    OR organizations.default_access IN ('view', 'edit');
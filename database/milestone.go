@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A Milestone is a target within a project, e.g. a release, which tasks of
+// the project can belong to.
+//
+// table: "milestones"
+type Milestone struct {
+	ID          int32            `db:"id"`
+	ProjectID   int32            `db:"project_id"`
+	Name        string           `db:"name"`
+	Description string           `db:"description"`
+	TargetDate  pgtype.Date      `db:"target_date"`
+	CreatedAt   pgtype.Timestamp `db:"created_at"`
+}
+
+// A MilestoneProgress is a Milestone along with the number of its tasks,
+// how many of them are done, and how many are past their due date.
+type MilestoneProgress struct {
+	Milestone
+	Total        int32 `db:"total"`
+	Done         int32 `db:"done"`
+	OverdueTasks int32 `db:"overdue_tasks"`
+}
+
+// Percent returns the share of the tasks of the milestone that are done,
+// from 0 to 100.
+func (p MilestoneProgress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return int(p.Done * 100 / p.Total)
+}
+
+// Overdue reports whether the target date of the milestone is before the
+// given day while some of its tasks aren't done yet.
+func (p MilestoneProgress) Overdue(today time.Time) bool {
+	if !p.TargetDate.Valid || p.Done == p.Total {
+		return false
+	}
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	return p.TargetDate.Time.Before(day)
+}
+
+// A MilestoneService is a connection to the database with methods
+// for interacting with the "milestones" table.
+type MilestoneService struct {
+	db *sqlx.DB
+}
+
+// NewMilestoneService returns a pointer to MilestoneService.
+func NewMilestoneService(db *sqlx.DB) *MilestoneService {
+	return &MilestoneService{
+		db: db,
+	}
+}
+
+// Create returns a Milestone and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "milestones" table with the
+// given data.
+func (s *MilestoneService) Create(
+	ctx context.Context,
+	projectID int32,
+	name string,
+	description string,
+	targetDate pgtype.Date,
+) (Milestone, error) {
+	ctx, end := startQuery(ctx, "MilestoneService", "Create")
+	defer end()
+	var milestone Milestone
+	err := s.db.GetContext(ctx, &milestone, `
+		INSERT INTO milestones (project_id, name, description, target_date)
+		    VALUES ($1, $2, $3, $4)
+		RETURNING
+		    *
+	`, projectID, name, description, targetDate)
+	return milestone, err
+}
+
+// GetAllByProjectID returns a slice of Milestone and returns an error from
+// the Select method.
+//
+// It returns the milestones of the given project, by target date, with
+// those without one last.
+func (s *MilestoneService) GetAllByProjectID(ctx context.Context, projectID int32) ([]Milestone, error) {
+	ctx, end := startQuery(ctx, "MilestoneService", "GetAllByProjectID")
+	defer end()
+	var milestones []Milestone
+	err := s.db.SelectContext(ctx, &milestones, `
+		SELECT
+		    *
+		FROM
+		    milestones
+		WHERE
+		    project_id = $1
+		ORDER BY
+		    target_date NULLS LAST,
+		    id
+	`, projectID)
+	return milestones, err
+}
+
+// GetProgressByProjectID returns a slice of MilestoneProgress and returns an
+// error from the Select method.
+//
+// It returns the milestones of the given project in the same order as
+// GetAllByProjectID, with their tasks counted. Tasks that aren't done are
+// overdue if they're due before the given date.
+func (s *MilestoneService) GetProgressByProjectID(ctx context.Context, projectID int32, today pgtype.Date) ([]MilestoneProgress, error) {
+	ctx, end := startQuery(ctx, "MilestoneService", "GetProgressByProjectID")
+	defer end()
+	var progress []MilestoneProgress
+	err := s.db.SelectContext(ctx, &progress, `
+		SELECT
+		    milestones.*,
+		    count(tasks.id) AS total,
+		    count(tasks.id) FILTER (WHERE tasks.status = 'done') AS done,
+		    count(tasks.id) FILTER (WHERE tasks.status <> 'done'
+		        AND tasks.due_date < $2) AS overdue_tasks
+		FROM
+		    milestones
+		    LEFT JOIN tasks ON tasks.milestone_id = milestones.id
+		WHERE
+		    milestones.project_id = $1
+		GROUP BY
+		    milestones.id
+		ORDER BY
+		    milestones.target_date NULLS LAST,
+		    milestones.id
+	`, projectID, today)
+	return progress, err
+}
+
+// Delete returns an error from the Get method.
+//
+// If successful, it deletes the "milestones" table row that matches the
+// given milestone id, if the given user can edit its project in their
+// active organization and it isn't archived. Its tasks are kept without a
+// milestone. It returns sql.ErrNoRows if no row was deleted.
+func (s *MilestoneService) Delete(ctx context.Context, milestoneID int32, ownerID int32) error {
+	ctx, end := startQuery(ctx, "MilestoneService", "Delete")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		DELETE FROM milestones
+		USING projects
+		WHERE milestones.id = $1
+		    AND projects.id = milestones.project_id
+		    AND projects.id IN (
+		        SELECT
+		            project_id
+		        FROM
+		            workspace_projects
+		        WHERE
+		            user_id = $2
+		            AND can_edit)
+		    AND projects.state = 'active'
+		RETURNING
+		    milestones.id
+	`, milestoneID, ownerID)
+}
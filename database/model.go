@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/webdevfuel/projectmotor/util"
 )
@@ -26,3 +28,36 @@ func Int4FromString(s string) (pgtype.Int4, error) {
 		Valid: true,
 	}, nil
 }
+
+// DateFromString returns a pgtype.Date parsed from the given string in the
+// format "2006-01-02", which is the value of a date input.
+//
+// An empty string returns an invalid pgtype.Date, which is stored as null.
+func DateFromString(s string) (pgtype.Date, error) {
+	if s == "" {
+		return pgtype.Date{
+			Valid: false,
+		}, nil
+	}
+
+	value, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return pgtype.Date{
+			Valid: false,
+		}, err
+	}
+
+	return pgtype.Date{
+		Time:  value,
+		Valid: true,
+	}, nil
+}
+
+// DateString returns the given pgtype.Date in the format "2006-01-02", or an
+// empty string if it's null.
+func DateString(d pgtype.Date) string {
+	if !d.Valid {
+		return ""
+	}
+	return d.Time.Format(time.DateOnly)
+}
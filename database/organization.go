@@ -0,0 +1,564 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLastOwner is returned when removing a member of an organization, or
+// changing their role, would leave it without an owner.
+var ErrLastOwner = errors.New("organization has no other owner")
+
+// An Organization, called a workspace in the app, owns projects, which its
+// members can see and edit depending on their role and its default access.
+//
+// Every user has a personal organization, which nobody else can join, and
+// which holds the projects they create until they switch to another one.
+//
+// table: "organizations"
+type Organization struct {
+	ID   int32  `db:"id"`
+	Name string `db:"name"`
+	// PersonalUserID is a foreign key to the "users" table, and is only
+	// valid for the personal organization of that user.
+	PersonalUserID pgtype.Int4 `db:"personal_user_id"`
+	// DefaultAccess is the access members have to the projects of the
+	// organization they didn't create.
+	DefaultAccess OrganizationAccess `db:"default_access"`
+	CreatedAt     pgtype.Timestamp   `db:"created_at"`
+	// Role is the role of the user the organization was returned for. It's
+	// joined from the "organization_members" table, and doesn't map to any
+	// column inside the "organizations" table.
+	Role OrganizationRole `db:"role"`
+}
+
+// Personal reports whether the organization is the personal workspace of a
+// user.
+func (o Organization) Personal() bool {
+	return o.PersonalUserID.Valid
+}
+
+// CanManage reports whether the user the organization was returned for can
+// change its settings and members, which nobody can for personal
+// organizations.
+func (o Organization) CanManage() bool {
+	return !o.Personal() && (o.Role == OrganizationRoleOwner || o.Role == OrganizationRoleAdmin)
+}
+
+// An OrganizationRole is the role of a member of an organization, stored in
+// the "role" column of the "organization_members" table.
+type OrganizationRole string
+
+const (
+	// OrganizationRoleOwner members can do everything, including deleting the
+	// organization and making other members owners.
+	OrganizationRoleOwner OrganizationRole = "owner"
+	// OrganizationRoleAdmin members can edit every project, and manage the
+	// settings and the members that aren't owners.
+	OrganizationRoleAdmin OrganizationRole = "admin"
+	// OrganizationRoleMember members can edit the projects they create, and see
+	// or edit the others depending on the default access.
+	OrganizationRoleMember OrganizationRole = "member"
+)
+
+// OrganizationRoles holds every role, from the most to the least powerful.
+var OrganizationRoles = []OrganizationRole{OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember}
+
+// Label returns the name of the role shown to users.
+func (r OrganizationRole) Label() string {
+	switch r {
+	case OrganizationRoleOwner:
+		return "Owner"
+	case OrganizationRoleAdmin:
+		return "Admin"
+	default:
+		return "Member"
+	}
+}
+
+// An OrganizationAccess is the access members of an organization have to
+// the projects they didn't create, stored in the "default_access" column of
+// the "organizations" table.
+type OrganizationAccess string
+
+const (
+	OrganizationAccessNone OrganizationAccess = "none"
+	OrganizationAccessView OrganizationAccess = "view"
+	OrganizationAccessEdit OrganizationAccess = "edit"
+)
+
+// OrganizationAccesses holds every default access, from the least to the
+// most open.
+var OrganizationAccesses = []OrganizationAccess{OrganizationAccessNone, OrganizationAccessView, OrganizationAccessEdit}
+
+// Label returns the description of the access shown to users.
+func (a OrganizationAccess) Label() string {
+	switch a {
+	case OrganizationAccessNone:
+		return "Members only see the projects they create"
+	case OrganizationAccessEdit:
+		return "Members can edit every project"
+	default:
+		return "Members can see every project"
+	}
+}
+
+// An OrganizationMember is a user who is a member of an organization.
+//
+// table: "organization_members"
+type OrganizationMember struct {
+	OrganizationID int32            `db:"organization_id"`
+	UserID         int32            `db:"user_id"`
+	Role           OrganizationRole `db:"role"`
+	CreatedAt      pgtype.Timestamp `db:"created_at"`
+	// Email, Name, AvatarURL and AvatarKey are joined from the "users"
+	// table, and don't map to any column inside the "organization_members"
+	// table.
+	Email     string      `db:"email"`
+	Name      pgtype.Text `db:"name"`
+	AvatarURL pgtype.Text `db:"avatar_url"`
+	AvatarKey pgtype.Text `db:"avatar_key"`
+}
+
+// User returns the parts of the user of the member that are joined, to
+// show their name and avatar.
+func (m OrganizationMember) User() User {
+	return User{
+		ID:        m.UserID,
+		Email:     m.Email,
+		Name:      m.Name,
+		AvatarURL: m.AvatarURL,
+		AvatarKey: m.AvatarKey,
+	}
+}
+
+// An OrganizationService is a connection to the database with methods
+// for interacting with the "organizations" and "organization_members"
+// tables.
+type OrganizationService struct {
+	db *sqlx.DB
+}
+
+// NewOrganizationService returns a pointer to OrganizationService.
+func NewOrganizationService(db *sqlx.DB) *OrganizationService {
+	return &OrganizationService{
+		db: db,
+	}
+}
+
+// organizationQuery selects the columns of Organization for a user, whose
+// id is the first parameter, to be followed by the rest of the query.
+const organizationQuery = `
+	SELECT
+	    organizations.*,
+	    organization_members.role
+	FROM
+	    organizations
+	    JOIN organization_members ON organization_members.organization_id = organizations.id
+	        AND organization_members.user_id = $1
+`
+
+// CreatePersonalWithTx returns an Organization and returns the first
+// encountered error.
+//
+// If successful, it inserts the personal organization of the user with the
+// given id inside the given transaction, and makes it their active one.
+func (s *OrganizationService) CreatePersonalWithTx(ctx context.Context, tx *sqlx.Tx, userID int32) (Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "CreatePersonalWithTx")
+	defer end()
+	return s.createWithTx(ctx, tx, "Personal", pgtype.Int4{Int32: userID, Valid: true}, userID)
+}
+
+// Create returns an Organization and returns the first encountered error.
+//
+// If successful, it inserts a new organization with the given name inside a
+// transaction, makes the user with the given id its owner, and switches them
+// to it.
+func (s *OrganizationService) Create(ctx context.Context, name string, userID int32) (Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "Create")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Organization{}, err
+	}
+	defer tx.Rollback()
+	organization, err := s.createWithTx(ctx, tx, name, pgtype.Int4{}, userID)
+	if err != nil {
+		return Organization{}, err
+	}
+	return organization, tx.Commit()
+}
+
+func (s *OrganizationService) createWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	name string,
+	personalUserID pgtype.Int4,
+	userID int32,
+) (Organization, error) {
+	var organization Organization
+	err := tx.GetContext(ctx, &organization, `
+		INSERT INTO organizations (name, personal_user_id)
+		    VALUES ($1, $2)
+		RETURNING
+		    *, 'owner' AS role
+	`, name, personalUserID)
+	if err != nil {
+		return Organization{}, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role)
+		    VALUES ($1, $2, 'owner')
+	`, organization.ID, userID)
+	if err != nil {
+		return Organization{}, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    users
+		SET
+		    active_organization_id = $1
+		WHERE
+		    id = $2
+	`, organization.ID, userID)
+	return organization, err
+}
+
+// GetAll returns a slice of Organization and returns an error from the
+// Select method.
+//
+// It returns the organizations the given user is a member of, starting
+// with their personal one, and then by name.
+func (s *OrganizationService) GetAll(ctx context.Context, userID int32) ([]Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "GetAll")
+	defer end()
+	var organizations []Organization
+	err := s.db.SelectContext(ctx, &organizations, organizationQuery+`
+		ORDER BY
+		    organizations.personal_user_id IS NULL,
+		    organizations.name,
+		    organizations.id
+	`, userID)
+	return organizations, err
+}
+
+// Get returns an Organization and returns an error from the Get method.
+//
+// It only returns the organization if the given user is a member of it.
+func (s *OrganizationService) Get(ctx context.Context, organizationID int32, userID int32) (Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "Get")
+	defer end()
+	var organization Organization
+	err := s.db.GetContext(ctx, &organization, organizationQuery+`
+		WHERE
+		    organizations.id = $2
+	`, userID, organizationID)
+	return organization, err
+}
+
+// GetActive returns an Organization and returns an error from the Get
+// method.
+//
+// It returns the organization the given user works in, whose projects and
+// tasks ProjectService and TaskService return.
+func (s *OrganizationService) GetActive(ctx context.Context, userID int32) (Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "GetActive")
+	defer end()
+	var organization Organization
+	err := s.db.GetContext(ctx, &organization, organizationQuery+`
+		JOIN active_organizations ON active_organizations.organization_id = organizations.id
+		    AND active_organizations.user_id = $1
+	`, userID)
+	return organization, err
+}
+
+// Switch returns an Organization and returns an error from the Get method.
+//
+// If successful, it makes the organization with the given id the active
+// one of the given user. It returns sql.ErrNoRows if they aren't a member
+// of it.
+func (s *OrganizationService) Switch(ctx context.Context, organizationID int32, userID int32) (Organization, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "Switch")
+	defer end()
+	var organization Organization
+	err := s.db.GetContext(ctx, &organization, `
+		WITH switched AS (
+		    UPDATE
+		        users
+		    SET
+		        active_organization_id = $2
+		    WHERE
+		        id = $1
+		        AND EXISTS (
+		            SELECT
+		                1
+		            FROM
+		                organization_members
+		            WHERE
+		                organization_id = $2
+		                AND user_id = $1)
+		    RETURNING
+		        active_organization_id)
+		`+organizationQuery+`
+		    JOIN switched ON switched.active_organization_id = organizations.id
+	`, userID, organizationID)
+	return organization, err
+}
+
+// Update returns an error from the Get method.
+//
+// If successful, it updates the name and default access of the
+// organization with the given id, which can't be a personal one. It
+// returns sql.ErrNoRows otherwise.
+func (s *OrganizationService) Update(
+	ctx context.Context,
+	organizationID int32,
+	name string,
+	defaultAccess OrganizationAccess,
+) error {
+	ctx, end := startQuery(ctx, "OrganizationService", "Update")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		UPDATE
+		    organizations
+		SET
+		    name = $2,
+		    default_access = $3
+		WHERE
+		    id = $1
+		    AND personal_user_id IS NULL
+		RETURNING
+		    id
+	`, organizationID, name, defaultAccess)
+}
+
+// Delete returns an error from the Get method.
+//
+// If successful, it deletes the organization with the given id, which
+// can't be a personal one, along with its projects. Tasks of the projects
+// are kept by their owners without a project, like when a project is
+// deleted, and members working in it are switched back to their personal
+// organization. It returns sql.ErrNoRows if no row was deleted.
+func (s *OrganizationService) Delete(ctx context.Context, organizationID int32) error {
+	ctx, end := startQuery(ctx, "OrganizationService", "Delete")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		DELETE FROM organizations
+		WHERE id = $1
+		    AND personal_user_id IS NULL
+		RETURNING
+		    id
+	`, organizationID)
+}
+
+// GetMembers returns a slice of OrganizationMember and returns an error
+// from the Select method.
+//
+// It returns the members of the organization with the given id, owners
+// first, and then by when they joined.
+func (s *OrganizationService) GetMembers(ctx context.Context, organizationID int32) ([]OrganizationMember, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "GetMembers")
+	defer end()
+	var members []OrganizationMember
+	err := s.db.SelectContext(ctx, &members, `
+		SELECT
+		    organization_members.*,
+		    users.email,
+		    users.name,
+		    users.avatar_url,
+		    users.avatar_key
+		FROM
+		    organization_members
+		    JOIN users ON users.id = organization_members.user_id
+		WHERE
+		    organization_members.organization_id = $1
+		ORDER BY
+		    array_position(ARRAY['owner', 'admin', 'member'], organization_members.role),
+		    organization_members.created_at,
+		    organization_members.user_id
+	`, organizationID)
+	return members, err
+}
+
+// AddMember reports whether the given user was already a member of the
+// organization with the given id, and returns an error from the Select
+// method.
+//
+// If successful, it makes the user a member with the given role, unless
+// they already were one or the organization is a personal one, in which
+// case sql.ErrNoRows is returned.
+func (s *OrganizationService) AddMember(ctx context.Context, organizationID int32, userID int32, role OrganizationRole) (bool, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "AddMember")
+	defer end()
+	var added []int32
+	err := s.db.SelectContext(ctx, &added, `
+		INSERT INTO organization_members (organization_id, user_id, role)
+		SELECT
+		    id,
+		    $2,
+		    $3
+		FROM
+		    organizations
+		WHERE
+		    id = $1
+		    AND personal_user_id IS NULL
+		ON CONFLICT
+		    DO NOTHING
+		RETURNING
+		    user_id
+	`, organizationID, userID, role)
+	if err != nil {
+		return false, err
+	}
+	if len(added) == 0 {
+		var exists bool
+		err = s.db.GetContext(ctx, &exists, `
+			SELECT
+			    EXISTS (
+			        SELECT
+			            1
+			        FROM
+			            organization_members
+			        WHERE
+			            organization_id = $1
+			            AND user_id = $2)
+		`, organizationID, userID)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, sql.ErrNoRows
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// SetRole returns an OrganizationMember and returns the first encountered
+// error.
+//
+// If successful, it changes the role of the given member of the
+// organization with the given id. It returns ErrLastOwner if they're its
+// only owner and the role isn't owner, and sql.ErrNoRows if they aren't a
+// member.
+func (s *OrganizationService) SetRole(ctx context.Context, organizationID int32, userID int32, role OrganizationRole) (OrganizationMember, error) {
+	ctx, end := startQuery(ctx, "OrganizationService", "SetRole")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return OrganizationMember{}, err
+	}
+	defer tx.Rollback()
+	if role != OrganizationRoleOwner {
+		err = s.ensureOtherOwnerWithTx(ctx, tx, organizationID, userID)
+		if err != nil {
+			return OrganizationMember{}, err
+		}
+	}
+	var member OrganizationMember
+	err = tx.GetContext(ctx, &member, `
+		UPDATE
+		    organization_members
+		SET
+		    role = $3
+		FROM
+		    users
+		WHERE
+		    organization_members.organization_id = $1
+		    AND organization_members.user_id = $2
+		    AND users.id = organization_members.user_id
+		RETURNING
+		    organization_members.*,
+		    users.email,
+		    users.name,
+		    users.avatar_url,
+		    users.avatar_key
+	`, organizationID, userID, role)
+	if err != nil {
+		return OrganizationMember{}, err
+	}
+	return member, tx.Commit()
+}
+
+// RemoveMember returns the first encountered error.
+//
+// If successful, it removes the given member from the organization with
+// the given id, which can't be their personal one, and switches them back
+// to their personal organization if they were working in it. The projects
+// they created are kept by the organization.
+//
+// It returns ErrLastOwner if they're its only owner, and sql.ErrNoRows if
+// they aren't a member.
+func (s *OrganizationService) RemoveMember(ctx context.Context, organizationID int32, userID int32) error {
+	ctx, end := startQuery(ctx, "OrganizationService", "RemoveMember")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = s.ensureOtherOwnerWithTx(ctx, tx, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	var id int32
+	err = tx.GetContext(ctx, &id, `
+		DELETE FROM organization_members
+		USING organizations
+		WHERE organization_members.organization_id = $1
+		    AND organization_members.user_id = $2
+		    AND organizations.id = organization_members.organization_id
+		    AND organizations.personal_user_id IS NULL
+		RETURNING
+		    organization_members.user_id
+	`, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    users
+		SET
+		    active_organization_id = NULL
+		WHERE
+		    id = $2
+		    AND active_organization_id = $1
+	`, organizationID, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureOtherOwnerWithTx returns ErrLastOwner if the given user is the only
+// owner of the organization with the given id.
+//
+// The owners are locked until the given transaction ends, so that two
+// owners can't be removed at the same time.
+func (s *OrganizationService) ensureOtherOwnerWithTx(ctx context.Context, tx *sqlx.Tx, organizationID int32, userID int32) error {
+	var owners []int32
+	err := tx.SelectContext(ctx, &owners, `
+		SELECT
+		    user_id
+		FROM
+		    organization_members
+		WHERE
+		    organization_id = $1
+		    AND role = 'owner'
+		FOR UPDATE
+	`, organizationID)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(owners, []int32{userID}) {
+		return ErrLastOwner
+	}
+	return nil
+}
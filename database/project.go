@@ -1,9 +1,10 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jmoiron/sqlx"
 )
@@ -21,18 +22,42 @@ type Project struct {
 	Description pgtype.Text `db:"description"`
 	// Published reports whether the project is available with shared users.
 	Published bool `db:"published"`
-	// OwnerID is a foreign key to the "users" table.
+	// OwnerID is a foreign key to the "users" table, pointing at the user
+	// who created the project, or was transferred it.
 	OwnerID int32 `db:"owner_id"`
+	// OrganizationID is a foreign key to the "organizations" table, which
+	// owns the project.
+	OrganizationID int32 `db:"organization_id"`
 	// CreatedAt tracks when the project was created by the owner.
 	CreatedAt pgtype.Timestamp `db:"created_at"`
 	// UpdatedAt tracks the last time the project was updated by the owner.
 	UpdatedAt pgtype.Timestamp `db:"updated_at"`
+	// IsTemplate reports whether the project is a template, which new
+	// projects can be created from.
+	IsTemplate bool `db:"is_template"`
+	// State is whether the project is active or archived. Archived projects
+	// are read-only, and hidden from most lists.
+	State ProjectState `db:"state"`
 	// Shared reports whether the project is shared or owned.
 	// It should always be set by Go code, and doesn't map to
 	// any column inside the "projects" table.
 	Shared bool `db:"-"`
 }
 
+// A ProjectState is the lifecycle state of a project, stored in the "state"
+// column of the "projects" table.
+type ProjectState string
+
+const (
+	ProjectStateActive   ProjectState = "active"
+	ProjectStateArchived ProjectState = "archived"
+)
+
+// Archived reports whether the project is archived, and so read-only.
+func (p Project) Archived() bool {
+	return p.State == ProjectStateArchived
+}
+
 // An ProjectService is a connection to the database with methods
 // for interacting with the "projects" table.
 type ProjectService struct {
@@ -49,10 +74,26 @@ func NewProjectService(db *sqlx.DB) *ProjectService {
 // Create returns a Project and returns an error from the Get method.
 //
 // If successful, it inserts a new row into the "projects" table with
-// the given title and description.
-func (s ProjectService) Create(title string, description string, ownerID int32) (Project, error) {
+// the given title and description, inside the active organization of
+// the given owner.
+func (s ProjectService) Create(ctx context.Context, title string, description string, ownerID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "Create")
+	defer end()
 	var project Project
-	err := s.db.Get(&project, "insert into projects (title, description, owner_id) values ($1, $2, $3) returning *", title, description, ownerID)
+	err := s.db.GetContext(ctx, &project, `
+		INSERT INTO projects (title, description, owner_id, organization_id)
+		SELECT
+		    $1,
+		    $2,
+		    $3,
+		    organization_id
+		FROM
+		    active_organizations
+		WHERE
+		    user_id = $3
+		RETURNING
+		    *
+	`, title, description, ownerID)
 	if err != nil {
 		return Project{}, err
 	}
@@ -62,10 +103,13 @@ func (s ProjectService) Create(title string, description string, ownerID int32)
 // TogglePublished returns a Project and returns an error from the Get method.
 //
 // If successful, it updates the "published" column inside the "projects" table
-// by the given id, to the opposite of the previous value.
-func (s ProjectService) TogglePublished(projectID int32, ownerID int32) (Project, error) {
+// by the given id, to the opposite of the previous value, if the given user
+// can edit it in their active organization.
+func (s ProjectService) TogglePublished(ctx context.Context, projectID int32, userID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "TogglePublished")
+	defer end()
 	var project Project
-	err := s.db.Get(&project, "update projects set published = not published where id = $1 and owner_id = $2 returning *", projectID, ownerID)
+	err := s.db.GetContext(ctx, &project, "update projects set published = not published where id = $1 and id in (select project_id from workspace_projects where user_id = $2 and can_edit) returning *", projectID, userID)
 	if err != nil {
 		return Project{}, err
 	}
@@ -73,67 +117,545 @@ func (s ProjectService) TogglePublished(projectID int32, ownerID int32) (Project
 }
 
 // Get returns a Project and returns an error from the Get method.
-func (s ProjectService) Get(projectID int32, ownerID int32) (Project, error) {
+//
+// It only returns the project if the given user can edit it in their active
+// organization.
+func (s ProjectService) Get(ctx context.Context, projectID int32, userID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "Get")
+	defer end()
 	var project Project
-	err := s.db.Get(&project, "select * from projects where id = $1 and owner_id = $2", projectID, ownerID)
+	err := s.db.GetContext(ctx, &project, "select * from projects where id = $1 and id in (select project_id from workspace_projects where user_id = $2 and can_edit)", projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+// GetVisible returns a Project and returns an error from the Get method.
+//
+// Unlike Get, it also returns the project if the given user can only see it
+// in their active organization, or if it's published and shared with them,
+// in which case it's marked as shared.
+func (s ProjectService) GetVisible(ctx context.Context, projectID int32, userID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetVisible")
+	defer end()
+	var row struct {
+		Project
+		CanEdit bool `db:"can_edit"`
+	}
+	query := `
+		select projects.*, coalesce(workspace_projects.can_edit, false) as can_edit from projects
+		left join workspace_projects on workspace_projects.project_id = projects.id and workspace_projects.user_id = $2
+		where projects.id = $1 and (
+			workspace_projects.project_id is not null
+			or (published and exists (select 1 from projects_users where project_id = projects.id and user_id = $2))
+		)
+	`
+	err := s.db.GetContext(ctx, &row, query, projectID, userID)
 	if err != nil {
 		return Project{}, err
 	}
+	project := row.Project
+	project.Shared = !row.CanEdit
 	return project, nil
 }
 
+// GetVisibleToMember returns a Project and returns an error from the Get
+// method.
+//
+// Unlike GetVisible, it returns the project if the given user can see it in
+// any of their organizations, not only their active one, or if it's
+// published and shared with them.
+func (s ProjectService) GetVisibleToMember(ctx context.Context, projectID int32, userID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetVisibleToMember")
+	defer end()
+	var project Project
+	query := `
+		select * from projects
+		where id = $1 and (
+			id in (select project_id from member_projects where user_id = $2)
+			or (published and exists (select 1 from projects_users where project_id = projects.id and user_id = $2))
+		)
+	`
+	err := s.db.GetContext(ctx, &project, query, projectID, userID)
+	return project, err
+}
+
 // GetAll returns a slice of Project and returns an error from the Select method.
-func (s ProjectService) GetAll(ownerID int32) ([]Project, error) {
+//
+// It returns the active projects of the active organization of the given
+// user that they can edit, see GetAllArchived for the archived ones and
+// GetAllReadOnly for the ones they can only see.
+func (s ProjectService) GetAll(ctx context.Context, userID int32) ([]Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetAll")
+	defer end()
+	var projects []Project
+	query := "select * from projects where id in (select project_id from workspace_projects where user_id = $1 and can_edit) and state = 'active' order by created_at desc"
+	err := s.db.SelectContext(ctx, &projects, query, userID)
+	if err != nil {
+		return []Project{}, err
+	}
+	return projects, nil
+}
+
+// GetAllReadOnly returns a slice of Project and returns an error from the
+// Select method.
+//
+// It returns the active projects of the active organization of the given
+// user that they can see but not edit, marked as shared.
+func (s ProjectService) GetAllReadOnly(ctx context.Context, userID int32) ([]Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetAllReadOnly")
+	defer end()
 	var projects []Project
-	query := "select * from projects where owner_id = $1 order by created_at desc"
-	err := s.db.Select(&projects, query, ownerID)
+	err := s.db.SelectContext(ctx, &projects, `
+		SELECT
+		    projects.*
+		FROM
+		    projects
+		    JOIN workspace_projects ON workspace_projects.project_id = projects.id
+		WHERE
+		    workspace_projects.user_id = $1
+		    AND NOT workspace_projects.can_edit
+		    AND projects.state = 'active'
+		ORDER BY
+		    projects.created_at DESC
+	`, userID)
 	if err != nil {
 		return []Project{}, err
 	}
+	for i := range projects {
+		projects[i].Shared = true
+	}
 	return projects, nil
 }
 
 // Update returns a Project and returns an error from the Get method.
 //
 // If successful, it updates the "projects" table row that matches the
-// given project id and owner id, with the given title and description.
-func (s ProjectService) Update(projectID int32, title string, description string, ownerID int32) (Project, error) {
+// given project id, if the given user can edit it in their active
+// organization, with the given title and description.
+func (s ProjectService) Update(ctx context.Context, projectID int32, title string, description string, userID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "Update")
+	defer end()
 	var project Project
-	err := s.db.Get(&project, "update projects set title = $1, description = $2 where id = $3 and owner_id = $4 returning *", title, description, projectID, ownerID)
+	err := s.db.GetContext(ctx, &project, "update projects set title = $1, description = $2 where id = $3 and id in (select project_id from workspace_projects where user_id = $4 and can_edit) returning *", title, description, projectID, userID)
 	if err != nil {
 		return Project{}, err
 	}
 	return project, nil
 }
 
+// GetAllArchived returns a slice of Project and returns an error from the
+// Select method.
+//
+// It returns the archived projects of the active organization of the given
+// user that they can edit.
+func (s ProjectService) GetAllArchived(ctx context.Context, userID int32) ([]Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetAllArchived")
+	defer end()
+	var projects []Project
+	query := "select * from projects where id in (select project_id from workspace_projects where user_id = $1 and can_edit) and state = 'archived' order by created_at desc"
+	err := s.db.SelectContext(ctx, &projects, query, userID)
+	if err != nil {
+		return []Project{}, err
+	}
+	return projects, nil
+}
+
+// SetState returns a Project and returns an error from the Get method.
+//
+// If successful, it updates the "state" column of the "projects" table row
+// that matches the given project id to the given state, if the given user
+// can edit it in their active organization.
+func (s ProjectService) SetState(ctx context.Context, projectID int32, userID int32, state ProjectState) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "SetState")
+	defer end()
+	var project Project
+	err := s.db.GetContext(ctx, &project, "update projects set state = $1 where id = $2 and id in (select project_id from workspace_projects where user_id = $3 and can_edit) returning *", state, projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+// GetAllDeletedWithUser returns a slice of Project and returns an error from
+// the Select method.
+//
+// It returns the projects the given user owns that are deleted along with
+// their account, which are the ones of organizations nobody else is a
+// member of, like their personal organization. The others are kept by their
+// organization, see UserService.DeleteWithTx.
+func (s ProjectService) GetAllDeletedWithUser(ctx context.Context, userID int32) ([]Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetAllDeletedWithUser")
+	defer end()
+	var projects []Project
+	err := s.db.SelectContext(ctx, &projects, `
+		SELECT
+		    *
+		FROM
+		    projects
+		WHERE
+		    owner_id = $1
+		    AND NOT EXISTS (
+		        SELECT
+		            1
+		        FROM
+		            organization_members
+		        WHERE
+		            organization_members.organization_id = projects.organization_id
+		            AND organization_members.user_id <> $1)
+		ORDER BY
+		    state,
+		    created_at DESC
+	`, userID)
+	if err != nil {
+		return []Project{}, err
+	}
+	return projects, nil
+}
+
+// IsArchived reports whether the project that matches the given id is
+// archived, and returns an error from the Get method. Tasks without a
+// project have an invalid id, which is never archived.
+func (s ProjectService) IsArchived(ctx context.Context, projectID pgtype.Int4) (bool, error) {
+	if !projectID.Valid {
+		return false, nil
+	}
+	ctx, end := startQuery(ctx, "ProjectService", "IsArchived")
+	defer end()
+	var archived bool
+	err := s.db.GetContext(ctx, &archived, "select state = 'archived' from projects where id = $1", projectID.Int32)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return archived, err
+}
+
+// OwnerSuspended reports whether the owner of the project with the given id
+// is suspended, and returns an error from the Get method.
+//
+// Projects of suspended users don't serve their public page and don't send
+// or receive webhooks, as their owner can't use the app.
+func (s ProjectService) OwnerSuspended(ctx context.Context, projectID int32) (bool, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "OwnerSuspended")
+	defer end()
+	var suspended bool
+	query := "select users.suspended_at is not null from projects join users on users.id = projects.owner_id where projects.id = $1"
+	err := s.db.GetContext(ctx, &suspended, query, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return suspended, err
+}
+
 // Delete returns an error from the Exec method.
 //
 // If successful, it delete the "projects" table row that matches the
-// given project id and owner id.
-func (s ProjectService) Delete(projectID int32, ownerID int32) error {
-	_, err := s.db.Exec("delete from projects where id = $1 and owner_id = $2", projectID, ownerID)
+// given project id, if the given user can edit it in their active
+// organization.
+func (s ProjectService) Delete(ctx context.Context, projectID int32, userID int32) error {
+	ctx, end := startQuery(ctx, "ProjectService", "Delete")
+	defer end()
+	_, err := s.db.ExecContext(ctx, "delete from projects where id = $1 and id in (select project_id from workspace_projects where user_id = $2 and can_edit)", projectID, userID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s ProjectService) Share(projectId int32, userId int32) (bool, error) {
-	_, err := s.db.Exec("insert into projects_users (project_id, user_id) values ($1, $2);", projectId, userId)
+func (s ProjectService) Revoke(ctx context.Context, projectId int32, userId int32) error {
+	ctx, end := startQuery(ctx, "ProjectService", "Revoke")
+	defer end()
+	_, err := s.db.ExecContext(ctx, "delete from projects_users where project_id = $1 and user_id = $2;", projectId, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateWithTx returns a Project and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "projects" table with the
+// given data, inside the active organization of the given owner and the
+// given transaction.
+func (s ProjectService) CreateWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	title string,
+	description string,
+	published bool,
+	ownerID int32,
+) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "CreateWithTx")
+	defer end()
+	var project Project
+	query := `
+		INSERT INTO projects (title, description, published, owner_id, organization_id)
+		SELECT
+		    $1,
+		    $2,
+		    $3,
+		    $4,
+		    organization_id
+		FROM
+		    active_organizations
+		WHERE
+		    user_id = $4
+		RETURNING
+		    *
+	`
+	err := tx.GetContext(ctx, &project, query, title, description, published, ownerID)
+	if err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+// ShareWithTx reports whether the project was already shared with the user,
+// and returns an error from the Exec method.
+//
+// If successful, it inserts a new row into the "projects_users" table inside
+// the given transaction, unless the project is already shared with the user.
+func (s ProjectService) ShareWithTx(ctx context.Context, tx *sqlx.Tx, projectID int32, userID int32) (bool, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "ShareWithTx")
+	defer end()
+	result, err := tx.ExecContext(ctx, "insert into projects_users (project_id, user_id) values ($1, $2) on conflict do nothing", projectID, userID)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return true, nil
-		}
 		return false, err
 	}
-	return false, nil
+	n, err := result.RowsAffected()
+	return n == 0, err
 }
 
-func (s ProjectService) Revoke(projectId int32, userId int32) error {
-	_, err := s.db.Exec("delete from projects_users where project_id = $1 and user_id = $2;", projectId, userId)
+// TransferWithTx returns a Project and returns the first encountered error.
+//
+// If successful, it makes the user with the given to id the owner of the
+// project with the given id, and moves it to their active organization,
+// inside the given transaction, as long as it's still owned by the user with
+// the given from id. sql.ErrNoRows is returned otherwise.
+//
+// The previous owner is shared the project when keepAccess is true, and
+// their tasks of the project that aren't done are given to the new owner
+// when reassignTasks is true. Pending transfers of the project are deleted.
+func (s ProjectService) TransferWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	projectID int32,
+	fromUserID int32,
+	toUserID int32,
+	reassignTasks bool,
+	keepAccess bool,
+) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "TransferWithTx")
+	defer end()
+	var project Project
+	err := tx.GetContext(ctx, &project, `
+		UPDATE
+		    projects
+		SET
+		    owner_id = $1,
+		    organization_id = active_organizations.organization_id,
+		    updated_at = now()
+		FROM
+		    active_organizations
+		WHERE
+		    projects.id = $2
+		    AND projects.owner_id = $3
+		    AND active_organizations.user_id = $1
+		RETURNING
+		    projects.*
+	`, toUserID, projectID, fromUserID)
 	if err != nil {
-		return err
+		return Project{}, err
 	}
-	return nil
+	if keepAccess {
+		_, err = s.ShareWithTx(ctx, tx, projectID, fromUserID)
+		if err != nil {
+			return Project{}, err
+		}
+	}
+	// owners don't need to be shared their own project
+	_, err = tx.ExecContext(ctx, "DELETE FROM projects_users WHERE project_id = $1 AND user_id = $2", projectID, toUserID)
+	if err != nil {
+		return Project{}, err
+	}
+	if reassignTasks {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE
+			    tasks
+			SET
+			    owner_id = $1,
+			    updated_at = now()
+			WHERE
+			    project_id = $2
+			    AND owner_id = $3
+			    AND status != 'done'
+		`, toUserID, projectID, fromUserID)
+		if err != nil {
+			return Project{}, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM project_transfers WHERE project_id = $1", projectID)
+	if err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+// GetAllTemplates returns a slice of Project and returns an error from the
+// Select method.
+//
+// It returns the active templates of the active organization of the given
+// user that they can see, by title.
+func (s ProjectService) GetAllTemplates(ctx context.Context, userID int32) ([]Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "GetAllTemplates")
+	defer end()
+	var projects []Project
+	query := "select * from projects where id in (select project_id from workspace_projects where user_id = $1) and is_template and state = 'active' order by title, id"
+	err := s.db.SelectContext(ctx, &projects, query, userID)
+	if err != nil {
+		return []Project{}, err
+	}
+	return projects, nil
+}
+
+// Copy returns a Project and returns an error from the Get, Select or Exec
+// methods.
+//
+// If successful, it copies the project that matches the given project id,
+// which the given owner can see in their active organization, into a new
+// unpublished project, or template, of that organization with the given
+// title and description, inside a single transaction. An empty description
+// keeps the one of the copied project.
+//
+// The milestones and tasks of the project are copied along, with tasks kept
+// in their milestones. Copied tasks are to do again, and attachments, time
+// entries and shares aren't copied.
+//
+// If the given start date is valid, dates are shifted so that the earliest
+// due date or milestone target date of the project falls on it, keeping the
+// days between them. Otherwise dates are copied as they are.
+func (s ProjectService) Copy(
+	ctx context.Context,
+	projectID int32,
+	ownerID int32,
+	title string,
+	description string,
+	template bool,
+	startDate pgtype.Date,
+) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectService", "Copy")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+	var source Project
+	// lock the project, so that it isn't deleted while it's copied
+	err = tx.GetContext(ctx, &source, "select * from projects where id = $1 and id in (select project_id from workspace_projects where user_id = $2) for share", projectID, ownerID)
+	if err != nil {
+		return Project{}, err
+	}
+	var milestones []Milestone
+	err = tx.SelectContext(ctx, &milestones, "select * from milestones where project_id = $1 order by id", source.ID)
+	if err != nil {
+		return Project{}, err
+	}
+	var tasks []Task
+	err = tx.SelectContext(ctx, &tasks, "select * from tasks where project_id = $1 order by id", source.ID)
+	if err != nil {
+		return Project{}, err
+	}
+	shift := 0
+	if startDate.Valid {
+		shift = daysBetween(earliestDate(milestones, tasks), startDate)
+	}
+	if description == "" {
+		description = source.Description.String
+	}
+	var project Project
+	err = tx.GetContext(ctx, &project, `
+		INSERT INTO projects (title, description, owner_id, organization_id, is_template)
+		SELECT
+		    $1,
+		    $2,
+		    $3,
+		    organization_id,
+		    $4
+		FROM
+		    active_organizations
+		WHERE
+		    user_id = $3
+		RETURNING
+		    *
+	`, title, description, ownerID, template)
+	if err != nil {
+		return Project{}, err
+	}
+	// ids of the copied milestones by the ids of their originals
+	copies := map[int32]int32{}
+	for _, m := range milestones {
+		var id int32
+		err = tx.GetContext(ctx, &id, `
+			INSERT INTO milestones (project_id, name, description, target_date)
+			    VALUES ($1, $2, $3, $4)
+			RETURNING
+			    id
+		`, project.ID, m.Name, m.Description, shiftDate(m.TargetDate, shift))
+		if err != nil {
+			return Project{}, err
+		}
+		copies[m.ID] = id
+	}
+	for _, t := range tasks {
+		milestoneID := pgtype.Int4{}
+		if t.MilestoneID.Valid {
+			milestoneID = pgtype.Int4{Int32: copies[t.MilestoneID.Int32], Valid: true}
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tasks (title, description, due_date, owner_id, project_id, recurrence, milestone_id)
+			    VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, t.Title, t.Description, shiftDate(t.DueDate, shift), ownerID, project.ID, t.Recurrence, milestoneID)
+		if err != nil {
+			return Project{}, err
+		}
+	}
+	return project, tx.Commit()
+}
+
+// earliestDate returns the earliest target date of the given milestones
+// and due date of the given tasks, which is invalid if none of them has a
+// date.
+func earliestDate(milestones []Milestone, tasks []Task) pgtype.Date {
+	earliest := pgtype.Date{}
+	consider := func(d pgtype.Date) {
+		if d.Valid && (!earliest.Valid || d.Time.Before(earliest.Time)) {
+			earliest = d
+		}
+	}
+	for _, m := range milestones {
+		consider(m.TargetDate)
+	}
+	for _, t := range tasks {
+		consider(t.DueDate)
+	}
+	return earliest
+}
+
+// daysBetween returns the number of days from the given date to the other,
+// or zero if either is invalid.
+func daysBetween(from pgtype.Date, to pgtype.Date) int {
+	if !from.Valid || !to.Valid {
+		return 0
+	}
+	return int(to.Time.Sub(from.Time).Hours() / 24)
+}
+
+// shiftDate returns the given date moved by the given number of days.
+func shiftDate(d pgtype.Date, days int) pgtype.Date {
+	if !d.Valid {
+		return d
+	}
+	return pgtype.Date{Time: d.Time.AddDate(0, 0, days), Valid: true}
 }
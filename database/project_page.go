@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A ProjectPage is the public, read-only page of a project, which anyone
+// with its token can see without logging in while the page is enabled and
+// the project is published.
+//
+// table: "project_pages"
+type ProjectPage struct {
+	// ProjectID is the primary key, and a foreign key to the "projects"
+	// table.
+	ProjectID int32 `db:"project_id"`
+	// Token is the secret part of the url of the page.
+	Token string `db:"token"`
+	// Enabled reports whether the owner made the page available.
+	Enabled bool `db:"enabled"`
+	// ShowDescription, ShowStatus, ShowDueDates and ShowTaskDescriptions
+	// report which fields the owner chose to expose. Task titles are always
+	// shown.
+	ShowDescription      bool `db:"show_description"`
+	ShowStatus           bool `db:"show_status"`
+	ShowDueDates         bool `db:"show_due_dates"`
+	ShowTaskDescriptions bool `db:"show_task_descriptions"`
+	// Views counts the times the page was seen, and LastViewedAt tracks the
+	// last one.
+	Views        int32            `db:"views"`
+	LastViewedAt pgtype.Timestamp `db:"last_viewed_at"`
+	CreatedAt    pgtype.Timestamp `db:"created_at"`
+}
+
+// ProjectPageSettings are the choices of the owner of a project about its
+// public page.
+type ProjectPageSettings struct {
+	Enabled              bool
+	ShowDescription      bool
+	ShowStatus           bool
+	ShowDueDates         bool
+	ShowTaskDescriptions bool
+}
+
+// A ProjectPageService is a connection to the database with methods
+// for interacting with the "project_pages" table.
+type ProjectPageService struct {
+	db *sqlx.DB
+}
+
+// NewProjectPageService returns a pointer to ProjectPageService.
+func NewProjectPageService(db *sqlx.DB) *ProjectPageService {
+	return &ProjectPageService{
+		db: db,
+	}
+}
+
+// Get returns a ProjectPage, reports whether the project with the given id
+// has a page, and returns an error from the Get method.
+func (s *ProjectPageService) Get(ctx context.Context, projectID int32) (ProjectPage, bool, error) {
+	ctx, end := startQuery(ctx, "ProjectPageService", "Get")
+	defer end()
+	var page ProjectPage
+	err := s.db.GetContext(ctx, &page, "select * from project_pages where project_id = $1", projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ProjectPage{}, false, nil
+	}
+	if err != nil {
+		return ProjectPage{}, false, err
+	}
+	return page, true, nil
+}
+
+// Save returns a ProjectPage and returns an error from the Get method.
+//
+// If successful, it updates the settings of the page of the project with the
+// given id, or inserts it with the given token if the project doesn't have
+// one yet. The token of an existing page is kept.
+func (s *ProjectPageService) Save(ctx context.Context, projectID int32, token string, settings ProjectPageSettings) (ProjectPage, error) {
+	ctx, end := startQuery(ctx, "ProjectPageService", "Save")
+	defer end()
+	var page ProjectPage
+	err := s.db.GetContext(ctx, &page, `
+		INSERT INTO project_pages (project_id, token, enabled, show_description, show_status, show_due_dates, show_task_descriptions)
+		    VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (project_id)
+		    DO UPDATE SET
+		        enabled = excluded.enabled,
+		        show_description = excluded.show_description,
+		        show_status = excluded.show_status,
+		        show_due_dates = excluded.show_due_dates,
+		        show_task_descriptions = excluded.show_task_descriptions
+		    RETURNING
+		        *
+	`, projectID, token, settings.Enabled, settings.ShowDescription, settings.ShowStatus, settings.ShowDueDates, settings.ShowTaskDescriptions)
+	return page, err
+}
+
+// SetToken returns a ProjectPage and returns an error from the Get method.
+//
+// If successful, it replaces the token of the page of the project with the
+// given id, so that previously shared urls stop working, and resets its
+// view count.
+func (s *ProjectPageService) SetToken(ctx context.Context, projectID int32, token string) (ProjectPage, error) {
+	ctx, end := startQuery(ctx, "ProjectPageService", "SetToken")
+	defer end()
+	var page ProjectPage
+	err := s.db.GetContext(ctx, &page, `
+		UPDATE
+		    project_pages
+		SET
+		    token = $1,
+		    views = 0,
+		    last_viewed_at = NULL
+		WHERE
+		    project_id = $2
+		RETURNING
+		    *
+	`, token, projectID)
+	return page, err
+}
+
+// View returns a ProjectPage with its Project, reports whether the page
+// with the given token can be seen, and returns an error from the Get
+// method.
+//
+// A page can be seen while it's enabled and its project is published, isn't
+// a template and its owner isn't suspended. If it can, its view count is
+// increased.
+func (s *ProjectPageService) View(ctx context.Context, token string) (ProjectPage, Project, bool, error) {
+	ctx, end := startQuery(ctx, "ProjectPageService", "View")
+	defer end()
+	var page ProjectPage
+	err := s.db.GetContext(ctx, &page, `
+		UPDATE
+		    project_pages
+		SET
+		    views = views + 1,
+		    last_viewed_at = now()
+		FROM
+		    projects
+		    JOIN users ON users.id = projects.owner_id
+		WHERE
+		    project_pages.token = $1
+		    AND project_pages.enabled
+		    AND projects.id = project_pages.project_id
+		    AND projects.published
+		    AND NOT projects.is_template
+		    AND users.suspended_at IS NULL
+		RETURNING
+		    project_pages.*
+	`, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ProjectPage{}, Project{}, false, nil
+	}
+	if err != nil {
+		return ProjectPage{}, Project{}, false, err
+	}
+	var project Project
+	err = s.db.GetContext(ctx, &project, "select * from projects where id = $1", page.ProjectID)
+	if err != nil {
+		return ProjectPage{}, Project{}, false, err
+	}
+	return page, project, true, nil
+}
+
+// GetTasks returns a slice of Task and returns an error from the Select
+// method.
+//
+// It returns all of the tasks of the project with the given id, whoever
+// they belong to, by due date and then by id, for its public page.
+func (s *ProjectPageService) GetTasks(ctx context.Context, projectID int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "ProjectPageService", "GetTasks")
+	defer end()
+	var tasks []Task
+	err := s.db.SelectContext(ctx, &tasks, `
+		SELECT
+		    *
+		FROM
+		    tasks
+		WHERE
+		    project_id = $1
+		ORDER BY
+		    due_date NULLS LAST,
+		    id
+	`, projectID)
+	return tasks, err
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A ProjectTransfer is a request of the owner of a project to make another
+// user its owner, which takes effect once that user accepts it.
+//
+// Projects have at most one pending transfer, and accepted or declined
+// transfers are deleted.
+//
+// table: "project_transfers"
+type ProjectTransfer struct {
+	ID         int32 `db:"id"`
+	ProjectID  int32 `db:"project_id"`
+	FromUserID int32 `db:"from_user_id"`
+	ToUserID   int32 `db:"to_user_id"`
+	// ReassignTasks reports whether the tasks of the project the current
+	// owner has, and that aren't done, are given to the new owner.
+	ReassignTasks bool `db:"reassign_tasks"`
+	// KeepAccess reports whether the current owner is shared the project
+	// once it's transferred.
+	KeepAccess bool             `db:"keep_access"`
+	CreatedAt  pgtype.Timestamp `db:"created_at"`
+	// ProjectTitle, FromEmail, FromName, ToEmail and ToName are joined from
+	// the "projects" and "users" tables, and don't map to any column inside
+	// the "project_transfers" table. Names fall back to email addresses.
+	ProjectTitle string `db:"project_title"`
+	FromEmail    string `db:"from_email"`
+	FromName     string `db:"from_name"`
+	ToEmail      string `db:"to_email"`
+	ToName       string `db:"to_name"`
+}
+
+// A ProjectTransferService is a connection to the database with methods
+// for interacting with the "project_transfers" table.
+type ProjectTransferService struct {
+	db *sqlx.DB
+}
+
+// NewProjectTransferService returns a pointer to ProjectTransferService.
+func NewProjectTransferService(db *sqlx.DB) *ProjectTransferService {
+	return &ProjectTransferService{
+		db: db,
+	}
+}
+
+// projectTransferQuery selects the columns of ProjectTransfer, to be
+// followed by the rest of the query.
+const projectTransferQuery = `
+	SELECT
+	    project_transfers.*,
+	    projects.title AS project_title,
+	    from_users.email AS from_email,
+	    coalesce(nullif(from_users.name, ''), from_users.email) AS from_name,
+	    to_users.email AS to_email,
+	    coalesce(nullif(to_users.name, ''), to_users.email) AS to_name
+	FROM
+	    project_transfers
+	    JOIN projects ON projects.id = project_transfers.project_id
+	    JOIN users from_users ON from_users.id = project_transfers.from_user_id
+	    JOIN users to_users ON to_users.id = project_transfers.to_user_id
+`
+
+// Create returns a ProjectTransfer and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "project_transfers" table
+// with the given data, replacing the pending transfer of the project if
+// there's one.
+func (s *ProjectTransferService) Create(
+	ctx context.Context,
+	projectID int32,
+	fromUserID int32,
+	toUserID int32,
+	reassignTasks bool,
+	keepAccess bool,
+) (ProjectTransfer, error) {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "Create")
+	defer end()
+	var id int32
+	err := s.db.GetContext(ctx, &id, `
+		INSERT INTO project_transfers (project_id, from_user_id, to_user_id, reassign_tasks, keep_access)
+		    VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (project_id)
+		    DO UPDATE SET
+		        from_user_id = excluded.from_user_id, to_user_id = excluded.to_user_id, reassign_tasks = excluded.reassign_tasks, keep_access = excluded.keep_access, created_at = now()
+		    RETURNING
+		        id
+	`, projectID, fromUserID, toUserID, reassignTasks, keepAccess)
+	if err != nil {
+		return ProjectTransfer{}, err
+	}
+	var transfer ProjectTransfer
+	err = s.db.GetContext(ctx, &transfer, projectTransferQuery+"WHERE project_transfers.id = $1", id)
+	return transfer, err
+}
+
+// GetByProject returns a ProjectTransfer, reports whether the project with
+// the given id has a pending transfer, and returns an error from the Get
+// method.
+func (s *ProjectTransferService) GetByProject(ctx context.Context, projectID int32) (ProjectTransfer, bool, error) {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "GetByProject")
+	defer end()
+	var transfer ProjectTransfer
+	err := s.db.GetContext(ctx, &transfer, projectTransferQuery+"WHERE project_transfers.project_id = $1", projectID)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			return ProjectTransfer{}, false, err
+		}
+		return transfer, true, nil
+	}
+	return ProjectTransfer{}, false, nil
+}
+
+// GetAllIncoming returns a slice of ProjectTransfer and returns an error
+// from the Select method.
+//
+// It returns the pending transfers to the user with the given id, oldest
+// first.
+func (s *ProjectTransferService) GetAllIncoming(ctx context.Context, userID int32) ([]ProjectTransfer, error) {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "GetAllIncoming")
+	defer end()
+	var transfers []ProjectTransfer
+	err := s.db.SelectContext(ctx, &transfers, projectTransferQuery+`
+		WHERE
+		    project_transfers.to_user_id = $1
+		ORDER BY
+		    project_transfers.created_at,
+		    project_transfers.id
+	`, userID)
+	if err != nil {
+		return []ProjectTransfer{}, err
+	}
+	return transfers, nil
+}
+
+// Cancel returns an error from the Get method.
+//
+// If successful, it deletes the pending transfer of the project with the
+// given id, which the user with the given id asked for. It returns
+// sql.ErrNoRows if no row was deleted.
+func (s *ProjectTransferService) Cancel(ctx context.Context, projectID int32, fromUserID int32) error {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "Cancel")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		DELETE FROM project_transfers
+		WHERE project_id = $1
+		    AND from_user_id = $2
+		RETURNING
+		    id
+	`, projectID, fromUserID)
+}
+
+// Decline returns an error from the Get method.
+//
+// If successful, it deletes the pending transfer with the given id to the
+// user with the given id. It returns sql.ErrNoRows if no row was deleted.
+func (s *ProjectTransferService) Decline(ctx context.Context, id int32, toUserID int32) error {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "Decline")
+	defer end()
+	var deleted int32
+	return s.db.GetContext(ctx, &deleted, `
+		DELETE FROM project_transfers
+		WHERE id = $1
+		    AND to_user_id = $2
+		RETURNING
+		    id
+	`, id, toUserID)
+}
+
+// Accept returns a Project and returns the first encountered error.
+//
+// If successful, it makes the user with the given id the owner of the
+// project of the pending transfer with the given id to them, as asked for
+// by its current owner, inside one transaction.
+//
+// sql.ErrNoRows is returned if the transfer doesn't exist, or if the
+// project changed owners since it was asked for, in which case the transfer
+// is deleted too.
+func (s *ProjectTransferService) Accept(ctx context.Context, id int32, toUserID int32) (Project, error) {
+	ctx, end := startQuery(ctx, "ProjectTransferService", "Accept")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+	var transfer ProjectTransfer
+	err = tx.GetContext(ctx, &transfer, `
+		DELETE FROM project_transfers
+		WHERE id = $1
+		    AND to_user_id = $2
+		RETURNING
+		    *
+	`, id, toUserID)
+	if err != nil {
+		return Project{}, err
+	}
+	project, err := NewProjectService(s.db).TransferWithTx(
+		ctx,
+		tx,
+		transfer.ProjectID,
+		transfer.FromUserID,
+		transfer.ToUserID,
+		transfer.ReassignTasks,
+		transfer.KeepAccess,
+	)
+	if err == sql.ErrNoRows {
+		// keep the stale transfer deleted
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			return Project{}, commitErr
+		}
+		return Project{}, err
+	}
+	if err != nil {
+		return Project{}, err
+	}
+	return project, tx.Commit()
+}
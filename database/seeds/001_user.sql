@@ -1,15 +1,30 @@
-INSERT INTO users ("id", "name", "email", "avatar")
-    VALUES (1, 'Web Dev Fuel', 'hello@webdevfuel.com', '');
+INSERT INTO users ("id", "name", "email", "gh_access_token", "gh_user_id", "gh_scopes")
+    VALUES (1, 'Web Dev Fuel', 'hello@webdevfuel.com', 'REDACTED', 1, 'read:user,repo,user:email');
 
 --> statement-breakpoint
-INSERT INTO accounts ("id", "user_id", "access_token")
-    VALUES (1, 1, 'REDACTED');
+INSERT INTO users ("id", "name", "email", "gh_access_token", "gh_user_id", "gh_scopes")
+    VALUES (2, 'John Doe', 'johndoe@gmail.com', 'REDACTED', 2, 'read:user,user:email');
 
 --> statement-breakpoint
-INSERT INTO users ("id", "name", "email", "avatar")
-    VALUES (2, 'John Doe', 'johndoe@gmail.com', '');
+SELECT setval('users_id_seq', (SELECT max(id) FROM users));
 
 --> statement-breakpoint
-INSERT INTO accounts ("id", "user_id", "access_token")
-    VALUES (2, 2, 'REDACTED');
+INSERT INTO organizations ("id", "name", "personal_user_id")
+    VALUES (1, 'Personal', 1), (2, 'Personal', 2);
 
+--> statement-breakpoint
+SELECT setval('organizations_id_seq', (SELECT max(id) FROM organizations));
+
+--> statement-breakpoint
+INSERT INTO organization_members ("organization_id", "user_id", "role")
+    VALUES (1, 1, 'owner'), (2, 2, 'owner');
+
+--> statement-breakpoint
+UPDATE
+    users
+SET
+    active_organization_id = organizations.id
+FROM
+    organizations
+WHERE
+    organizations.personal_user_id = users.id;
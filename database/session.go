@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/jackc/pgx/v5/pgtype"
@@ -25,10 +26,12 @@ func NewSessionService(db *sqlx.DB) *SessionService {
 	}
 }
 
-func (ss SessionService) GetSessionByToken(token string) (Session, bool, error) {
+func (ss SessionService) GetSessionByToken(ctx context.Context, token string) (Session, bool, error) {
+	ctx, end := startQuery(ctx, "SessionService", "GetSessionByToken")
+	defer end()
 	var session Session
 	query := "select * from sessions where token = $1"
-	err := ss.db.Get(&session, query, token)
+	err := ss.db.GetContext(ctx, &session, query, token)
 	if err != sql.ErrNoRows {
 		if err != nil {
 			return Session{}, false, err
@@ -39,12 +42,16 @@ func (ss SessionService) GetSessionByToken(token string) (Session, bool, error)
 }
 
 func (ss SessionService) CreateToken(
+	ctx context.Context,
 	tx *sqlx.Tx,
 	userId int32,
 	token string,
 	userAgent string,
 ) error {
-	_, err := tx.Exec(
+	ctx, end := startQuery(ctx, "SessionService", "CreateToken")
+	defer end()
+	_, err := tx.ExecContext(
+		ctx,
 		"insert into sessions (user_id, token, user_agent) values ($1, $2, $3);",
 		userId,
 		token,
@@ -56,8 +63,11 @@ func (ss SessionService) CreateToken(
 	return nil
 }
 
-func (ss SessionService) DeleteToken(token string) error {
-	_, err := ss.db.Exec(
+func (ss SessionService) DeleteToken(ctx context.Context, token string) error {
+	ctx, end := startQuery(ctx, "SessionService", "DeleteToken")
+	defer end()
+	_, err := ss.db.ExecContext(
+		ctx,
 		"delete from sessions where token = $1;",
 		token,
 	)
@@ -67,8 +77,11 @@ func (ss SessionService) DeleteToken(token string) error {
 	return nil
 }
 
-func (ss SessionService) DeleteAllTokens(userId int32, token string) error {
-	_, err := ss.db.Exec(
+func (ss SessionService) DeleteAllTokens(ctx context.Context, userId int32, token string) error {
+	ctx, end := startQuery(ctx, "SessionService", "DeleteAllTokens")
+	defer end()
+	_, err := ss.db.ExecContext(
+		ctx,
 		"delete from sessions where id in (select sessions.id from sessions left join users on users.id = sessions.user_id where users.id = $1 and sessions.token != $2);",
 		userId,
 		token,
@@ -79,9 +92,12 @@ func (ss SessionService) DeleteAllTokens(userId int32, token string) error {
 	return nil
 }
 
-func (ss SessionService) GetAllSessions(userId int32) ([]Session, error) {
+func (ss SessionService) GetAllSessions(ctx context.Context, userId int32) ([]Session, error) {
+	ctx, end := startQuery(ctx, "SessionService", "GetAllSessions")
+	defer end()
 	var sessions []Session
-	err := ss.db.Select(
+	err := ss.db.SelectContext(
+		ctx,
 		&sessions,
 		"select sessions.* from sessions left join users on users.id = sessions.user_id where users.id = $1;",
 		userId,
@@ -91,3 +107,25 @@ func (ss SessionService) GetAllSessions(userId int32) ([]Session, error) {
 	}
 	return sessions, nil
 }
+
+// DeleteAllUserTokens returns an error from the Exec method.
+//
+// If successful, it deletes every session of the user with the given id,
+// logging them out everywhere, e.g. when they're suspended.
+func (ss SessionService) DeleteAllUserTokens(ctx context.Context, tx *sqlx.Tx, userID int32) error {
+	ctx, end := startQuery(ctx, "SessionService", "DeleteAllUserTokens")
+	defer end()
+	_, err := tx.ExecContext(ctx, "delete from sessions where user_id = $1;", userID)
+	return err
+}
+
+// DeleteByID returns an error from the Get method.
+//
+// If successful, it deletes the session with the given id, of any user.
+// sql.ErrNoRows is returned if it doesn't exist.
+func (ss SessionService) DeleteByID(ctx context.Context, id int32) error {
+	ctx, end := startQuery(ctx, "SessionService", "DeleteByID")
+	defer end()
+	var deleted int32
+	return ss.db.GetContext(ctx, &deleted, "delete from sessions where id = $1 returning id;", id)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jmoiron/sqlx"
 )
@@ -15,10 +16,46 @@ type Task struct {
 	Description pgtype.Text      `db:"description"`
 	OwnerID     int32            `db:"owner_id"`
 	ProjectID   pgtype.Int4      `db:"project_id"`
+	Status      TaskStatus       `db:"status"`
+	DueDate     pgtype.Date      `db:"due_date"`
 	CreatedAt   pgtype.Timestamp `db:"created_at"`
 	UpdatedAt   pgtype.Timestamp `db:"updated_at"`
+	// Recurrence is the rule, as parsed by the recurrence package, after
+	// which the next occurrence of the task is created.
+	Recurrence pgtype.Text `db:"recurrence"`
+	// RecurredAt is when the next occurrence was created, which happens
+	// once per task.
+	RecurredAt pgtype.Timestamp `db:"recurred_at"`
+	// MilestoneID is the milestone of the project the task belongs to, if
+	// any.
+	MilestoneID pgtype.Int4 `db:"milestone_id"`
 }
 
+// A TaskStatus is the state of a task, stored in the "status" column
+// of the "tasks" table.
+type TaskStatus string
+
+const (
+	TaskStatusTodo       TaskStatus = "todo"
+	TaskStatusInProgress TaskStatus = "in_progress"
+	TaskStatusDone       TaskStatus = "done"
+)
+
+// Label returns the status as it's displayed to users, e.g. "In progress".
+func (s TaskStatus) Label() string {
+	switch s {
+	case TaskStatusInProgress:
+		return "In progress"
+	case TaskStatusDone:
+		return "Done"
+	}
+	return "To do"
+}
+
+// TaskStatuses is a slice of all valid TaskStatus values, in the order
+// they're usually displayed.
+var TaskStatuses = []TaskStatus{TaskStatusTodo, TaskStatusInProgress, TaskStatusDone}
+
 // A TaskService is a connection to the database with methods
 // for interacting with the "tasks" table.
 type TaskService struct {
@@ -32,29 +69,69 @@ func NewTaskService(db *sqlx.DB) *TaskService {
 	}
 }
 
-// Create returns a Task and returns an error from the Get method.
+// CreateWithTx returns a Task and returns an error from the Get method.
 //
-// If successful, it inserts a new row into the "tasks" table with the given data.
-func (s *TaskService) Create(title string, description string, projectID pgtype.Int4, ownerID int32) error {
+// If successful, it inserts a new row into the "tasks" table with the given data,
+// inside the given transaction, as long as the given owner can edit the given
+// project in their active organization, if there's one. It returns
+// sql.ErrNoRows otherwise.
+func (s *TaskService) CreateWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	title string,
+	description string,
+	dueDate pgtype.Date,
+	projectID pgtype.Int4,
+	ownerID int32,
+) (Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "CreateWithTx")
+	defer end()
 	var task Task
-	return s.db.Get(&task, `
-		INSERT INTO tasks (title, description, owner_id, project_id)
-		    VALUES ($1, $2, $3, $4)
+	err := tx.GetContext(ctx, &task, `
+		INSERT INTO tasks (title, description, due_date, owner_id, project_id)
+		SELECT
+		    $1,
+		    $2,
+		    $3,
+		    $4,
+		    $5
+		WHERE
+		    $5::integer IS NULL
+		    OR $5 IN (
+		        SELECT
+		            project_id
+		        FROM
+		            workspace_projects
+		        WHERE
+		            user_id = $4
+		            AND can_edit)
 		RETURNING
 		    *
-	`, title, description, ownerID, projectID)
+	`, title, description, dueDate, ownerID, projectID)
+	return task, err
 }
 
 // GetAll returns a slice of Task and returns an error from the Select method.
-func (s *TaskService) GetAll(ownerID int32) ([]Task, error) {
+//
+// It returns the tasks the given user owns in their active organization.
+func (s *TaskService) GetAll(ctx context.Context, ownerID int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAll")
+	defer end()
 	var tasks []Task
-	err := s.db.Select(&tasks, `
+	err := s.db.SelectContext(ctx, &tasks, `
 		SELECT
 		    *
 		FROM
 		    tasks
 		WHERE
 		    owner_id = $1
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $1)
 	`, ownerID)
 	return tasks, err
 }
@@ -62,9 +139,11 @@ func (s *TaskService) GetAll(ownerID int32) ([]Task, error) {
 // GetAll returns a slice of Task and returns an error from the Select method.
 //
 // It filters the query by the given project id.
-func (s *TaskService) GetAllByProjectID(ownerID int32, projectID int32) ([]Task, error) {
+func (s *TaskService) GetAllByProjectID(ctx context.Context, ownerID int32, projectID int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAllByProjectID")
+	defer end()
 	var tasks []Task
-	err := s.db.Select(&tasks, `
+	err := s.db.SelectContext(ctx, &tasks, `
 		SELECT
 		    *
 		FROM
@@ -72,14 +151,73 @@ func (s *TaskService) GetAllByProjectID(ownerID int32, projectID int32) ([]Task,
 		WHERE
 		    owner_id = $1
 		    AND project_id = $2
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $1)
 	`, ownerID, projectID)
 	return tasks, err
 }
 
+// A TaskFilter narrows down the tasks returned by GetAllByFilter. Its zero
+// value doesn't filter anything.
+type TaskFilter struct {
+	// ProjectID keeps the tasks of the given project.
+	ProjectID pgtype.Int4
+	// Status keeps the tasks with the given status.
+	Status TaskStatus
+	// DueBefore keeps the tasks due on or before the given date.
+	DueBefore pgtype.Date
+}
+
+// GetAllByFilter returns a slice of Task and returns an error from the
+// Select method.
+//
+// It returns the tasks the given user owns in their active organization that
+// match the given filter, oldest first.
+func (s *TaskService) GetAllByFilter(ctx context.Context, ownerID int32, filter TaskFilter) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAllByFilter")
+	defer end()
+	var tasks []Task
+	err := s.db.SelectContext(ctx, &tasks, `
+		SELECT
+		    *
+		FROM
+		    tasks
+		WHERE
+		    owner_id = $1
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $1)
+		    AND ($2::integer IS NULL
+		        OR project_id = $2)
+		    AND ($3::text = ''
+		        OR status = $3)
+		    AND ($4::date IS NULL
+		        OR due_date <= $4)
+		ORDER BY
+		    created_at,
+		    id
+	`, ownerID, filter.ProjectID, string(filter.Status), filter.DueBefore)
+	return tasks, err
+}
+
 // Get returns a Task and returns an error from the Get method.
-func (s *TaskService) Get(taskID int32, ownerID int32) (Task, error) {
+//
+// It only returns the task if the given user owns it in their active
+// organization.
+func (s *TaskService) Get(ctx context.Context, taskID int32, ownerID int32) (Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "Get")
+	defer end()
 	var task Task
-	err := s.db.Get(&task, `
+	err := s.db.GetContext(ctx, &task, `
 		SELECT
 		    *
 		FROM
@@ -87,24 +225,374 @@ func (s *TaskService) Get(taskID int32, ownerID int32) (Task, error) {
 		WHERE
 		    id = $1
 		    AND owner_id = $2
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $2)
 	`, taskID, ownerID)
 	return task, err
 }
 
-// Update returns a Task and returns an error from the Get method.
+// UpdateWithTx returns a Task and returns an error from the Get method.
 //
-// If successful, it updates the "tasks" table row that matches the
-// given task id and owner id, with the given title and description.
-func (s *TaskService) Update(taskID int32, ownerID int32, title string, description string) error {
-	_, err := s.db.Exec(`
+// If successful, it updates the "tasks" table row that matches the given
+// task id and owner id in their active organization, with the given title,
+// description, due date, status, recurrence rule and milestone, inside the
+// given transaction, and returns the updated row.
+//
+// The milestone is only set if it belongs to the project of the task, and
+// is cleared otherwise.
+func (s *TaskService) UpdateWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	taskID int32,
+	ownerID int32,
+	title string,
+	description string,
+	dueDate pgtype.Date,
+	status TaskStatus,
+	recurrence pgtype.Text,
+	milestoneID pgtype.Int4,
+) (Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "UpdateWithTx")
+	defer end()
+	var task Task
+	err := tx.GetContext(ctx, &task, `
 		UPDATE
 		    tasks
 		SET
 		    title = $3,
-		    description = $4
+		    description = $4,
+		    due_date = $5,
+		    status = $6,
+		    recurrence = $7,
+		    milestone_id = (
+		        SELECT
+		            milestones.id
+		        FROM
+		            milestones
+		        WHERE
+		            milestones.id = $8
+		            AND milestones.project_id = tasks.project_id)
+		WHERE
+		    id = $1
+		    AND owner_id = $2
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $2)
+		RETURNING
+		    *
+	`, taskID, ownerID, title, description, dueDate, status, recurrence, milestoneID)
+	return task, err
+}
+
+// GetAllDue returns a slice of Task and returns an error from the Select method.
+//
+// It returns the tasks with a due date that the given user can see, which are
+// the tasks they own and the tasks of projects they can edit in any of their
+// organizations, and the tasks of published projects shared with them. Unlike
+// most queries, it doesn't depend on their active organization, since
+// calendar applications fetch the feed on their own.
+func (s *TaskService) GetAllDue(ctx context.Context, userID int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAllDue")
+	defer end()
+	var tasks []Task
+	err := s.db.SelectContext(ctx, &tasks, `
+		SELECT
+		    tasks.*
+		FROM
+		    tasks
+		    LEFT JOIN projects ON projects.id = tasks.project_id
+		WHERE
+		    tasks.due_date IS NOT NULL
+		    AND ((tasks.project_id IS NULL
+		            AND tasks.owner_id = $1)
+		        OR EXISTS (
+		            SELECT
+		                1
+		            FROM
+		                member_projects
+		            WHERE
+		                member_projects.user_id = $1
+		                AND member_projects.project_id = tasks.project_id
+		                AND (member_projects.can_edit
+		                    OR tasks.owner_id = $1))
+		        OR (projects.published
+		            AND EXISTS (
+		                SELECT
+		                    1
+		                FROM
+		                    projects_users
+		                WHERE
+		                    projects_users.project_id = projects.id
+		                    AND projects_users.user_id = $1)))
+		ORDER BY
+		    tasks.due_date,
+		    tasks.id
+	`, userID)
+	return tasks, err
+}
+
+// GetAllDueByProjectID returns a slice of Task and returns an error from the
+// Select method.
+//
+// It returns the tasks with a due date of the project with the given id, if
+// the given user can see it in any of their organizations, or it's published
+// and shared with them.
+func (s *TaskService) GetAllDueByProjectID(ctx context.Context, userID int32, projectID int32) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAllDueByProjectID")
+	defer end()
+	var tasks []Task
+	err := s.db.SelectContext(ctx, &tasks, `
+		SELECT
+		    tasks.*
+		FROM
+		    tasks
+		    JOIN projects ON projects.id = tasks.project_id
+		WHERE
+		    tasks.due_date IS NOT NULL
+		    AND projects.id = $2
+		    AND (projects.id IN (
+		            SELECT
+		                project_id
+		            FROM
+		                member_projects
+		            WHERE
+		                user_id = $1)
+		        OR (projects.published
+		            AND EXISTS (
+		                SELECT
+		                    1
+		                FROM
+		                    projects_users
+		                WHERE
+		                    projects_users.project_id = projects.id
+		                    AND projects_users.user_id = $1)))
+		ORDER BY
+		    tasks.due_date,
+		    tasks.id
+	`, userID, projectID)
+	return tasks, err
+}
+
+// ImportWithTx returns an error from the Exec method.
+//
+// If successful, it inserts a new row into the "tasks" table with the given
+// data, inside the given transaction.
+func (s *TaskService) ImportWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	title string,
+	description string,
+	status TaskStatus,
+	dueDate pgtype.Date,
+	projectID pgtype.Int4,
+	ownerID int32,
+) error {
+	ctx, end := startQuery(ctx, "TaskService", "ImportWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tasks (title, description, status, due_date, owner_id, project_id)
+		    VALUES ($1, $2, $3, $4, $5, $6)
+	`, title, description, status, dueDate, ownerID, projectID)
+	return err
+}
+
+// GetVisible returns a Task and returns an error from the Get method.
+//
+// Unlike Get, it also returns tasks of projects the given user can see in
+// their active organization, and tasks of published projects shared with
+// them.
+func (s *TaskService) GetVisible(ctx context.Context, taskID int32, userID int32) (Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetVisible")
+	defer end()
+	var task Task
+	err := s.db.GetContext(ctx, &task, `
+		SELECT
+		    tasks.*
+		FROM
+		    tasks
+		    LEFT JOIN projects ON projects.id = tasks.project_id
+		WHERE
+		    tasks.id = $1
+		    AND (tasks.id IN (
+		            SELECT
+		                task_id
+		            FROM
+		                workspace_tasks
+		            WHERE
+		                user_id = $2)
+		        OR (projects.published
+		            AND EXISTS (
+		                SELECT
+		                    1
+		                FROM
+		                    projects_users
+		                WHERE
+		                    projects_users.project_id = projects.id
+		                    AND projects_users.user_id = $2)))
+	`, taskID, userID)
+	return task, err
+}
+
+// DeleteWithTx returns a slice of Attachment and returns an error from the
+// Get, Select or Exec methods.
+//
+// If successful, it deletes the "tasks" table row that matches the given
+// task id and owner id in their active organization, inside the given
+// transaction, along with its attachments, and returns the deleted
+// attachments so that their files can be removed from storage once the
+// transaction is committed.
+//
+// The task row is locked first, so that no attachment can be added while
+// the task is being deleted. It returns sql.ErrNoRows if the task doesn't
+// exist.
+func (s *TaskService) DeleteWithTx(ctx context.Context, tx *sqlx.Tx, taskID int32, ownerID int32) ([]Attachment, error) {
+	ctx, end := startQuery(ctx, "TaskService", "DeleteWithTx")
+	defer end()
+	var id int32
+	err := tx.GetContext(ctx, &id, `
+		SELECT
+		    id
+		FROM
+		    tasks
 		WHERE
 		    id = $1
 		    AND owner_id = $2
-	`, taskID, ownerID, title, description)
+		    AND id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $2)
+		FOR UPDATE
+	`, taskID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	err = tx.SelectContext(ctx, &attachments, `
+		SELECT
+		    *
+		FROM
+		    attachments
+		WHERE
+		    task_id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM tasks
+		WHERE id = $1
+	`, id)
+	return attachments, err
+}
+
+// GetAllRecurringDueWithTx returns a slice of Task and returns an error from
+// the Select method.
+//
+// It returns up to the given limit of recurring tasks due on or before the
+// given date, whose next occurrence hasn't been created yet. Rules after
+// completion are left out, since only completing the task creates their next
+// occurrence, and so are tasks of archived projects, until they're restored.
+//
+// The rows are locked until the given transaction ends, and rows locked by
+// other transactions are skipped, so that several instances of the app can
+// look for due tasks at the same time without creating an occurrence twice.
+func (s *TaskService) GetAllRecurringDueWithTx(ctx context.Context, tx *sqlx.Tx, date pgtype.Date, limit int) ([]Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetAllRecurringDueWithTx")
+	defer end()
+	var tasks []Task
+	err := tx.SelectContext(ctx, &tasks, `
+		SELECT
+		    *
+		FROM
+		    tasks
+		WHERE
+		    recurrence IS NOT NULL
+		    AND recurred_at IS NULL
+		    AND due_date <= $1
+		    AND recurrence NOT LIKE '%X-AFTER-COMPLETION=TRUE%'
+		    AND NOT EXISTS (
+		        SELECT
+		            1
+		        FROM
+		            projects
+		        WHERE
+		            projects.id = tasks.project_id
+		            AND projects.state = 'archived')
+		ORDER BY
+		    due_date,
+		    id
+		LIMIT $2
+		FOR UPDATE
+		    SKIP LOCKED
+	`, date, limit)
+	return tasks, err
+}
+
+// RecurWithTx returns a Task and returns an error from the Exec or Get
+// methods.
+//
+// If successful, it marks the given task as recurred and inserts its next
+// occurrence, due on the given date, inside the given transaction. The
+// occurrence copies the title, description, project, milestone, owner and
+// recurrence rule of the task.
+//
+// It returns sql.ErrNoRows if the next occurrence of the task was already
+// created, or its recurrence rule was removed.
+func (s *TaskService) RecurWithTx(ctx context.Context, tx *sqlx.Tx, taskID int32, dueDate pgtype.Date) (Task, error) {
+	ctx, end := startQuery(ctx, "TaskService", "RecurWithTx")
+	defer end()
+	var task Task
+	err := tx.GetContext(ctx, &task, `
+		UPDATE
+		    tasks
+		SET
+		    recurred_at = now()
+		WHERE
+		    id = $1
+		    AND recurrence IS NOT NULL
+		    AND recurred_at IS NULL
+		RETURNING
+		    *
+	`, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+	var next Task
+	err = tx.GetContext(ctx, &next, `
+		INSERT INTO tasks (title, description, due_date, owner_id, project_id, milestone_id, recurrence)
+		    VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING
+		    *
+	`, task.Title, task.Description, dueDate, task.OwnerID, task.ProjectID, task.MilestoneID, task.Recurrence)
+	return next, err
+}
+
+// ClearRecurrenceWithTx returns an error from the Exec method.
+//
+// If successful, it removes the recurrence rule of the task that matches the
+// given task id inside the given transaction, so that it stops recurring.
+func (s *TaskService) ClearRecurrenceWithTx(ctx context.Context, tx *sqlx.Tx, taskID int32) error {
+	ctx, end := startQuery(ctx, "TaskService", "ClearRecurrenceWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+		    tasks
+		SET
+		    recurrence = NULL
+		WHERE
+		    id = $1
+	`, taskID)
 	return err
 }
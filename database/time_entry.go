@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// A TimeEntry is time a user spent on a task, either tracked with a timer or
+// entered manually. The timer of an entry is running while EndedAt is null,
+// and each user has at most one running timer.
+//
+// Times are stored in UTC.
+//
+// table: "time_entries"
+type TimeEntry struct {
+	ID        int32            `db:"id"`
+	TaskID    int32            `db:"task_id"`
+	UserID    int32            `db:"user_id"`
+	StartedAt pgtype.Timestamp `db:"started_at"`
+	EndedAt   pgtype.Timestamp `db:"ended_at"`
+	Note      string           `db:"note"`
+	CreatedAt pgtype.Timestamp `db:"created_at"`
+}
+
+// Duration returns the time between the start and end of the entry, or
+// between its start and the given time if its timer is running.
+func (e TimeEntry) Duration(now time.Time) time.Duration {
+	if !e.EndedAt.Valid {
+		return now.Sub(e.StartedAt.Time)
+	}
+	return e.EndedAt.Time.Sub(e.StartedAt.Time)
+}
+
+// A TimeEntryRow is a TimeEntry along with the titles of its task and
+// project, and the name and email of its user.
+type TimeEntryRow struct {
+	TimeEntry
+	TaskTitle    string      `db:"task_title"`
+	ProjectID    pgtype.Int4 `db:"project_id"`
+	ProjectTitle pgtype.Text `db:"project_title"`
+	UserName     pgtype.Text `db:"user_name"`
+	UserEmail    string      `db:"user_email"`
+}
+
+// timeEntryRowQuery selects TimeEntryRow values, to be followed by a WHERE
+// clause.
+const timeEntryRowQuery = `
+	SELECT
+	    time_entries.*,
+	    tasks.title AS task_title,
+	    tasks.project_id,
+	    projects.title AS project_title,
+	    users.name AS user_name,
+	    users.email AS user_email
+	FROM
+	    time_entries
+	    JOIN tasks ON tasks.id = time_entries.task_id
+	    LEFT JOIN projects ON projects.id = tasks.project_id
+	    JOIN users ON users.id = time_entries.user_id
+`
+
+// StartTimer returns a TimeEntry and returns an error from the Exec or Get
+// methods.
+//
+// If successful, it stops the running timer of the given user, if any, and
+// inserts a new running time entry for the given task, inside a transaction.
+func (s *TaskService) StartTimer(ctx context.Context, taskID int32, userID int32) (TimeEntry, error) {
+	ctx, end := startQuery(ctx, "TaskService", "StartTimer")
+	defer end()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    time_entries
+		SET
+		    ended_at = now() AT TIME ZONE 'utc'
+		WHERE
+		    user_id = $1
+		    AND ended_at IS NULL
+	`, userID)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	var entry TimeEntry
+	err = tx.GetContext(ctx, &entry, `
+		INSERT INTO time_entries (task_id, user_id, started_at)
+		    VALUES ($1, $2, now() AT TIME ZONE 'utc')
+		RETURNING
+		    *
+	`, taskID, userID)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	return entry, tx.Commit()
+}
+
+// StopTimer returns a TimeEntry and returns an error from the Get method.
+//
+// If successful, it stops the running timer of the given user and returns
+// its entry. It returns sql.ErrNoRows if no timer is running.
+func (s *TaskService) StopTimer(ctx context.Context, userID int32) (TimeEntry, error) {
+	ctx, end := startQuery(ctx, "TaskService", "StopTimer")
+	defer end()
+	var entry TimeEntry
+	err := s.db.GetContext(ctx, &entry, `
+		UPDATE
+		    time_entries
+		SET
+		    ended_at = now() AT TIME ZONE 'utc'
+		WHERE
+		    user_id = $1
+		    AND ended_at IS NULL
+		RETURNING
+		    *
+	`, userID)
+	return entry, err
+}
+
+// GetRunningTimer returns a TimeEntryRow and returns an error from the Get
+// method.
+//
+// It returns the entry of the running timer of the given user, or
+// sql.ErrNoRows if no timer is running.
+func (s *TaskService) GetRunningTimer(ctx context.Context, userID int32) (TimeEntryRow, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetRunningTimer")
+	defer end()
+	var row TimeEntryRow
+	err := s.db.GetContext(ctx, &row, timeEntryRowQuery+`
+		WHERE
+		    time_entries.user_id = $1
+		    AND time_entries.ended_at IS NULL
+	`, userID)
+	return row, err
+}
+
+// CreateTimeEntry returns a TimeEntry and returns an error from the Get
+// method.
+//
+// If successful, it inserts a new time entry for the given task and user,
+// from the given start to the given end.
+func (s *TaskService) CreateTimeEntry(
+	ctx context.Context,
+	taskID int32,
+	userID int32,
+	startedAt time.Time,
+	endedAt time.Time,
+	note string,
+) (TimeEntry, error) {
+	ctx, end := startQuery(ctx, "TaskService", "CreateTimeEntry")
+	defer end()
+	var entry TimeEntry
+	err := s.db.GetContext(ctx, &entry, `
+		INSERT INTO time_entries (task_id, user_id, started_at, ended_at, note)
+		    VALUES ($1, $2, $3, $4, $5)
+		RETURNING
+		    *
+	`, taskID, userID, startedAt.UTC(), endedAt.UTC(), note)
+	return entry, err
+}
+
+// DeleteTimeEntry returns a TimeEntry and returns an error from the Get
+// method.
+//
+// If successful, it deletes the time entry that matches the given entry id
+// and user id, unless the project of its task is archived, and returns it.
+func (s *TaskService) DeleteTimeEntry(ctx context.Context, entryID int32, userID int32) (TimeEntry, error) {
+	ctx, end := startQuery(ctx, "TaskService", "DeleteTimeEntry")
+	defer end()
+	var entry TimeEntry
+	err := s.db.GetContext(ctx, &entry, `
+		DELETE FROM time_entries
+		USING tasks
+		WHERE time_entries.id = $1
+		    AND time_entries.user_id = $2
+		    AND tasks.id = time_entries.task_id
+		    AND NOT EXISTS (
+		        SELECT
+		            1
+		        FROM
+		            projects
+		        WHERE
+		            projects.id = tasks.project_id
+		            AND projects.state = 'archived')
+		RETURNING
+		    time_entries.*
+	`, entryID, userID)
+	return entry, err
+}
+
+// GetTimeEntriesByTaskID returns a slice of TimeEntryRow and returns an error
+// from the Select method.
+//
+// It returns the entries of every user on the given task, latest first.
+func (s *TaskService) GetTimeEntriesByTaskID(ctx context.Context, taskID int32) ([]TimeEntryRow, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetTimeEntriesByTaskID")
+	defer end()
+	var rows []TimeEntryRow
+	err := s.db.SelectContext(ctx, &rows, timeEntryRowQuery+`
+		WHERE
+		    time_entries.task_id = $1
+		ORDER BY
+		    time_entries.started_at DESC,
+		    time_entries.id DESC
+	`, taskID)
+	return rows, err
+}
+
+// GetTimeEntries returns a slice of TimeEntryRow and returns an error from
+// the Select method.
+//
+// It returns the entries started from the given time and before the given
+// time that the given user can report on in their active organization, which
+// are their own entries and every entry on tasks they own or projects they
+// can edit, oldest first.
+func (s *TaskService) GetTimeEntries(ctx context.Context, userID int32, from time.Time, to time.Time) ([]TimeEntryRow, error) {
+	ctx, end := startQuery(ctx, "TaskService", "GetTimeEntries")
+	defer end()
+	var rows []TimeEntryRow
+	err := s.db.SelectContext(ctx, &rows, timeEntryRowQuery+`
+		WHERE
+		    time_entries.started_at >= $2
+		    AND time_entries.started_at < $3
+		    AND tasks.id IN (
+		        SELECT
+		            task_id
+		        FROM
+		            workspace_tasks
+		        WHERE
+		            user_id = $1)
+		    AND (time_entries.user_id = $1
+		        OR tasks.owner_id = $1
+		        OR projects.id IN (
+		            SELECT
+		                project_id
+		            FROM
+		                workspace_projects
+		            WHERE
+		                user_id = $1
+		                AND can_edit))
+		ORDER BY
+		    time_entries.started_at,
+		    time_entries.id
+	`, userID, from.UTC(), to.UTC())
+	return rows, err
+}
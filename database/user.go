@@ -1,7 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +25,77 @@ type User struct {
 	Email             string
 	GitHubAccessToken string `db:"gh_access_token"`
 	GitHubUserID      int32  `db:"gh_user_id"`
+	// GitHubScopes are the scopes granted to the access token, separated
+	// by commas, e.g. "read:user,repo,user:email".
+	GitHubScopes string `db:"gh_scopes"`
+	// CalendarToken is the secret part of the url of the user's calendar
+	// feeds, and is null until the feeds are first shown to the user.
+	CalendarToken pgtype.Text `db:"calendar_token"`
+	// IsAdmin reports whether the user can see the admin area, and manage
+	// the accounts and projects of other users.
+	IsAdmin bool `db:"is_admin"`
+	// SuspendedAt is when the user was suspended by an admin, and is null
+	// unless they are. Suspended users can't log in or use the API, their
+	// calendar feeds and the public pages of their projects aren't served,
+	// and their projects don't send or receive webhooks.
+	SuspendedAt pgtype.Timestamp `db:"suspended_at"`
+	// DeletionScheduledAt is when the account of the user is deleted, and is
+	// null unless they asked for it. They can cancel it until then.
+	DeletionScheduledAt pgtype.Timestamp `db:"deletion_scheduled_at"`
+	// Timezone is the name of the time zone dates are shown in, from the
+	// IANA database, e.g. "Europe/Lisbon".
+	Timezone string `db:"timezone"`
+	// AvatarURL is the url of the avatar of the user's GitHub account,
+	// refreshed every time they log in.
+	AvatarURL pgtype.Text `db:"avatar_url"`
+	// AvatarKey is where the avatar the user uploaded is kept in storage,
+	// which is shown instead of the GitHub one, and is null unless they
+	// uploaded one.
+	AvatarKey pgtype.Text `db:"avatar_key"`
+	// ActiveOrganizationID is a foreign key to the "organizations" table,
+	// pointing at the workspace the user works in. It's null while they work
+	// in their personal workspace after leaving another one.
+	ActiveOrganizationID pgtype.Int4 `db:"active_organization_id"`
+}
+
+// DeletedUserID is the id of the user what deleted users authored inside
+// projects of others is credited to, named "Deleted user", who can't log in.
+const DeletedUserID int32 = 0
+
+// DisplayName returns the name of the user, or their email address if they
+// haven't got one.
+func (u User) DisplayName() string {
+	if u.Name.Valid && u.Name.String != "" {
+		return u.Name.String
+	}
+	return u.Email
+}
+
+// Location returns the time zone of the user, or UTC if it isn't a valid
+// one anymore.
+func (u User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil || u.Timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// HasGitHubScope reports whether the access token of the user was granted
+// the given scope.
+func (u User) HasGitHubScope(scope string) bool {
+	return slices.Contains(strings.Split(u.GitHubScopes, ","), scope)
+}
+
+// Suspended reports whether the user is suspended.
+func (u User) Suspended() bool {
+	return u.SuspendedAt.Valid
+}
+
+// DeletionScheduled reports whether the user asked for their account to be
+// deleted.
+func (u User) DeletionScheduled() bool {
+	return u.DeletionScheduledAt.Valid
 }
 
 // A UserService is a connection to the database with methods
@@ -41,10 +116,12 @@ func NewUserService(db *sqlx.DB) *UserService {
 //
 // sql.ErrNoRows isn't treated as an error, but rather makes the function
 // report the user doesn't exist.
-func (us UserService) GetUserByID(ID int32) (User, bool, error) {
+func (us UserService) GetUserByID(ctx context.Context, ID int32) (User, bool, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetUserByID")
+	defer end()
 	var user User
 	query := "select * from users where id = $1"
-	err := us.db.Get(&user, query, ID)
+	err := us.db.GetContext(ctx, &user, query, ID)
 	if err != sql.ErrNoRows {
 		if err != nil {
 			return User{}, false, err
@@ -56,40 +133,66 @@ func (us UserService) GetUserByID(ID int32) (User, bool, error) {
 
 // CreateUser returns a User and returns an error from the Get method.
 //
-// If successful, it inserts a new row into the "users" table with the given data.
+// If successful, it inserts a new row into the "users" table with the given data,
+// along with their personal organization. The name is only set when it isn't
+// empty.
 func (us UserService) CreateUser(
+	ctx context.Context,
 	tx *sqlx.Tx,
 	email string,
 	ghAccessToken string,
+	ghScopes string,
 	ghUserId int32,
+	name string,
+	avatarURL string,
 ) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "CreateUser")
+	defer end()
 	var user User
-	query := "insert into users (email, gh_access_token, gh_user_id) values ($1, $2, $3) returning *"
-	err := tx.Get(&user, query, email, ghAccessToken, ghUserId)
+	query := "insert into users (email, gh_access_token, gh_scopes, gh_user_id, name, avatar_url) values ($1, $2, $3, $4, nullif($5, ''), nullif($6, '')) returning *"
+	err := tx.GetContext(ctx, &user, query, email, ghAccessToken, ghScopes, ghUserId, name, avatarURL)
 	if err != nil {
 		return User{}, err
 	}
+	organization, err := NewOrganizationService(us.db).CreatePersonalWithTx(ctx, tx, user.ID)
+	if err != nil {
+		return User{}, err
+	}
+	user.ActiveOrganizationID = pgtype.Int4{Int32: organization.ID, Valid: true}
 	return user, nil
 }
 
+// UpdateUser returns a User and returns an error from the Get method.
+//
+// If successful, it updates the email address, access token with its scopes
+// and GitHub avatar of the user with the given GitHub id. Their name is left
+// alone, since they may have changed it since signing up.
 func (us UserService) UpdateUser(
+	ctx context.Context,
 	tx *sqlx.Tx,
 	email string,
 	ghAccessToken string,
+	ghScopes string,
 	ghUserId int32,
+	avatarURL string,
 ) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "UpdateUser")
+	defer end()
 	var user User
-	query := "update users set email = $1, gh_access_token = $2 where gh_user_id = $3 returning *;"
-	err := tx.Get(&user, query, email, ghAccessToken, ghUserId)
+	query := "update users set email = $1, gh_access_token = $2, gh_scopes = $3, avatar_url = nullif($5, '') where gh_user_id = $4 returning *;"
+	err := tx.GetContext(ctx, &user, query, email, ghAccessToken, ghScopes, ghUserId, avatarURL)
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) GetSharedUsers(projectId int32) ([]User, error) {
+func (us UserService) GetSharedUsers(ctx context.Context, projectId int32) ([]User, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetSharedUsers")
+	defer end()
 	var users []User
-	err := us.db.Select(
+	err := us.db.SelectContext(
+		ctx,
 		&users,
 		"select users.* from projects_users left join users on projects_users.user_id = users.id where projects_users.project_id = $1",
 		projectId,
@@ -100,48 +203,59 @@ func (us UserService) GetSharedUsers(projectId int32) ([]User, error) {
 	return users, nil
 }
 
-func (us UserService) GetUserByEmail(email string) (User, error) {
+func (us UserService) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetUserByEmail")
+	defer end()
 	var user User
 	query := "select * from users where email = $1"
-	err := us.db.Get(&user, query, email)
+	err := us.db.GetContext(ctx, &user, query, email)
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) MustGetUserByID(id int32) (User, error) {
+func (us UserService) MustGetUserByID(ctx context.Context, id int32) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "MustGetUserByID")
+	defer end()
 	var user User
 	query := "select * from users where id = $1"
-	err := us.db.Get(&user, query, id)
+	err := us.db.GetContext(ctx, &user, query, id)
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) UserExists(email int32) (bool, error) {
+func (us UserService) UserExists(ctx context.Context, email int32) (bool, error) {
+	ctx, end := startQuery(ctx, "UserService", "UserExists")
+	defer end()
 	var count int
 	query := "select count(*) from users where email = $1"
-	err := us.db.Get(&count, query, email)
+	err := us.db.GetContext(ctx, &count, query, email)
 	if err != nil {
 		return false, err
 	}
 	return count != 0, nil
 }
 
-func (us UserService) UserExistsByGitHubID(gitHubUserId int32) (bool, error) {
+func (us UserService) UserExistsByGitHubID(ctx context.Context, gitHubUserId int32) (bool, error) {
+	ctx, end := startQuery(ctx, "UserService", "UserExistsByGitHubID")
+	defer end()
 	var count int
-	err := us.db.Get(&count, "select count(*) from users where gh_user_id = $1;", gitHubUserId)
+	err := us.db.GetContext(ctx, &count, "select count(*) from users where gh_user_id = $1;", gitHubUserId)
 	if err != nil {
 		return false, err
 	}
 	return count != 0, nil
 }
 
-func (us UserService) GetUserBySessionToken(sessionToken string) (User, error) {
+func (us UserService) GetUserBySessionToken(ctx context.Context, sessionToken string) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetUserBySessionToken")
+	defer end()
 	var user User
-	err := us.db.Get(
+	err := us.db.GetContext(
+		ctx,
 		&user,
 		"select users.* from users left join sessions on users.id = sessions.user_id where sessions.token = $1;",
 		sessionToken,
@@ -151,3 +265,449 @@ func (us UserService) GetUserBySessionToken(sessionToken string) (User, error) {
 	}
 	return user, nil
 }
+
+// GetUserByCalendarToken returns a User, reports whether the user exists
+// inside the database with the given calendar token, and returns an error
+// from the Get method.
+//
+// Suspended users are treated as if they didn't exist, so that their feeds
+// stop serving tasks while they're suspended.
+func (us UserService) GetUserByCalendarToken(ctx context.Context, token string) (User, bool, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetUserByCalendarToken")
+	defer end()
+	var user User
+	query := "select * from users where calendar_token = $1 and suspended_at is null"
+	err := us.db.GetContext(ctx, &user, query, token)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			return User{}, false, err
+		}
+		return user, true, nil
+	}
+	return User{}, false, nil
+}
+
+// SetCalendarToken returns a User and returns an error from the Get method.
+//
+// If successful, it replaces the calendar token of the user with the given
+// id, so that previously shared feed urls stop working.
+func (us UserService) SetCalendarToken(ctx context.Context, userID int32, token string) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "SetCalendarToken")
+	defer end()
+	var user User
+	query := "update users set calendar_token = $1 where id = $2 returning *"
+	err := us.db.GetContext(ctx, &user, query, token, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// GetUserByAPIToken returns a User, reports whether the user exists inside
+// the database with an API token with the given hash, and returns an error
+// from the Get method.
+//
+// It also records that the token was used.
+func (us UserService) GetUserByAPIToken(ctx context.Context, tokenHash string) (User, bool, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetUserByAPIToken")
+	defer end()
+	var user User
+	query := `
+		WITH used AS (
+		    UPDATE
+		        api_tokens
+		    SET
+		        last_used_at = now()
+		    WHERE
+		        token_hash = $1
+		    RETURNING
+		        user_id)
+		SELECT
+		    users.*
+		FROM
+		    users
+		    JOIN used ON used.user_id = users.id
+	`
+	err := us.db.GetContext(ctx, &user, query, tokenHash)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			return User{}, false, err
+		}
+		return user, true, nil
+	}
+	return User{}, false, nil
+}
+
+// SetAdmin returns a User and returns an error from the Get method.
+//
+// If successful, it grants the admin role to the user with the given id,
+// or revokes it.
+func (us UserService) SetAdmin(ctx context.Context, userID int32, isAdmin bool) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "SetAdmin")
+	defer end()
+	var user User
+	query := "update users set is_admin = $1 where id = $2 returning *"
+	err := us.db.GetContext(ctx, &user, query, isAdmin, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Suspend returns a User and returns an error from the Get method.
+//
+// If successful, it marks the user with the given id as suspended, keeping
+// the time they were first suspended at. Their sessions are left alone, and
+// should be deleted inside the same transaction.
+func (us UserService) Suspend(ctx context.Context, tx *sqlx.Tx, userID int32) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "Suspend")
+	defer end()
+	var user User
+	query := "update users set suspended_at = coalesce(suspended_at, now()) where id = $1 returning *"
+	err := tx.GetContext(ctx, &user, query, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// Unsuspend returns a User and returns an error from the Get method.
+//
+// If successful, it lets the user with the given id log in again.
+func (us UserService) Unsuspend(ctx context.Context, userID int32) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "Unsuspend")
+	defer end()
+	var user User
+	query := "update users set suspended_at = null where id = $1 returning *"
+	err := us.db.GetContext(ctx, &user, query, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// ScheduleDeletion returns a User and returns an error from the Get method.
+//
+// If successful, it schedules the account of the user with the given id to
+// be deleted at the given time, keeping the time it was first scheduled at.
+func (us UserService) ScheduleDeletion(ctx context.Context, userID int32, at pgtype.Timestamp) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "ScheduleDeletion")
+	defer end()
+	var user User
+	query := "update users set deletion_scheduled_at = coalesce(deletion_scheduled_at, $1) where id = $2 returning *"
+	err := us.db.GetContext(ctx, &user, query, at, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// CancelDeletion returns a User and returns an error from the Get method.
+//
+// If successful, it keeps the account of the user with the given id.
+func (us UserService) CancelDeletion(ctx context.Context, userID int32) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "CancelDeletion")
+	defer end()
+	var user User
+	query := "update users set deletion_scheduled_at = null where id = $1 returning *"
+	err := us.db.GetContext(ctx, &user, query, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// GetAllDueForDeletionWithTx returns a slice of User and returns an error
+// from the Select method.
+//
+// It returns up to the given limit of users whose account is scheduled to
+// be deleted at or before the given time. The rows are locked until the
+// given transaction ends, and rows locked by other transactions are
+// skipped.
+func (us UserService) GetAllDueForDeletionWithTx(ctx context.Context, tx *sqlx.Tx, now pgtype.Timestamp, limit int) ([]User, error) {
+	ctx, end := startQuery(ctx, "UserService", "GetAllDueForDeletionWithTx")
+	defer end()
+	var users []User
+	err := tx.SelectContext(ctx, &users, `
+		SELECT
+		    *
+		FROM
+		    users
+		WHERE
+		    deletion_scheduled_at <= $1
+		ORDER BY
+		    deletion_scheduled_at,
+		    id
+		LIMIT $2
+		FOR UPDATE
+		    SKIP LOCKED
+	`, now, limit)
+	return users, err
+}
+
+// DeleteWithTx returns a slice of storage keys and returns the first
+// encountered error.
+//
+// If successful, it deletes the user with the given id inside the given
+// transaction, along with their personal organization, the organizations
+// nobody else is a member of, the projects they own in those, and their
+// tasks, and returns the storage keys of the deleted attachments, data
+// exports and avatar so that their files can be removed once the
+// transaction is committed.
+//
+// Organizations the user is the only owner of are given to their oldest
+// other member, and the projects the user owns in organizations with other
+// members are kept by them, given to their oldest owner.
+//
+// What the user authored inside projects of other users is kept, but
+// credited to the user with the DeletedUserID, so that nothing left points
+// at the user: their tasks and the attachments they uploaded to tasks of
+// other users, and the time they tracked on those tasks, which is stopped if
+// it's still running. Tasks of other users inside projects the user owns are
+// kept by their owners, without a project, like when a project is deleted.
+func (us UserService) DeleteWithTx(ctx context.Context, tx *sqlx.Tx, userID int32) ([]string, error) {
+	ctx, end := startQuery(ctx, "UserService", "DeleteWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+		    organization_members
+		SET
+		    role = 'owner'
+		FROM (
+		    SELECT DISTINCT ON (organization_id)
+		        organization_id,
+		        user_id
+		    FROM
+		        organization_members AS others
+		    WHERE
+		        user_id <> $1
+		        AND organization_id IN (
+		            SELECT
+		                organization_id
+		            FROM
+		                organization_members
+		            WHERE
+		                user_id = $1
+		                AND role = 'owner')
+		        AND NOT EXISTS (
+		            SELECT
+		                1
+		            FROM
+		                organization_members AS owners
+		            WHERE
+		                owners.organization_id = others.organization_id
+		                AND owners.user_id <> $1
+		                AND owners.role = 'owner')
+		    ORDER BY
+		        organization_id,
+		        created_at,
+		        user_id) AS successors
+		WHERE
+		    organization_members.organization_id = successors.organization_id
+		    AND organization_members.user_id = successors.user_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    projects
+		SET
+		    owner_id = owners.user_id,
+		    updated_at = now()
+		FROM (
+		    SELECT DISTINCT ON (organization_id)
+		        organization_id,
+		        user_id
+		    FROM
+		        organization_members
+		    WHERE
+		        user_id <> $1
+		        AND role = 'owner'
+		    ORDER BY
+		        organization_id,
+		        created_at,
+		        user_id) AS owners
+		WHERE
+		    owners.organization_id = projects.organization_id
+		    AND projects.owner_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    tasks
+		SET
+		    owner_id = $2,
+		    updated_at = now()
+		FROM
+		    projects
+		WHERE
+		    projects.id = tasks.project_id
+		    AND tasks.owner_id = $1
+		    AND projects.owner_id <> $1
+	`, userID, DeletedUserID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    attachments
+		SET
+		    uploader_id = $2
+		FROM
+		    tasks
+		WHERE
+		    tasks.id = attachments.task_id
+		    AND attachments.uploader_id = $1
+		    AND tasks.owner_id <> $1
+	`, userID, DeletedUserID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+		    time_entries
+		SET
+		    user_id = $2,
+		    ended_at = coalesce(ended_at, now() AT TIME ZONE 'utc')
+		FROM
+		    tasks
+		WHERE
+		    tasks.id = time_entries.task_id
+		    AND time_entries.user_id = $1
+		    AND tasks.owner_id <> $1
+	`, userID, DeletedUserID)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	err = tx.SelectContext(ctx, &attachments, `
+		SELECT
+		    attachments.*
+		FROM
+		    attachments
+		    JOIN tasks ON tasks.id = attachments.task_id
+		WHERE
+		    tasks.owner_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, attachment := range attachments {
+		keys = append(keys, attachment.Keys()...)
+	}
+	var exportKeys []string
+	err = tx.SelectContext(ctx, &exportKeys, `
+		SELECT
+		    storage_key
+		FROM
+		    data_exports
+		WHERE
+		    user_id = $1
+		    AND storage_key IS NOT NULL
+		UNION ALL
+		SELECT
+		    avatar_key
+		FROM
+		    users
+		WHERE
+		    id = $1
+		    AND avatar_key IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, exportKeys...)
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM tasks
+		WHERE owner_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM projects
+		WHERE owner_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM organizations
+		WHERE id IN (
+		        SELECT
+		            organization_id
+		        FROM
+		            organization_members
+		        WHERE
+		            user_id = $1)
+		    AND NOT EXISTS (
+		        SELECT
+		            1
+		        FROM
+		            organization_members
+		        WHERE
+		            organization_members.organization_id = organizations.id
+		            AND organization_members.user_id <> $1)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var id int32
+	err = tx.GetContext(ctx, &id, `
+		DELETE FROM users
+		WHERE id = $1
+		RETURNING
+		    id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// UpdateProfile returns a User and returns an error from the Get method.
+//
+// If successful, it updates the name and time zone of the user with the
+// given id. An empty name clears it.
+func (us UserService) UpdateProfile(ctx context.Context, userID int32, name string, timezone string) (User, error) {
+	ctx, end := startQuery(ctx, "UserService", "UpdateProfile")
+	defer end()
+	var user User
+	query := "update users set name = nullif($1, ''), timezone = $2 where id = $3 returning *"
+	err := us.db.GetContext(ctx, &user, query, name, timezone, userID)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// SetAvatar returns a User, the storage key of the avatar it replaced, and
+// returns the first encountered error.
+//
+// If successful, it sets the storage key of the avatar the user with the
+// given id uploaded, or clears it so that their GitHub avatar is shown
+// again. The replaced avatar should be removed from storage by the caller.
+func (us UserService) SetAvatar(ctx context.Context, userID int32, key pgtype.Text) (User, pgtype.Text, error) {
+	ctx, end := startQuery(ctx, "UserService", "SetAvatar")
+	defer end()
+	tx, err := us.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return User{}, pgtype.Text{}, err
+	}
+	defer tx.Rollback()
+	var previous pgtype.Text
+	err = tx.GetContext(ctx, &previous, "select avatar_key from users where id = $1 for update", userID)
+	if err != nil {
+		return User{}, pgtype.Text{}, err
+	}
+	var user User
+	err = tx.GetContext(ctx, &user, "update users set avatar_key = $1 where id = $2 returning *", key, userID)
+	if err != nil {
+		return User{}, pgtype.Text{}, err
+	}
+	return user, previous, tx.Commit()
+}
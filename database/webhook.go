@@ -0,0 +1,336 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+)
+
+// A Webhook is a subscription of a url to events of a project, which are
+// delivered to it as signed JSON payloads.
+//
+// table: "webhooks"
+type Webhook struct {
+	ID        int32  `db:"id"`
+	ProjectID int32  `db:"project_id"`
+	URL       string `db:"url"`
+	// Secret is the key the payloads are signed with.
+	Secret string `db:"secret"`
+	// Events is the comma-separated list of event types, e.g.
+	// "task.created,task.updated".
+	Events    string           `db:"events"`
+	CreatedAt pgtype.Timestamp `db:"created_at"`
+}
+
+// EventList returns the event types the webhook is subscribed to.
+func (w Webhook) EventList() []string {
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribes reports whether the webhook is subscribed to the given event
+// type.
+func (w Webhook) Subscribes(event string) bool {
+	return slices.Contains(w.EventList(), event)
+}
+
+// A WebhookDeliveryStatus is the state of a delivery, stored in the
+// "status" column of the "webhook_deliveries" table.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending deliveries are attempted once their next
+	// attempt is due.
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	// WebhookDeliveryDelivered deliveries got a successful response.
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryFailed deliveries ran out of attempts.
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// A WebhookDelivery is an event queued for a webhook, along with the outcome
+// of the attempts to deliver it.
+//
+// table: "webhook_deliveries"
+type WebhookDelivery struct {
+	ID        int32                 `db:"id"`
+	WebhookID int32                 `db:"webhook_id"`
+	Event     string                `db:"event"`
+	Payload   string                `db:"payload"`
+	Status    WebhookDeliveryStatus `db:"status"`
+	Attempts  int32                 `db:"attempts"`
+	// NextAttemptAt is when the delivery is attempted next, while it's
+	// pending.
+	NextAttemptAt pgtype.Timestamp `db:"next_attempt_at"`
+	// LastStatusCode and LastError describe the response to the last
+	// attempt, if any.
+	LastStatusCode pgtype.Int4      `db:"last_status_code"`
+	LastError      string           `db:"last_error"`
+	CreatedAt      pgtype.Timestamp `db:"created_at"`
+	DeliveredAt    pgtype.Timestamp `db:"delivered_at"`
+}
+
+// A WebhookDeliveryTarget is a WebhookDelivery along with the url and secret
+// of its webhook, which are needed to attempt it.
+type WebhookDeliveryTarget struct {
+	WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// A WebhookService is a connection to the database with methods
+// for interacting with the "webhooks" and "webhook_deliveries" tables.
+type WebhookService struct {
+	db *sqlx.DB
+}
+
+// NewWebhookService returns a pointer to WebhookService.
+func NewWebhookService(db *sqlx.DB) *WebhookService {
+	return &WebhookService{
+		db: db,
+	}
+}
+
+// Create returns a Webhook and returns an error from the Get method.
+//
+// If successful, it inserts a new row into the "webhooks" table with the
+// given data.
+func (s *WebhookService) Create(ctx context.Context, projectID int32, url string, secret string, events []string) (Webhook, error) {
+	ctx, end := startQuery(ctx, "WebhookService", "Create")
+	defer end()
+	var webhook Webhook
+	err := s.db.GetContext(ctx, &webhook, `
+		INSERT INTO webhooks (project_id, url, secret, events)
+		    VALUES ($1, $2, $3, $4)
+		RETURNING
+		    *
+	`, projectID, url, secret, strings.Join(events, ","))
+	return webhook, err
+}
+
+// GetAllByProjectID returns a slice of Webhook and returns an error from
+// the Select method.
+func (s *WebhookService) GetAllByProjectID(ctx context.Context, projectID int32) ([]Webhook, error) {
+	ctx, end := startQuery(ctx, "WebhookService", "GetAllByProjectID")
+	defer end()
+	var webhooks []Webhook
+	err := s.db.SelectContext(ctx, &webhooks, `
+		SELECT
+		    *
+		FROM
+		    webhooks
+		WHERE
+		    project_id = $1
+		ORDER BY
+		    id
+	`, projectID)
+	return webhooks, err
+}
+
+// Delete returns an error from the Get method.
+//
+// If successful, it deletes the "webhooks" table row that matches the given
+// webhook id, if the given user can edit its project, along with its
+// deliveries. It returns sql.ErrNoRows if no row was deleted.
+func (s *WebhookService) Delete(ctx context.Context, webhookID int32, ownerID int32) error {
+	ctx, end := startQuery(ctx, "WebhookService", "Delete")
+	defer end()
+	var id int32
+	return s.db.GetContext(ctx, &id, `
+		DELETE FROM webhooks
+		USING projects
+		WHERE webhooks.id = $1
+		    AND projects.id = webhooks.project_id
+		    AND projects.id IN (
+		        SELECT
+		            project_id
+		        FROM
+		            workspace_projects
+		        WHERE
+		            user_id = $2
+		            AND can_edit)
+		RETURNING
+		    webhooks.id
+	`, webhookID, ownerID)
+}
+
+// EnqueueWithTx returns an error from the Exec method.
+//
+// If successful, it queues a delivery of the given event type and payload
+// for every webhook of the given project subscribed to it, inside the given
+// transaction, so that deliveries are only queued if the change they're
+// about is committed.
+func (s *WebhookService) EnqueueWithTx(ctx context.Context, tx *sqlx.Tx, projectID int32, event string, payload []byte) error {
+	ctx, end := startQuery(ctx, "WebhookService", "EnqueueWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, enqueueQuery, projectID, event, string(payload))
+	return err
+}
+
+const enqueueQuery = `
+	INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	SELECT
+	    id,
+	    $2,
+	    $3
+	FROM
+	    webhooks
+	WHERE
+	    project_id = $1
+	    AND $2 = ANY (string_to_array(events, ','))
+`
+
+// GetDeliveriesByProjectID returns a slice of WebhookDeliveryTarget and
+// returns an error from the Select method.
+//
+// It returns up to the given limit of the latest deliveries of the webhooks
+// of the given project, newest first.
+func (s *WebhookService) GetDeliveriesByProjectID(ctx context.Context, projectID int32, limit int) ([]WebhookDeliveryTarget, error) {
+	ctx, end := startQuery(ctx, "WebhookService", "GetDeliveriesByProjectID")
+	defer end()
+	var deliveries []WebhookDeliveryTarget
+	err := s.db.SelectContext(ctx, &deliveries, `
+		SELECT
+		    webhook_deliveries.*,
+		    webhooks.url,
+		    webhooks.secret
+		FROM
+		    webhook_deliveries
+		    JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE
+		    webhooks.project_id = $1
+		ORDER BY
+		    webhook_deliveries.id DESC
+		LIMIT $2
+	`, projectID, limit)
+	return deliveries, err
+}
+
+// Redeliver returns a WebhookDelivery and returns an error from the Get
+// method.
+//
+// If successful, it queues a copy of the delivery that matches the given
+// delivery id, if the given user can edit the project of its webhook, to be
+// attempted right away. The original delivery is kept in the log. It
+// returns sql.ErrNoRows if no row was inserted.
+func (s *WebhookService) Redeliver(ctx context.Context, deliveryID int32, ownerID int32) (WebhookDelivery, error) {
+	ctx, end := startQuery(ctx, "WebhookService", "Redeliver")
+	defer end()
+	var delivery WebhookDelivery
+	err := s.db.GetContext(ctx, &delivery, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT
+		    webhook_deliveries.webhook_id,
+		    webhook_deliveries.event,
+		    webhook_deliveries.payload
+		FROM
+		    webhook_deliveries
+		    JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		    JOIN projects ON projects.id = webhooks.project_id
+		WHERE
+		    webhook_deliveries.id = $1
+		    AND projects.id IN (
+		        SELECT
+		            project_id
+		        FROM
+		            workspace_projects
+		        WHERE
+		            user_id = $2
+		            AND can_edit)
+		RETURNING
+		    *
+	`, deliveryID, ownerID)
+	return delivery, err
+}
+
+// ClaimDue returns a slice of WebhookDeliveryTarget and returns an error from
+// the Select method.
+//
+// It claims up to the given limit of pending deliveries whose next attempt is
+// due at the given time, oldest first, by moving their next attempt to the
+// given claimed until time, so that they're not due while they're attempted.
+// Deliveries whose attempt is never recorded, e.g. because the instance
+// attempting them stopped, are due again after that time.
+//
+// Rows locked by other transactions are skipped, so that several instances
+// of the app can attempt deliveries at the same time without sending one
+// twice. Deliveries of projects whose owner is suspended are skipped too,
+// and stay pending until the owner is unsuspended.
+func (s *WebhookService) ClaimDue(ctx context.Context, now pgtype.Timestamp, claimedUntil pgtype.Timestamp, limit int) ([]WebhookDeliveryTarget, error) {
+	ctx, end := startQuery(ctx, "WebhookService", "ClaimDue")
+	defer end()
+	var deliveries []WebhookDeliveryTarget
+	err := s.db.SelectContext(ctx, &deliveries, `
+		WITH due AS (
+		    SELECT
+		        webhook_deliveries.id
+		    FROM
+		        webhook_deliveries
+		        JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		        JOIN projects ON projects.id = webhooks.project_id
+		        JOIN users ON users.id = projects.owner_id
+		    WHERE
+		        webhook_deliveries.status = 'pending'
+		        AND webhook_deliveries.next_attempt_at <= $1
+		        AND users.suspended_at IS NULL
+		    ORDER BY
+		        webhook_deliveries.next_attempt_at,
+		        webhook_deliveries.id
+		    LIMIT $3
+		    FOR UPDATE OF webhook_deliveries
+		        SKIP LOCKED)
+		UPDATE
+		    webhook_deliveries
+		SET
+		    next_attempt_at = $2
+		FROM
+		    due,
+		    webhooks
+		WHERE
+		    webhook_deliveries.id = due.id
+		    AND webhooks.id = webhook_deliveries.webhook_id
+		RETURNING
+		    webhook_deliveries.*,
+		    webhooks.url,
+		    webhooks.secret
+	`, now, claimedUntil, limit)
+	return deliveries, err
+}
+
+// RecordAttemptWithTx returns an error from the Exec method.
+//
+// If successful, it counts an attempt of the delivery that matches the given
+// delivery id inside the given transaction, with its outcome. The next
+// attempt time only matters if the delivery is still pending.
+func (s *WebhookService) RecordAttemptWithTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	deliveryID int32,
+	status WebhookDeliveryStatus,
+	statusCode pgtype.Int4,
+	lastError string,
+	nextAttemptAt pgtype.Timestamp,
+) error {
+	ctx, end := startQuery(ctx, "WebhookService", "RecordAttemptWithTx")
+	defer end()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+		    webhook_deliveries
+		SET
+		    status = $2,
+		    attempts = attempts + 1,
+		    last_status_code = $3,
+		    last_error = $4,
+		    next_attempt_at = $5,
+		    delivered_at = CASE WHEN $2 = 'delivered' THEN
+		        now()
+		    ELSE
+		        NULL
+		    END
+		WHERE
+		    id = $1
+	`, deliveryID, status, statusCode, lastError, nextAttemptAt)
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/handler"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestError(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("responses include a generated request id", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "login")),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Len(res.Header.Get("X-Request-Id"), 32)
+	})
+
+	t.Run("responses reuse an incoming request id", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "login")),
+		)
+		req.Header.Set("X-Request-Id", "incoming-id")
+		res := test.Do(req)
+		assert.Equal(t, "incoming-id", res.Header.Get("X-Request-Id"))
+	})
+
+	t.Run("error renders page with request id", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/999/edit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal("Internal Server Error", doc.Find("h1").Text())
+		assert.Equal(res.Header.Get("X-Request-Id"), doc.Find("#request-id").Text())
+	})
+
+	t.Run("htmx error renders toast with request id", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/999")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		req.Header.Set("Hx-Request", "true")
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal("none", res.Header.Get("Hx-Reswap"))
+		assert.Contains(body, res.Header.Get("X-Request-Id"))
+	})
+}
+
+func TestErrorWrapper(t *testing.T) {
+	h := handler.ErrorWrapper(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("failed")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/profile/calendar", nil)
+	req.Header.Set("Hx-Request", "true")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+	assert.Equal("none", rec.Header().Get("Hx-Reswap"))
+	assert.Contains(rec.Body.String(), "There was an error")
+}
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// issuesPerPage is the number of issues requested per page when listing the
+// issues of a repository, which is the most GitHub returns.
+const issuesPerPage = 100
+
+// A Repo is a representation of data returned from the GitHub API when
+// making a GET request to "https://api.github.com/repos/{owner}/{name}".
+type Repo struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+	Private  bool   `json:"private"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// An Issue is a representation of data returned from the GitHub API when
+// making a GET request to "https://api.github.com/repos/{owner}/{name}/issues".
+type Issue struct {
+	Number  int32  `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+	// PullRequest is set when the issue is a pull request, which the issues
+	// endpoints of the GitHub API return too.
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+}
+
+// Issue states, as returned and accepted by the GitHub API.
+const (
+	IssueOpen   = "open"
+	IssueClosed = "closed"
+)
+
+// IsPullRequest reports whether the issue is a pull request.
+func (i Issue) IsPullRequest() bool {
+	return i.PullRequest != nil
+}
+
+// An IssueUpdate is the body of a PATCH request to
+// "https://api.github.com/repos/{owner}/{name}/issues/{number}". Empty
+// fields are left unchanged.
+type IssueUpdate struct {
+	Title string `json:"title,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// GetRepo returns the repository with the given owner and name, and the
+// first error encountered when fetching the GitHub API.
+func (a *API) GetRepo(ctx context.Context, accessToken string, owner string, name string) (Repo, error) {
+	var repo Repo
+	path := fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(name))
+	err := a.do(ctx, accessToken, http.MethodGet, path, nil, &repo)
+	return repo, err
+}
+
+// GetOpenIssues returns the open issues of the repository with the given
+// owner and name, without pull requests, and the first error encountered
+// when fetching the GitHub API.
+//
+// It requests every page of issues, oldest first.
+func (a *API) GetOpenIssues(ctx context.Context, accessToken string, owner string, name string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; ; page++ {
+		var batch []Issue
+		path := fmt.Sprintf(
+			"/repos/%s/%s/issues?state=open&sort=created&direction=asc&per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(name), issuesPerPage, page,
+		)
+		err := a.do(ctx, accessToken, http.MethodGet, path, nil, &batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range batch {
+			if !issue.IsPullRequest() {
+				issues = append(issues, issue)
+			}
+		}
+		if len(batch) < issuesPerPage {
+			return issues, nil
+		}
+	}
+}
+
+// UpdateIssue returns the issue with the given number of the repository with
+// the given owner and name after updating it, and the first error
+// encountered when fetching the GitHub API.
+func (a *API) UpdateIssue(ctx context.Context, accessToken string, owner string, name string, number int32, update IssueUpdate) (Issue, error) {
+	var issue Issue
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d", url.PathEscape(owner), url.PathEscape(name), number)
+	err := a.do(ctx, accessToken, http.MethodPatch, path, update, &issue)
+	return issue, err
+}
+
+var repoPattern = regexp.MustCompile(`^(?:https://github\.com/)?([A-Za-z0-9](?:[A-Za-z0-9-]{0,38}))/([A-Za-z0-9._-]{1,100}?)(?:\.git)?/?$`)
+
+// ParseRepo returns the owner and name of a repository written as
+// "owner/name" or as its url, e.g. "https://github.com/owner/name", and
+// reports whether the given string is either.
+func ParseRepo(s string) (string, string, bool) {
+	matches := repoPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
@@ -0,0 +1,239 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/tracing"
+)
+
+// DefaultAPIURL is the base url of the GitHub REST API.
+const DefaultAPIURL = "https://api.github.com"
+
+// An APIError is a response of the GitHub API with a status other than 2xx.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether the given error is a response of the GitHub API
+// saying that the resource doesn't exist, or that the access token can't see
+// it.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// An API sends requests to the GitHub REST API on behalf of users, given
+// their access token.
+//
+// Requests that fail with a server error, or because of a rate limit, are
+// retried after the delay asked for by GitHub, if any, or after an
+// exponential backoff otherwise.
+type API struct {
+	baseURL string
+	client  *http.Client
+	// timeout is how long each attempt of a request may take.
+	timeout time.Duration
+	// retries is the number of times a failed request is attempted again.
+	retries int
+	// maxRetryWait is the longest delay waited before attempting a request
+	// again. Requests asked to wait longer fail right away.
+	maxRetryWait time.Duration
+	// backoff is the delay before the first retry of a request when GitHub
+	// doesn't ask for one, which doubles after each retry.
+	backoff time.Duration
+}
+
+// NewAPI returns a pointer to API, configured with the given options.
+//
+// By default, it sends requests to DefaultAPIURL with a 10 second timeout,
+// and retries failed ones twice, waiting up to 10 seconds.
+func NewAPI(options ...func(*API)) *API {
+	a := &API{
+		baseURL:      DefaultAPIURL,
+		client:       &http.Client{},
+		timeout:      10 * time.Second,
+		retries:      2,
+		maxRetryWait: 10 * time.Second,
+		backoff:      500 * time.Millisecond,
+	}
+	for _, o := range options {
+		o(a)
+	}
+	return a
+}
+
+// WithBaseURL returns a function that sets the base url of the API, usually
+// the url of a fake server in tests.
+func WithBaseURL(baseURL string) func(*API) {
+	return func(a *API) {
+		a.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient returns a function that sets the client requests are sent
+// with.
+func WithHTTPClient(client *http.Client) func(*API) {
+	return func(a *API) {
+		a.client = client
+	}
+}
+
+// WithTimeout returns a function that sets how long each attempt of a
+// request may take.
+func WithTimeout(timeout time.Duration) func(*API) {
+	return func(a *API) {
+		a.timeout = timeout
+	}
+}
+
+// WithRetries returns a function that sets the number of times a failed
+// request is attempted again, and the longest delay waited before each of
+// those attempts.
+func WithRetries(retries int, maxWait time.Duration) func(*API) {
+	return func(a *API) {
+		a.retries = retries
+		a.maxRetryWait = maxWait
+	}
+}
+
+// WithBackoff returns a function that sets the delay before the first retry
+// of a request when GitHub doesn't ask for one.
+func WithBackoff(backoff time.Duration) func(*API) {
+	return func(a *API) {
+		a.backoff = backoff
+	}
+}
+
+// do sends a request with the given method to the given path of the GitHub
+// API, with the given body encoded as JSON if it isn't nil, and decodes the
+// JSON response into v.
+func (a *API) do(ctx context.Context, accessToken string, method string, path string, body any, v any) (err error) {
+	u := a.baseURL + path
+	ctx, span := startRequest(ctx, method, u)
+	defer func() { tracing.End(span, err) }()
+	var b []byte
+	if body != nil {
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := a.attempt(ctx, accessToken, method, u, b, v)
+		if err == nil || retryAfter < 0 || attempt >= a.retries {
+			return err
+		}
+		if retryAfter == 0 {
+			retryAfter = a.backoff << attempt
+		}
+		if retryAfter > a.maxRetryWait {
+			return err
+		}
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once, and returns how long to wait before it may
+// be attempted again if it failed: a negative duration if it shouldn't be,
+// and zero if GitHub didn't say.
+func (a *API) attempt(ctx context.Context, accessToken string, method string, u string, body []byte, v any) (time.Duration, error) {
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return -1, err
+	}
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(request)
+	if err != nil {
+		// the caller's context being done isn't worth retrying
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var message struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&message)
+		return retryDelay(resp, time.Now()), &APIError{StatusCode: resp.StatusCode, Message: message.Message}
+	}
+	return -1, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// retryDelay returns how long to wait before attempting the request of the
+// given failed response again: a negative duration if it shouldn't be, and
+// zero if GitHub didn't say.
+//
+// Server errors are retried, and so are responses to requests that hit a
+// rate limit, which GitHub answers with a 429 or a 403, along with either a
+// "Retry-After" header or an "X-RateLimit-Reset" header once no requests
+// remain.
+func retryDelay(resp *http.Response, now time.Time) time.Duration {
+	switch {
+	case resp.StatusCode >= 500:
+		return retryAfter(resp, now)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(resp, now)
+	case resp.StatusCode == http.StatusForbidden:
+		if resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return retryAfter(resp, now)
+		}
+	}
+	return -1
+}
+
+// retryAfter returns the delay asked for by the "Retry-After" header of the
+// given response, in seconds or as a date, or until the time in its
+// "X-RateLimit-Reset" header, in seconds since the epoch, and zero if
+// neither is set.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return max(time.Duration(seconds)*time.Second, time.Millisecond)
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(now), time.Millisecond)
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Unix(reset, 0).Sub(now), time.Millisecond)
+		}
+	}
+	return 0
+}
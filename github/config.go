@@ -2,11 +2,18 @@ package github
 
 import (
 	"os"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 )
 
+// ScopeRepo is the scope that lets projects be linked to repositories of the
+// user, whose issues are kept in sync with the tasks of the project. It isn't
+// asked for when logging in, but only once the user links a repository,
+// with RepoAuthCodeOption.
+const ScopeRepo = "repo"
+
 // Config is a oauth2 configuration with
 // a client id, client secret, scopes and endpoint.
 //
@@ -17,3 +24,17 @@ var Config = &oauth2.Config{
 	Scopes:       []string{"read:user", "user:email"},
 	Endpoint:     github.Endpoint,
 }
+
+// RepoAuthCodeOption returns the option of AuthCodeURL that asks for the
+// scopes of the given configuration along with ScopeRepo.
+func RepoAuthCodeOption(config *oauth2.Config) oauth2.AuthCodeOption {
+	scopes := append(append([]string{}, config.Scopes...), ScopeRepo)
+	return oauth2.SetAuthURLParam("scope", strings.Join(scopes, " "))
+}
+
+// TokenScopes returns the scopes granted to the given token, separated by
+// commas, as sent by GitHub along with it.
+func TokenScopes(token *oauth2.Token) string {
+	scopes, _ := token.Extra("scope").(string)
+	return scopes
+}
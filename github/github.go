@@ -1,10 +1,14 @@
 package github
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/webdevfuel/projectmotor/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Email is a representation of data returned from the GitHub API when
@@ -19,7 +23,9 @@ type Email struct {
 // User is a representation of data returned from the GitHub API when
 // making a GET request to "https://api.github.com/user".
 type User struct {
-	ID int32 `json:"id"`
+	ID        int32  `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
 }
 
 // Data is a representation of a user's GitHub account.
@@ -28,22 +34,27 @@ type Data struct {
 	ID int32
 	// PrimaryEmail is the primary email address of the user's GitHub account.
 	PrimaryEmail string
+	// Name is the name on the user's GitHub profile, which may be empty.
+	Name string
+	// AvatarURL is the url of the avatar of the user's GitHub account.
+	AvatarURL string
 }
 
 // GitHubOAuth2 is a wrapper around a GitHub OAuth access token.
 //
 // It's used to attach methods to it to interact with the GitHub API.
 type GitHubOAuth2 struct {
+	api         *API
 	accessToken string
 }
 
 // GetData returns a new Data and the first error encountered when fetching
 // the GitHub API.
 //
-// It fetches the GitHub API to know what the primary email and id of
-// the user is given the access token.
-func (g *GitHubOAuth2) GetData() (Data, error) {
-	emails, err := fetchEmails(g.accessToken)
+// It fetches the GitHub API to know what the primary email, id, name and
+// avatar of the user are given the access token.
+func (g *GitHubOAuth2) GetData(ctx context.Context) (Data, error) {
+	emails, err := g.api.GetEmails(ctx, g.accessToken)
 	if err != nil {
 		return Data{}, err
 	}
@@ -51,58 +62,55 @@ func (g *GitHubOAuth2) GetData() (Data, error) {
 	if err != nil {
 		return Data{}, err
 	}
-	user, err := fetchUser(g.accessToken)
+	user, err := g.api.GetUser(ctx, g.accessToken)
 	if err != nil {
 		return Data{}, err
 	}
 	return Data{
 		ID:           user.ID,
 		PrimaryEmail: primaryEmail,
+		Name:         user.Name,
+		AvatarURL:    user.AvatarURL,
 	}, nil
 }
 
-// NewGitHubOAuth2 returns a new GitHubOAuth2 with the given access token.
-func NewGitHubOAuth2(accessToken string) *GitHubOAuth2 {
+// NewGitHubOAuth2 returns a new GitHubOAuth2 with the given access token,
+// which sends requests with the given API.
+func NewGitHubOAuth2(api *API, accessToken string) *GitHubOAuth2 {
 	return &GitHubOAuth2{
+		api:         api,
 		accessToken: accessToken,
 	}
 }
 
-func fetchEmails(accessToken string) ([]Email, error) {
+// GetEmails returns the email addresses of the user with the given access
+// token, and the first error encountered when fetching the GitHub API.
+func (a *API) GetEmails(ctx context.Context, accessToken string) ([]Email, error) {
 	var emails []Email
-	request, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-	if err != nil {
-		return []Email{}, err
-	}
-	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	resp, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return []Email{}, err
-	}
-	err = json.NewDecoder(resp.Body).Decode(&emails)
-	if err != nil {
-		return []Email{}, err
-	}
-	return emails, nil
-
+	err := a.do(ctx, accessToken, http.MethodGet, "/user/emails", nil, &emails)
+	return emails, err
 }
 
-func fetchUser(accessToken string) (User, error) {
+// GetUser returns the user with the given access token, and the first error
+// encountered when fetching the GitHub API.
+func (a *API) GetUser(ctx context.Context, accessToken string) (User, error) {
 	var user User
-	request, err := http.NewRequest("GET", "https://api.github.com/user", nil)
-	if err != nil {
-		return User{}, err
-	}
-	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
-	resp, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return User{}, err
-	}
-	err = json.NewDecoder(resp.Body).Decode(&user)
-	if err != nil {
-		return User{}, err
-	}
-	return user, nil
+	err := a.do(ctx, accessToken, http.MethodGet, "/user", nil, &user)
+	return user, err
+}
+
+// startRequest returns a copy of the given context with a client span for a
+// request to the GitHub API, and the span.
+func startRequest(ctx context.Context, method string, url string) (context.Context, trace.Span) {
+	return tracing.Start(
+		ctx,
+		fmt.Sprintf("GitHub %s", method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(url),
+		),
+	)
 }
 
 func primaryEmail(emails []Email) (string, error) {
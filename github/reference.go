@@ -0,0 +1,30 @@
+package github
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var taskReferencePattern = regexp.MustCompile(`(?i)\bPM-(\d{1,9})\b`)
+
+// TaskReferences returns the ids of the tasks referenced as "PM-123" in the
+// given texts, like the title and body of a pull request or the name of its
+// branch, in the order they first appear and without duplicates.
+//
+// References are case insensitive, so that they can be written in branch
+// names, e.g. "pm-123-fix-login".
+func TaskReferences(texts ...string) []int32 {
+	var ids []int32
+	seen := map[int32]bool{}
+	for _, text := range texts {
+		for _, matches := range taskReferencePattern.FindAllStringSubmatch(text, -1) {
+			id, err := strconv.ParseInt(matches[1], 10, 32)
+			if err != nil || id == 0 || seen[int32(id)] {
+				continue
+			}
+			seen[int32(id)] = true
+			ids = append(ids, int32(id))
+		}
+	}
+	return ids
+}
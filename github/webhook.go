@@ -0,0 +1,113 @@
+package github
+
+// Headers GitHub sends along with every webhook delivery.
+const (
+	HeaderEvent     = "X-GitHub-Event"
+	HeaderDelivery  = "X-GitHub-Delivery"
+	HeaderSignature = "X-Hub-Signature-256"
+)
+
+// Event types of webhook deliveries handled by the app.
+const (
+	EventPing        = "ping"
+	EventIssues      = "issues"
+	EventPullRequest = "pull_request"
+	EventPush        = "push"
+)
+
+// Actions of the "issues" event handled by the app.
+const (
+	IssueActionOpened      = "opened"
+	IssueActionEdited      = "edited"
+	IssueActionClosed      = "closed"
+	IssueActionReopened    = "reopened"
+	IssueActionDeleted     = "deleted"
+	IssueActionTransferred = "transferred"
+)
+
+// An IssuesEvent is the body of a webhook delivery of the "issues" event.
+type IssuesEvent struct {
+	Action     string `json:"action"`
+	Issue      Issue  `json:"issue"`
+	Repository Repo   `json:"repository"`
+	// Changes holds the previous values of the fields of the issue changed
+	// by an "edited" action.
+	Changes IssueChanges `json:"changes"`
+}
+
+// IssueChanges are the previous values of the fields of an edited issue,
+// which are nil when the field wasn't changed.
+type IssueChanges struct {
+	Title *Change `json:"title,omitempty"`
+	Body  *Change `json:"body,omitempty"`
+}
+
+// A Change is the previous value of a field.
+type Change struct {
+	From string `json:"from"`
+}
+
+// Actions of the "pull_request" event handled by the app. Other actions only
+// update the pull request.
+const (
+	PullRequestActionClosed = "closed"
+)
+
+// A PullRequestEvent is the body of a webhook delivery of the "pull_request"
+// event.
+type PullRequestEvent struct {
+	Action      string      `json:"action"`
+	PullRequest PullRequest `json:"pull_request"`
+	Repository  Repo        `json:"repository"`
+}
+
+// A PullRequest is a representation of the pull request of a
+// PullRequestEvent.
+type PullRequest struct {
+	Number  int32  `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	Merged  bool   `json:"merged"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		// Ref is the name of the branch of the pull request.
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// States of pull requests, where GitHub reports merged ones as closed.
+const (
+	PullRequestOpen   = "open"
+	PullRequestMerged = "merged"
+	PullRequestClosed = "closed"
+)
+
+// Status returns whether the pull request is open, merged or closed without
+// being merged.
+func (pr PullRequest) Status() string {
+	if pr.Merged {
+		return PullRequestMerged
+	}
+	if pr.State == PullRequestClosed {
+		return PullRequestClosed
+	}
+	return PullRequestOpen
+}
+
+// A PushEvent is the body of a webhook delivery of the "push" event.
+type PushEvent struct {
+	// Ref is the full name of the branch pushed to, e.g.
+	// "refs/heads/main".
+	Ref        string   `json:"ref"`
+	Commits    []Commit `json:"commits"`
+	Repository Repo     `json:"repository"`
+}
+
+// A Commit is a representation of a commit of a PushEvent.
+type Commit struct {
+	// ID is the sha of the commit.
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/signature"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestGitHubLinks(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	secret := "a-very-secret-signing-key"
+	_, err = handler.DB.Exec(`
+		insert into github_repos (project_id, owner, name, user_id, webhook_secret)
+		values (1, 'acme', 'widgets', 1, $1)
+	`, secret)
+	if err != nil {
+		t.Errorf("error linking repository %s", err)
+		return
+	}
+
+	deliver := func(event string, body string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "github/projects/1/webhook")),
+			test.WithMethod(test.Post),
+			test.WithBody([]byte(body)),
+			test.WithHeader("Content-Type", "application/json"),
+			test.WithHeader(github.HeaderEvent, event),
+			test.WithHeader(github.HeaderSignature, signature.Sign(secret, []byte(body))),
+		)
+		return test.Do(req)
+	}
+
+	taskPage := func(id int) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/tasks/%d", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		return test.Do(req)
+	}
+
+	status := func(id int) string {
+		var status string
+		handler.DB.Get(&status, "select status from tasks where id = $1", id)
+		return status
+	}
+
+	t.Run("pull requests are linked to referenced tasks", func(t *testing.T) {
+		// task 3 belongs to another project
+		body := `{
+			"action": "opened",
+			"pull_request": {"number": 7, "title": "Fix the login PM-1", "body": "Also fixes PM-3", "state": "open", "html_url": "https://github.com/acme/widgets/pull/7", "head": {"ref": "pm-2-login"}},
+			"repository": {"full_name": "acme/widgets"}
+		}`
+		res := deliver(github.EventPullRequest, body)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+
+		doc := test.Doc(taskPage(1))
+		assert.Equal("open", doc.Find("li.task-pull-request .task-pull-request-state").Text())
+		assert.Equal("#7 Fix the login PM-1", doc.Find("li.task-pull-request a").Text())
+		assert.Equal(1, test.Doc(taskPage(2)).Find("li.task-pull-request").Length())
+
+		var count int
+		handler.DB.Get(&count, "select count(*) from github_pull_requests where task_id = 3")
+		assert.Equal(0, count)
+	})
+
+	t.Run("commits are linked to referenced tasks", func(t *testing.T) {
+		body := `{
+			"ref": "refs/heads/pm-2-login",
+			"commits": [
+				{"id": "0123456789abcdef0123456789abcdef01234567", "message": "Check the password PM-1\n\nIt was never checked.", "url": "https://github.com/acme/widgets/commit/0123456"},
+				{"id": "89abcdef0123456789abcdef0123456789abcdef", "message": "Tidy up", "url": "https://github.com/acme/widgets/commit/89abcde"}
+			],
+			"repository": {"full_name": "acme/widgets"}
+		}`
+		res := deliver(github.EventPush, body)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+		doc := test.Doc(taskPage(1))
+		assert.Equal(1, doc.Find("li.task-commit").Length())
+		assert.Equal("0123456", doc.Find("li.task-commit a").Text())
+		assert.Equal("Check the password PM-1", doc.Find("li.task-commit span").Text())
+
+		// pushing the same commit again doesn't link it twice
+		deliver(github.EventPush, body)
+		assert.Equal(1, test.Doc(taskPage(1)).Find("li.task-commit").Length())
+	})
+
+	t.Run("merged pull requests only complete tasks when set to", func(t *testing.T) {
+		body := `{
+			"action": "closed",
+			"pull_request": {"number": 8, "title": "Refactor PM-2", "body": "", "state": "closed", "merged": true, "html_url": "https://github.com/acme/widgets/pull/8", "head": {"ref": "refactor"}},
+			"repository": {"full_name": "acme/widgets"}
+		}`
+		deliver(github.EventPullRequest, body)
+		assert := assert.New(t)
+		assert.NotEqual("done", status(2))
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/github/settings")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "complete_tasks_on_merge", Value: "on"},
+			),
+		)
+		res := test.Do(req)
+		assert.Equal(200, res.StatusCode)
+
+		body = `{
+			"action": "closed",
+			"pull_request": {"number": 7, "title": "Fix the login PM-1", "body": "", "state": "closed", "merged": true, "html_url": "https://github.com/acme/widgets/pull/7", "head": {"ref": "pm-2-login"}},
+			"repository": {"full_name": "acme/widgets"}
+		}`
+		deliver(github.EventPullRequest, body)
+		assert.Equal("done", status(1))
+		assert.Equal("done", status(2))
+		assert.Equal("merged", test.Doc(taskPage(1)).Find("li.task-pull-request .task-pull-request-state").Text())
+	})
+
+	t.Run("closed pull requests don't complete tasks", func(t *testing.T) {
+		_, err := handler.DB.Exec("update tasks set status = 'todo' where id = 1")
+		if err != nil {
+			t.Errorf("error updating task %s", err)
+			return
+		}
+		body := `{
+			"action": "closed",
+			"pull_request": {"number": 9, "title": "Try again PM-1", "body": "", "state": "closed", "merged": false, "html_url": "https://github.com/acme/widgets/pull/9", "head": {"ref": "retry"}},
+			"repository": {"full_name": "acme/widgets"}
+		}`
+		deliver(github.EventPullRequest, body)
+		assert := assert.New(t)
+		assert.Equal("todo", status(1))
+		var state string
+		handler.DB.Get(&state, "select state from github_pull_requests where task_id = 1 and number = 9")
+		assert.Equal("closed", state)
+	})
+}
+
+func TestTaskReferences(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]int32{123, 4}, github.TaskReferences("Fix PM-123 and pm-4", "PM-123"))
+	assert.Equal([]int32{12}, github.TaskReferences("feature/pm-12-login"))
+	assert.Nil(github.TaskReferences("PM-12a", "XPM-1", "PM-", "PM-0"))
+}
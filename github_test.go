@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/signature"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestGitHub(t *testing.T) {
+	gh := test.NewGitHub()
+	defer gh.Close()
+	gh.AddRepo(
+		"acme", "widgets",
+		github.Issue{Number: 1, Title: "Fix the login page", Body: "It's broken", State: github.IssueOpen},
+		github.Issue{Number: 2, Title: "Add a widget", State: github.IssueOpen, PullRequest: &struct{}{}},
+		github.Issue{Number: 3, Title: "Write the docs", State: github.IssueOpen},
+	)
+
+	handler, server := test.NewServer(test.WithGitHub(gh), test.WithPublicURL("https://projectmotor.example.com"))
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	link := func(repository string, cookie string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/github")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "repository", Value: repository},
+			),
+		)
+		return test.Do(req)
+	}
+
+	deliver := func(event string, body string, secret string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "github/projects/1/webhook")),
+			test.WithMethod(test.Post),
+			test.WithBody([]byte(body)),
+			test.WithHeader("Content-Type", "application/json"),
+			test.WithHeader(github.HeaderEvent, event),
+			test.WithHeader(github.HeaderSignature, signature.Sign(secret, []byte(body))),
+		)
+		return test.Do(req)
+	}
+
+	issueTask := func(number int) (task struct {
+		Title  string `db:"title"`
+		Status string `db:"status"`
+	}) {
+		handler.DB.Get(&task, `
+			select tasks.title, tasks.status from tasks
+			join github_issues on github_issues.task_id = tasks.id
+			where github_issues.project_id = 1 and github_issues.number = $1
+		`, number)
+		return task
+	}
+
+	t.Run("link invalid repository", func(t *testing.T) {
+		res := link("not a repository", cookie)
+		form := test.NewForm(test.Doc(res), "github-repo-form")
+		assert.Equal(t, "must be owner/name or the url of the repository", form.MustGetFieldByID("repository").Error)
+	})
+
+	t.Run("link missing repository", func(t *testing.T) {
+		res := link("acme/gadgets", cookie)
+		form := test.NewForm(test.Doc(res), "github-repo-form")
+		assert.Equal(t, "wasn't found, or you can't access it", form.MustGetFieldByID("repository").Error)
+	})
+
+	t.Run("link repository of projects of others", func(t *testing.T) {
+		res := link("acme/widgets", otherCookie)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("link repository", func(t *testing.T) {
+		res := link("https://github.com/acme/widgets", cookie)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("acme/widgets", doc.Find("#github-repo-name").Text())
+		assert.Equal(0, doc.Find("#github-repo-form").Length())
+		url, _ := doc.Find("#github_webhook_url").Attr("value")
+		assert.Equal("https://projectmotor.example.com/github/projects/1/webhook", url)
+	})
+
+	t.Run("import open issues", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/github/import")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("2 issues linked to tasks", doc.Find("#github-repo-issues").Text())
+		assert.Equal("Fix the login page", issueTask(1).Title)
+		assert.Equal("", issueTask(2).Title)
+		assert.Equal("Write the docs", issueTask(3).Title)
+
+		// issues are only imported once
+		res = test.Do(test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/github/import")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		))
+		assert.Equal("2 issues linked to tasks", test.Doc(res).Find("#github-repo-issues").Text())
+	})
+
+	t.Run("task changes are pushed to issues", func(t *testing.T) {
+		var taskID int
+		handler.DB.Get(&taskID, "select task_id from github_issues where project_id = 1 and number = 1")
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/tasks/%d", server.URL, taskID)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Fix the login page for good"},
+				test.FormValue{Key: "status", Value: "done"},
+			),
+		)
+		test.Do(req)
+		assert := assert.New(t)
+		updates := gh.IssueUpdates()
+		if !assert.Len(updates, 1) {
+			return
+		}
+		assert.Equal("acme/widgets", updates[0].Repo)
+		assert.Equal(int32(1), updates[0].Number)
+		assert.Equal("Bearer REDACTED", updates[0].Authorization)
+		assert.Equal("Fix the login page for good", updates[0].Update.Title)
+		assert.Equal(github.IssueClosed, updates[0].Update.State)
+	})
+
+	var secret string
+	handler.DB.Get(&secret, "select webhook_secret from github_repos where project_id = 1")
+
+	t.Run("deliveries must be signed", func(t *testing.T) {
+		body := `{"action": "opened", "issue": {"number": 4, "title": "Forged", "state": "open"}, "repository": {"full_name": "acme/widgets"}}`
+		res := deliver(github.EventIssues, body, "not-the-secret")
+		assert := assert.New(t)
+		assert.Equal(401, res.StatusCode)
+		assert.Equal("", issueTask(4).Title)
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		res := deliver(github.EventPing, `{"zen": "Keep it logically awesome."}`, secret)
+		assert.Equal(t, 204, res.StatusCode)
+	})
+
+	t.Run("opened issues are created as tasks", func(t *testing.T) {
+		body := `{"action": "opened", "issue": {"number": 4, "title": "Ship it", "state": "open"}, "repository": {"full_name": "acme/widgets"}}`
+		res := deliver(github.EventIssues, body, secret)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("Ship it", issueTask(4).Title)
+		assert.Equal("todo", issueTask(4).Status)
+	})
+
+	t.Run("edited and closed issues update tasks", func(t *testing.T) {
+		body := `{"action": "edited", "issue": {"number": 3, "title": "Write the API docs", "state": "open"}, "changes": {"title": {"from": "Write the docs"}}, "repository": {"full_name": "acme/widgets"}}`
+		res := deliver(github.EventIssues, body, secret)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("Write the API docs", issueTask(3).Title)
+
+		body = `{"action": "closed", "issue": {"number": 3, "title": "Write the API docs", "state": "closed"}, "repository": {"full_name": "acme/widgets"}}`
+		res = deliver(github.EventIssues, body, secret)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("done", issueTask(3).Status)
+
+		body = `{"action": "reopened", "issue": {"number": 3, "title": "Write the API docs", "state": "open"}, "repository": {"full_name": "acme/widgets"}}`
+		deliver(github.EventIssues, body, secret)
+		assert.Equal("todo", issueTask(3).Status)
+	})
+
+	t.Run("deliveries of other repositories", func(t *testing.T) {
+		body := `{"action": "opened", "issue": {"number": 5, "title": "Elsewhere", "state": "open"}, "repository": {"full_name": "acme/gadgets"}}`
+		res := deliver(github.EventIssues, body, secret)
+		assert := assert.New(t)
+		assert.Equal(400, res.StatusCode)
+		assert.Equal("", issueTask(5).Title)
+	})
+
+	t.Run("deliveries to projects of suspended users are ignored", func(t *testing.T) {
+		handler.DB.MustExec("update users set suspended_at = now() where id = 1")
+		defer handler.DB.MustExec("update users set suspended_at = null where id = 1")
+		body := `{"action": "opened", "issue": {"number": 6, "title": "While away", "state": "open"}, "repository": {"full_name": "acme/widgets"}}`
+		res := deliver(github.EventIssues, body, secret)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("", issueTask(6).Title)
+	})
+
+	t.Run("unlink repository", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/github")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, test.Doc(res).Find("#github-repo-form").Length())
+		var count int
+		handler.DB.Get(&count, "select count(*) from github_issues where project_id = 1")
+		assert.Equal(0, count)
+		// imported tasks are kept
+		handler.DB.Get(&count, "select count(*) from tasks where title = 'Ship it'")
+		assert.Equal(1, count)
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/account"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// CreateDataExport asks for an export of the data of the user, which is
+// generated in the background by the account.Worker, and renders their
+// exports again.
+func (h *Handler) CreateDataExport(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	_, err := h.DataExportService.Create(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.GetDataExports(w, r)
+}
+
+// GetDataExports renders the data exports of the user, which the page polls
+// while one of them is pending.
+func (h *Handler) GetDataExports(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	exports, err := h.DataExportService.GetAll(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, template.ProfileDataExports(exports))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DownloadDataExport serves the ZIP file of a ready data export of the
+// user.
+func (h *Handler) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	export, err := h.DataExportService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if export.Status != database.DataExportReady {
+		h.Error(w, r, fmt.Errorf("data export %d is %s", export.ID, export.Status), http.StatusNotFound)
+		return
+	}
+	filename := fmt.Sprintf("projectmotor-%s.zip", export.CreatedAt.Time.Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	h.serveFile(w, r, export.StorageKey.String, "application/zip", export.Size.Int64)
+}
+
+type DeleteAccountForm struct {
+	Email string `form:"email"`
+}
+
+func (data DeleteAccountForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Email, validation.Required),
+	)
+}
+
+// ScheduleAccountDeletion schedules the account of the user to be deleted
+// once the grace period is over, as long as they confirmed it by typing
+// their email address, and renders the deletion section again.
+func (h *Handler) ScheduleAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	var data DeleteAccountForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	if ok && !strings.EqualFold(strings.TrimSpace(data.Email), user.Email) {
+		ok = false
+		errors = validator.ValidatedSlice{{Key: "Email", Value: data.Email, Error: "doesn't match your email address"}}
+	}
+	if ok {
+		// timestamps are stored without a time zone, in UTC
+		at := pgtype.Timestamp{Time: time.Now().UTC().Add(account.GracePeriod), Valid: true}
+		user, err = h.UserService.ScheduleDeletion(r.Context(), user.ID, at)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		errors = validator.NewValidatedSlice()
+	}
+	h.renderAccountDeletion(w, r, user, errors)
+}
+
+// CancelAccountDeletion keeps the account of the user, if it was scheduled
+// to be deleted, and renders the deletion section again.
+func (h *Handler) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	user, err := h.UserService.CancelDeletion(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderAccountDeletion(w, r, user, validator.NewValidatedSlice())
+}
+
+// renderAccountDeletion renders the deletion section of the profile of the
+// given user, listing the projects deleted along with their account.
+func (h *Handler) renderAccountDeletion(w http.ResponseWriter, r *http.Request, user database.User, errors validator.ValidatedSlice) {
+	projects, err := h.ProjectService.GetAllDeletedWithUser(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, template.ProfileAccountDeletion(user, projects, errors))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
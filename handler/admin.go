@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// Admin redirects to the first tab of the admin area.
+func (h *Handler) Admin(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminUsers renders the users of every account, filtered by the search in
+// the "q" query.
+func (h *Handler) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	users, err := h.AdminService.SearchUsers(r.Context(), search)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.AdminUsers(users, search, h.GetUserFromContext(r.Context()).ID)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// AdminProjects renders the projects of every user, filtered by the search
+// in the "q" query.
+func (h *Handler) AdminProjects(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	projects, err := h.AdminService.SearchProjects(r.Context(), search)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.AdminProjects(projects, search)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// AdminSessions renders the sessions of every user, filtered by the search
+// in the "q" query.
+func (h *Handler) AdminSessions(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	sessions, err := h.AdminService.SearchSessions(r.Context(), search)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.AdminSessions(sessions, search)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// SuspendUser suspends a user, logging them out of all of their sessions,
+// and renders their row again.
+//
+// Admins can't suspend themselves, so that there's always one left.
+func (h *Handler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	admin := h.GetUserFromContext(r.Context())
+	if id == admin.ID {
+		h.renderAdminError(w, r, http.StatusBadRequest, "It's not possible to suspend yourself.")
+		return
+	}
+	_, err = h.AdminService.SuspendUser(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderAdminUser(w, r, id, "User suspended and logged out of all sessions")
+}
+
+// UnsuspendUser lets a suspended user log in again, and renders their row
+// again.
+func (h *Handler) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	_, err = h.UserService.Unsuspend(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderAdminUser(w, r, id, "User unsuspended")
+}
+
+func (h *Handler) renderAdminUser(w http.ResponseWriter, r *http.Request, id int32, message string) {
+	user, err := h.AdminService.GetUser(r.Context(), id)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.AdminUserRow(user, h.GetUserFromContext(r.Context()).ID),
+		successToastComponent(message),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// AdminDeleteSession deletes a session of any user, logging them out of it.
+func (h *Handler) AdminDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	err = h.SessionService.DeleteByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, successToastComponent("Session deleted successfully"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type AdminTransferProjectForm struct {
+	Email string `form:"email"`
+}
+
+func (data AdminTransferProjectForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Email, validation.Required, is.Email),
+	)
+}
+
+// AdminTransferProject makes the user with the given email address the
+// owner of a project of any user, and renders its row again. The previous
+// owner keeps access to the project as a shared user.
+func (h *Handler) AdminTransferProject(w http.ResponseWriter, r *http.Request) {
+	var data AdminTransferProjectForm
+	ok, _, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.renderAdminError(w, r, http.StatusBadRequest, "The email address must be valid.")
+		return
+	}
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	owner, err := h.UserService.GetUserByEmail(r.Context(), data.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.renderAdminError(w, r, http.StatusNotFound, "We couldn't find a user with the email address you provided.")
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, err := h.AdminService.TransferProject(r.Context(), id, owner.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.AdminProjectRow(database.AdminProject{Project: project, OwnerEmail: owner.Email}),
+		successToastComponent("Project transferred successfully"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderAdminError replies to an action of the admin area with an error
+// toast with the given message, leaving the page as it is.
+func (h *Handler) renderAdminError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	h.Reswap(w, "none")
+	w.WriteHeader(code)
+	h.Render(w, r, errorToastComponent(message))
+}
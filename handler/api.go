@@ -0,0 +1,464 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/api"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/webhook"
+)
+
+// maxAPIBodySize is the largest request body the API reads.
+const maxAPIBodySize = 1 << 20
+
+// JSON replies to the request with the given HTTP code, and the given value
+// encoded as JSON.
+func (h *Handler) JSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// JSONError replies to the request with the given HTTP code and an api.Error
+// with the given message, and logs the error with the request-scoped logger.
+func (h *Handler) JSONError(w http.ResponseWriter, r *http.Request, err error, code int, message string) {
+	ctx := r.Context()
+	logging.FromContext(ctx).ErrorContext(ctx, "request failed", "error", err, "status", code)
+	h.JSON(w, code, api.Error{Message: message})
+}
+
+// jsonValidationError replies to the request with the fields that failed
+// the given validation error, or with an internal server error if it isn't
+// one.
+func (h *Handler) jsonValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	fields := map[string]string{}
+	for key, err := range errs {
+		fields[key] = err.Error()
+	}
+	h.JSON(w, http.StatusBadRequest, api.Error{
+		Message: "The request has invalid fields.",
+		Fields:  fields,
+	})
+}
+
+// decodeJSON decodes the JSON body of the given request into v, and replies
+// with a bad request if it can't.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusBadRequest, "The request body must be a JSON object.")
+		return false
+	}
+	return true
+}
+
+// getAPIOwnedProject returns the project of the "id" url param if the user
+// owns it, and replies with a not found otherwise.
+func (h *Handler) getAPIOwnedProject(w http.ResponseWriter, r *http.Request) (database.Project, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusNotFound, "Project not found.")
+		return database.Project{}, false
+	}
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.JSONError(w, r, err, http.StatusNotFound, "Project not found.")
+		return database.Project{}, false
+	}
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return database.Project{}, false
+	}
+	return project, true
+}
+
+// getAPIOwnedTask returns the task of the "id" url param if the user owns
+// it, and replies with a not found otherwise.
+func (h *Handler) getAPIOwnedTask(w http.ResponseWriter, r *http.Request) (database.Task, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusNotFound, "Task not found.")
+		return database.Task{}, false
+	}
+	task, err := h.TaskService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.JSONError(w, r, err, http.StatusNotFound, "Task not found.")
+		return database.Task{}, false
+	}
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return database.Task{}, false
+	}
+	return task, true
+}
+
+// ensureAPIActiveProject returns false after replying with a conflict if the
+// project with the given id is archived.
+func (h *Handler) ensureAPIActiveProject(w http.ResponseWriter, r *http.Request, projectID pgtype.Int4) bool {
+	archived, err := h.ProjectService.IsArchived(r.Context(), projectID)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return false
+	}
+	if archived {
+		h.JSONError(w, r, errors.New("project is archived"), http.StatusConflict, projectArchivedMessage)
+		return false
+	}
+	return true
+}
+
+// APIGetProjects replies with the active projects of the user, or the
+// archived ones if the url query "archived" is "true".
+func (h *Handler) APIGetProjects(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	var projects []database.Project
+	var err error
+	if h.GetURLQuery(r, "archived").Value == "true" {
+		projects, err = h.ProjectService.GetAllArchived(r.Context(), user.ID)
+	} else {
+		projects, err = h.ProjectService.GetAll(r.Context(), user.ID)
+	}
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	data := []api.Project{}
+	for _, project := range projects {
+		data = append(data, apiProject(project))
+	}
+	h.JSON(w, http.StatusOK, data)
+}
+
+// APICreateProject creates a project the user owns.
+func (h *Handler) APICreateProject(w http.ResponseWriter, r *http.Request) {
+	var data api.CreateProject
+	if !h.decodeJSON(w, r, &data) {
+		return
+	}
+	err := validation.ValidateStruct(&data,
+		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+	)
+	if err != nil {
+		h.jsonValidationError(w, r, err)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	project, err := h.ProjectService.Create(r.Context(), data.Title, data.Description, user.ID)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.JSON(w, http.StatusCreated, apiProject(project))
+}
+
+// APIShareProject shares a project the user owns with the user with the
+// given email address.
+func (h *Handler) APIShareProject(w http.ResponseWriter, r *http.Request) {
+	var data api.ShareProject
+	if !h.decodeJSON(w, r, &data) {
+		return
+	}
+	err := validation.ValidateStruct(&data,
+		validation.Field(&data.Email, validation.Required, is.Email),
+	)
+	if err != nil {
+		h.jsonValidationError(w, r, err)
+		return
+	}
+	project, ok := h.getAPIOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	owner := h.GetUserFromContext(r.Context())
+	user, err := h.UserService.GetUserByEmail(r.Context(), data.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.JSONError(w, r, err, http.StatusNotFound, "We couldn't find a user with the email address you provided.")
+		return
+	}
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if owner.ID == user.ID {
+		h.JSONError(w, r, errors.New("sharing project with owner"), http.StatusBadRequest, "It's not possible to share a project with yourself.")
+		return
+	}
+	exists, err := h.shareProject(r.Context(), project, user)
+	if exists {
+		h.JSONError(w, r, errors.New("project already shared"), http.StatusConflict, "The user with the email address you provided already has access to the project.")
+		return
+	}
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.JSON(w, http.StatusCreated, api.Share{
+		ProjectID: project.ID,
+		UserID:    user.ID,
+		Email:     user.Email,
+	})
+}
+
+// apiTaskQuery is the url query of the list of tasks, whose fields are
+// named after their keys in validation errors.
+type apiTaskQuery struct {
+	Project   string `json:"project"`
+	Status    string `json:"status"`
+	DueBefore string `json:"due_before"`
+}
+
+func (data apiTaskQuery) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Project, is.Digit),
+		validation.Field(&data.Status, validation.In(api.TaskStatusTodo, api.TaskStatusInProgress, api.TaskStatusDone)),
+		validation.Field(&data.DueBefore, validation.Date(time.DateOnly)),
+	)
+}
+
+// APIGetTasks replies with the tasks the user owns, filtered by the url
+// queries "project", "status" and "due_before".
+func (h *Handler) APIGetTasks(w http.ResponseWriter, r *http.Request) {
+	query := apiTaskQuery{
+		Project:   h.GetURLQuery(r, "project").Value,
+		Status:    h.GetURLQuery(r, "status").Value,
+		DueBefore: h.GetURLQuery(r, "due_before").Value,
+	}
+	err := query.Validate()
+	if err != nil {
+		h.jsonValidationError(w, r, err)
+		return
+	}
+	var filter database.TaskFilter
+	filter.Status = database.TaskStatus(query.Status)
+	filter.ProjectID, err = database.Int4FromString(query.Project)
+	if err != nil {
+		h.jsonValidationError(w, r, validation.Errors{"project": errors.New("must be a valid id")})
+		return
+	}
+	filter.DueBefore, err = database.DateFromString(query.DueBefore)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	tasks, err := h.TaskService.GetAllByFilter(r.Context(), user.ID, filter)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	data := []api.Task{}
+	for _, task := range tasks {
+		data = append(data, apiTask(task))
+	}
+	h.JSON(w, http.StatusOK, data)
+}
+
+// APIGetTask replies with a task the user owns.
+func (h *Handler) APIGetTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := h.getAPIOwnedTask(w, r)
+	if !ok {
+		return
+	}
+	h.JSON(w, http.StatusOK, apiTask(task))
+}
+
+// APICreateTask creates a task the user owns, in a project they own if
+// one is given.
+func (h *Handler) APICreateTask(w http.ResponseWriter, r *http.Request) {
+	var data api.CreateTask
+	if !h.decodeJSON(w, r, &data) {
+		return
+	}
+	err := validation.ValidateStruct(&data,
+		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.DueDate, validation.Date(time.DateOnly)),
+	)
+	if err != nil {
+		h.jsonValidationError(w, r, err)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	var projectID pgtype.Int4
+	if data.ProjectID != nil {
+		project, err := h.ProjectService.Get(r.Context(), *data.ProjectID, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.jsonValidationError(w, r, validation.Errors{"project_id": errors.New("must be a project you own")})
+			return
+		}
+		if err != nil {
+			h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if project.Archived() {
+			h.JSONError(w, r, errors.New("project is archived"), http.StatusConflict, projectArchivedMessage)
+			return
+		}
+		projectID = pgtype.Int4{Int32: project.ID, Valid: true}
+	} else {
+		shared, err := h.inSharedWorkspace(r.Context(), user.ID)
+		if err != nil {
+			h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if shared {
+			h.jsonValidationError(w, r, validation.Errors{"project_id": errors.New(sharedWorkspaceProjectMessage)})
+			return
+		}
+	}
+	dueDate, err := database.DateFromString(data.DueDate)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	task, err := h.TaskService.CreateWithTx(r.Context(), tx, data.Title, data.Description, dueDate, projectID, user.ID)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	err = h.enqueueWebhookWithTx(r.Context(), tx, task.ProjectID, webhook.EventTaskCreated, webhook.NewTask(task))
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.JSON(w, http.StatusCreated, apiTask(task))
+}
+
+// APIUpdateTask updates the given fields of a task the user owns, and
+// leaves the others as they are.
+func (h *Handler) APIUpdateTask(w http.ResponseWriter, r *http.Request) {
+	var data api.UpdateTask
+	if !h.decodeJSON(w, r, &data) {
+		return
+	}
+	err := validation.ValidateStruct(&data,
+		validation.Field(&data.Title, validation.NilOrNotEmpty, validation.Length(1, 255)),
+		validation.Field(&data.DueDate, validation.Date(time.DateOnly)),
+		validation.Field(&data.Status, validation.In(api.TaskStatusTodo, api.TaskStatusInProgress, api.TaskStatusDone)),
+	)
+	if err != nil {
+		h.jsonValidationError(w, r, err)
+		return
+	}
+	task, ok := h.getAPIOwnedTask(w, r)
+	if !ok {
+		return
+	}
+	if !h.ensureAPIActiveProject(w, r, task.ProjectID) {
+		return
+	}
+	title := task.Title
+	if data.Title != nil {
+		title = *data.Title
+	}
+	description := task.Description.String
+	if data.Description != nil {
+		description = *data.Description
+	}
+	dueDate := task.DueDate
+	if data.DueDate != nil {
+		dueDate, err = database.DateFromString(*data.DueDate)
+		if err != nil {
+			h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+	status := task.Status
+	if data.Status != nil {
+		status = database.TaskStatus(*data.Status)
+	}
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	defer tx.Rollback()
+	updated, err := h.TaskService.UpdateWithTx(
+		r.Context(),
+		tx,
+		task.ID,
+		task.OwnerID,
+		title,
+		description,
+		dueDate,
+		status,
+		task.Recurrence,
+		task.MilestoneID,
+	)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	_, _, err = h.taskUpdatedWithTx(r.Context(), tx, task, updated)
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.pushTaskToGitHub(r.Context(), updated)
+	h.JSON(w, http.StatusOK, apiTask(updated))
+}
+
+// apiProject returns the API representation of the given project.
+func apiProject(project database.Project) api.Project {
+	return api.Project{
+		ID:          project.ID,
+		Title:       project.Title,
+		Description: project.Description.String,
+		Published:   project.Published,
+		Archived:    project.Archived(),
+		CreatedAt:   project.CreatedAt.Time,
+	}
+}
+
+// apiTask returns the API representation of the given task.
+func apiTask(task database.Task) api.Task {
+	data := api.Task{
+		ID:          task.ID,
+		Title:       task.Title,
+		Description: task.Description.String,
+		Status:      string(task.Status),
+		CreatedAt:   task.CreatedAt.Time,
+	}
+	if task.DueDate.Valid {
+		dueDate := database.DateString(task.DueDate)
+		data.DueDate = &dueDate
+	}
+	if task.ProjectID.Valid {
+		data.ProjectID = &task.ProjectID.Int32
+	}
+	if task.MilestoneID.Valid {
+		data.MilestoneID = &task.MilestoneID.Int32
+	}
+	return data
+}
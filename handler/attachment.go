@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/attachment"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/storage"
+	"github.com/webdevfuel/projectmotor/template"
+)
+
+// UploadAttachment stores the uploaded file, and a thumbnail if it's an
+// image, and renders it for the list of attachments of the task.
+//
+// Only the owner of the task can upload files.
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	task, err := h.TaskService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
+		return
+	}
+	tooLarge := fmt.Sprintf("The file must be smaller than %s.", attachment.Size(attachment.MaxSize))
+	r.Body = http.MaxBytesReader(w, r.Body, attachment.MaxSize+(64<<10))
+	err = r.ParseMultipartForm(attachment.MaxSize)
+	if err != nil {
+		h.renderAttachmentError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.renderAttachmentError(w, r, http.StatusBadRequest, "Please choose a file.")
+		return
+	}
+	defer file.Close()
+	if header.Size > attachment.MaxSize {
+		h.renderAttachmentError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	filename := attachment.Filename(header.Filename)
+	contentType, ok := attachment.ContentType(filename, data)
+	if !ok {
+		h.renderAttachmentError(
+			w,
+			r,
+			http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Only %s can be attached.", attachment.Allowed),
+		)
+		return
+	}
+	key, err := attachment.NewKey(task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Storage.Put(r.Context(), key, bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	keys := []string{key}
+	// a thumbnail is a nicety, so images that can't be decoded are
+	// still attached without one
+	var thumbnailKey pgtype.Text
+	if attachment.IsImage(contentType) {
+		thumbnail, err := attachment.Thumbnail(data)
+		if err == nil {
+			err = h.Storage.Put(r.Context(), key+"-thumbnail", bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/png")
+		}
+		if err == nil {
+			thumbnailKey = pgtype.Text{String: key + "-thumbnail", Valid: true}
+			keys = append(keys, thumbnailKey.String)
+		} else {
+			logging.FromContext(r.Context()).WarnContext(r.Context(), "attachment thumbnail failed", "error", err)
+		}
+	}
+	a, err := h.AttachmentService.Create(
+		r.Context(),
+		task.ID,
+		user.ID,
+		filename,
+		contentType,
+		int64(len(data)),
+		key,
+		thumbnailKey,
+	)
+	if err != nil {
+		// the task may have been deleted meanwhile
+		h.deleteFiles(r.Context(), keys...)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.TaskAttachment(a, true),
+		successToastComponent("File attached successfully"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderAttachmentError replies to an upload with an error toast with the
+// given message, leaving the list of attachments as it is.
+func (h *Handler) renderAttachmentError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	h.Reswap(w, "none")
+	w.WriteHeader(code)
+	h.Render(w, r, errorToastComponent(message))
+}
+
+// DownloadAttachment serves the contents of an attachment, as long as the
+// user can see its task.
+//
+// Images and PDFs are shown in the browser and everything else is
+// downloaded.
+func (h *Handler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.getVisibleAttachment(w, r)
+	if !ok {
+		return
+	}
+	disposition := "attachment"
+	if attachment.Inline(a.ContentType) {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	h.serveFile(w, r, a.StorageKey, a.ContentType, a.Size)
+}
+
+// GetAttachmentThumbnail serves the thumbnail of an image attachment, as
+// long as the user can see its task.
+func (h *Handler) GetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.getVisibleAttachment(w, r)
+	if !ok {
+		return
+	}
+	if !a.ThumbnailKey.Valid {
+		h.Error(w, r, fmt.Errorf("attachment %d has no thumbnail", a.ID), http.StatusNotFound)
+		return
+	}
+	h.serveFile(w, r, a.ThumbnailKey.String, "image/png", -1)
+}
+
+// DeleteAttachment deletes an attachment of a task the user owns, along with
+// its files.
+func (h *Handler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	a, err := h.AttachmentService.Delete(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.deleteFiles(r.Context(), a.Keys()...)
+	err = h.Render(w, r, successToastComponent("Attachment deleted successfully"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getVisibleAttachment returns the attachment with the id in the url, and
+// false after replying with an error if the user can't see it.
+func (h *Handler) getVisibleAttachment(w http.ResponseWriter, r *http.Request) (database.Attachment, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Attachment{}, false
+	}
+	a, err := h.AttachmentService.GetVisible(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Attachment{}, false
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.Attachment{}, false
+	}
+	return a, true
+}
+
+// serveFile copies the object at the given key from storage to the
+// response. The size is sent as the Content-Length, unless it's negative.
+//
+// Objects never change once stored, so they can be cached by the browser.
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, key string, contentType string, size int64) {
+	body, err := h.Storage.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	_, err = io.Copy(w, body)
+	if err != nil {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "attachment download interrupted", "error", err)
+	}
+}
+
+// deleteFiles removes the objects at the given keys from storage.
+//
+// The rows pointing at them are already gone by then, so failures are only
+// logged, leaving the objects behind rather than failing the request.
+func (h *Handler) deleteFiles(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		err := h.Storage.Delete(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "attachment file not deleted", "error", err, "key", key)
+		}
+	}
+}
@@ -15,31 +15,44 @@ import (
 	"github.com/webdevfuel/projectmotor/github"
 	"github.com/webdevfuel/projectmotor/template"
 	"github.com/webdevfuel/projectmotor/template/toast"
+	"golang.org/x/oauth2"
 )
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	component := template.Login()
-	component.Render(r.Context(), w)
+	h.Render(w, r, component)
 }
 
 func (h *Handler) OAuthGitHubLogin(w http.ResponseWriter, r *http.Request) {
+	h.redirectToGitHub(w, r, "")
+}
+
+// redirectToGitHub redirects to GitHub to log in with the given auth code
+// options, e.g. to ask for more scopes, and stores the path the callback
+// redirects to afterwards in the session, which is "/" if empty.
+func (h *Handler) redirectToGitHub(w http.ResponseWriter, r *http.Request, next string, opts ...oauth2.AuthCodeOption) {
 	state, err := generateCSRFToken(16)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	session, err := h.GetSessionStore(r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	session.Values["state"] = state
+	if next != "" {
+		session.Values["next"] = next
+	} else {
+		delete(session.Values, "next")
+	}
 	err = session.Save(r, w)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	url := github.Config.AuthCodeURL(state)
+	url := h.GitHubOAuth2Config.AuthCodeURL(state, opts...)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
@@ -47,7 +60,7 @@ func (h *Handler) OAuthGitHubCallback(w http.ResponseWriter, r *http.Request) {
 	// Get session store
 	session, err := h.GetSessionStore(r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Get state and code from url query (?state=foo&code=bar)
@@ -55,99 +68,114 @@ func (h *Handler) OAuthGitHubCallback(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	// Ensure state matches between query and session
 	if !stateMatches(state, session) {
-		h.Error(w, errors.New("session and query state mismatch"), http.StatusBadRequest)
+		h.Error(w, r, errors.New("session and query state mismatch"), http.StatusBadRequest)
 		return
 	}
 	// Exchange code for token
-	token, err := github.Config.Exchange(context.Background(), code)
+	token, err := h.GitHubOAuth2Config.Exchange(r.Context(), code)
 	if err != nil {
-		h.Error(w, err, http.StatusBadRequest)
+		h.Error(w, r, err, http.StatusBadRequest)
 		return
 	}
 	// Ensure token is valid
 	if !token.Valid() {
-		h.Error(w, err, http.StatusBadRequest)
+		h.Error(w, r, err, http.StatusBadRequest)
 		return
 	}
 	// Initialise github.GitHubOAuth2 instance
-	gh := github.NewGitHubOAuth2(token.AccessToken)
+	gh := github.NewGitHubOAuth2(h.GitHubAPI, token.AccessToken)
 	// Fetch data from GitHub's API
-	data, err := gh.GetData()
+	data, err := gh.GetData(r.Context())
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Check if user already exists
-	exists, err := h.UserService.UserExistsByGitHubID(data.ID)
+	exists, err := h.UserService.UserExistsByGitHubID(r.Context(), data.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Begin transaction
 	tx, err := h.BeginTx(r.Context())
 	defer tx.Rollback()
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Create or update user access token and email
 	user, err := createOrUpdateUser(
+		r.Context(),
 		tx,
 		exists,
-		data.PrimaryEmail,
+		data,
 		token.AccessToken,
-		data.ID,
+		github.TokenScopes(token),
 		h.UserService,
 	)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	// Suspended users can't log in until an admin unsuspends them
+	if user.Suspended() {
+		h.Error(w, r, errors.New("user is suspended"), http.StatusForbidden)
 		return
 	}
 	// Generate a random token to use as session identifier
 	sessionToken, err := auth.GenerateSessionToken()
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Get User-Agent from request headers
 	userAgent := r.Header.Get("User-Agent")
 	if userAgent == "" {
-		h.Error(w, errors.New("user-agent header must be present"), http.StatusInternalServerError)
+		h.Error(w, r, errors.New("user-agent header must be present"), http.StatusInternalServerError)
 		return
 	}
 	// Create session
-	err = h.SessionService.CreateToken(tx, user.ID, sessionToken, userAgent)
+	err = h.SessionService.CreateToken(r.Context(), tx, user.ID, sessionToken, userAgent)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
+	// Redirect to where logging in was started from, if it was asked for
+	next, _ := session.Values["next"].(string)
+	delete(session.Values, "next")
+	if next == "" {
+		next = "/"
+	}
 	// Set session on cookies with token
 	err = auth.SetUserSession(w, r, sessionToken, session)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, next, http.StatusSeeOther)
 }
 
+// createOrUpdateUser creates the user of the given GitHub account, named
+// after it, or updates it if it exists.
 func createOrUpdateUser(
+	ctx context.Context,
 	tx *sqlx.Tx,
 	exists bool,
-	primaryEmail string,
+	data github.Data,
 	accessToken string,
-	id int32,
+	scopes string,
 	userService *database.UserService,
 ) (database.User, error) {
 	if exists {
-		return userService.UpdateUser(tx, primaryEmail, accessToken, id)
+		return userService.UpdateUser(ctx, tx, data.PrimaryEmail, accessToken, scopes, data.ID, data.AvatarURL)
 	}
-	return userService.CreateUser(tx, primaryEmail, accessToken, id)
+	return userService.CreateUser(ctx, tx, data.PrimaryEmail, accessToken, scopes, data.ID, data.Name, data.AvatarURL)
 }
 
 func generateCSRFToken(n int) (string, error) {
@@ -184,23 +212,23 @@ func secureCompare(given string, actual string) bool {
 func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
 	sess, err := h.GetSessionStore(r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	tok, ok := sess.Values["token"].(string)
 	if !ok {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	err = h.SessionService.DeleteToken(tok)
+	err = h.SessionService.DeleteToken(r.Context(), tok)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	delete(sess.Values, "token")
 	err = sess.Save(r, w)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.Redirect(w, "http://localhost:3000/login")
@@ -209,18 +237,18 @@ func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteAllSessions(w http.ResponseWriter, r *http.Request) {
 	sess, err := h.GetSessionStore(r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	tok, ok := sess.Values["token"].(string)
 	if !ok {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	user := h.GetUserFromContext(r.Context())
-	err = h.SessionService.DeleteAllTokens(user.ID, tok)
+	err = h.SessionService.DeleteAllTokens(r.Context(), user.ID, tok)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.TriggerEvent(w, "clearSessions")
@@ -229,5 +257,5 @@ func (h *Handler) DeleteAllSessions(w http.ResponseWriter, r *http.Request) {
 		Type:    "success",
 		SwapOOB: true,
 	})
-	component.Render(r.Context(), w)
+	h.Render(w, r, component)
 }
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/webdevfuel/projectmotor/auth"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/ical"
+	"github.com/webdevfuel/projectmotor/template"
+)
+
+// UserCalendar serves the tasks with a due date that the owner of the calendar
+// token in the url can see, as an iCalendar feed.
+func (h *Handler) UserCalendar(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getCalendarUser(w, r)
+	if !ok {
+		return
+	}
+	tasks, err := h.TaskService.GetAllDue(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.serveCalendar(w, r, "ProjectMotor", tasks)
+}
+
+// ProjectCalendar serves the tasks with a due date of a project as an
+// iCalendar feed, as long as the owner of the calendar token in the url can
+// see the project in any of their workspaces, or it's published and shared
+// with them.
+func (h *Handler) ProjectCalendar(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.getCalendarUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	project, err := h.ProjectService.GetVisibleToMember(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	tasks, err := h.TaskService.GetAllDueByProjectID(r.Context(), user.ID, project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.serveCalendar(w, r, fmt.Sprintf("ProjectMotor - %s", project.Title), tasks)
+}
+
+// RegenerateCalendarToken replaces the calendar token of the current user, so
+// that feed urls shared before stop working.
+func (h *Handler) RegenerateCalendarToken(w http.ResponseWriter, r *http.Request) error {
+	user := h.GetUserFromContext(r.Context())
+	token, err := auth.GenerateCalendarToken()
+	if err != nil {
+		return err
+	}
+	user, err = h.UserService.SetCalendarToken(r.Context(), user.ID, token)
+	if err != nil {
+		return err
+	}
+	return h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProfileCalendar(h.CalendarURL(user)),
+		successToastComponent("Calendar link regenerated successfully. Update it in your calendar applications."),
+	)
+}
+
+// CalendarURL returns the url of the calendar feed of the given user, or an
+// empty string if the user doesn't have a calendar token yet.
+func (h *Handler) CalendarURL(user database.User) string {
+	if !user.CalendarToken.Valid {
+		return ""
+	}
+	return h.PublicURLFor(fmt.Sprintf("/calendar/%s/tasks.ics", user.CalendarToken.String))
+}
+
+// ProjectCalendarURL returns the url of the calendar feed of the given project
+// for the given user, or an empty string if the user doesn't have a calendar
+// token yet.
+func (h *Handler) ProjectCalendarURL(user database.User, projectID int32) string {
+	if !user.CalendarToken.Valid {
+		return ""
+	}
+	return h.PublicURLFor(fmt.Sprintf("/calendar/%s/projects/%d/tasks.ics", user.CalendarToken.String, projectID))
+}
+
+// ensureCalendarToken returns the given user, with a new calendar token if
+// they don't have one yet.
+func (h *Handler) ensureCalendarToken(r *http.Request, user database.User) (database.User, error) {
+	if user.CalendarToken.Valid {
+		return user, nil
+	}
+	token, err := auth.GenerateCalendarToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	return h.UserService.SetCalendarToken(r.Context(), user.ID, token)
+}
+
+// getCalendarUser returns the owner of the calendar token in the url, and
+// reports whether it exists. If it doesn't, a response is already written.
+func (h *Handler) getCalendarUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	token := chi.URLParam(r, "token")
+	user, ok, err := h.UserService.GetUserByCalendarToken(r.Context(), token)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.User{}, false
+	}
+	if !ok {
+		h.Error(w, r, errors.New("calendar token doesn't exist"), http.StatusNotFound)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// serveCalendar writes the given tasks as an iCalendar feed with the given
+// name.
+//
+// Tasks are written as all-day events, unless the query param "component" is
+// "todo". Calendar applications poll feeds, so the response has an ETag and
+// replies with status 304 when the feed hasn't changed.
+func (h *Handler) serveCalendar(w http.ResponseWriter, r *http.Request, name string, tasks []database.Task) {
+	calendar := ical.Calendar{
+		Name:      name,
+		Component: ical.ComponentEvent,
+	}
+	if h.GetURLQuery(r, "component").Value == "todo" {
+		calendar.Component = ical.ComponentTodo
+	}
+	for _, task := range tasks {
+		calendar.Entries = append(calendar.Entries, ical.Entry{
+			UID:         fmt.Sprintf("task-%d@projectmotor", task.ID),
+			Summary:     task.Title,
+			Description: task.Description.String,
+			Due:         task.DueDate.Time,
+			Status:      calendarStatus(task.Status),
+			Created:     task.CreatedAt.Time,
+			Modified:    task.UpdatedAt.Time,
+		})
+	}
+	var buf bytes.Buffer
+	err := ical.Write(&buf, calendar)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Write(buf.Bytes())
+}
+
+func calendarStatus(status database.TaskStatus) string {
+	switch status {
+	case database.TaskStatusInProgress:
+		return ical.StatusInProcess
+	case database.TaskStatusDone:
+		return ical.StatusCompleted
+	}
+	return ical.StatusNeedsAction
+}
@@ -9,6 +9,6 @@ import (
 
 func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
-	component := template.Dashboard(fmt.Sprintf("Welcome back, %s!", user.Email))
-	component.Render(r.Context(), w)
+	component := template.Dashboard(fmt.Sprintf("Welcome back, %s!", user.DisplayName()))
+	h.Render(w, r, component)
 }
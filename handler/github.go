@@ -0,0 +1,615 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/recurrence"
+	"github.com/webdevfuel/projectmotor/signature"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+	"github.com/webdevfuel/projectmotor/webhook"
+)
+
+// maxGitHubPayload is the largest webhook delivery accepted from GitHub,
+// which caps payloads at 25 MB.
+const maxGitHubPayload = 25 << 20
+
+// ProjectGitHub renders the GitHub tab of a project the user owns, with the
+// repository it's linked to, if any.
+func (h *Handler) ProjectGitHub(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	repo, linked, issues, err := h.getGitHubRepo(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectGitHub(project, repo, linked, issues, h.gitHubRepoAccess(r), h.GitHubWebhookURL(project.ID))
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type LinkGitHubRepoForm struct {
+	// Repository is either "owner/name" or the url of the repository.
+	Repository string `form:"repository"`
+}
+
+func (data LinkGitHubRepoForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Repository, validation.Required, validation.By(githubRepo)),
+	)
+}
+
+// githubRepo checks that a string is a repository written as "owner/name"
+// or as its url.
+func githubRepo(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, _, ok := github.ParseRepo(s); !ok {
+		return errors.New("must be owner/name or the url of the repository")
+	}
+	return nil
+}
+
+// LinkGitHubRepo links a project the user owns to a GitHub repository the
+// user can access, and renders the GitHub tab of the project again.
+func (h *Handler) LinkGitHubRepo(w http.ResponseWriter, r *http.Request) {
+	var data LinkGitHubRepoForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	repo, linked, issues, err := h.getGitHubRepo(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	// the form links to GitHub to grant access to repositories instead
+	if !h.gitHubRepoAccess(r) {
+		ok = false
+	}
+	if ok && !linked {
+		user := h.GetUserFromContext(r.Context())
+		owner, name, _ := github.ParseRepo(data.Repository)
+		ghRepo, err := h.GitHubAPI.GetRepo(r.Context(), user.GitHubAccessToken, owner, name)
+		if github.IsNotFound(err) {
+			errors = validator.ValidatedSlice{{
+				Key:   "Repository",
+				Value: data.Repository,
+				Error: "wasn't found, or you can't access it",
+			}}
+		} else if err != nil {
+			h.Error(w, r, err, http.StatusBadGateway)
+			return
+		} else {
+			secret, err := webhook.GenerateSecret()
+			if err != nil {
+				h.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			// keep the owner and name as they're written on GitHub
+			repo, err = h.GitHubService.LinkRepo(r.Context(), project.ID, user.ID, ghRepo.Owner.Login, ghRepo.Name, secret)
+			if err != nil {
+				h.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			linked = true
+		}
+	}
+	component := template.ProjectGitHubRepo(project, repo, linked, issues, h.gitHubRepoAccess(r), h.GitHubWebhookURL(project.ID), errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// AuthorizeGitHubRepo redirects to GitHub to grant the app access to the
+// repositories of the user, which isn't asked for when logging in, and back
+// to the GitHub tab of a project the user owns to link one of them.
+func (h *Handler) AuthorizeGitHubRepo(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	next := fmt.Sprintf("/projects/%d/github", project.ID)
+	h.redirectToGitHub(w, r, next, github.RepoAuthCodeOption(h.GitHubOAuth2Config))
+}
+
+// gitHubRepoAccess reports whether the user granted the app access to their
+// repositories, which linking a repository needs.
+func (h *Handler) gitHubRepoAccess(r *http.Request) bool {
+	user := h.GetUserFromContext(r.Context())
+	return user.HasGitHubScope(github.ScopeRepo)
+}
+
+// UnlinkGitHubRepo unlinks a project the user owns from its repository, and
+// renders the GitHub tab of the project again. Tasks imported from issues
+// are kept.
+func (h *Handler) UnlinkGitHubRepo(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	err := h.GitHubService.UnlinkRepo(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectGitHubRepo(project, database.GitHubRepo{}, false, 0, h.gitHubRepoAccess(r), h.GitHubWebhookURL(project.ID), validator.NewValidatedSlice())
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type GitHubSettingsForm struct {
+	CompleteTasksOnMerge bool `form:"complete_tasks_on_merge"`
+}
+
+func (data GitHubSettingsForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.CompleteTasksOnMerge),
+	)
+}
+
+// UpdateGitHubSettings saves whether the tasks referenced by a pull request
+// of the repository of a project the user owns are moved to done when it's
+// merged, and renders the GitHub tab of the project again.
+func (h *Handler) UpdateGitHubSettings(w http.ResponseWriter, r *http.Request) {
+	var data GitHubSettingsForm
+	_, _, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	_, linked, issues, err := h.getGitHubRepo(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !linked {
+		h.Error(w, r, errors.New("project isn't linked to a repository"), http.StatusNotFound)
+		return
+	}
+	repo, err := h.GitHubService.SetCompleteTasksOnMerge(r.Context(), project.ID, data.CompleteTasksOnMerge)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProjectGitHubRepo(project, repo, true, issues, h.gitHubRepoAccess(r), h.GitHubWebhookURL(project.ID), validator.NewValidatedSlice()),
+		successToastComponent("Settings saved successfully"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ImportGitHubIssues creates a task for every open issue of the repository
+// of a project the user owns that isn't linked to a task yet, and renders
+// the GitHub tab of the project again.
+func (h *Handler) ImportGitHubIssues(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	repo, linked, err := h.GitHubService.GetRepo(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !linked {
+		h.Error(w, r, errors.New("project isn't linked to a repository"), http.StatusNotFound)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	issues, err := h.GitHubAPI.GetOpenIssues(r.Context(), user.GitHubAccessToken, repo.Owner, repo.Name)
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadGateway)
+		return
+	}
+	numbers, err := h.GitHubService.GetIssueNumbers(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	imported := 0
+	for _, issue := range issues {
+		if slices.Contains(numbers, issue.Number) {
+			continue
+		}
+		task, err := h.GitHubService.CreateTaskFromIssueWithTx(
+			r.Context(),
+			tx,
+			project.ID,
+			project.OwnerID,
+			issue.Number,
+			issue.Title,
+			issue.Body,
+			database.TaskStatusTodo,
+		)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		err = h.enqueueWebhookWithTx(r.Context(), tx, task.ProjectID, webhook.EventTaskCreated, webhook.NewTask(task))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		imported++
+	}
+	err = tx.Commit()
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	message := fmt.Sprintf("Imported %d issues", imported)
+	if imported == 1 {
+		message = "Imported 1 issue"
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProjectGitHubRepo(project, repo, true, len(numbers)+imported, h.gitHubRepoAccess(r), h.GitHubWebhookURL(project.ID), validator.NewValidatedSlice()),
+		successToastComponent(message),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GitHubWebhook receives the webhook deliveries of the repository of a
+// project, and applies the changes of its issues to the linked tasks, and
+// links its pull requests and commits to the tasks they reference.
+//
+// Deliveries must be signed with the secret of the repository, and are
+// ignored while the project is archived.
+func (h *Handler) GitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	repo, linked, err := h.GitHubService.GetRepo(r.Context(), id)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !linked {
+		h.Error(w, r, errors.New("project isn't linked to a repository"), http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitHubPayload))
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if !signature.Verify(repo.WebhookSecret, body, r.Header.Get(github.HeaderSignature)) {
+		h.Error(w, r, errors.New("invalid github webhook signature"), http.StatusUnauthorized)
+		return
+	}
+	archived, err := h.ProjectService.IsArchived(r.Context(), pgtype.Int4{Int32: repo.ProjectID, Valid: true})
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	suspended, err := h.gitHubRepoSuspended(r.Context(), repo)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	event := r.Header.Get(github.HeaderEvent)
+	if archived || suspended || !slices.Contains(githubEvents, event) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var delivery struct {
+		Repository github.Repo `json:"repository"`
+	}
+	err = json.Unmarshal(body, &delivery)
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if !strings.EqualFold(delivery.Repository.FullName, repo.FullName()) {
+		h.Error(w, r, fmt.Errorf("delivery of %q to project of %q", delivery.Repository.FullName, repo.FullName()), http.StatusBadRequest)
+		return
+	}
+	switch event {
+	case github.EventIssues:
+		var e github.IssuesEvent
+		err = json.Unmarshal(body, &e)
+		if err == nil {
+			err = h.syncGitHubIssue(r.Context(), repo, e)
+		}
+	case github.EventPullRequest:
+		var e github.PullRequestEvent
+		err = json.Unmarshal(body, &e)
+		if err == nil {
+			err = h.syncGitHubPullRequest(r.Context(), repo, e)
+		}
+	case github.EventPush:
+		var e github.PushEvent
+		err = json.Unmarshal(body, &e)
+		if err == nil {
+			err = h.syncGitHubPush(r.Context(), repo, e)
+		}
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// githubEvents are the event types of the deliveries GitHubWebhook applies,
+// while the others are acknowledged and ignored.
+var githubEvents = []string{github.EventIssues, github.EventPullRequest, github.EventPush}
+
+// syncGitHubIssue applies the change of an issue in the given event to the
+// task it's linked to. Issues opened after the repository was linked are
+// created as tasks, owned by the user who linked it.
+func (h *Handler) syncGitHubIssue(ctx context.Context, repo database.GitHubRepo, event github.IssuesEvent) error {
+	issue := event.Issue
+	if issue.IsPullRequest() {
+		return nil
+	}
+	task, linked, err := h.GitHubService.GetTaskByIssue(ctx, repo.ProjectID, issue.Number)
+	if err != nil {
+		return err
+	}
+	tx, err := h.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	switch event.Action {
+	case github.IssueActionOpened:
+		if linked {
+			return nil
+		}
+		task, err = h.GitHubService.CreateTaskFromIssueWithTx(
+			ctx,
+			tx,
+			repo.ProjectID,
+			repo.UserID,
+			issue.Number,
+			issue.Title,
+			issue.Body,
+			issueTaskStatus(issue.State, database.TaskStatusTodo),
+		)
+		if err != nil {
+			return err
+		}
+		err = h.enqueueWebhookWithTx(ctx, tx, task.ProjectID, webhook.EventTaskCreated, webhook.NewTask(task))
+		if err != nil {
+			return err
+		}
+	case github.IssueActionEdited, github.IssueActionClosed, github.IssueActionReopened:
+		if !linked {
+			return nil
+		}
+		// only the fields changed on GitHub are updated, so that edits
+		// that aren't pushed to the issue, like its description, are kept
+		title := task.Title
+		if event.Changes.Title != nil {
+			title = issue.Title
+		}
+		description := task.Description.String
+		if event.Changes.Body != nil {
+			description = issue.Body
+		}
+		status := issueTaskStatus(issue.State, task.Status)
+		updated, err := h.GitHubService.UpdateTaskFromIssueWithTx(ctx, tx, task.ID, title, description, status)
+		if err != nil {
+			return err
+		}
+		err = h.enqueueWebhookWithTx(ctx, tx, updated.ProjectID, webhook.EventTaskUpdated, webhook.NewTask(updated))
+		if err != nil {
+			return err
+		}
+	case github.IssueActionDeleted, github.IssueActionTransferred:
+		if !linked {
+			return nil
+		}
+		return h.GitHubService.UnlinkIssue(ctx, repo.ProjectID, issue.Number)
+	}
+	return tx.Commit()
+}
+
+// syncGitHubPullRequest links the pull request in the given event to the
+// tasks it references in its title, body or branch name, and updates the
+// state of the tasks it's linked to already.
+//
+// When the pull request is merged, the tasks it's linked to are moved to
+// done if the repository is set to.
+func (h *Handler) syncGitHubPullRequest(ctx context.Context, repo database.GitHubRepo, event github.PullRequestEvent) error {
+	pr := event.PullRequest
+	state := pr.Status()
+	err := h.GitHubService.UpdatePullRequest(ctx, repo.ProjectID, pr.Number, pr.Title, pr.HTMLURL, state)
+	if err != nil {
+		return err
+	}
+	for _, taskID := range github.TaskReferences(pr.Title, pr.Body, pr.Head.Ref) {
+		_, err := h.GitHubService.LinkPullRequest(ctx, repo.ProjectID, taskID, pr.Number, pr.Title, pr.HTMLURL, state)
+		if err != nil {
+			return err
+		}
+	}
+	if event.Action != github.PullRequestActionClosed || state != github.PullRequestMerged || !repo.CompleteTasksOnMerge {
+		return nil
+	}
+	tx, err := h.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tasks, err := h.GitHubService.CompletePullRequestTasksWithTx(ctx, tx, repo.ProjectID, pr.Number)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		err = h.enqueueWebhookWithTx(ctx, tx, task.ProjectID, webhook.EventTaskUpdated, webhook.NewTask(task))
+		if err != nil {
+			return err
+		}
+		// completing an occurrence of a recurring task creates the next one
+		_, _, err = recurrence.Recur(ctx, tx, h.TaskService, task, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		h.pushTaskToGitHub(ctx, task)
+	}
+	return nil
+}
+
+// syncGitHubPush links the commits in the given event to the tasks they
+// reference in their messages.
+func (h *Handler) syncGitHubPush(ctx context.Context, repo database.GitHubRepo, event github.PushEvent) error {
+	for _, commit := range event.Commits {
+		for _, taskID := range github.TaskReferences(commit.Message) {
+			_, err := h.GitHubService.LinkCommit(ctx, repo.ProjectID, taskID, commit.ID, commit.Message, commit.URL)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pushTaskToGitHub updates the title and state of the issue linked to the
+// given task, if any. Changes shouldn't fail because of GitHub, so errors
+// are only logged.
+func (h *Handler) pushTaskToGitHub(ctx context.Context, task database.Task) {
+	target, linked, err := h.GitHubService.GetIssueTarget(ctx, task.ID)
+	if err == nil && linked {
+		_, err = h.GitHubAPI.UpdateIssue(ctx, target.AccessToken, target.Owner, target.Name, target.Number, github.IssueUpdate{
+			Title: task.Title,
+			State: taskIssueState(task.Status),
+		})
+	}
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "issue wasn't updated", "error", err, "task_id", task.ID)
+	}
+}
+
+// issueTaskStatus returns the status of a task linked to an issue in the
+// given state. Closed issues are done, and reopened ones are to do again,
+// while open issues keep the status of their task otherwise.
+func issueTaskStatus(state string, current database.TaskStatus) database.TaskStatus {
+	if state == github.IssueClosed {
+		return database.TaskStatusDone
+	}
+	if current == database.TaskStatusDone {
+		return database.TaskStatusTodo
+	}
+	return current
+}
+
+// taskIssueState returns the state of the issue linked to a task with the
+// given status.
+func taskIssueState(status database.TaskStatus) string {
+	if status == database.TaskStatusDone {
+		return github.IssueClosed
+	}
+	return github.IssueOpen
+}
+
+// getGitHubRepo returns the repository the project with the given id is
+// linked to, whether it is, and the number of issues linked to its tasks.
+func (h *Handler) getGitHubRepo(ctx context.Context, projectID int32) (database.GitHubRepo, bool, int, error) {
+	repo, linked, err := h.GitHubService.GetRepo(ctx, projectID)
+	if err != nil || !linked {
+		return repo, linked, 0, err
+	}
+	numbers, err := h.GitHubService.GetIssueNumbers(ctx, projectID)
+	return repo, linked, len(numbers), err
+}
+
+// gitHubRepoSuspended reports whether the owner of the project the given
+// repository is linked to, or the user who linked it, is suspended, in which
+// case deliveries from GitHub are ignored, since tasks created from issues
+// belong to the user who linked the repository.
+func (h *Handler) gitHubRepoSuspended(ctx context.Context, repo database.GitHubRepo) (bool, error) {
+	suspended, err := h.ProjectService.OwnerSuspended(ctx, repo.ProjectID)
+	if err != nil || suspended {
+		return suspended, err
+	}
+	user, ok, err := h.UserService.GetUserByID(ctx, repo.UserID)
+	if err != nil {
+		return false, err
+	}
+	return ok && user.Suspended(), nil
+}
+
+// GitHubWebhookURL returns the url GitHub delivers the webhook events of the
+// repository of the project with the given id to.
+func (h *Handler) GitHubWebhookURL(projectID int32) string {
+	return h.PublicURLFor(fmt.Sprintf("/github/projects/%d/webhook", projectID))
+}
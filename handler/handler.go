@@ -3,7 +3,6 @@ package handler
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,9 +11,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/webdevfuel/projectmotor/auth"
 	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/metrics"
+	"github.com/webdevfuel/projectmotor/storage"
+	"github.com/webdevfuel/projectmotor/template"
 	"github.com/webdevfuel/projectmotor/template/toast"
+	"github.com/webdevfuel/projectmotor/tracing"
+	"golang.org/x/oauth2"
 )
 
 // A Handler interacts with the database and cookie store.
@@ -23,15 +30,76 @@ type Handler struct {
 	SessionService *database.SessionService
 	ProjectService *database.ProjectService
 	TaskService    *database.TaskService
-	Store          *sessions.CookieStore
-	DB             *sqlx.DB
+	// MilestoneService holds the milestones of projects, which tasks can
+	// belong to.
+	MilestoneService *database.MilestoneService
+	// AttachmentService holds the rows of attachments, whose contents are
+	// kept in Storage.
+	AttachmentService *database.AttachmentService
+	// ProjectPageService holds the settings of the public pages of
+	// projects.
+	ProjectPageService *database.ProjectPageService
+	// WebhookService holds the webhooks of projects, and the queue of
+	// deliveries sent by the webhook.Dispatcher.
+	WebhookService *database.WebhookService
+	// GitHubService holds the repositories projects are linked to, and the
+	// issues tasks are linked to.
+	GitHubService *database.GitHubService
+	// APITokenService holds the tokens users authenticate requests to the
+	// API with.
+	APITokenService *database.APITokenService
+	// ProjectTransferService holds the pending transfers of projects to
+	// new owners.
+	ProjectTransferService *database.ProjectTransferService
+	// DataExportService holds the exports of their data users ask for,
+	// which are generated by the account.Worker.
+	DataExportService *database.DataExportService
+	// OrganizationService holds the workspaces that own projects, and
+	// their members.
+	OrganizationService *database.OrganizationService
+	// AdminService searches the rows of every user for the admin area.
+	AdminService *database.AdminService
+	// GitHubAPI sends requests to the GitHub API on behalf of users.
+	GitHubAPI *github.API
+	// GitHubOAuth2Config is the configuration of logging in with GitHub.
+	GitHubOAuth2Config *oauth2.Config
+	Storage            storage.Storage
+	Store              *sessions.CookieStore
+	DB                 *sqlx.DB
+	// MetricsRegistry holds the metrics served on "/metrics".
+	MetricsRegistry *prometheus.Registry
+	// AllowPrivateWebhooks lets webhooks be subscribed to urls that
+	// resolve to private addresses, which is refused otherwise.
+	AllowPrivateWebhooks bool
+	// PublicURL is the url the app is reached at by its users, e.g.
+	// "https://projectmotor.example.com", without a trailing slash.
+	PublicURL string
+	// MetricsToken is the bearer token requests to "/metrics" must send.
+	// Without one, metrics aren't served at all.
+	MetricsToken string
 }
 
 // HandlerOptions is a representation of the options that should
 // be passed to a handler when initialized.
 type HandlerOptions struct {
-	DB    *sqlx.DB
-	Store *sessions.CookieStore
+	DB      *sqlx.DB
+	Store   *sessions.CookieStore
+	Storage storage.Storage
+	// GitHubAPI defaults to the GitHub REST API, as configured by
+	// github.NewAPI.
+	GitHubAPI *github.API
+	// GitHubOAuth2Config defaults to github.Config.
+	GitHubOAuth2Config *oauth2.Config
+	// AllowPrivateWebhooks lets webhooks be subscribed to urls of
+	// loopback and private addresses, e.g. in development and tests.
+	AllowPrivateWebhooks bool
+	// PublicURL is the url links to the app given out to calendar
+	// applications and other services are built with, which defaults to
+	// "http://localhost:3000".
+	PublicURL string
+	// MetricsToken is the bearer token that scrapers of "/metrics" must
+	// send, which leaves metrics disabled when empty.
+	MetricsToken string
 }
 
 // NewHandler returns a new Handler.
@@ -40,13 +108,52 @@ func NewHandler(options HandlerOptions) *Handler {
 	sessionService := database.NewSessionService(options.DB)
 	projectService := database.NewProjectService(options.DB)
 	taskService := database.NewTaskService(options.DB)
+	attachmentService := database.NewAttachmentService(options.DB)
+	milestoneService := database.NewMilestoneService(options.DB)
+	projectPageService := database.NewProjectPageService(options.DB)
+	webhookService := database.NewWebhookService(options.DB)
+	githubService := database.NewGitHubService(options.DB)
+	apiTokenService := database.NewAPITokenService(options.DB)
+	adminService := database.NewAdminService(options.DB)
+	projectTransferService := database.NewProjectTransferService(options.DB)
+	dataExportService := database.NewDataExportService(options.DB)
+	organizationService := database.NewOrganizationService(options.DB)
+	githubAPI := options.GitHubAPI
+	if githubAPI == nil {
+		githubAPI = github.NewAPI()
+	}
+	githubOAuth2Config := options.GitHubOAuth2Config
+	if githubOAuth2Config == nil {
+		githubOAuth2Config = github.Config
+	}
+	publicURL := strings.TrimSuffix(options.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:3000"
+	}
 	return &Handler{
-		Store:          options.Store,
-		DB:             options.DB,
-		UserService:    userService,
-		SessionService: sessionService,
-		ProjectService: projectService,
-		TaskService:    taskService,
+		Store:                  options.Store,
+		DB:                     options.DB,
+		UserService:            userService,
+		SessionService:         sessionService,
+		ProjectService:         projectService,
+		TaskService:            taskService,
+		MilestoneService:       milestoneService,
+		AttachmentService:      attachmentService,
+		ProjectPageService:     projectPageService,
+		WebhookService:         webhookService,
+		GitHubService:          githubService,
+		APITokenService:        apiTokenService,
+		AdminService:           adminService,
+		ProjectTransferService: projectTransferService,
+		DataExportService:      dataExportService,
+		OrganizationService:    organizationService,
+		GitHubAPI:              githubAPI,
+		GitHubOAuth2Config:     githubOAuth2Config,
+		Storage:                options.Storage,
+		MetricsRegistry:        metrics.NewRegistry(options.DB),
+		AllowPrivateWebhooks:   options.AllowPrivateWebhooks,
+		PublicURL:              publicURL,
+		MetricsToken:           options.MetricsToken,
 	}
 }
 
@@ -55,6 +162,12 @@ func (h *Handler) GetSessionStore(r *http.Request) (*sessions.Session, error) {
 	return h.Store.Get(r, "_projectmotor_session")
 }
 
+// PublicURLFor returns the absolute url of the given path, e.g. "/p/abc", at
+// the PublicURL of the app.
+func (h *Handler) PublicURLFor(path string) string {
+	return h.PublicURL + path
+}
+
 // BeginTx returns a new Tx and an error from the DB BeginTxx method.
 func (h *Handler) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
 	tx, err := h.DB.BeginTxx(ctx, nil)
@@ -92,12 +205,24 @@ func (h *Handler) GetIDFromRequest(r *http.Request, key string) (int32, error) {
 	return int32(id), nil
 }
 
-// Error replies to the request with given HTTP code, and a status text given
-// the HTTP code, and prints the error messago to the console.
-func (h *Handler) Error(w http.ResponseWriter, err error, code int) {
-	// http.Error(w, http.StatusText(code), code)
+// Error replies to the request with given HTTP code, and logs the error with
+// the request-scoped logger.
+//
+// HTMX requests get an error toast and all other requests get an error page,
+// both showing the request id so that the error can be found in the logs.
+func (h *Handler) Error(w http.ResponseWriter, r *http.Request, err error, code int) {
+	ctx := r.Context()
+	logging.FromContext(ctx).ErrorContext(ctx, "request failed", "error", err, "status", code)
+	var component templ.Component
+	if h.IsHTMXRequest(r) {
+		h.Reswap(w, "none")
+		component = requestErrorToastComponent(ctx)
+	} else {
+		component = template.Error(code, logging.RequestID(ctx))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
-	log.Println("error:", err)
+	component.Render(ctx, w)
 }
 
 // TriggerEvent joins the given slice of events with a comma-separated string
@@ -150,6 +275,14 @@ func (h *Handler) GetURLQuery(r *http.Request, key string) URLQuery {
 	}
 }
 
+// Render renders the given component inside a span named after it.
+func (h *Handler) Render(w http.ResponseWriter, r *http.Request, component templ.Component) error {
+	ctx, span := tracing.StartRender(r.Context(), component)
+	err := component.Render(ctx, w)
+	tracing.End(span, err)
+	return err
+}
+
 // RenderComponents renders a list of components and sets the status code on the response
 func (h *Handler) RenderComponents(
 	w http.ResponseWriter,
@@ -158,7 +291,7 @@ func (h *Handler) RenderComponents(
 	components ...templ.Component,
 ) error {
 	for _, component := range components {
-		err := component.Render(r.Context(), w)
+		err := h.Render(w, r, component)
 		if err != nil {
 			return err
 		}
@@ -169,12 +302,22 @@ func (h *Handler) RenderComponents(
 
 type handlerWithError func(w http.ResponseWriter, r *http.Request) error
 
+// ErrorWrapper returns a http.HandlerFunc that calls the given handler, and
+// logs the returned error with the request-scoped logger.
+//
+// The handler is expected to return errors before writing a response, which
+// is then an error toast with the request id and an error status, without
+// swapping anything else, like Error renders for HTMX requests.
 func ErrorWrapper(h handlerWithError) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := h(w, r)
 		if err != nil {
-			log.Printf("error: %v", err)
+			ctx := r.Context()
+			logging.FromContext(ctx).ErrorContext(ctx, "request failed", "error", err, "status", http.StatusInternalServerError)
+			w.Header().Set("HX-Reswap", "none")
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			w.WriteHeader(http.StatusInternalServerError)
+			requestErrorToastComponent(ctx).Render(ctx, w)
 		}
 	}
 }
@@ -197,6 +340,12 @@ func errorToastComponent(s string) templ.Component {
 	})
 }
 
+// requestErrorToastComponent returns an error toast with the request id from
+// the given context, so that users can report it.
+func requestErrorToastComponent(ctx context.Context) templ.Component {
+	return errorToastComponent(fmt.Sprintf("There was an error (request ID %s).", logging.RequestID(ctx)))
+}
+
 func successToastComponent(s string) templ.Component {
 	return toast.Toast(toast.ToastOpts{
 		Message: s,
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// Healthz replies with status 200 as long as the process is able to serve
+// requests. It doesn't check any dependency, and is meant for liveness probes.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+// Readyz replies with status 200 if the database can be reached and the
+// schema is at the latest migration, otherwise it replies with status 503.
+//
+// It's meant for readiness probes, so that traffic isn't routed to an
+// instance that can't serve it yet.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	err := h.DB.PingContext(ctx)
+	if err != nil {
+		h.Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+	err = database.CheckSchema(ctx, h.DB)
+	if err != nil {
+		h.Error(w, r, err, http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
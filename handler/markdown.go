@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/webdevfuel/projectmotor/markdown"
+)
+
+// PreviewMarkdown renders the form value "description" as Markdown, for the
+// preview tab of forms with a description field.
+func (h *Handler) PreviewMarkdown(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	component := markdown.Component(r.Form.Get("description"))
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
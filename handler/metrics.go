@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/webdevfuel/projectmotor/metrics"
+)
+
+// Metrics serves the metrics from the MetricsRegistry in the Prometheus
+// exposition format.
+//
+// Requests must send the MetricsToken as a bearer token within the
+// "Authorization" header, since metrics describe the sessions, projects,
+// database and routes of the app. Without a MetricsToken, metrics aren't
+// served and requests are replied to with not found.
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
+	if h.MetricsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !secureCompare(r.Header.Get("Authorization"), "Bearer "+h.MetricsToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	metrics.Handler(h.MetricsRegistry).ServeHTTP(w, r)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// ProjectMilestones renders the milestones tab of a project the user owns,
+// with the progress of each milestone.
+func (h *Handler) ProjectMilestones(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	today := userToday(h.GetUserFromContext(r.Context()))
+	progress, err := h.MilestoneService.GetProgressByProjectID(r.Context(), project.ID, pgtype.Date{Time: today, Valid: true})
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectMilestones(project, progress, today)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type CreateMilestoneForm struct {
+	Name        string `form:"name"`
+	Description string `form:"description"`
+	TargetDate  string `form:"target_date"`
+}
+
+func (data CreateMilestoneForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.Description, validation.Length(0, 1000)),
+		validation.Field(&data.TargetDate, validation.Date(time.DateOnly)),
+	)
+}
+
+// CreateMilestone adds a milestone to a project the user owns, and renders
+// the milestones of the project again.
+func (h *Handler) CreateMilestone(w http.ResponseWriter, r *http.Request) {
+	var data CreateMilestoneForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	if ok {
+		targetDate, err := database.DateFromString(data.TargetDate)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		_, err = h.MilestoneService.Create(r.Context(), project.ID, data.Name, data.Description, targetDate)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		errors = validator.NewValidatedSlice()
+	}
+	today := userToday(h.GetUserFromContext(r.Context()))
+	progress, err := h.MilestoneService.GetProgressByProjectID(r.Context(), project.ID, pgtype.Date{Time: today, Valid: true})
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectMilestoneList(project, progress, today, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteMilestone deletes a milestone of a project the user owns. Its tasks
+// stay in the project without a milestone.
+func (h *Handler) DeleteMilestone(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	err = h.MilestoneService.Delete(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, successToastComponent("Milestone deleted successfully"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getOwnedProject returns the project with the id in the url, and false
+// after replying with an error if the user doesn't own it.
+func (h *Handler) getOwnedProject(w http.ResponseWriter, r *http.Request) (database.Project, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Project{}, false
+	}
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Project{}, false
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.Project{}, false
+	}
+	return project, true
+}
+
+// userToday returns the current date in the time zone of the given user, at
+// midnight UTC like the dates of the database.
+func userToday(user database.User) time.Time {
+	now := time.Now().In(user.Location())
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
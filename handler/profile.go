@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/attachment"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+type UpdateProfileForm struct {
+	Name     string `form:"name"`
+	Timezone string `form:"timezone"`
+}
+
+func (data UpdateProfileForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Name, validation.Length(0, 100)),
+		validation.Field(&data.Timezone, validation.Required, validation.By(func(value interface{}) error {
+			_, err := time.LoadLocation(value.(string))
+			if err != nil {
+				return fmt.Errorf("must be a time zone like Europe/Lisbon")
+			}
+			return nil
+		})),
+	)
+}
+
+// UpdateProfile updates the display name and time zone of the user, and
+// renders the details section of their profile again.
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var data UpdateProfileForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	if !ok {
+		h.renderProfileDetails(w, r, user, errors, "")
+		return
+	}
+	user, err = h.UserService.UpdateProfile(r.Context(), user.ID, data.Name, data.Timezone)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderProfileDetails(w, r, user, validator.NewValidatedSlice(), "Profile updated successfully")
+}
+
+// UploadAvatar replaces the avatar of the user with the uploaded image,
+// scaled down and stored as a PNG, and renders the details section of their
+// profile again.
+func (h *Handler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	tooLarge := fmt.Sprintf("The image must be smaller than %s.", attachment.Size(attachment.AvatarMaxSize))
+	r.Body = http.MaxBytesReader(w, r.Body, attachment.AvatarMaxSize+(64<<10))
+	err := r.ParseMultipartForm(attachment.AvatarMaxSize)
+	if err != nil {
+		h.renderProfileError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		h.renderProfileError(w, r, http.StatusBadRequest, "Please choose an image.")
+		return
+	}
+	defer file.Close()
+	if header.Size > attachment.AvatarMaxSize {
+		h.renderProfileError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	contentType, ok := attachment.ContentType(header.Filename, data)
+	if !ok || !attachment.IsImage(contentType) {
+		h.renderProfileError(w, r, http.StatusUnsupportedMediaType, "Only PNG, JPEG, GIF and WebP images can be used as an avatar.")
+		return
+	}
+	avatar, err := attachment.Avatar(data)
+	if err != nil {
+		h.renderProfileError(w, r, http.StatusUnsupportedMediaType, "The image couldn't be read.")
+		return
+	}
+	key, err := attachment.NewAvatarKey(user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Storage.Put(r.Context(), key, bytes.NewReader(avatar), int64(len(avatar)), "image/png")
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user, previous, err := h.UserService.SetAvatar(r.Context(), user.ID, pgtype.Text{String: key, Valid: true})
+	if err != nil {
+		h.deleteFiles(r.Context(), key)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if previous.Valid {
+		h.deleteFiles(r.Context(), previous.String)
+	}
+	h.renderProfileDetails(w, r, user, validator.NewValidatedSlice(), "Avatar updated successfully")
+}
+
+// DeleteAvatar deletes the avatar the user uploaded, so that their GitHub
+// avatar is shown again, and renders the details section of their profile
+// again.
+func (h *Handler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	user, previous, err := h.UserService.SetAvatar(r.Context(), user.ID, pgtype.Text{})
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if previous.Valid {
+		h.deleteFiles(r.Context(), previous.String)
+	}
+	h.renderProfileDetails(w, r, user, validator.NewValidatedSlice(), "Avatar removed successfully")
+}
+
+// GetAvatar serves the avatar a user uploaded, which every logged in user
+// can see, like their name.
+func (h *Handler) GetAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	user, found, err := h.UserService.GetUserByID(r.Context(), id)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !found || !user.AvatarKey.Valid {
+		h.Error(w, r, fmt.Errorf("user %d has no avatar", id), http.StatusNotFound)
+		return
+	}
+	h.serveFile(w, r, user.AvatarKey.String, "image/png", -1)
+}
+
+// renderProfileDetails renders the details section of the profile of the
+// given user, along with a success toast with the given message unless it's
+// empty.
+func (h *Handler) renderProfileDetails(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+	errors validator.ValidatedSlice,
+	message string,
+) {
+	var err error
+	if message == "" {
+		err = h.Render(w, r, template.ProfileDetails(user, errors))
+	} else {
+		err = h.RenderComponents(w, r, http.StatusOK, template.ProfileDetails(user, errors), successToastComponent(message))
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderProfileError replies with an error toast with the given message,
+// leaving the profile as it is.
+func (h *Handler) renderProfileError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	h.Reswap(w, "none")
+	w.WriteHeader(code)
+	h.Render(w, r, errorToastComponent(message))
+}
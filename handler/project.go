@@ -1,36 +1,72 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/database"
 	"github.com/webdevfuel/projectmotor/template"
 	"github.com/webdevfuel/projectmotor/template/toast"
+	"github.com/webdevfuel/projectmotor/util"
 	"github.com/webdevfuel/projectmotor/validator"
+	"github.com/webdevfuel/projectmotor/webhook"
 )
 
+// GetProjects renders the active projects of the user, or the archived ones
+// if the url query "filter" is "archived".
 func (h *Handler) GetProjects(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
-	projects, err := h.ProjectService.GetAll(user.ID)
+	archived := h.GetURLQuery(r, "filter").Value == "archived"
+	var projects []database.Project
+	var err error
+	if archived {
+		projects, err = h.ProjectService.GetAllArchived(r.Context(), user.ID)
+	} else {
+		projects, err = h.ProjectService.GetAll(r.Context(), user.ID)
+	}
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	component := template.Projects(projects)
-	err = component.Render(r.Context(), w)
+	var readOnly []database.Project
+	if !archived {
+		readOnly, err = h.ProjectService.GetAllReadOnly(r.Context(), user.ID)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	transfers, err := h.ProjectTransferService.GetAllIncoming(r.Context(), user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.Projects(projects, readOnly, archived, transfers)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
 
 func (h *Handler) NewProject(w http.ResponseWriter, r *http.Request) {
-	component := template.ProjectNew()
-	err := component.Render(r.Context(), w)
+	user := h.GetUserFromContext(r.Context())
+	templates, err := h.ProjectService.GetAllTemplates(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectNew(templates)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -38,11 +74,17 @@ func (h *Handler) NewProject(w http.ResponseWriter, r *http.Request) {
 type CreateProjectForm struct {
 	Title       string `form:"title"`
 	Description string `form:"description"`
+	// TemplateID is the id of the template the project is created from, if
+	// any, and StartDate is the date its dates are shifted to.
+	TemplateID string `form:"template_id"`
+	StartDate  string `form:"start_date"`
 }
 
 func (data CreateProjectForm) Validate() error {
 	return validation.ValidateStruct(&data,
 		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.TemplateID, is.Digit),
+		validation.Field(&data.StartDate, validation.Date(time.DateOnly)),
 	)
 }
 
@@ -50,39 +92,141 @@ func (h *Handler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	var data CreateProjectForm
 	ok, errors, err := validator.Validate(&data, r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
+	user := h.GetUserFromContext(r.Context())
 	if !ok {
-		component := template.ProjectNewForm(errors)
-		err = component.Render(r.Context(), w)
+		templates, err := h.ProjectService.GetAllTemplates(r.Context(), user.ID)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		component := template.ProjectNewForm(errors, templates)
+		err = h.Render(w, r, component)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		return
 	}
-	user := h.GetUserFromContext(r.Context())
-	_, err = h.ProjectService.Create(data.Title, data.Description, user.ID)
+	if data.TemplateID != "" {
+		h.createProjectFromTemplate(w, r, data)
+		return
+	}
+	_, err = h.ProjectService.Create(r.Context(), data.Title, data.Description, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.Redirect(w, "http://localhost:3000/projects")
 }
 
+// createProjectFromTemplate creates a project as a copy of a template the
+// user owns, and redirects to it.
+func (h *Handler) createProjectFromTemplate(w http.ResponseWriter, r *http.Request, data CreateProjectForm) {
+	user := h.GetUserFromContext(r.Context())
+	templateID, err := util.Atoi32(data.TemplateID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	startDate, err := database.DateFromString(data.StartDate)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, err := h.ProjectService.Copy(r.Context(), templateID, user.ID, data.Title, data.Description, false, startDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, fmt.Sprintf("/projects/%d/edit", project.ID))
+}
+
+type CopyProjectForm struct {
+	// Title is named apart from the title of the project edit form, which
+	// is on the same page.
+	Title string `form:"copy_title"`
+	// StartDate is the date the dates of the copy are shifted to, and keeps
+	// them as they are when empty.
+	StartDate string `form:"start_date"`
+}
+
+func (data CopyProjectForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.StartDate, validation.Date(time.DateOnly)),
+	)
+}
+
+// DuplicateProject copies a project the user owns into a new project.
+func (h *Handler) DuplicateProject(w http.ResponseWriter, r *http.Request) {
+	h.copyProject(w, r, false)
+}
+
+// SaveProjectAsTemplate copies a project the user owns into a new template.
+func (h *Handler) SaveProjectAsTemplate(w http.ResponseWriter, r *http.Request) {
+	h.copyProject(w, r, true)
+}
+
+// copyProject copies a project the user owns with its milestones and tasks,
+// and redirects to the copy.
+func (h *Handler) copyProject(w http.ResponseWriter, r *http.Request, asTemplate bool) {
+	var data CopyProjectForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	if !ok {
+		component := template.ProjectCopyForm(project, errors)
+		err = h.Render(w, r, component)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	startDate, err := database.DateFromString(data.StartDate)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	copied, err := h.ProjectService.Copy(r.Context(), project.ID, user.ID, data.Title, "", asTemplate, startDate)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, fmt.Sprintf("/projects/%d/edit", copied.ID))
+}
+
 func (h *Handler) EditProject(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
 	id, _ := h.GetIDFromRequest(r, "id")
-	project, err := h.ProjectService.Get(id, user.ID)
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	component := template.ProjectEdit(project)
-	err = component.Render(r.Context(), w)
+	user, err = h.ensureCalendarToken(r, user)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectEdit(project, h.ProjectCalendarURL(user, project.ID))
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -90,16 +234,19 @@ func (h *Handler) EditProject(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ToggleProjectPublished(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
 	id, _ := h.GetIDFromRequest(r, "id")
-	project, err := h.ProjectService.TogglePublished(id, user.ID)
+	if !h.ensureActiveProject(w, r, pgtype.Int4{Int32: id, Valid: true}) {
+		return
+	}
+	project, err := h.ProjectService.TogglePublished(r.Context(), id, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.TriggerEvent(w, fmt.Sprintf("toggle-project-status:%d", project.ID))
 	component := template.ProjectStatusLabel(project.Published)
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	component = toast.Toast(toast.ToastOpts{
@@ -107,9 +254,9 @@ func (h *Handler) ToggleProjectPublished(w http.ResponseWriter, r *http.Request)
 		Type:    "success",
 		SwapOOB: true,
 	})
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -129,28 +276,32 @@ func (h *Handler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	var data UpdateProjectForm
 	id, _ := h.GetIDFromRequest(r, "id")
 	user := h.GetUserFromContext(r.Context())
-	project, err := h.ProjectService.Get(id, user.ID)
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
 		return
 	}
 	ok, errors, err := validator.Validate(&data, r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	if !ok {
 		component := template.ProjectEditForm(project, errors, template.NewProjectEditFormOpts())
-		err = component.Render(r.Context(), w)
+		err = h.Render(w, r, component)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		return
 	}
-	project, err = h.ProjectService.Update(id, data.Title, data.Description, user.ID)
+	project, err = h.ProjectService.Update(r.Context(), id, data.Title, data.Description, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	component := template.ProjectEditForm(
@@ -160,9 +311,9 @@ func (h *Handler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 			SwapOOB: true,
 		},
 	)
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	component = toast.Toast(toast.ToastOpts{
@@ -170,19 +321,78 @@ func (h *Handler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 		Type:    "success",
 		SwapOOB: true,
 	})
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ArchiveProject archives a project the user owns, which makes it and its
+// tasks read-only until it's restored.
+func (h *Handler) ArchiveProject(w http.ResponseWriter, r *http.Request) {
+	h.setProjectState(w, r, database.ProjectStateArchived)
+}
+
+// RestoreProject makes an archived project the user owns active again.
+func (h *Handler) RestoreProject(w http.ResponseWriter, r *http.Request) {
+	h.setProjectState(w, r, database.ProjectStateActive)
+}
+
+func (h *Handler) setProjectState(w http.ResponseWriter, r *http.Request, state database.ProjectState) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusNotFound)
 		return
 	}
+	project, err := h.ProjectService.SetState(r.Context(), id, user.ID, state)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, fmt.Sprintf("/projects/%d/edit", project.ID))
+}
+
+// ensureActiveProject returns false after replying with a conflict if the
+// project with the given id is archived, since archived projects are
+// read-only for their owner and members alike.
+func (h *Handler) ensureActiveProject(w http.ResponseWriter, r *http.Request, projectID pgtype.Int4) bool {
+	archived, err := h.ProjectService.IsArchived(r.Context(), projectID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return false
+	}
+	if archived {
+		h.projectArchivedError(w, r)
+		return false
+	}
+	return true
+}
+
+// projectArchivedError replies with a conflict and an error toast saying
+// that the project is archived.
+func (h *Handler) projectArchivedError(w http.ResponseWriter, r *http.Request) {
+	h.Reswap(w, "none")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	errorToastComponent(projectArchivedMessage).Render(r.Context(), w)
 }
 
+// projectArchivedMessage tells users that changes to archived projects
+// aren't possible.
+const projectArchivedMessage = "This project is archived. Restore it to make changes."
+
 func (h *Handler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
 	id, _ := h.GetIDFromRequest(r, "id")
-	err := h.ProjectService.Delete(id, user.ID)
+	err := h.ProjectService.Delete(r.Context(), id, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.Redirect(w, "http://localhost:3000/projects")
@@ -191,25 +401,27 @@ func (h *Handler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ShareProject(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
 	id, _ := h.GetIDFromRequest(r, "id")
-	project, err := h.ProjectService.Get(id, user.ID)
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	users, err := h.UserService.GetSharedUsers(id)
+	users, err := h.UserService.GetSharedUsers(r.Context(), id)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	var u []template.ProjectShareUser
 	for _, user := range users {
-		u = append(u, template.ProjectShareUser{
-			ID:    user.ID,
-			Email: user.Email,
-		})
+		u = append(u, template.NewProjectShareUser(user))
+	}
+	transfer, pending, err := h.ProjectTransferService.GetByProject(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
 	}
-	component := template.ProjectShare(project, u)
-	component.Render(r.Context(), w)
+	component := template.ProjectShare(project, u, transfer, pending)
+	h.Render(w, r, component)
 }
 
 type ShareProjectByEmailForm struct {
@@ -239,7 +451,7 @@ func (h *Handler) ShareProjectByEmail(w http.ResponseWriter, r *http.Request) er
 		return h.RenderComponents(w, r, http.StatusBadRequest, projectShareFormComponent)
 	}
 	owner := h.GetUserFromContext(r.Context())
-	project, err := h.ProjectService.Get(projectId, owner.ID)
+	project, err := h.ProjectService.Get(r.Context(), projectId, owner.ID)
 	if err != nil {
 		return h.RenderComponents(
 			w,
@@ -249,7 +461,7 @@ func (h *Handler) ShareProjectByEmail(w http.ResponseWriter, r *http.Request) er
 			defaultErrorToastComponent(),
 		)
 	}
-	user, err := h.UserService.GetUserByEmail(data.Email)
+	user, err := h.UserService.GetUserByEmail(r.Context(), data.Email)
 	if err != nil {
 		return h.RenderComponents(
 			w,
@@ -268,7 +480,7 @@ func (h *Handler) ShareProjectByEmail(w http.ResponseWriter, r *http.Request) er
 			errorToastComponent("It's not possible to share a project with yourself."),
 		)
 	}
-	exists, err := h.ProjectService.Share(project.ID, user.ID)
+	exists, err := h.shareProject(r.Context(), project, user)
 	if exists {
 		return h.RenderComponents(
 			w,
@@ -295,14 +507,36 @@ func (h *Handler) ShareProjectByEmail(w http.ResponseWriter, r *http.Request) er
 		r,
 		http.StatusCreated,
 		projectShareFormComponent,
-		template.ProjectCurrentlySharedRow(projectId, template.ProjectShareUser{
-			ID:    user.ID,
-			Email: user.Email,
-		}, true),
+		template.ProjectCurrentlySharedRow(projectId, template.NewProjectShareUser(user), true),
 		successToastComponent("Project shared successfully."),
 	)
 }
 
+// shareProject shares the given project with the given user, and queues the
+// webhooks of the share inside the same transaction. It reports whether the
+// project was already shared with them, in which case nothing is queued.
+func (h *Handler) shareProject(ctx context.Context, project database.Project, user database.User) (bool, error) {
+	tx, err := h.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	exists, err := h.ProjectService.ShareWithTx(ctx, tx, project.ID, user.ID)
+	if err != nil || exists {
+		return exists, err
+	}
+	err = h.enqueueWebhookWithTx(ctx, tx, pgtype.Int4{Int32: project.ID, Valid: true}, webhook.EventProjectShared, webhook.Share{
+		ProjectID:    project.ID,
+		ProjectTitle: project.Title,
+		UserID:       user.ID,
+		Email:        user.Email,
+	})
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
 func (h *Handler) RevokeProjectById(w http.ResponseWriter, r *http.Request) error {
 	projectId, err := h.GetIDFromRequest(r, "projectId")
 	if err != nil {
@@ -323,7 +557,7 @@ func (h *Handler) RevokeProjectById(w http.ResponseWriter, r *http.Request) erro
 		)
 	}
 	owner := h.GetUserFromContext(r.Context())
-	project, err := h.ProjectService.Get(projectId, owner.ID)
+	project, err := h.ProjectService.Get(r.Context(), projectId, owner.ID)
 	if err != nil {
 		return h.RenderComponents(
 			w,
@@ -332,7 +566,7 @@ func (h *Handler) RevokeProjectById(w http.ResponseWriter, r *http.Request) erro
 			defaultErrorToastComponent(),
 		)
 	}
-	user, err := h.UserService.MustGetUserByID(userId)
+	user, err := h.UserService.MustGetUserByID(r.Context(), userId)
 	if err != nil {
 		return h.RenderComponents(
 			w,
@@ -341,7 +575,7 @@ func (h *Handler) RevokeProjectById(w http.ResponseWriter, r *http.Request) erro
 			defaultErrorToastComponent(),
 		)
 	}
-	err = h.ProjectService.Revoke(project.ID, user.ID)
+	err = h.ProjectService.Revoke(r.Context(), project.ID, user.ID)
 	if err != nil {
 		return h.RenderComponents(
 			w,
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/webdevfuel/projectmotor/auth"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// ProjectPage renders the settings of the public page of a project the user
+// owns, with its url and view count.
+func (h *Handler) ProjectPage(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	page, err := h.ensureProjectPage(r, project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectPage(project, page, h.ProjectPageURL(page))
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type ProjectPageForm struct {
+	Enabled              bool `form:"enabled"`
+	ShowDescription      bool `form:"show_description"`
+	ShowStatus           bool `form:"show_status"`
+	ShowDueDates         bool `form:"show_due_dates"`
+	ShowTaskDescriptions bool `form:"show_task_descriptions"`
+}
+
+func (data ProjectPageForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Enabled),
+		validation.Field(&data.ShowDescription),
+		validation.Field(&data.ShowStatus),
+		validation.Field(&data.ShowDueDates),
+		validation.Field(&data.ShowTaskDescriptions),
+	)
+}
+
+// UpdateProjectPage saves whether the public page of a project the user owns
+// is enabled, and which fields it shows.
+func (h *Handler) UpdateProjectPage(w http.ResponseWriter, r *http.Request) {
+	var data ProjectPageForm
+	_, _, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	page, err := h.ensureProjectPage(r, project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	page, err = h.ProjectPageService.Save(r.Context(), project.ID, page.Token, database.ProjectPageSettings{
+		Enabled:              data.Enabled,
+		ShowDescription:      data.ShowDescription,
+		ShowStatus:           data.ShowStatus,
+		ShowDueDates:         data.ShowDueDates,
+		ShowTaskDescriptions: data.ShowTaskDescriptions,
+	})
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProjectPageSettings(project, page, h.ProjectPageURL(page)),
+		successToastComponent("Public page updated successfully"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// RegenerateProjectPageToken replaces the token of the public page of a
+// project the user owns, so that links shared before stop working.
+func (h *Handler) RegenerateProjectPageToken(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	_, err := h.ensureProjectPage(r, project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	token, err := auth.GeneratePublicPageToken()
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	page, err := h.ProjectPageService.SetToken(r.Context(), project.ID, token)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProjectPageSettings(project, page, h.ProjectPageURL(page)),
+		successToastComponent("Public link regenerated successfully. Links shared before no longer work."),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// PublicProjectPage renders the public page with the token in the url to
+// anyone, without logging in, and counts the view.
+func (h *Handler) PublicProjectPage(w http.ResponseWriter, r *http.Request) {
+	page, project, ok, err := h.ProjectPageService.View(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.Error(w, r, fmt.Errorf("public page doesn't exist or isn't available"), http.StatusNotFound)
+		return
+	}
+	tasks, err := h.ProjectPageService.GetTasks(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	// the url is a secret, so keep it out of search engines and caches
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Cache-Control", "no-store")
+	component := template.PublicProject(page, project, tasks)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ProjectPageURL returns the url of the given public page.
+func (h *Handler) ProjectPageURL(page database.ProjectPage) string {
+	return h.PublicURLFor(fmt.Sprintf("/p/%s", page.Token))
+}
+
+// ensureProjectPage returns the public page of the project with the given
+// id, which is created disabled if the project doesn't have one yet.
+func (h *Handler) ensureProjectPage(r *http.Request, projectID int32) (database.ProjectPage, error) {
+	page, ok, err := h.ProjectPageService.Get(r.Context(), projectID)
+	if err != nil || ok {
+		return page, err
+	}
+	token, err := auth.GeneratePublicPageToken()
+	if err != nil {
+		return database.ProjectPage{}, err
+	}
+	return h.ProjectPageService.Save(r.Context(), projectID, token, database.ProjectPageSettings{
+		ShowDescription: true,
+		ShowStatus:      true,
+		ShowDueDates:    true,
+	})
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+type TransferProjectForm struct {
+	Email         string `form:"email"`
+	ReassignTasks bool   `form:"reassign_tasks"`
+	KeepAccess    bool   `form:"keep_access"`
+}
+
+func (data TransferProjectForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Email, validation.Required, is.Email),
+		validation.Field(&data.ReassignTasks),
+		validation.Field(&data.KeepAccess),
+	)
+}
+
+// TransferProject asks the user with the given email address to become the
+// owner of a project the user owns, replacing the pending transfer if
+// there's one, and renders the transfer section of the project again.
+func (h *Handler) TransferProject(w http.ResponseWriter, r *http.Request) {
+	var data TransferProjectForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	transfer, pending, err := h.ProjectTransferService.GetByProject(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if ok {
+		recipient, reason, err := h.getTransferRecipient(r, project, data.Email)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if reason == "" {
+			transfer, err = h.ProjectTransferService.Create(
+				r.Context(),
+				project.ID,
+				project.OwnerID,
+				recipient.ID,
+				data.ReassignTasks,
+				data.KeepAccess,
+			)
+			if err != nil {
+				h.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			pending = true
+			errors = validator.NewValidatedSlice()
+		} else {
+			errors = validator.ValidatedSlice{{Key: "Email", Value: data.Email, Error: reason}}
+		}
+	}
+	component := template.ProjectTransferSection(project, transfer, pending, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getTransferRecipient returns the user with the given email address, and
+// the reason they can't be transferred the given project, which is empty
+// if they can.
+//
+// Only projects of personal workspaces can be transferred, and they move to
+// the active workspace of the recipient once accepted, which may be a shared
+// one. Projects of shared workspaces belong to the workspace rather than to
+// the member who created them, so they can't be given away by that member.
+func (h *Handler) getTransferRecipient(r *http.Request, project database.Project, email string) (database.User, string, error) {
+	organization, err := h.OrganizationService.Get(r.Context(), project.OrganizationID, h.GetUserFromContext(r.Context()).ID)
+	if err != nil {
+		return database.User{}, "", err
+	}
+	if !organization.Personal() {
+		return database.User{}, "can't be given a project of a shared workspace", nil
+	}
+	user, err := h.UserService.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, "doesn't belong to a ProjectMotor account", nil
+	}
+	if err != nil {
+		return database.User{}, "", err
+	}
+	if user.ID == project.OwnerID {
+		return database.User{}, "belongs to the current owner", nil
+	}
+	if user.Suspended() {
+		return database.User{}, "belongs to a suspended account", nil
+	}
+	return user, "", nil
+}
+
+// CancelProjectTransfer deletes the pending transfer of a project the user
+// owns, and renders the transfer section of the project again.
+func (h *Handler) CancelProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	err := h.ProjectTransferService.Cancel(r.Context(), project.ID, project.OwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.ProjectTransferSection(project, database.ProjectTransfer{}, false, validator.NewValidatedSlice()),
+		successToastComponent("Transfer cancelled"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// AcceptProjectTransfer makes the user the owner of the project of a
+// pending transfer to them, and redirects to the project.
+func (h *Handler) AcceptProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	project, err := h.ProjectTransferService.Accept(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, fmt.Sprintf("/projects/%d/edit", project.ID))
+}
+
+// DeclineProjectTransfer deletes a pending transfer to the user, leaving
+// the project with its current owner.
+func (h *Handler) DeclineProjectTransfer(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	err = h.ProjectTransferService.Decline(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, successToastComponent("Transfer declined"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
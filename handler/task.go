@@ -1,30 +1,41 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/a-h/templ"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
 	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/recurrence"
 	"github.com/webdevfuel/projectmotor/template"
 	"github.com/webdevfuel/projectmotor/template/toast"
+	"github.com/webdevfuel/projectmotor/timetrack"
 	"github.com/webdevfuel/projectmotor/util"
 	"github.com/webdevfuel/projectmotor/validator"
+	"github.com/webdevfuel/projectmotor/webhook"
 )
 
 func (h *Handler) NewTask(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
-	projects, err := h.ProjectService.GetAll(user.ID)
+	projects, err := h.ProjectService.GetAll(r.Context(), user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	component := template.TaskNew(projects)
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -32,12 +43,14 @@ func (h *Handler) NewTask(w http.ResponseWriter, r *http.Request) {
 type CreateTaskForm struct {
 	Title       string `form:"title"`
 	Description string `form:"description"`
+	DueDate     string `form:"due_date"`
 	ProjectID   string `form:"project_id"`
 }
 
 func (data CreateTaskForm) Validate() error {
 	return validation.ValidateStruct(&data,
 		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.DueDate, validation.Date(time.DateOnly)),
 		validation.Field(&data.ProjectID, is.Digit),
 	)
 }
@@ -46,32 +59,72 @@ func (h *Handler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var data CreateTaskForm
 	ok, errors, err := validator.Validate(&data, r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	projects, err := h.ProjectService.GetAll(h.GetUserFromContext(r.Context()).ID)
+	projects, err := h.ProjectService.GetAll(r.Context(), h.GetUserFromContext(r.Context()).ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
+	if ok && data.ProjectID == "" {
+		shared, err := h.inSharedWorkspace(r.Context(), h.GetUserFromContext(r.Context()).ID)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if shared {
+			ok = false
+			errors = validator.ValidatedSlice{
+				{Key: "Title", Value: data.Title},
+				{Key: "Description", Value: data.Description},
+				{Key: "DueDate", Value: data.DueDate},
+				{Key: "ProjectID", Error: sharedWorkspaceProjectMessage},
+			}
+		}
+	}
 	if !ok {
 		component := template.TaskNewForm(errors, projects)
-		err = component.Render(r.Context(), w)
+		err = h.Render(w, r, component)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		return
 	}
 	projectID, err := database.Int4FromString(data.ProjectID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !h.ensureActiveProject(w, r, projectID) {
+		return
+	}
+	dueDate, err := database.DateFromString(data.DueDate)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	user := h.GetUserFromContext(r.Context())
-	err = h.TaskService.Create(data.Title, data.Description, projectID, user.ID)
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	task, err := h.TaskService.CreateWithTx(r.Context(), tx, data.Title, data.Description, dueDate, projectID, user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.enqueueWebhookWithTx(r.Context(), tx, task.ProjectID, webhook.EventTaskCreated, webhook.NewTask(task))
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.Redirect(w, "http://localhost:3000/tasks")
@@ -90,31 +143,31 @@ func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	if !project.IsEmpty {
 		id, err := util.Atoi32(project.Value)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		projectId = id
 	}
 	// get appropriate tasks based on project id
 	if project.IsEmpty {
-		t, err := h.TaskService.GetAll(user.ID)
+		t, err := h.TaskService.GetAll(r.Context(), user.ID)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		tasks = t
 	} else {
-		t, err := h.TaskService.GetAllByProjectID(user.ID, projectId)
+		t, err := h.TaskService.GetAllByProjectID(r.Context(), user.ID, projectId)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		tasks = t
 	}
 	// get all projects
-	projects, err := h.ProjectService.GetAll(user.ID)
+	projects, err := h.ProjectService.GetAll(r.Context(), user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// filter based on project existing or not
@@ -137,16 +190,16 @@ func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 		h.ReplaceUrl(w, fmt.Sprintf("/tasks?project=%d", projectId))
 	}
 	// render component
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	// override component with tasks filter and render it
 	component = template.TasksFilter(filter)
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -154,16 +207,24 @@ func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) EditTask(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
 	id, _ := h.GetIDFromRequest(r, "id")
-	task, err := h.TaskService.Get(id, user.ID)
+	task, err := h.TaskService.Get(r.Context(), id, user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
+		return
+	}
+	milestones, err := h.getTaskMilestones(r.Context(), task)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	h.TriggerEvent(w, "open-modal")
-	component := template.TaskEditForm(task, validator.NewValidatedSlice())
-	err = component.Render(r.Context(), w)
+	component := template.TaskEditForm(task, milestones, validator.NewValidatedSlice())
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -171,69 +232,342 @@ func (h *Handler) EditTask(w http.ResponseWriter, r *http.Request) {
 type UpdateTaskForm struct {
 	Title       string `form:"title"`
 	Description string `form:"description"`
+	DueDate     string `form:"due_date"`
+	// Status keeps the current status when empty.
+	Status string `form:"status"`
+	// Repeat is "none", "daily", "weekly", "monthly" or "after_completion",
+	// and keeps the current recurrence rule when empty.
+	Repeat   string   `form:"repeat"`
+	Interval string   `form:"interval"`
+	Weekdays []string `form:"weekdays"`
+	MonthDay string   `form:"month_day"`
+	// MilestoneID is "none" or the id of a milestone of the project of the
+	// task, and keeps the current milestone when empty.
+	MilestoneID string `form:"milestone_id"`
 }
 
 func (data UpdateTaskForm) Validate() error {
+	intervalRules := []validation.Rule{}
+	if data.Repeat != "" && data.Repeat != "none" {
+		intervalRules = append(intervalRules, validation.Required, is.Digit, intBetween(1, recurrence.MaxInterval))
+	}
+	monthDayRules := []validation.Rule{}
+	if data.Repeat == "monthly" {
+		monthDayRules = append(monthDayRules, is.Digit, intBetween(1, 31))
+	}
 	return validation.ValidateStruct(&data,
 		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.DueDate, validation.Date(time.DateOnly)),
+		validation.Field(&data.Status, validation.In(
+			string(database.TaskStatusTodo),
+			string(database.TaskStatusInProgress),
+			string(database.TaskStatusDone),
+		)),
+		validation.Field(&data.Repeat, validation.In("none", "daily", "weekly", "monthly", "after_completion")),
+		validation.Field(&data.Interval, intervalRules...),
+		validation.Field(&data.Weekdays, validation.By(weekdayCodes)),
+		validation.Field(&data.MonthDay, monthDayRules...),
+		validation.Field(&data.MilestoneID, validation.Match(milestoneIDPattern)),
 	)
 }
 
+var milestoneIDPattern = regexp.MustCompile(`^(none|[0-9]+)$`)
+
+// intBetween returns a validation rule that checks that a string, if not
+// empty, is an integer between min and max.
+func intBetween(min int, max int) validation.Rule {
+	return validation.By(func(value interface{}) error {
+		s, _ := value.(string)
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("must be between %d and %d", min, max)
+		}
+		return nil
+	})
+}
+
+// weekdayCodes checks that a slice of strings only has weekday codes like
+// "MO", as used by recurrence rules.
+func weekdayCodes(value interface{}) error {
+	codes, _ := value.([]string)
+	for _, code := range codes {
+		_, ok := recurrence.ParseWeekday(code)
+		if !ok {
+			return fmt.Errorf("%q isn't a weekday", code)
+		}
+	}
+	return nil
+}
+
+// Recurrence returns the recurrence rule chosen in the form, or the given
+// current rule if the form has no repeat field.
+func (data UpdateTaskForm) Recurrence(current pgtype.Text) pgtype.Text {
+	interval, _ := strconv.Atoi(data.Interval)
+	rule := recurrence.Rule{Interval: interval}
+	switch data.Repeat {
+	case "":
+		return current
+	case "none":
+		return pgtype.Text{}
+	case "daily":
+		rule.Freq = recurrence.Daily
+	case "after_completion":
+		rule.Freq = recurrence.Daily
+		rule.AfterCompletion = true
+	case "weekly":
+		rule.Freq = recurrence.Weekly
+		for _, code := range data.Weekdays {
+			day, _ := recurrence.ParseWeekday(code)
+			rule.Weekdays = append(rule.Weekdays, day)
+		}
+	case "monthly":
+		rule.Freq = recurrence.Monthly
+		rule.MonthDay, _ = strconv.Atoi(data.MonthDay)
+	}
+	return pgtype.Text{String: rule.String(), Valid: true}
+}
+
+// Milestone returns the milestone chosen in the form, or the given current
+// milestone if the form has no milestone field.
+func (data UpdateTaskForm) Milestone(current pgtype.Int4) pgtype.Int4 {
+	switch data.MilestoneID {
+	case "":
+		return current
+	case "none":
+		return pgtype.Int4{}
+	}
+	// ids too large for an int4 can't belong to any milestone
+	id, _ := database.Int4FromString(data.MilestoneID)
+	return id
+}
+
 func (h *Handler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	var data UpdateTaskForm
 	ok, errors, err := validator.Validate(&data, r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	taskId, _ := h.GetIDFromRequest(r, "id")
 	userId := h.GetUserFromContext(r.Context()).ID
-	task, err := h.TaskService.Get(taskId, userId)
+	task, err := h.TaskService.Get(r.Context(), taskId, userId)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
 		return
 	}
 	if !ok {
-		component := template.TaskEditForm(task, errors)
-		err = component.Render(r.Context(), w)
+		milestones, err := h.getTaskMilestones(r.Context(), task)
 		if err != nil {
-			h.Error(w, err, http.StatusInternalServerError)
+			h.Error(w, r, err, http.StatusInternalServerError)
 			return
 		}
+		component := template.TaskEditForm(task, milestones, errors)
+		err = h.Render(w, r, component)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	dueDate, err := database.DateFromString(data.DueDate)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	status := task.Status
+	if data.Status != "" {
+		status = database.TaskStatus(data.Status)
+	}
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	updated, err := h.TaskService.UpdateWithTx(
+		r.Context(),
+		tx,
+		taskId,
+		userId,
+		data.Title,
+		data.Description,
+		dueDate,
+		status,
+		data.Recurrence(task.Recurrence),
+		data.Milestone(task.MilestoneID),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	next, created, err := h.taskUpdatedWithTx(r.Context(), tx, task, updated)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
-	err = h.TaskService.Update(taskId, userId, data.Title, data.Description)
+	err = tx.Commit()
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
+	h.pushTaskToGitHub(r.Context(), updated)
+	message := "Task updated successfully"
+	if created {
+		message = fmt.Sprintf("Task completed, next one is due %s", next.DueDate.Time.Format("Jan 2, 2006"))
+	}
 	component := toast.Toast(toast.ToastOpts{
-		Message: "Task updated successfully",
+		Message: message,
 		Type:    "success",
 		SwapOOB: true,
 	})
 	h.TriggerEvent(w, fmt.Sprintf("update-task-row:%d", task.ID))
 	h.Reswap(w, "none")
-	err = component.Render(r.Context(), w)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// getTaskMilestones returns the milestones the given task can belong to,
+// which are those of its project.
+func (h *Handler) getTaskMilestones(ctx context.Context, task database.Task) ([]database.Milestone, error) {
+	if !task.ProjectID.Valid {
+		return nil, nil
+	}
+	return h.MilestoneService.GetAllByProjectID(ctx, task.ProjectID.Int32)
+}
+
+// taskUpdatedWithTx queues the webhooks of the given updated task inside
+// the given transaction, which the update was made in. The task should be
+// pushed to its GitHub issue, if any, once the transaction is committed.
+//
+// Completing an occurrence of a recurring task creates the next one, which
+// is returned, and reported true if it was created.
+func (h *Handler) taskUpdatedWithTx(ctx context.Context, tx *sqlx.Tx, task database.Task, updated database.Task) (database.Task, bool, error) {
+	err := h.enqueueWebhookWithTx(ctx, tx, updated.ProjectID, webhook.EventTaskUpdated, webhook.NewTask(updated))
+	if err != nil {
+		return database.Task{}, false, err
+	}
+	if task.Status == database.TaskStatusDone || updated.Status != database.TaskStatusDone {
+		return database.Task{}, false, nil
+	}
+	return recurrence.Recur(ctx, tx, h.TaskService, updated, time.Now())
+}
+
 func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
 	taskId, _ := h.GetIDFromRequest(r, "id")
-	userId := h.GetUserFromContext(r.Context()).ID
-	task, err := h.TaskService.Get(taskId, userId)
+	user := h.GetUserFromContext(r.Context())
+	userId := user.ID
+	// the row is swapped in when the task is updated
+	if h.IsHTMXRequest(r) {
+		task, err := h.TaskService.Get(r.Context(), taskId, userId)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		err = h.Render(w, r, template.TaskRow(task))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	// otherwise render the whole page, which task references link to,
+	// and which users the project is shared with can see too
+	task, err := h.TaskService.GetVisible(r.Context(), taskId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	attachments, err := h.AttachmentService.GetAllByTaskID(r.Context(), task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	entries, err := h.TaskService.GetTimeEntriesByTaskID(r.Context(), task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	archived, err := h.ProjectService.IsArchived(r.Context(), task.ProjectID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	pullRequests, err := h.GitHubService.GetPullRequestsByTaskID(r.Context(), task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	commits, err := h.GitHubService.GetCommitsByTaskID(r.Context(), task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.Task(task, attachments, timetrack.NewEntries(entries, time.Now().In(user.Location())), pullRequests, commits, userId, archived)
+	err = h.Render(w, r, component)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteTask deletes a task the user owns along with its attachments, whose
+// files are removed from storage once the task is gone.
+func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, _ := h.GetIDFromRequest(r, "id")
+	task, err := h.TaskService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
 		return
 	}
-	component := template.TaskRow(task)
-	err = component.Render(r.Context(), w)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
 		return
 	}
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	attachments, err := h.TaskService.DeleteWithTx(r.Context(), tx, id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.enqueueWebhookWithTx(r.Context(), tx, task.ProjectID, webhook.EventTaskDeleted, webhook.NewTask(task))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	for _, a := range attachments {
+		h.deleteFiles(r.Context(), a.Keys()...)
+	}
+	h.Redirect(w, "/tasks")
 }
@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/timetrack"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// timeChangedEvent is triggered whenever a timer starts or stops, or an
+// entry is deleted, so that the timer indicator and the time of the task
+// page refresh themselves.
+const timeChangedEvent = "time-changed"
+
+// GetTimer renders the indicator of the running timer of the user, which
+// the dashboard layout loads on every page.
+func (h *Handler) GetTimer(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	var running *timetrack.Entry
+	row, err := h.TaskService.GetRunningTimer(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		entry := timetrack.NewEntries([]database.TimeEntryRow{row}, time.Now().In(user.Location()))[0]
+		running = &entry
+	}
+	err = h.Render(w, r, template.TimerIndicator(running))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// StartTimer starts a timer on a task the user can see, stopping the timer
+// that was running before, since each user has at most one.
+func (h *Handler) StartTimer(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	task, ok := h.getVisibleTask(w, r)
+	if !ok {
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
+		return
+	}
+	_, err := h.TaskService.StartTimer(r.Context(), task.ID, user.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// another request started a timer at the same time
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			h.Error(w, r, err, http.StatusConflict)
+			return
+		}
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.TriggerEvent(w, timeChangedEvent)
+	h.Reswap(w, "none")
+	err = h.Render(w, r, successToastComponent("Timer started"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// StopTimer stops the running timer of the user.
+func (h *Handler) StopTimer(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	entry, err := h.TaskService.StopTimer(r.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.TriggerEvent(w, timeChangedEvent)
+	h.Reswap(w, "none")
+	message := fmt.Sprintf("Timer stopped at %s", timetrack.FormatDuration(entry.Duration(time.Now())))
+	err = h.Render(w, r, successToastComponent(message))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetTaskTime renders the time entries of a task the user can see, with
+// their total.
+func (h *Handler) GetTaskTime(w http.ResponseWriter, r *http.Request) {
+	task, ok := h.getVisibleTask(w, r)
+	if !ok {
+		return
+	}
+	h.renderTaskTime(w, r, task, validator.NewValidatedSlice())
+}
+
+type CreateTimeEntryForm struct {
+	Date     string `form:"date"`
+	Duration string `form:"duration"`
+	Note     string `form:"note"`
+}
+
+func (data CreateTimeEntryForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Date, validation.Required, validation.Date(time.DateOnly)),
+		validation.Field(&data.Duration, validation.Required, validation.By(func(value interface{}) error {
+			_, err := timetrack.ParseDuration(value.(string))
+			return err
+		})),
+		validation.Field(&data.Note, validation.Length(0, 1000)),
+	)
+}
+
+// CreateTimeEntry adds a manual time entry to a task the user can see, on
+// the given date.
+func (h *Handler) CreateTimeEntry(w http.ResponseWriter, r *http.Request) {
+	var data CreateTimeEntryForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	task, found := h.getVisibleTask(w, r)
+	if !found {
+		return
+	}
+	if !h.ensureActiveProject(w, r, task.ProjectID) {
+		return
+	}
+	if !ok {
+		h.renderTaskTime(w, r, task, errors)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	// the entry starts at midnight in the time zone of the user
+	date, _ := time.ParseInLocation(time.DateOnly, data.Date, user.Location())
+	duration, _ := timetrack.ParseDuration(data.Duration)
+	_, err = h.TaskService.CreateTimeEntry(r.Context(), task.ID, user.ID, date, date.Add(duration), data.Note)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderTaskTime(w, r, task, validator.NewValidatedSlice())
+}
+
+// DeleteTimeEntry deletes a time entry of the user.
+func (h *Handler) DeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	_, err = h.TaskService.DeleteTimeEntry(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.TriggerEvent(w, timeChangedEvent)
+	h.Reswap(w, "none")
+	err = h.Render(w, r, successToastComponent("Time entry deleted successfully"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) renderTaskTime(w http.ResponseWriter, r *http.Request, task database.Task, errors validator.ValidatedSlice) {
+	user := h.GetUserFromContext(r.Context())
+	rows, err := h.TaskService.GetTimeEntriesByTaskID(r.Context(), task.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	archived, err := h.ProjectService.IsArchived(r.Context(), task.ProjectID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.TaskTime(task, timetrack.NewEntries(rows, time.Now().In(user.Location())), user.ID, archived, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getVisibleTask returns the task with the id in the url, and false after
+// replying with an error if the user can't see it.
+func (h *Handler) getVisibleTask(w http.ResponseWriter, r *http.Request) (database.Task, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Task{}, false
+	}
+	task, err := h.TaskService.GetVisible(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Task{}, false
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.Task{}, false
+	}
+	return task, true
+}
+
+// timeRange returns the dates of the "from" and "to" url queries, which
+// default to the current month, and an error if either isn't a date or the
+// range is reversed.
+//
+// Dates are at midnight in the location of the given time.
+func (h *Handler) timeRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 1, -1)
+	var err error
+	if q := h.GetURLQuery(r, "from"); !q.IsEmpty {
+		from, err = time.ParseInLocation(time.DateOnly, q.Value, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if q := h.GetURLQuery(r, "to"); !q.IsEmpty {
+		to, err = time.ParseInLocation(time.DateOnly, q.Value, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range from %s to %s is reversed", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	}
+	return from, to, nil
+}
+
+// getTimeEntries returns the entries the user can report on within the
+// range of the url queries, including both dates.
+func (h *Handler) getTimeEntries(r *http.Request) (time.Time, time.Time, []timetrack.Entry, error) {
+	user := h.GetUserFromContext(r.Context())
+	now := time.Now().In(user.Location())
+	from, to, err := h.timeRange(r, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, err
+	}
+	rows, err := h.TaskService.GetTimeEntries(r.Context(), user.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, err
+	}
+	return from, to, timetrack.NewEntries(rows, now), nil
+}
+
+// TimeReport renders the totals per task, project and member of the time
+// entries within a date range.
+func (h *Handler) TimeReport(w http.ResponseWriter, r *http.Request) {
+	from, to, entries, err := h.getTimeEntries(r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	component := template.TimeReport(from, to, entries)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ExportTime writes the time entries within a date range as CSV, or their
+// totals when the url query "group" is "task", "project" or "member".
+func (h *Handler) ExportTime(w http.ResponseWriter, r *http.Request) {
+	from, to, entries, err := h.getTimeEntries(r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	// write to a buffer first, so that an error can still be reported
+	var buf bytes.Buffer
+	group := h.GetURLQuery(r, "group")
+	switch group.Value {
+	case "", "entries":
+		err = timetrack.WriteEntriesCSV(&buf, entries)
+	case "task":
+		err = timetrack.WriteTotalsCSV(&buf, "task", timetrack.ByTask(entries))
+	case "project":
+		err = timetrack.WriteTotalsCSV(&buf, "project", timetrack.ByProject(entries))
+	case "member":
+		err = timetrack.WriteTotalsCSV(&buf, "member", timetrack.ByMember(entries))
+	default:
+		h.Error(w, r, fmt.Errorf("unknown time export group %q", group.Value), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	name := group.Value
+	if name == "" {
+		name = "entries"
+	}
+	filename := fmt.Sprintf("projectmotor-time-%s-%s-%s.csv", name, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(buf.Bytes())
+}
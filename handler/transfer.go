@@ -0,0 +1,413 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/transfer"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+func (h *Handler) ExportProject(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	project, err := h.ProjectService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	tasks, err := h.TaskService.GetAllByProjectID(r.Context(), user.ID, project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	users, err := h.UserService.GetSharedUsers(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	export := transfer.NewProject(project, tasks, users)
+	// write to a buffer first, so that an error can still be reported
+	var buf bytes.Buffer
+	format := h.GetURLQuery(r, "format")
+	switch format.Value {
+	case "", "json":
+		err = transfer.WriteJSON(&buf, export)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, transfer.Filename(export, "json")))
+	case "csv":
+		err = transfer.WriteCSV(&buf, export)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, transfer.Filename(export, "csv")))
+	default:
+		h.Error(w, r, fmt.Errorf("unknown export format %q", format.Value), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+func (h *Handler) ImportProject(w http.ResponseWriter, r *http.Request) {
+	component := template.ProjectImport()
+	err := h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// UploadProjectImport reads the uploaded file, and renders the column mapping
+// step for CSV files or the preview step for JSON files.
+func (h *Handler) UploadProjectImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, transfer.MaxSize+(64<<10))
+	err := r.ParseMultipartForm(transfer.MaxSize)
+	if err != nil {
+		h.renderUploadError(w, r, "The file must be smaller than 1 MB.")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.renderUploadError(w, r, "Please choose a CSV or JSON file.")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	data := ImportProjectForm{
+		Format:  "csv",
+		Content: string(content),
+	}
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if ext == ".json" || bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		data.Format = "json"
+		project, err := transfer.ReadJSON(strings.NewReader(data.Content))
+		if err != nil {
+			h.renderUploadError(w, r, fmt.Sprintf("The JSON file couldn't be read: %s.", err))
+			return
+		}
+		data.Title = project.Title
+		h.renderImportPreview(w, r, data, validator.NewValidatedSlice())
+		return
+	}
+	columns, _, err := transfer.ReadCSV(strings.NewReader(data.Content))
+	if err != nil {
+		h.renderUploadError(w, r, fmt.Sprintf("The CSV file couldn't be read: %s.", err))
+		return
+	}
+	mapping := transfer.GuessMapping(columns)
+	data.Title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	data.TitleColumn = columnValue(mapping.Title)
+	data.DescriptionColumn = columnValue(mapping.Description)
+	data.StatusColumn = columnValue(mapping.Status)
+	data.DueDateColumn = columnValue(mapping.DueDate)
+	component := template.ProjectImportMapping(data.State(), columns, validator.NewValidatedSlice())
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type ImportProjectForm struct {
+	Format            string `form:"format"`
+	Content           string `form:"content"`
+	Title             string `form:"title"`
+	TitleColumn       string `form:"title_column"`
+	DescriptionColumn string `form:"description_column"`
+	StatusColumn      string `form:"status_column"`
+	DueDateColumn     string `form:"due_date_column"`
+}
+
+func (data ImportProjectForm) Validate() error {
+	// JSON files have no columns to map
+	titleColumnRules := []validation.Rule{is.Digit}
+	if data.Format == "csv" {
+		titleColumnRules = append([]validation.Rule{validation.Required}, titleColumnRules...)
+	}
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Format, validation.Required, validation.In("csv", "json")),
+		validation.Field(&data.Content, validation.Required, validation.Length(1, transfer.MaxSize)),
+		validation.Field(&data.Title, validation.Required, validation.Length(1, 255)),
+		validation.Field(&data.TitleColumn, titleColumnRules...),
+		validation.Field(&data.DescriptionColumn, is.Digit),
+		validation.Field(&data.StatusColumn, is.Digit),
+		validation.Field(&data.DueDateColumn, is.Digit),
+	)
+}
+
+// State returns the template.ProjectImportState carried between the steps.
+func (data ImportProjectForm) State() template.ProjectImportState {
+	return template.ProjectImportState{
+		Format:            data.Format,
+		Content:           data.Content,
+		Title:             data.Title,
+		TitleColumn:       data.TitleColumn,
+		DescriptionColumn: data.DescriptionColumn,
+		StatusColumn:      data.StatusColumn,
+		DueDateColumn:     data.DueDateColumn,
+	}
+}
+
+// PreviewProjectImport validates the column mapping, and renders every row
+// of the file with the errors that would prevent importing it.
+func (h *Handler) PreviewProjectImport(w http.ResponseWriter, r *http.Request) {
+	var data ImportProjectForm
+	_, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.renderImportPreview(w, r, data, errors)
+}
+
+// CommitProjectImport creates the project, its tasks and shares inside a
+// single transaction, as long as every row of the file is valid.
+func (h *Handler) CommitProjectImport(w http.ResponseWriter, r *http.Request) {
+	var data ImportProjectForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.renderImportPreview(w, r, data, errors)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	preview, err := h.buildImportPreview(r.Context(), data, user)
+	if err != nil {
+		h.renderUploadError(w, r, fmt.Sprintf("The file couldn't be read: %s.", err))
+		return
+	}
+	if !preview.Valid() {
+		h.renderImportPreview(w, r, data, errors)
+		return
+	}
+	// Begin transaction
+	tx, err := h.BeginTx(r.Context())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	project, err := h.ProjectService.CreateWithTx(
+		r.Context(),
+		tx,
+		data.Title,
+		preview.Project.Description,
+		preview.Project.Published,
+		user.ID,
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	projectID := pgtype.Int4{Int32: project.ID, Valid: true}
+	for _, row := range preview.Rows {
+		dueDate, err := database.DateFromString(row.Task.DueDate)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		err = h.TaskService.ImportWithTx(
+			r.Context(),
+			tx,
+			row.Task.Title,
+			row.Task.Description,
+			database.TaskStatus(row.Task.Status),
+			dueDate,
+			projectID,
+			user.ID,
+		)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, share := range preview.Shares {
+		if !share.Found {
+			continue
+		}
+		_, err = h.ProjectService.ShareWithTx(r.Context(), tx, project.ID, share.UserID)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, fmt.Sprintf("/projects/%d/edit", project.ID))
+}
+
+func (h *Handler) renderUploadError(w http.ResponseWriter, r *http.Request, message string) {
+	component := template.ProjectImportUploadForm(message)
+	err := h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderImportPreview renders the mapping step again if the given errors
+// aren't empty, and the preview step otherwise.
+func (h *Handler) renderImportPreview(
+	w http.ResponseWriter,
+	r *http.Request,
+	data ImportProjectForm,
+	errors validator.ValidatedSlice,
+) {
+	var component templ.Component
+	if len(errors) != 0 {
+		if data.Format != "csv" {
+			h.renderUploadError(w, r, "The import couldn't be read, please upload the file again.")
+			return
+		}
+		columns, _, err := transfer.ReadCSV(strings.NewReader(data.Content))
+		if err != nil {
+			h.renderUploadError(w, r, fmt.Sprintf("The CSV file couldn't be read: %s.", err))
+			return
+		}
+		component = template.ProjectImportMapping(data.State(), columns, errors)
+	} else {
+		user := h.GetUserFromContext(r.Context())
+		preview, err := h.buildImportPreview(r.Context(), data, user)
+		if err != nil {
+			h.renderUploadError(w, r, fmt.Sprintf("The file couldn't be read: %s.", err))
+			return
+		}
+		component = template.ProjectImportPreview(data.State(), preview)
+	}
+	err := h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// buildImportPreview returns the template.ProjectImportPreviewData for the
+// given form, validating every task with the rules of CreateTaskForm and
+// looking up the users the project should be shared with.
+func (h *Handler) buildImportPreview(
+	ctx context.Context,
+	data ImportProjectForm,
+	user database.User,
+) (template.ProjectImportPreviewData, error) {
+	var project transfer.Project
+	switch data.Format {
+	case "json":
+		p, err := transfer.ReadJSON(strings.NewReader(data.Content))
+		if err != nil {
+			return template.ProjectImportPreviewData{}, err
+		}
+		project = p
+	case "csv":
+		_, records, err := transfer.ReadCSV(strings.NewReader(data.Content))
+		if err != nil {
+			return template.ProjectImportPreviewData{}, err
+		}
+		mapping := transfer.Mapping{
+			Title:       columnIndex(data.TitleColumn),
+			Description: columnIndex(data.DescriptionColumn),
+			Status:      columnIndex(data.StatusColumn),
+			DueDate:     columnIndex(data.DueDateColumn),
+		}
+		project.Tasks = mapping.Tasks(records)
+	}
+	project.Title = data.Title
+	preview := template.ProjectImportPreviewData{
+		Project: project,
+	}
+	for i, task := range project.Tasks {
+		preview.Rows = append(preview.Rows, template.ProjectImportRow{
+			Number: i + 1,
+			Task:   task,
+			Errors: validateImportedTask(task),
+		})
+	}
+	for _, email := range project.SharedWith {
+		share := template.ProjectImportShare{Email: email}
+		if email != user.Email {
+			u, err := h.UserService.GetUserByEmail(ctx, email)
+			if err == nil {
+				share.UserID = u.ID
+				share.Found = true
+			}
+		}
+		preview.Shares = append(preview.Shares, share)
+	}
+	return preview, nil
+}
+
+// validateImportedTask returns the errors of the given task, using the same
+// rules as CreateTaskForm and also checking its status.
+func validateImportedTask(task transfer.Task) []string {
+	messages := []string{}
+	data := CreateTaskForm{
+		Title:       task.Title,
+		Description: task.Description,
+		DueDate:     task.DueDate,
+	}
+	err := data.Validate()
+	if errors, ok := err.(validation.Errors); ok {
+		keys := make([]string, 0, len(errors))
+		for key := range errors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			messages = append(messages, fmt.Sprintf("%s %s", key, errors[key].Error()))
+		}
+	}
+	if !transfer.ValidStatus(task.Status) {
+		messages = append(messages, fmt.Sprintf("Status %q is unknown", task.Status))
+	}
+	return messages
+}
+
+func columnValue(i int) string {
+	if i < 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+func columnIndex(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return i
+}
@@ -1,33 +1,126 @@
 package handler
 
 import (
+	"database/sql"
 	"errors"
 	"net/http"
 
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/webdevfuel/projectmotor/auth"
 	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
 )
 
 func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
 	user := h.GetUserFromContext(r.Context())
-	sessions, err := h.SessionService.GetAllSessions(user.ID)
+	sessions, err := h.SessionService.GetAllSessions(r.Context(), user.ID)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	sess, err := h.GetSessionStore(r)
 	if err != nil {
-		h.Error(w, err, http.StatusInternalServerError)
+		h.Error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	tok, ok := sess.Values["token"].(string)
 	if !ok {
 		h.Error(
 			w,
+			r,
 			errors.New("token must be present in session values"),
 			http.StatusInternalServerError,
 		)
 		return
 	}
-	component := template.Profile(sessions, tok)
-	component.Render(r.Context(), w)
+	user, err = h.ensureCalendarToken(r, user)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	tokens, err := h.APITokenService.GetAll(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	exports, err := h.DataExportService.GetAll(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	projects, err := h.ProjectService.GetAllDeletedWithUser(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.Profile(user, sessions, tok, h.CalendarURL(user), tokens, exports, projects)
+	h.Render(w, r, component)
+}
+
+type CreateAPITokenForm struct {
+	Name string `form:"name"`
+}
+
+func (data CreateAPITokenForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Name, validation.Required, validation.Length(1, 100)),
+	)
+}
+
+// CreateAPIToken creates an API token for the user, and renders their
+// tokens again along with the new one, which is only ever shown then.
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var data CreateAPITokenForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	var token string
+	if ok {
+		token, err = auth.GenerateAPIToken()
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		_, err = h.APITokenService.Create(r.Context(), user.ID, data.Name, auth.HashAPIToken(token))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		errors = validator.NewValidatedSlice()
+	}
+	tokens, err := h.APITokenService.GetAll(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProfileAPITokens(tokens, token, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteAPIToken deletes an API token of the user, which stops
+// authenticating requests right away.
+func (h *Handler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	err = h.APITokenService.Delete(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 }
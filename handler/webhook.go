@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/validator"
+	"github.com/webdevfuel/projectmotor/webhook"
+)
+
+// deliveriesLimit is the number of latest deliveries shown in the delivery
+// log of a project.
+const deliveriesLimit = 25
+
+// webhookDeliveriesChangedEvent refreshes the delivery log when a delivery
+// is queued again.
+const webhookDeliveriesChangedEvent = "webhook-deliveries-changed"
+
+// ProjectWebhooks renders the webhooks tab of a project the user owns, with
+// the log of its latest deliveries.
+func (h *Handler) ProjectWebhooks(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	webhooks, err := h.WebhookService.GetAllByProjectID(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := h.WebhookService.GetDeliveriesByProjectID(r.Context(), project.ID, deliveriesLimit)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectWebhooks(project, webhooks, deliveries)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ProjectWebhookDeliveries renders the delivery log of a project the user
+// owns.
+func (h *Handler) ProjectWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.getOwnedProject(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := h.WebhookService.GetDeliveriesByProjectID(r.Context(), project.ID, deliveriesLimit)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectWebhookDeliveries(project.ID, deliveries)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type CreateWebhookForm struct {
+	URL string `form:"url"`
+	// Secret is generated when empty.
+	Secret string   `form:"secret"`
+	Events []string `form:"events"`
+}
+
+var webhookURLPattern = regexp.MustCompile(`^https?://`)
+
+func (data CreateWebhookForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.URL, validation.Required, is.URL, validation.Match(webhookURLPattern).Error("must be an http or https url")),
+		validation.Field(&data.Secret, validation.Length(16, 255)),
+		validation.Field(&data.Events, validation.Required.Error("must have at least one event"), validation.By(webhookEvents)),
+	)
+}
+
+// webhookEvents checks that a slice of strings only has event types webhooks
+// can subscribe to.
+func webhookEvents(value interface{}) error {
+	events, _ := value.([]string)
+	for _, event := range events {
+		if !slices.Contains(webhook.Events, event) {
+			return fmt.Errorf("%q isn't an event", event)
+		}
+	}
+	return nil
+}
+
+// CreateWebhook subscribes a url to events of a project the user owns, and
+// renders the webhooks of the project again.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var data CreateWebhookForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	project, found := h.getOwnedProject(w, r)
+	if !found {
+		return
+	}
+	if project.Archived() {
+		h.projectArchivedError(w, r)
+		return
+	}
+	if ok {
+		reason := h.webhookURLError(r.Context(), data.URL)
+		if reason != "" {
+			ok = false
+			errors = validator.ValidatedSlice{
+				{Key: "URL", Value: data.URL, Error: reason},
+				{Key: "Secret", Value: data.Secret},
+				{Key: "Events", Value: strings.Join(data.Events, ",")},
+			}
+		}
+	}
+	if ok {
+		secret := data.Secret
+		if secret == "" {
+			secret, err = webhook.GenerateSecret()
+			if err != nil {
+				h.Error(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+		_, err = h.WebhookService.Create(r.Context(), project.ID, data.URL, secret, data.Events)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		errors = validator.NewValidatedSlice()
+	}
+	webhooks, err := h.WebhookService.GetAllByProjectID(r.Context(), project.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	component := template.ProjectWebhookList(project, webhooks, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// webhookURLError returns the reason webhooks can't be subscribed to the
+// given url, which is empty if they can. Urls must resolve to public
+// addresses, unless AllowPrivateWebhooks.
+func (h *Handler) webhookURLError(ctx context.Context, url string) string {
+	if h.AllowPrivateWebhooks {
+		return ""
+	}
+	err := webhook.CheckURL(ctx, url)
+	if errors.Is(err, webhook.ErrPrivateAddress) {
+		return "must not resolve to a private address"
+	}
+	if err != nil {
+		return "must have a host that resolves"
+	}
+	return ""
+}
+
+// DeleteWebhook deletes a webhook of a project the user owns, along with its
+// deliveries.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	err = h.WebhookService.Delete(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.TriggerEvent(w, webhookDeliveriesChangedEvent)
+	err = h.Render(w, r, successToastComponent("Webhook deleted successfully"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// RedeliverWebhook queues a copy of a delivery of a webhook of a project the
+// user owns, to be sent again right away.
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	_, err = h.WebhookService.Redeliver(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.TriggerEvent(w, webhookDeliveriesChangedEvent)
+	h.Reswap(w, "none")
+	err = h.Render(w, r, successToastComponent("Delivery queued again"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// enqueueWebhookWithTx queues deliveries of the given event for the webhooks
+// of the given project inside the given transaction, which should be the one
+// the change the event describes is made in, so that deliveries are queued
+// if and only if the change is committed.
+func (h *Handler) enqueueWebhookWithTx(ctx context.Context, tx *sqlx.Tx, projectID pgtype.Int4, event string, data any) error {
+	if !projectID.Valid {
+		return nil
+	}
+	payload, err := webhook.Marshal(event, data, time.Now())
+	if err != nil {
+		return err
+	}
+	return h.WebhookService.EnqueueWithTx(ctx, tx, projectID.Int32, event, payload)
+}
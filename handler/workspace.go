@@ -0,0 +1,505 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/template"
+	"github.com/webdevfuel/projectmotor/util"
+	"github.com/webdevfuel/projectmotor/validator"
+)
+
+// WorkspaceSwitcher renders the workspaces of the user, with the active one
+// selected, which the dashboard layout loads on every page.
+func (h *Handler) WorkspaceSwitcher(w http.ResponseWriter, r *http.Request) {
+	user := h.GetUserFromContext(r.Context())
+	organizations, err := h.OrganizationService.GetAll(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	active, err := h.OrganizationService.GetActive(r.Context(), user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.Render(w, r, template.WorkspaceSwitcher(organizations, active))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type SwitchWorkspaceForm struct {
+	ID string `form:"id"`
+}
+
+func (data SwitchWorkspaceForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.ID, validation.Required, is.Digit),
+	)
+}
+
+// SwitchWorkspace makes a workspace the user is a member of their active
+// one, and redirects to its projects.
+func (h *Handler) SwitchWorkspace(w http.ResponseWriter, r *http.Request) {
+	var data SwitchWorkspaceForm
+	ok, _, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.Error(w, r, errors.New("invalid workspace id"), http.StatusNotFound)
+		return
+	}
+	id, err := util.Atoi32(data.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	_, err = h.OrganizationService.Switch(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, "/projects")
+}
+
+// NewWorkspace renders the page to create a workspace.
+func (h *Handler) NewWorkspace(w http.ResponseWriter, r *http.Request) {
+	err := h.Render(w, r, template.WorkspaceNew())
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type CreateWorkspaceForm struct {
+	Name string `form:"name"`
+}
+
+func (data CreateWorkspaceForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Name, validation.Required, validation.Length(1, 100)),
+	)
+}
+
+// CreateWorkspace creates a workspace owned by the user, switches them to
+// it, and redirects to its projects.
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var data CreateWorkspaceForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		err = h.Render(w, r, template.WorkspaceNewForm(errors))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	_, err = h.OrganizationService.Create(r.Context(), data.Name, user.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, "/projects")
+}
+
+// Workspace renders the settings and members of a workspace the user is a
+// member of. Personal workspaces don't have any.
+func (h *Handler) Workspace(w http.ResponseWriter, r *http.Request) {
+	organization, found := h.getWorkspace(w, r)
+	if !found {
+		return
+	}
+	members, err := h.OrganizationService.GetMembers(r.Context(), organization.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	component := template.Workspace(organization, members, user.ID)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+type UpdateWorkspaceForm struct {
+	Name          string `form:"name"`
+	DefaultAccess string `form:"default_access"`
+}
+
+func (data UpdateWorkspaceForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&data.DefaultAccess, validation.Required, validation.In(
+			string(database.OrganizationAccessNone),
+			string(database.OrganizationAccessView),
+			string(database.OrganizationAccessEdit),
+		)),
+	)
+}
+
+// UpdateWorkspace changes the name and default access of a workspace the
+// user manages, and renders its settings form again.
+func (h *Handler) UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var data UpdateWorkspaceForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	organization, found := h.getManagedWorkspace(w, r)
+	if !found {
+		return
+	}
+	if !ok {
+		err = h.Render(w, r, template.WorkspaceForm(organization, errors))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	organization.Name = data.Name
+	organization.DefaultAccess = database.OrganizationAccess(data.DefaultAccess)
+	err = h.OrganizationService.Update(r.Context(), organization.ID, organization.Name, organization.DefaultAccess)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.WorkspaceForm(organization, validator.NewValidatedSlice()),
+		successToastComponent("Workspace updated"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteWorkspace deletes a workspace the user owns along with its
+// projects, and redirects to the projects of the workspace they're
+// switched back to.
+func (h *Handler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	organization, found := h.getWorkspace(w, r)
+	if !found {
+		return
+	}
+	if organization.Role != database.OrganizationRoleOwner {
+		h.Error(w, r, errors.New("only owners can delete a workspace"), http.StatusForbidden)
+		return
+	}
+	err := h.OrganizationService.Delete(r.Context(), organization.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	h.Redirect(w, "/projects")
+}
+
+type AddWorkspaceMemberForm struct {
+	Email string `form:"email"`
+	Role  string `form:"role"`
+}
+
+func (data AddWorkspaceMemberForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Email, validation.Required, is.Email),
+		validation.Field(&data.Role, validation.Required, workspaceRoleRule),
+	)
+}
+
+// workspaceRoleRule checks that a form value is one of the roles of the
+// members of a workspace.
+var workspaceRoleRule = validation.In(
+	string(database.OrganizationRoleOwner),
+	string(database.OrganizationRoleAdmin),
+	string(database.OrganizationRoleMember),
+)
+
+// AddWorkspaceMember adds the user with the given email address to a
+// workspace the user manages, and renders its members again. Only owners
+// can add other owners.
+func (h *Handler) AddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	var data AddWorkspaceMemberForm
+	ok, errors, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	organization, found := h.getManagedWorkspace(w, r)
+	if !found {
+		return
+	}
+	role := database.OrganizationRole(data.Role)
+	if ok && role == database.OrganizationRoleOwner && organization.Role != database.OrganizationRoleOwner {
+		ok = false
+		errors = validator.ValidatedSlice{
+			{Key: "Email", Value: data.Email},
+			{Key: "Role", Value: data.Role, Error: "only owners can add owners"},
+		}
+	}
+	if ok {
+		reason, err := h.addWorkspaceMember(r, organization, data.Email, role)
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if reason == "" {
+			errors = validator.NewValidatedSlice()
+		} else {
+			errors = validator.ValidatedSlice{
+				{Key: "Email", Value: data.Email, Error: reason},
+				{Key: "Role", Value: data.Role},
+			}
+		}
+	}
+	members, err := h.OrganizationService.GetMembers(r.Context(), organization.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	component := template.WorkspaceMembers(organization, members, user.ID, errors)
+	err = h.Render(w, r, component)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// addWorkspaceMember adds the user with the given email address to the
+// given workspace, and returns the reason they couldn't be added, which is
+// empty if they were.
+func (h *Handler) addWorkspaceMember(
+	r *http.Request,
+	organization database.Organization,
+	email string,
+	role database.OrganizationRole,
+) (string, error) {
+	user, err := h.UserService.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "doesn't belong to a ProjectMotor account", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Suspended() {
+		return "belongs to a suspended account", nil
+	}
+	exists, err := h.OrganizationService.AddMember(r.Context(), organization.ID, user.ID, role)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "belongs to a member of the workspace", nil
+	}
+	return "", nil
+}
+
+type SetWorkspaceMemberRoleForm struct {
+	Role string `form:"role"`
+}
+
+func (data SetWorkspaceMemberRoleForm) Validate() error {
+	return validation.ValidateStruct(&data,
+		validation.Field(&data.Role, validation.Required, workspaceRoleRule),
+	)
+}
+
+// SetWorkspaceMemberRole changes the role of a member of a workspace the
+// user manages, and renders the member again. Admins can't change the role
+// of owners, nor make anyone an owner.
+func (h *Handler) SetWorkspaceMemberRole(w http.ResponseWriter, r *http.Request) {
+	var data SetWorkspaceMemberRoleForm
+	ok, _, err := validator.Validate(&data, r)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.Error(w, r, errors.New("invalid role"), http.StatusUnprocessableEntity)
+		return
+	}
+	organization, member, found := h.getWorkspaceMember(w, r)
+	if !found {
+		return
+	}
+	role := database.OrganizationRole(data.Role)
+	if organization.Role != database.OrganizationRoleOwner &&
+		(member.Role == database.OrganizationRoleOwner || role == database.OrganizationRoleOwner) {
+		h.Error(w, r, errors.New("only owners can change the role of owners"), http.StatusForbidden)
+		return
+	}
+	member, err = h.OrganizationService.SetRole(r.Context(), organization.ID, member.UserID, role)
+	if errors.Is(err, database.ErrLastOwner) {
+		h.Reswap(w, "none")
+		err = h.RenderComponents(w, r, http.StatusConflict, errorToastComponent("A workspace needs at least one owner."))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	err = h.RenderComponents(
+		w,
+		r,
+		http.StatusOK,
+		template.WorkspaceMember(organization, member, user.ID),
+		successToastComponent("Role changed"),
+	)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// RemoveWorkspaceMember removes a member from a workspace the user
+// manages, or the user themselves from any workspace they're a member of.
+// Admins can't remove owners. Users leaving a workspace are redirected to
+// the projects of their personal one.
+func (h *Handler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	organization, member, found := h.getWorkspaceMember(w, r)
+	if !found {
+		return
+	}
+	user := h.GetUserFromContext(r.Context())
+	leaving := member.UserID == user.ID
+	if !leaving && (!organization.CanManage() ||
+		(organization.Role != database.OrganizationRoleOwner && member.Role == database.OrganizationRoleOwner)) {
+		h.Error(w, r, errors.New("user can't remove the member"), http.StatusForbidden)
+		return
+	}
+	err := h.OrganizationService.RemoveMember(r.Context(), organization.ID, member.UserID)
+	if errors.Is(err, database.ErrLastOwner) {
+		h.Reswap(w, "none")
+		err = h.RenderComponents(w, r, http.StatusConflict, errorToastComponent("A workspace needs at least one owner."))
+		if err != nil {
+			h.Error(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if leaving {
+		h.Redirect(w, "/projects")
+		return
+	}
+	err = h.Render(w, r, successToastComponent("Member removed"))
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// inSharedWorkspace reports whether the active workspace of the given user
+// isn't their personal one, where tasks can't be created without a project
+// since nobody else would see them.
+func (h *Handler) inSharedWorkspace(ctx context.Context, userID int32) (bool, error) {
+	organization, err := h.OrganizationService.GetActive(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return !organization.Personal(), nil
+}
+
+// sharedWorkspaceProjectMessage tells users that tasks of shared workspaces
+// need a project.
+const sharedWorkspaceProjectMessage = "is required in a shared workspace"
+
+// getWorkspace returns the workspace with the id in the url, and false
+// after replying with an error if the user isn't a member of it or it's
+// their personal one.
+func (h *Handler) getWorkspace(w http.ResponseWriter, r *http.Request) (database.Organization, bool) {
+	user := h.GetUserFromContext(r.Context())
+	id, err := h.GetIDFromRequest(r, "id")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Organization{}, false
+	}
+	organization, err := h.OrganizationService.Get(r.Context(), id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Organization{}, false
+	}
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.Organization{}, false
+	}
+	if organization.Personal() {
+		h.Error(w, r, errors.New("personal workspaces have no settings"), http.StatusNotFound)
+		return database.Organization{}, false
+	}
+	return organization, true
+}
+
+// getManagedWorkspace returns the workspace with the id in the url, and
+// false after replying with an error if the user can't manage it.
+func (h *Handler) getManagedWorkspace(w http.ResponseWriter, r *http.Request) (database.Organization, bool) {
+	organization, found := h.getWorkspace(w, r)
+	if !found {
+		return database.Organization{}, false
+	}
+	if !organization.CanManage() {
+		h.Error(w, r, errors.New("user can't manage the workspace"), http.StatusForbidden)
+		return database.Organization{}, false
+	}
+	return organization, true
+}
+
+// getWorkspaceMember returns the workspace with the id in the url and its
+// member with the user id in the url, and false after replying with an
+// error if the user isn't a member of the workspace, or the other user
+// isn't either.
+func (h *Handler) getWorkspaceMember(w http.ResponseWriter, r *http.Request) (database.Organization, database.OrganizationMember, bool) {
+	organization, found := h.getWorkspace(w, r)
+	if !found {
+		return database.Organization{}, database.OrganizationMember{}, false
+	}
+	userID, err := h.GetIDFromRequest(r, "userId")
+	if err != nil {
+		h.Error(w, r, err, http.StatusNotFound)
+		return database.Organization{}, database.OrganizationMember{}, false
+	}
+	members, err := h.OrganizationService.GetMembers(r.Context(), organization.ID)
+	if err != nil {
+		h.Error(w, r, err, http.StatusInternalServerError)
+		return database.Organization{}, database.OrganizationMember{}, false
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return organization, member, true
+		}
+	}
+	h.Error(w, r, fmt.Errorf("user %d isn't a member of the workspace", userID), http.StatusNotFound)
+	return database.Organization{}, database.OrganizationMember{}, false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestHealth(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	err := test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("healthz returns ok without authentication", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "healthz")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("ok", body)
+	})
+
+	t.Run("readyz returns ok when schema is current", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "readyz")),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("ok", body)
+	})
+
+	t.Run("readyz returns service unavailable when schema is behind", func(t *testing.T) {
+		_, err := handler.DB.Exec("update schema_migrations set version = version - 1")
+		if err != nil {
+			t.Errorf("error updating schema version %s", err)
+			return
+		}
+		defer handler.DB.Exec("update schema_migrations set version = version + 1")
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "readyz")),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(503, res.StatusCode)
+	})
+}
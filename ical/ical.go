@@ -0,0 +1,165 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Component is the kind of calendar component written for each entry.
+type Component int
+
+const (
+	// ComponentEvent writes entries as all-day VEVENT components, which are
+	// shown by every calendar application.
+	ComponentEvent Component = iota
+	// ComponentTodo writes entries as VTODO components, which are shown by
+	// applications with reminders or task lists.
+	ComponentTodo
+)
+
+// ContentType is the media type of an iCalendar feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+// Statuses of a VTODO component.
+const (
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusInProcess   = "IN-PROCESS"
+	StatusCompleted   = "COMPLETED"
+)
+
+// A Calendar is a named list of entries, written as a VCALENDAR object.
+type Calendar struct {
+	Name      string
+	Component Component
+	Entries   []Entry
+}
+
+// An Entry is a thing due on a date.
+type Entry struct {
+	// UID uniquely identifies the entry across feeds and updates.
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Due         time.Time
+	// Status is only written for VTODO components.
+	Status   string
+	Created  time.Time
+	Modified time.Time
+}
+
+// Write writes the given calendar to the given writer in the iCalendar
+// format, as described by RFC 5545.
+func Write(w io.Writer, c Calendar) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", "-//ProjectMotor//ProjectMotor//EN")
+	lw.line("CALSCALE", "GREGORIAN")
+	lw.line("METHOD", "PUBLISH")
+	lw.line("X-WR-CALNAME", escape(c.Name))
+	for _, e := range c.Entries {
+		stamp := e.Modified
+		if stamp.IsZero() {
+			stamp = e.Created
+		}
+		switch c.Component {
+		case ComponentTodo:
+			lw.line("BEGIN", "VTODO")
+			lw.line("UID", escape(e.UID))
+			lw.line("DTSTAMP", formatTime(stamp))
+			lw.line("SUMMARY", escape(e.Summary))
+			lw.line("DUE;VALUE=DATE", formatDate(e.Due))
+			if e.Status != "" {
+				lw.line("STATUS", e.Status)
+			}
+		default:
+			lw.line("BEGIN", "VEVENT")
+			lw.line("UID", escape(e.UID))
+			lw.line("DTSTAMP", formatTime(stamp))
+			lw.line("SUMMARY", escape(e.Summary))
+			lw.line("DTSTART;VALUE=DATE", formatDate(e.Due))
+			lw.line("DTEND;VALUE=DATE", formatDate(e.Due.AddDate(0, 0, 1)))
+			lw.line("TRANSP", "TRANSPARENT")
+		}
+		if e.Description != "" {
+			lw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			lw.line("URL", e.URL)
+		}
+		if !e.Created.IsZero() {
+			lw.line("CREATED", formatTime(e.Created))
+		}
+		if !e.Modified.IsZero() {
+			lw.line("LAST-MODIFIED", formatTime(e.Modified))
+		}
+		if c.Component == ComponentTodo {
+			lw.line("END", "VTODO")
+		} else {
+			lw.line("END", "VEVENT")
+		}
+	}
+	lw.line("END", "VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+// lineWriter writes content lines, keeping the first error encountered so
+// that it only has to be checked once.
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line writes a content line with the given name and value, folded so that
+// no line is longer than 75 octets.
+func (lw *lineWriter) line(name string, value string) {
+	if lw.err != nil {
+		return
+	}
+	_, lw.err = io.WriteString(lw.w, fold(name+":"+value))
+}
+
+func fold(s string) string {
+	const limit = 75
+	var b strings.Builder
+	n := 0
+	for len(s) > 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		// continuation lines start with a space, which counts towards the limit
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteString(s[:size])
+		n += size
+		s = s[size:]
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
@@ -0,0 +1,144 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"plain", "Ship it", "Ship it"},
+		{"backslash", `C:\tasks`, `C:\\tasks`},
+		{"semicolon and comma", "a;b,c", `a\;b\,c`},
+		{"newlines", "one\ntwo\r\nthree", `one\ntwo\nthree`},
+		{"escaped sequence", `\n`, `\\n`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, escape(tt.s))
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		lines int
+	}{
+		{"short", "SUMMARY:Ship it", 1},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"76 octets", "SUMMARY:" + strings.Repeat("a", 68), 2},
+		{"long", "DESCRIPTION:" + strings.Repeat("a", 200), 3},
+		{"multi-byte characters", "SUMMARY:" + strings.Repeat("é", 100), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := fold(tt.s)
+			assert := assert.New(t)
+			assert.True(strings.HasSuffix(folded, "\r\n"))
+			lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+			assert.Len(lines, tt.lines)
+			for i, line := range lines {
+				assert.LessOrEqual(len(line), 75)
+				// characters aren't split across lines
+				assert.True(utf8.ValidString(line))
+				if i > 0 {
+					assert.True(strings.HasPrefix(line, " "))
+				}
+			}
+			assert.Equal(tt.s, strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""))
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, Calendar{
+		Name: "ProjectMotor, Tasks",
+		Entries: []Entry{
+			{
+				UID:         "task-1@projectmotor",
+				Summary:     "Ship it",
+				Description: "Line one\nLine two",
+				URL:         "https://projectmotor.example.com/tasks/1",
+				Due:         time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+				Status:      StatusCompleted,
+				Created:     time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+				Modified:    time.Date(2026, 2, 2, 12, 30, 0, 0, time.FixedZone("CET", 3600)),
+			},
+			{
+				UID:     "task-2@projectmotor",
+				Summary: "Plan next year",
+				Due:     time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+				Created: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	})
+	body := buf.String()
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+	assert.Contains(body, "X-WR-CALNAME:ProjectMotor\\, Tasks\r\n")
+	assert.Equal(2, strings.Count(body, "BEGIN:VEVENT\r\n"))
+	assert.Equal(2, strings.Count(body, "END:VEVENT\r\n"))
+	assert.NotContains(body, "VTODO")
+
+	// all-day events end on the day after they start
+	assert.Contains(body, "DTSTART;VALUE=DATE:20260228\r\nDTEND;VALUE=DATE:20260301\r\n")
+	assert.Contains(body, "DTSTART;VALUE=DATE:20261231\r\nDTEND;VALUE=DATE:20270101\r\n")
+
+	// the stamp is the last modification, or the creation, in UTC
+	assert.Contains(body, "DTSTAMP:20260202T113000Z\r\n")
+	assert.Contains(body, "LAST-MODIFIED:20260202T113000Z\r\n")
+	assert.Contains(body, "DTSTAMP:20260201T100000Z\r\n")
+
+	assert.Contains(body, "DESCRIPTION:Line one\\nLine two\r\n")
+	assert.Contains(body, "URL:https://projectmotor.example.com/tasks/1\r\n")
+	assert.NotContains(body, "STATUS:")
+}
+
+func TestWriteTodo(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, Calendar{
+		Name:      "Tasks",
+		Component: ComponentTodo,
+		Entries: []Entry{
+			{
+				UID:     "task-1@projectmotor",
+				Summary: "Ship it",
+				Due:     time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+				Status:  StatusInProcess,
+				Created: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+			},
+			{
+				UID:     "task-2@projectmotor",
+				Summary: "Without status",
+				Due:     time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+				Created: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	})
+	body := buf.String()
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal(2, strings.Count(body, "BEGIN:VTODO\r\n"))
+	assert.Equal(2, strings.Count(body, "END:VTODO\r\n"))
+	assert.Contains(body, "DUE;VALUE=DATE:20260301\r\n")
+	assert.Contains(body, "DUE;VALUE=DATE:20260302\r\n")
+	assert.Equal(1, strings.Count(body, "STATUS:"))
+	assert.Contains(body, "STATUS:IN-PROCESS\r\n")
+	assert.NotContains(body, "VEVENT")
+	assert.NotContains(body, "DTSTART")
+	assert.NotContains(body, "LAST-MODIFIED")
+}
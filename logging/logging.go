@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A LoggerKey is the representation of a key, for usage with context.
+//
+// It's used to keep the request-scoped logger inside the request context.
+type LoggerKey struct{}
+
+// A RequestKey is the representation of a key, for usage with context.
+//
+// It's used to keep the request id and the id of the logged in user inside
+// the request context, so that they're included on every log line.
+type RequestKey struct{}
+
+// requestInfo is kept as a pointer inside the request context, so that the
+// user id set by a later middleware is also seen by earlier ones.
+type requestInfo struct {
+	id      string
+	userID  int32
+	hasUser bool
+}
+
+// NewLogger returns a new slog.Logger that writes JSON to the given writer,
+// enriched with the request attributes found in the context of each record.
+func NewLogger(w io.Writer) *slog.Logger {
+	return slog.New(NewHandler(slog.NewJSONHandler(w, nil)))
+}
+
+// FromContext returns the request-scoped logger from the given context.
+//
+// The function never fails, and if the logger doesn't exist within the
+// context, it returns the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := ctx.Value(LoggerKey{})
+	if logger, ok := logger.(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithLogger returns a copy of the given context with the given logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, LoggerKey{}, logger)
+}
+
+// WithRequestID returns a copy of the given context with the given request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestKey{}, &requestInfo{id: id})
+}
+
+// RequestID returns the request id from the given context, or an empty
+// string if it doesn't exist.
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(RequestKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
+// SetUserID sets the given user id on the request within the given context.
+//
+// It does nothing if the context wasn't created with WithRequestID.
+func SetUserID(ctx context.Context, id int32) {
+	info, ok := ctx.Value(RequestKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.userID = id
+	info.hasUser = true
+}
+
+// A Handler is a slog.Handler that adds the request id, user id, route
+// pattern and trace found in the context of each record, before passing it on.
+//
+// The route pattern is read when the record is handled rather than when the
+// logger is created, since chi only knows it after routing.
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler returns a pointer to Handler wrapping the given slog.Handler.
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{
+		next: next,
+	}
+}
+
+// Enabled reports whether the wrapped handler handles records at the given level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the request attributes from the given context to the record,
+// and passes it on to the wrapped handler.
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	if info, ok := ctx.Value(RequestKey{}).(*requestInfo); ok {
+		record.AddAttrs(slog.String("request_id", info.id))
+		if info.hasUser {
+			record.AddAttrs(slog.Int("user_id", int(info.userID)))
+		}
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			record.AddAttrs(slog.String("route", pattern))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a new Handler whose wrapped handler has the given attributes.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewHandler(h.next.WithAttrs(attrs))
+}
+
+// WithGroup returns a new Handler whose wrapped handler has the given group.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return NewHandler(h.next.WithGroup(name))
+}
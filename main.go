@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	// Embed the time zone database, so that the time zones of users load
+	// even where the system doesn't have one
+	_ "time/tzdata"
 
 	"github.com/gorilla/sessions"
+	"github.com/webdevfuel/projectmotor/account"
 	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/github"
 	"github.com/webdevfuel/projectmotor/handler"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/recurrence"
 	"github.com/webdevfuel/projectmotor/router"
+	"github.com/webdevfuel/projectmotor/storage"
+	"github.com/webdevfuel/projectmotor/tracing"
+	"github.com/webdevfuel/projectmotor/webhook"
 )
 
 func getCookieSessionKey() string {
@@ -20,18 +37,184 @@ func getCookieSessionKey() string {
 	return sessionKey
 }
 
-var store = sessions.NewCookieStore([]byte(getCookieSessionKey()))
+// getServerAddr returns the value of the environment variable SERVER_ADDR,
+// or "localhost:3000" if it isn't set.
+func getServerAddr() string {
+	addr := os.Getenv("SERVER_ADDR")
+	if addr == "" {
+		return "localhost:3000"
+	}
+	return addr
+}
+
+// getDuration returns the duration parsed from the environment variable with
+// the given key, or the fallback if it isn't set.
+//
+// The value must be a string accepted by time.ParseDuration, e.g. "15s".
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("environment variable %s must be a valid duration: %v", key, err)
+	}
+	return d
+}
+
+// allowPrivateWebhooks reports whether the environment variable
+// WEBHOOK_ALLOW_PRIVATE is "true", which lets webhooks be sent to loopback
+// and private addresses, e.g. to a receiver running next to the app in
+// development.
+func allowPrivateWebhooks() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// webhookClient returns the client webhook deliveries are sent with, which
+// refuses to connect to private addresses unless allowPrivateWebhooks, and
+// never follows redirects.
+func webhookClient(timeout time.Duration) *http.Client {
+	if allowPrivateWebhooks() {
+		return &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return webhook.NewClient(timeout)
+}
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		runAdmin(os.Args[2:])
+		return
+	}
+	// Log JSON lines, including those written with the log package
+	slog.SetDefault(logging.NewLogger(os.Stdout))
+	// Export traces as configured by OTEL_TRACES_EXPORTER, flushing
+	// buffered spans after the server has shut down
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := shutdownTracing(ctx)
+		if err != nil {
+			slog.Error("tracing didn't shut down cleanly", "error", err)
+		}
+	}()
 	db, err := database.OpenDB()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	// Apply pending migrations when asked to, otherwise refuse to boot
+	// against a schema that's behind the embedded migrations
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = migrator.Up(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = database.CheckSchema(context.Background(), db)
+	if err != nil {
+		log.Fatalf("%v (run \"projectmotor migrate up\" or set MIGRATE_ON_START=true)", err)
+	}
+	store := sessions.NewCookieStore([]byte(getCookieSessionKey()))
+	// Keep attachments where STORAGE_BACKEND says, on disk by default
+	files, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 	h := handler.NewHandler(handler.HandlerOptions{
-		DB:    db,
-		Store: store,
+		DB:      db,
+		Store:   store,
+		Storage: files,
+		GitHubAPI: github.NewAPI(
+			github.WithTimeout(getDuration("GITHUB_TIMEOUT", 10*time.Second)),
+		),
+		AllowPrivateWebhooks: allowPrivateWebhooks(),
+		// Build the links given out to calendar applications and other
+		// services with the url the app is reached at, which differs
+		// from SERVER_ADDR behind a proxy
+		PublicURL: os.Getenv("PUBLIC_URL"),
+		// Serve metrics only to scrapers that send the token
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
 	})
 	r := router.NewRouter(h)
-	http.ListenAndServe("localhost:3000", r)
+	server := &http.Server{
+		Addr:              getServerAddr(),
+		Handler:           r,
+		ReadHeaderTimeout: getDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      getDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       getDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+	}
+	shutdownTimeout := getDuration("HTTP_SHUTDOWN_TIMEOUT", 30*time.Second)
+	// Wait for the background workers to return before the database is
+	// closed, after stop cancels their context on the way out
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	// Stop accepting new requests on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+	// Create the next occurrence of recurring tasks once they're due,
+	// which every instance can do at the same time
+	scheduler := recurrence.NewScheduler(db, getDuration("RECURRENCE_INTERVAL", time.Minute))
+	runWorker(scheduler.Run)
+	// Send queued webhook deliveries, retrying failed ones with a backoff,
+	// which every instance can do at the same time too
+	dispatcher := webhook.NewDispatcher(
+		db,
+		webhookClient(getDuration("WEBHOOK_TIMEOUT", 10*time.Second)),
+		getDuration("WEBHOOK_INTERVAL", 10*time.Second),
+	)
+	runWorker(dispatcher.Run)
+	// Generate the data exports users ask for, and delete the accounts
+	// whose grace period is over, which every instance can do at the same
+	// time as well
+	worker := account.NewWorker(db, files, getDuration("ACCOUNT_INTERVAL", time.Minute))
+	runWorker(worker.Run)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped unexpectedly", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down, draining in-flight requests")
+	// Give in-flight requests until the shutdown timeout to finish,
+	// after which the database is closed by the deferred call, once the
+	// background workers have returned
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("server didn't shut down cleanly", "error", err)
+	}
 }
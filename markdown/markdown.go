@@ -0,0 +1,62 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/a-h/templ"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		&taskReferences{},
+	),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+	),
+)
+
+var policy = newPolicy()
+
+// newPolicy returns the sanitization policy applied to rendered Markdown.
+//
+// It's the user generated content policy of bluemonday, which also allows the
+// disabled checkboxes of GFM task lists and the language class of code blocks.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^task-reference$`)).OnElements("a")
+	return p
+}
+
+// HTML returns the given GitHub Flavored Markdown rendered to sanitized HTML.
+//
+// Task references like "#123" are linked to the referenced task. Raw HTML
+// inside the source is dropped, and the output is sanitized again, so it's
+// safe to render text written by any user.
+func HTML(source string) (string, error) {
+	var buf bytes.Buffer
+	err := md.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Component returns a templ.Component that renders the given Markdown with
+// HTML, inside a div with the class "markdown".
+func Component(source string) templ.Component {
+	html, err := HTML(source)
+	if err != nil {
+		return templ.Raw("", err)
+	}
+	return templ.Raw(`<div class="markdown">` + html + `</div>`)
+}
@@ -0,0 +1,60 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLSanitizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		removed []string
+	}{
+		{"script tag", "<script>alert(1)</script>", []string{"<script", "alert(1)"}},
+		{"inline script tag", "hello <script>alert(1)</script>", []string{"<script"}},
+		{"event handler", "<img src=x onerror=alert(1)>", []string{"onerror"}},
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript image", "![x](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript autolink", "<javascript:alert(1)>", []string{"<a", "href"}},
+		{"javascript html link", `<a href="javascript:alert(1)">x</a>`, []string{"javascript:"}},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", []string{"data:text/html"}},
+		{"iframe", "<iframe src=https://example.com></iframe>", []string{"<iframe"}},
+		{"style attribute", `<div style="background:url(javascript:alert(1))">x</div>`, []string{"style=", "javascript:"}},
+		{"text input", `<input type="text" value="x">`, []string{`type="text"`}},
+		{"code block class", "```go\" onclick=\"alert(1)\nx\n```", []string{"onclick"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.source)
+			assert := assert.New(t)
+			assert.Nil(err)
+			for _, s := range tt.removed {
+				assert.NotContains(html, s)
+			}
+		})
+	}
+}
+
+func TestHTMLKeepsAllowedMarkup(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		kept   string
+	}{
+		{"task list checkbox", "- [x] shipped", `<input checked="" disabled="" type="checkbox"`},
+		{"code block language", "```go\nx\n```", `<code class="language-go">`},
+		{"table", "| a | b |\n|---|---|\n| 1 | 2 |", "<table>"},
+		{"link", "[site](https://example.com)", `href="https://example.com"`},
+		{"task reference", "see #2", `class="task-reference"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.source)
+			assert := assert.New(t)
+			assert.Nil(err)
+			assert.Contains(html, tt.kept)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package markdown
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindTaskReference is the ast.NodeKind of a TaskReference.
+var KindTaskReference = ast.NewNodeKind("TaskReference")
+
+// A TaskReference is an inline node for a reference to a task, written as
+// "#" followed by the id of the task, e.g. "#123".
+type TaskReference struct {
+	ast.BaseInline
+	ID int32
+}
+
+// Kind returns KindTaskReference.
+func (n *TaskReference) Kind() ast.NodeKind {
+	return KindTaskReference
+}
+
+// Dump dumps the node to stdout, for debugging.
+func (n *TaskReference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"ID": strconv.Itoa(int(n.ID))}, nil)
+}
+
+// taskReferences is a goldmark.Extender that parses and renders task
+// references.
+type taskReferences struct{}
+
+// Extend adds the task reference parser and renderer to the given goldmark.Markdown.
+func (e *taskReferences) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&taskReferenceParser{}, 999),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&taskReferenceRenderer{}, 999),
+	))
+}
+
+type taskReferenceParser struct{}
+
+// Trigger returns the characters that start a task reference.
+func (p *taskReferenceParser) Trigger() []byte {
+	return []byte{'#'}
+}
+
+// Parse returns a TaskReference if the reader is at "#" followed by digits,
+// or nil otherwise.
+//
+// The reference must be a whole word, so that anchors in urls like
+// "/docs#12" and words like "#1st" aren't linked.
+func (p *taskReferenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	prev := block.PrecendingCharacter()
+	if prev != '\n' && prev != '(' && !unicode.IsSpace(prev) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	i := 1
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i == 1 {
+		return nil
+	}
+	if i < len(line) && (line[i] == '_' || unicode.IsLetter(rune(line[i])) || line[i] >= 0x80) {
+		return nil
+	}
+	id, err := strconv.ParseInt(string(line[1:i]), 10, 32)
+	if err != nil {
+		return nil
+	}
+	block.Advance(i)
+	return &TaskReference{ID: int32(id)}
+}
+
+type taskReferenceRenderer struct{}
+
+// RegisterFuncs registers the render function of TaskReference.
+func (r *taskReferenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindTaskReference, r.render)
+}
+
+func (r *taskReferenceRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := node.(*TaskReference)
+		fmt.Fprintf(w, `<a href="/tasks/%d" class="task-reference">#%d</a>`, n.ID, n.ID)
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestMarkdown(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("preview renders sanitized markdown", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "markdown/preview")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "description", Value: "- [x] shipped, see #2\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n<img src=x onerror=alert(1)>"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// body assertions
+		assert.Equal(1, doc.Find(".markdown input[type=checkbox][checked]").Length())
+		assert.Equal(1, doc.Find(".markdown table").Length())
+		href, _ := doc.Find("a.task-reference").Attr("href")
+		assert.Equal("/tasks/2", href)
+		assert.Equal(0, doc.Find("[onerror]").Length())
+	})
+
+	t.Run("task page renders description as markdown", func(t *testing.T) {
+		_, err := handler.DB.Exec("update tasks set description = '**Bold** and `code`' where id = 1")
+		if err != nil {
+			t.Errorf("error updating task description %s", err)
+			return
+		}
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// body assertions
+		assert.Equal("Task 1", doc.Find("#task-title").Text())
+		assert.Equal("Bold", doc.Find("#task-description strong").Text())
+		assert.Equal("code", doc.Find("#task-description code").Text())
+	})
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// businessCollector is a prometheus.Collector that counts rows of the main
+// tables each time metrics are scraped.
+type businessCollector struct {
+	db       *sqlx.DB
+	sessions *prometheus.Desc
+	projects *prometheus.Desc
+	tasks    *prometheus.Desc
+	errors   *prometheus.Desc
+}
+
+func newBusinessCollector(db *sqlx.DB) *businessCollector {
+	return &businessCollector{
+		db: db,
+		sessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sessions_active"),
+			"Number of active user sessions.",
+			nil, nil,
+		),
+		projects: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "projects"),
+			"Number of projects, labeled by whether they're published.",
+			[]string{"published"}, nil,
+		),
+		tasks: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tasks"),
+			"Number of tasks, labeled by status.",
+			[]string{"status"}, nil,
+		),
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "business_scrape_errors"),
+			"Number of queries that failed while collecting business metrics.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe sends the descriptors of all business metrics to the given channel.
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sessions
+	ch <- c.projects
+	ch <- c.tasks
+	ch <- c.errors
+}
+
+// Collect queries the database and sends the business metrics to the given
+// channel. Failed queries are skipped and counted on the errors gauge, so that
+// a slow database doesn't fail the whole scrape.
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var errors float64
+	var sessions int
+	err := c.db.GetContext(ctx, &sessions, "select count(*) from sessions")
+	if err != nil {
+		errors++
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(sessions))
+	}
+	var projects []struct {
+		Published bool `db:"published"`
+		Count     int  `db:"count"`
+	}
+	err = c.db.SelectContext(ctx, &projects, "select published, count(*) from projects group by published")
+	if err != nil {
+		errors++
+	} else {
+		counts := map[string]int{"true": 0, "false": 0}
+		for _, row := range projects {
+			if row.Published {
+				counts["true"] = row.Count
+			} else {
+				counts["false"] = row.Count
+			}
+		}
+		for published, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.projects, prometheus.GaugeValue, float64(count), published)
+		}
+	}
+	var tasks []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err = c.db.SelectContext(ctx, &tasks, "select status, count(*) from tasks group by status")
+	if err != nil {
+		errors++
+	} else {
+		for _, row := range tasks {
+			ch <- prometheus.MustNewConstMetric(c.tasks, prometheus.GaugeValue, float64(row.Count), row.Status)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.GaugeValue, errors)
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "projectmotor"
+
+// HTTPRequestDuration is a histogram of the time it takes to serve a request,
+// labeled by method, chi route pattern and status code.
+var HTTPRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time it takes to serve a HTTP request.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"method", "route", "status"},
+)
+
+// QueryDuration is a histogram of the time it takes a service method to
+// query the database, labeled by service and method name.
+var QueryDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time it takes a service method to query the database.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	},
+	[]string{"service", "method"},
+)
+
+// NewRegistry returns a new prometheus.Registry with the HTTP and query
+// histograms, Go runtime and process metrics, and the pool stats and
+// business gauges of the given database.
+//
+// The histograms are shared between registries, so that every registry
+// reports the same values.
+func NewRegistry(db *sqlx.DB) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db.DB, namespace),
+		newBusinessCollector(db),
+		HTTPRequestDuration,
+		QueryDuration,
+	)
+	return registry
+}
+
+// Handler returns a http.Handler that serves the metrics of the given
+// registry in the Prometheus exposition format.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the duration of every request on HTTPRequestDuration.
+//
+// The route pattern is read after the request is served, since chi only
+// knows it after routing, and requests that don't match a route are
+// labeled "unmatched" so that unknown paths don't create new series.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			HTTPRequestDuration.
+				WithLabelValues(r.Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// ObserveQuery returns a function that records the time since it was called
+// on QueryDuration, meant to be deferred at the start of a service method.
+//
+// An example of usage inside a service method:
+//
+//	defer metrics.ObserveQuery("ProjectService", "Get")()
+func ObserveQuery(service string, method string) func() {
+	start := time.Now()
+	return func() {
+		QueryDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestMetrics(t *testing.T) {
+	handler, server := test.NewServer(test.WithMetricsToken("secret"))
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("metrics include request, query and business metrics", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		test.Do(req)
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "metrics")),
+		)
+		req.Header.Set("Authorization", "Bearer secret")
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// body assertions
+		assert.Contains(body, `projectmotor_http_request_duration_seconds_count{method="GET",route="/projects",status="200"}`)
+		assert.Contains(body, `projectmotor_db_query_duration_seconds_count{method="GetAll",service="ProjectService"}`)
+		assert.Contains(body, `projectmotor_projects{published="true"} 2`)
+		assert.Contains(body, `projectmotor_tasks{status="todo"} 10`)
+		assert.Contains(body, "projectmotor_sessions_active")
+		assert.Contains(body, "go_sql_open_connections")
+	})
+
+	t.Run("metrics require the token", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "metrics")),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(401, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "metrics")),
+		)
+		req.Header.Set("Authorization", "Bearer wrong")
+		res = test.Do(req)
+		assert.Equal(401, res.StatusCode)
+	})
+
+	t.Run("metrics aren't served without a token", func(t *testing.T) {
+		_, server := test.NewServer()
+		defer server.Close()
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "metrics")),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+const migrateUsage = `usage: projectmotor migrate <command>
+
+commands:
+  up       apply all pending migrations
+  down     revert the most recently applied migration
+  status   list migrations and whether they're applied
+  to N     apply or revert migrations until the schema is at version N
+  force N  record version N as applied and clean, after fixing a dirty schema`
+
+// runMigrate runs the "migrate" subcommand with the given arguments, using
+// the migrations embedded in the binary.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	db, err := database.OpenDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			log.Fatalf("version must be a number: %v", parseErr)
+		}
+		err = migrator.To(ctx, uint(version))
+	case "force":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			log.Fatalf("version must be a number: %v", parseErr)
+		}
+		err = migrator.Force(ctx, uint(version))
+	case "status":
+		err = printMigrateStatus(ctx, migrator)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if args[0] != "status" {
+		version, _, err := database.SchemaVersion(ctx, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("schema is at version %d", version)
+	}
+}
+
+func printMigrateStatus(ctx context.Context, migrator *database.Migrator) error {
+	statuses, version, dirty, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, state)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		fmt.Printf("\nschema is at version %d (dirty)\n", version)
+	} else {
+		fmt.Printf("\nschema is at version %d\n", version)
+	}
+	return nil
+}
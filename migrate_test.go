@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestMigrate(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	err := test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	migrator, err := database.NewMigrator(handler.DB)
+	if err != nil {
+		t.Errorf("error creating migrator %s", err)
+		return
+	}
+
+	latest, err := database.LatestVersion()
+	if err != nil {
+		t.Errorf("error getting latest version %s", err)
+		return
+	}
+
+	ctx := context.Background()
+
+	t.Run("status reports all migrations as applied", func(t *testing.T) {
+		statuses, version, dirty, err := migrator.Status(ctx)
+		assert := assert.New(t)
+		assert.Nil(err)
+		assert.Equal(latest, version)
+		assert.False(dirty)
+		for _, status := range statuses {
+			assert.True(status.Applied)
+		}
+		assert.Nil(database.CheckSchema(ctx, handler.DB))
+	})
+
+	t.Run("down reverts the latest migration and schema is behind", func(t *testing.T) {
+		err := migrator.Down(ctx)
+		assert := assert.New(t)
+		assert.Nil(err)
+		version, _, err := database.SchemaVersion(ctx, handler.DB)
+		assert.Nil(err)
+		assert.Less(version, latest)
+		assert.ErrorIs(database.CheckSchema(ctx, handler.DB), database.ErrSchemaBehind)
+	})
+
+	t.Run("to migrates back to the latest version", func(t *testing.T) {
+		err := migrator.To(ctx, latest)
+		assert := assert.New(t)
+		assert.Nil(err)
+		version, _, err := database.SchemaVersion(ctx, handler.DB)
+		assert.Nil(err)
+		assert.Equal(latest, version)
+	})
+
+	t.Run("to refuses unknown versions", func(t *testing.T) {
+		err := migrator.To(ctx, latest+100)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("concurrent up calls don't apply migrations twice", func(t *testing.T) {
+		err := migrator.To(ctx, 0)
+		if err != nil {
+			t.Errorf("error reverting migrations %s", err)
+			return
+		}
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				errs <- migrator.Up(ctx)
+			}()
+		}
+		assert := assert.New(t)
+		assert.Nil(<-errs)
+		assert.Nil(<-errs)
+		assert.Nil(database.CheckSchema(ctx, handler.DB))
+	})
+
+	t.Run("dirty schema is refused", func(t *testing.T) {
+		_, err := handler.DB.Exec("update schema_migrations set dirty = true")
+		if err != nil {
+			t.Errorf("error marking schema as dirty %s", err)
+			return
+		}
+		assert := assert.New(t)
+		_, dirty, err := database.SchemaVersion(ctx, handler.DB)
+		assert.Nil(err)
+		assert.True(dirty)
+		assert.NotNil(database.CheckSchema(ctx, handler.DB))
+		assert.NotNil(migrator.Down(ctx))
+
+		// force records the version as clean again
+		assert.Nil(migrator.Force(ctx, latest))
+		assert.Nil(database.CheckSchema(ctx, handler.DB))
+	})
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestMilestones(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("create milestone", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/milestones")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: "Beta"},
+				test.FormValue{Key: "target_date", Value: "2026-01-31"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("Beta", doc.Find("li.milestone .milestone-name").Text())
+		assert.Equal("0 of 0 tasks done", doc.Find("li.milestone .milestone-count").Text())
+	})
+
+	t.Run("create milestone requires a name", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/milestones")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: ""},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		form := test.NewForm(doc, "milestone-form")
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("cannot be blank", form.MustGetFieldByID("name").Error)
+	})
+
+	t.Run("create milestone on projects of others", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/milestones")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: "Mine"},
+			),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("tasks join milestones of their project only", func(t *testing.T) {
+		var milestoneID int
+		handler.DB.Get(&milestoneID, "select id from milestones where name = 'Beta'")
+		update := func(taskID int, value string) {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/tasks/%d", server.URL, taskID)),
+				test.WithAuthentication(test.Authenticated, cookie),
+				test.WithMethod(test.Patch),
+				test.WithFormValues(
+					test.FormValue{Key: "title", Value: fmt.Sprintf("Task %d", taskID)},
+					test.FormValue{Key: "milestone_id", Value: value},
+				),
+			)
+			test.Do(req)
+		}
+		// tasks 1 and 2 are in project 1, task 3 in project 2
+		update(1, fmt.Sprint(milestoneID))
+		update(2, fmt.Sprint(milestoneID))
+		update(3, fmt.Sprint(milestoneID))
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where milestone_id is not null")
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("progress counts done and overdue tasks", func(t *testing.T) {
+		_, err := handler.DB.Exec(`
+			update tasks set status = 'done' where id = 1;
+			update tasks set due_date = '2026-01-15' where id = 2;
+		`)
+		if err != nil {
+			t.Errorf("error updating tasks %s", err)
+			return
+		}
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/milestones")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		progress := doc.Find("li.milestone progress.milestone-progress")
+		assert.Equal("2", progress.AttrOr("max", ""))
+		assert.Equal("1", progress.AttrOr("value", ""))
+		assert.Contains(doc.Find("li.milestone .milestone-count").Text(), "1 of 2 tasks done")
+		assert.Contains(doc.Find("li.milestone .milestone-count").Text(), "1 overdue")
+		assert.Equal(1, doc.Find("li.milestone .milestone-overdue").Length())
+	})
+
+	t.Run("deleting a milestone keeps its tasks", func(t *testing.T) {
+		var milestoneID int
+		handler.DB.Get(&milestoneID, "select id from milestones where name = 'Beta'")
+		url := fmt.Sprintf("%s/milestones/%d", server.URL, milestoneID)
+		req := test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(404, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where id in (1, 2) and milestone_id is null")
+		assert.Equal(2, count)
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestOAuthGitHub(t *testing.T) {
+	gh := test.NewGitHub()
+	defer gh.Close()
+	gh.AddUser("jane-code", test.GitHubUser{
+		ID:          3,
+		Email:       "jane@example.com",
+		AccessToken: "jane-token",
+		Name:        "Jane Code",
+		AvatarURL:   "https://avatars.githubusercontent.com/u/3",
+	})
+	gh.AddUser("web-dev-fuel-code", test.GitHubUser{ID: 1, Email: "hello@webdevfuel.com", AccessToken: "new-token"})
+	gh.AddUser("john-repo-code", test.GitHubUser{
+		ID:          2,
+		Email:       "johndoe@gmail.com",
+		AccessToken: "john-repo-token",
+		Scopes:      []string{"read:user", "user:email", github.ScopeRepo},
+	})
+
+	handler, server := test.NewServer(test.WithGitHub(gh))
+	defer server.Close()
+
+	err := test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	sessionCookie := func(res *http.Response) string {
+		for _, c := range res.Cookies() {
+			if c.Name == "_projectmotor_session" {
+				return fmt.Sprintf("%s=%s", c.Name, c.Value)
+			}
+		}
+		return ""
+	}
+
+	// login starts logging in with GitHub, and returns the state sent to it
+	// along with the session cookie it's stored in
+	login := func(t *testing.T) (string, string) {
+		res := test.DoWithoutRedirect(test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "oauth/github/login")),
+		))
+		assert := assert.New(t)
+		assert.Equal(http.StatusTemporaryRedirect, res.StatusCode)
+		location, err := url.Parse(res.Header.Get("Location"))
+		if !assert.NoError(err) {
+			return "", ""
+		}
+		assert.True(strings.HasPrefix(location.String(), gh.Server.URL+"/login/oauth/authorize"))
+		assert.Equal("client-id", location.Query().Get("client_id"))
+		// access to repositories is only asked for when linking one
+		assert.Equal("read:user user:email", location.Query().Get("scope"))
+		cookie := sessionCookie(res)
+		assert.NotEmpty(cookie)
+		return location.Query().Get("state"), cookie
+	}
+
+	callback := func(state string, code string, cookie string) *http.Response {
+		query := url.Values{"state": {state}, "code": {code}}
+		return test.DoWithoutRedirect(test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/oauth/github/callback?%s", server.URL, query.Encode())),
+			test.WithAuthentication(test.Authenticated, cookie),
+		))
+	}
+
+	t.Run("new users are created", func(t *testing.T) {
+		state, cookie := login(t)
+		res := callback(state, "jane-code", cookie)
+		assert := assert.New(t)
+		assert.Equal(http.StatusSeeOther, res.StatusCode)
+		assert.Equal("/", res.Header.Get("Location"))
+
+		var user struct {
+			Email       string `db:"email"`
+			AccessToken string `db:"gh_access_token"`
+			Name        string `db:"name"`
+			AvatarURL   string `db:"avatar_url"`
+		}
+		err := handler.DB.Get(&user, "select email, gh_access_token, name, avatar_url from users where gh_user_id = 3")
+		assert.NoError(err)
+		assert.Equal("jane@example.com", user.Email)
+		assert.Equal("jane-token", user.AccessToken)
+		// the name and avatar are imported from GitHub
+		assert.Equal("Jane Code", user.Name)
+		assert.Equal("https://avatars.githubusercontent.com/u/3", user.AvatarURL)
+
+		// the session logs the user in
+		res = test.Do(test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, sessionCookie(res)),
+		))
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects", res.Request.URL.Path)
+	})
+
+	t.Run("existing users are updated", func(t *testing.T) {
+		state, cookie := login(t)
+		res := callback(state, "web-dev-fuel-code", cookie)
+		assert := assert.New(t)
+		assert.Equal(http.StatusSeeOther, res.StatusCode)
+
+		var count int
+		handler.DB.Get(&count, "select count(*) from users where gh_user_id = 1 and gh_access_token = 'new-token'")
+		assert.Equal(1, count)
+	})
+
+	t.Run("requests failed by GitHub are retried", func(t *testing.T) {
+		gh.FailNext(1, http.StatusBadGateway, nil)
+		gh.FailNext(1, http.StatusForbidden, http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {"0"},
+		})
+		requests := gh.Requests()
+		state, cookie := login(t)
+		res := callback(state, "jane-code", cookie)
+		assert := assert.New(t)
+		assert.Equal(http.StatusSeeOther, res.StatusCode)
+		// the emails are requested three times, and the user once
+		assert.Equal(requests+4, gh.Requests())
+	})
+
+	t.Run("repository access is asked for when linking one", func(t *testing.T) {
+		cookie, err := test.SetUserSession(server, 2)
+		if err != nil {
+			t.Errorf("error setting user test session %s", err)
+			return
+		}
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/3/github")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc := test.Doc(test.Do(req))
+		assert := assert.New(t)
+		assert.Equal(1, doc.Find("#github-authorize").Length())
+		assert.Equal(0, doc.Find("#github-repo-form").Length())
+
+		res := test.DoWithoutRedirect(test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/3/github/authorize")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		))
+		assert.Equal(http.StatusTemporaryRedirect, res.StatusCode)
+		location, err := url.Parse(res.Header.Get("Location"))
+		if !assert.NoError(err) {
+			return
+		}
+		assert.Equal("read:user user:email repo", location.Query().Get("scope"))
+
+		res = callback(location.Query().Get("state"), "john-repo-code", sessionCookie(res))
+		assert.Equal(http.StatusSeeOther, res.StatusCode)
+		assert.Equal("/projects/3/github", res.Header.Get("Location"))
+		var scopes string
+		handler.DB.Get(&scopes, "select gh_scopes from users where id = 2")
+		assert.Equal("read:user,user:email,repo", scopes)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/3/github")),
+			test.WithAuthentication(test.Authenticated, sessionCookie(res)),
+		)
+		doc = test.Doc(test.Do(req))
+		assert.Equal(0, doc.Find("#github-authorize").Length())
+		assert.Equal(1, doc.Find("#github-repo-form").Length())
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		_, cookie := login(t)
+		res := callback("not-the-state", "jane-code", cookie)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		state, cookie := login(t)
+		res := callback(state, "not-a-code", cookie)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestGitHubAPIRetries(t *testing.T) {
+	gh := test.NewGitHub()
+	defer gh.Close()
+	gh.AddUser("code", test.GitHubUser{ID: 3, Email: "jane@example.com", AccessToken: "token"})
+	api := gh.API()
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		gh.FailNext(2, http.StatusServiceUnavailable, nil)
+		requests := gh.Requests()
+		user, err := api.GetUser(context.Background(), "token")
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal(int32(3), user.ID)
+		assert.Equal(requests+3, gh.Requests())
+	})
+
+	t.Run("rate limits are retried after the delay asked for", func(t *testing.T) {
+		gh.FailNext(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+		requests := gh.Requests()
+		_, err := api.GetUser(context.Background(), "token")
+		assert := assert.New(t)
+		assert.NoError(err)
+		assert.Equal(requests+2, gh.Requests())
+	})
+
+	t.Run("long delays aren't waited for", func(t *testing.T) {
+		gh.FailNext(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}})
+		requests := gh.Requests()
+		_, err := api.GetUser(context.Background(), "token")
+		assert := assert.New(t)
+		var apiErr *github.APIError
+		if assert.ErrorAs(err, &apiErr) {
+			assert.Equal(http.StatusTooManyRequests, apiErr.StatusCode)
+		}
+		assert.Equal(requests+1, gh.Requests())
+	})
+
+	t.Run("retries are limited", func(t *testing.T) {
+		gh.FailNext(3, http.StatusInternalServerError, nil)
+		requests := gh.Requests()
+		_, err := api.GetUser(context.Background(), "token")
+		assert := assert.New(t)
+		assert.Error(err)
+		assert.Equal(requests+3, gh.Requests())
+	})
+
+	t.Run("client errors aren't retried", func(t *testing.T) {
+		gh.FailNext(1, http.StatusForbidden, nil)
+		requests := gh.Requests()
+		_, err := api.GetUser(context.Background(), "token")
+		assert := assert.New(t)
+		assert.Error(err)
+		assert.Equal(requests+1, gh.Requests())
+
+		_, err = api.GetRepo(context.Background(), "token", "acme", "gadgets")
+		assert.True(github.IsNotFound(err))
+	})
+}
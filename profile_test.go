@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/attachment"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestProfile(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	updateProfile := func(name string, timezone string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: name},
+				test.FormValue{Key: "timezone", Value: timezone},
+			),
+		)
+		return test.Do(req)
+	}
+
+	t.Run("update name and time zone", func(t *testing.T) {
+		res := updateProfile("Fuel", "Europe/Lisbon")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("Fuel", doc.Find("#name").AttrOr("value", ""))
+		assert.Equal("Europe/Lisbon", doc.Find("#timezone").AttrOr("value", ""))
+
+		var user struct {
+			Name     string `db:"name"`
+			Timezone string `db:"timezone"`
+		}
+		handler.DB.Get(&user, "select name, timezone from users where id = 1")
+		assert.Equal("Fuel", user.Name)
+		assert.Equal("Europe/Lisbon", user.Timezone)
+
+		// the name is shown instead of the email
+		req := test.NewRequest(
+			test.WithUrl(server.URL),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc = test.Doc(test.Do(req))
+		assert.Equal("Fuel", doc.Find(".current-user-name").Text())
+	})
+
+	t.Run("unknown time zone", func(t *testing.T) {
+		res := updateProfile("Fuel", "Mars/Olympus_Mons")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("must be a time zone like Europe/Lisbon", doc.Find("#profile-form .text-red-600").Text())
+
+		var timezone string
+		handler.DB.Get(&timezone, "select timezone from users where id = 1")
+		assert.Equal("Europe/Lisbon", timezone)
+	})
+
+	t.Run("upload avatar", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/avatar")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("avatar", "me.png", newPNG(640, 480)),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		src := doc.Find(".profile-avatar img").AttrOr("src", "")
+		assert.Contains(src, "/users/1/avatar")
+
+		// the avatar is scaled down
+		req = test.NewRequest(
+			test.WithUrl(server.URL+src),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("image/png", res.Header.Get("Content-Type"))
+		img, err := png.Decode(res.Body)
+		if assert.NoError(err) {
+			assert.Equal(attachment.AvatarSize, img.Bounds().Dx())
+		}
+	})
+
+	t.Run("upload something that isn't an image", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/avatar")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("avatar", "notes.txt", []byte("hello")),
+		)
+		res := test.Do(req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	})
+
+	t.Run("remove avatar", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "profile/avatar")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		// the seeded user has no GitHub avatar, so their initial is shown
+		assert.Equal("F", doc.Find(".profile-avatar .avatar").Text())
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "users/1/avatar")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res = test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+	})
+}
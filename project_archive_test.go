@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestProjectArchive(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	updateTask := func() int {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Renamed"},
+			),
+		)
+		return test.Do(req).StatusCode
+	}
+
+	t.Run("archive projects of others", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/archive")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Patch),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(404, res.StatusCode)
+		var state string
+		handler.DB.Get(&state, "select state from projects where id = 1")
+		assert.Equal("active", state)
+	})
+
+	t.Run("archive project", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/archive")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects/1/edit", res.Header.Get("HX-Redirect"))
+		var state string
+		handler.DB.Get(&state, "select state from projects where id = 1")
+		assert.Equal("archived", state)
+	})
+
+	t.Run("archived projects are listed under their filter", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(0, doc.Find(`a[href="/projects/1/edit"]`).Length())
+		assert.Equal(1, doc.Find(`a[href="/projects/2/edit"]`).Length())
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects?filter=archived")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		res = test.Do(req)
+		doc = test.Doc(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, doc.Find(`a[href="/projects/1/edit"]`).Length())
+		assert.Equal(0, doc.Find(`a[href="/projects/2/edit"]`).Length())
+	})
+
+	t.Run("archived projects are read-only", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(409, updateTask())
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1/timer")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert.Equal(409, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/milestones")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "name", Value: "Beta"},
+			),
+		)
+		res = test.Do(req)
+		assert.Equal(409, res.StatusCode)
+
+		var title string
+		handler.DB.Get(&title, "select title from tasks where id = 1")
+		assert.NotEqual("Renamed", title)
+	})
+
+	t.Run("restore project", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/restore")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(200, updateTask())
+		var title string
+		handler.DB.Get(&title, "select title from tasks where id = 1")
+		assert.Equal("Renamed", title)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestProjectCopy(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	_, err = handler.DB.Exec(`
+		insert into milestones (project_id, name, target_date) values (1, 'Launch', '2026-01-10');
+		update tasks set due_date = '2026-01-05', status = 'done' where id = 1;
+		update tasks set due_date = '2026-01-08', milestone_id = (select id from milestones where name = 'Launch') where id = 2;
+	`)
+	if err != nil {
+		t.Errorf("error preparing project %s", err)
+		return
+	}
+
+	t.Run("save as template keeps dates", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/template")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "copy_title", Value: "Monthly template"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		var template struct {
+			ID         int  `db:"id"`
+			IsTemplate bool `db:"is_template"`
+			Published  bool `db:"published"`
+		}
+		handler.DB.Get(&template, "select id, is_template, published from projects where title = 'Monthly template'")
+		assert.True(template.IsTemplate)
+		assert.False(template.Published)
+		assert.Equal(fmt.Sprintf("/projects/%d/edit", template.ID), res.Header.Get("HX-Redirect"))
+		var dueDates []time.Time
+		handler.DB.Select(&dueDates, "select due_date from tasks where project_id = $1 order by due_date", template.ID)
+		assert.Len(dueDates, 2)
+		if len(dueDates) == 2 {
+			assert.Equal("2026-01-05", dueDates[0].Format(time.DateOnly))
+			assert.Equal("2026-01-08", dueDates[1].Format(time.DateOnly))
+		}
+	})
+
+	t.Run("create from template shifts dates and keeps milestones", func(t *testing.T) {
+		var templateID int
+		handler.DB.Get(&templateID, "select id from projects where title = 'Monthly template'")
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "February"},
+				test.FormValue{Key: "template_id", Value: fmt.Sprint(templateID)},
+				test.FormValue{Key: "start_date", Value: "2026-02-01"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		var projectID int
+		handler.DB.Get(&projectID, "select id from projects where title = 'February' and not is_template")
+		var tasks []struct {
+			DueDate   time.Time `db:"due_date"`
+			Status    string    `db:"status"`
+			Milestone *string   `db:"milestone"`
+		}
+		handler.DB.Select(&tasks, `
+			select tasks.due_date, tasks.status, milestones.name as milestone
+			from tasks left join milestones on milestones.id = tasks.milestone_id
+			where tasks.project_id = $1 order by tasks.due_date
+		`, projectID)
+		assert.Len(tasks, 2)
+		if len(tasks) == 2 {
+			assert.Equal("2026-02-01", tasks[0].DueDate.Format(time.DateOnly))
+			assert.Equal("todo", tasks[0].Status)
+			assert.Equal("2026-02-04", tasks[1].DueDate.Format(time.DateOnly))
+			if assert.NotNil(tasks[1].Milestone) {
+				assert.Equal("Launch", *tasks[1].Milestone)
+			}
+		}
+		var targetDate time.Time
+		handler.DB.Get(&targetDate, "select target_date from milestones where project_id = $1", projectID)
+		assert.Equal("2026-02-06", targetDate.Format(time.DateOnly))
+	})
+
+	t.Run("duplicate requires a title", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/duplicate")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "copy_title", Value: ""},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		form := test.NewForm(doc, "project-copy-form")
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("cannot be blank", form.MustGetFieldByID("copy_title").Error)
+	})
+
+	t.Run("duplicate projects of others", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/duplicate")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "copy_title", Value: "Stolen"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(404, res.StatusCode)
+		var count int
+		handler.DB.Get(&count, "select count(*) from projects where title = 'Stolen'")
+		assert.Equal(0, count)
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestProjectPage(t *testing.T) {
+	handler, server := test.NewServer(test.WithPublicURL("https://projectmotor.example.com"))
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	_, err = handler.DB.Exec(`update tasks set due_date = '2026-03-01' where id = 3`)
+	if err != nil {
+		t.Errorf("error preparing tasks %s", err)
+		return
+	}
+
+	token := func() string {
+		var token string
+		handler.DB.Get(&token, "select token from project_pages where project_id = 2")
+		return token
+	}
+
+	view := func(token string) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/p/%s", server.URL, token)),
+		)
+		return test.Do(req)
+	}
+
+	t.Run("pages start disabled", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/2/page")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.NotEmpty(token())
+		url, _ := doc.Find("#page_url").Attr("value")
+		assert.Equal("https://projectmotor.example.com/p/"+token(), url)
+		assert.Equal(404, view(token()).StatusCode)
+	})
+
+	t.Run("update pages of others", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/2/page")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "enabled", Value: "on"},
+			),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("enabled pages show chosen fields without login", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/2/page")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "enabled", Value: "on"},
+				test.FormValue{Key: "show_status", Value: "on"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+
+		res = view(token())
+		doc := test.Doc(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("noindex", res.Header.Get("X-Robots-Tag"))
+		assert.Equal(2, doc.Find("li.public-task").Length())
+		assert.Equal(2, doc.Find("li.public-task .public-task-status").Length())
+		assert.Equal(0, doc.Find("li.public-task .public-task-due").Length())
+		assert.Equal(0, doc.Find("li.public-task form, li.public-task button").Length())
+
+		var views int
+		handler.DB.Get(&views, "select views from project_pages where project_id = 2")
+		assert.Equal(1, views)
+	})
+
+	t.Run("pages of unpublished projects aren't available", func(t *testing.T) {
+		handler.DB.Exec("update projects set published = false where id = 2")
+		defer handler.DB.Exec("update projects set published = true where id = 2")
+		assert.Equal(t, 404, view(token()).StatusCode)
+	})
+
+	t.Run("regenerate link", func(t *testing.T) {
+		previous := token()
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/2/page/token")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.NotEqual(previous, token())
+		assert.Equal(404, view(previous).StatusCode)
+		assert.Equal(200, view(token()).StatusCode)
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestProjectTransfer(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	// task 2 is done, so it stays with the previous owner
+	handler.DB.MustExec("update tasks set status = 'done' where id = 2")
+
+	transfer := func(projectID int32, email string, values ...test.FormValue) *http.Response {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/projects/%d/transfer", server.URL, projectID)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(append(values, test.FormValue{Key: "email", Value: email})...),
+		)
+		return test.Do(req)
+	}
+
+	incoming := func(t *testing.T) (int, int32) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		doc := test.Doc(test.Do(req))
+		var id int32
+		handler.DB.Get(&id, "select id from project_transfers where to_user_id = 2 order by id desc limit 1")
+		return doc.Find(".project-transfer").Length(), id
+	}
+
+	t.Run("recipient must have an account", func(t *testing.T) {
+		res := transfer(1, "nobody@example.com")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("doesn't belong to a ProjectMotor account", doc.Find("#project-transfer .text-red-600").Text())
+		res = transfer(1, "hello@webdevfuel.com")
+		doc = test.Doc(res)
+		assert.Equal("belongs to the current owner", doc.Find("#project-transfer .text-red-600").Text())
+	})
+
+	t.Run("decline transfer", func(t *testing.T) {
+		res := transfer(2, "johndoe@gmail.com")
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal("John Doe", doc.Find(".project-transfer-recipient").Text())
+
+		count, id := incoming(t)
+		assert.Equal(1, count)
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/project-transfers/%d/decline", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		count, _ = incoming(t)
+		assert.Equal(0, count)
+
+		var ownerID int32
+		handler.DB.Get(&ownerID, "select owner_id from projects where id = 2")
+		assert.Equal(int32(1), ownerID)
+	})
+
+	t.Run("cancel transfer", func(t *testing.T) {
+		transfer(2, "johndoe@gmail.com")
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/projects/%d/transfer", server.URL, 2)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		count, _ := incoming(t)
+		assert.Equal(0, count)
+	})
+
+	t.Run("accept transfer", func(t *testing.T) {
+		transfer(
+			1,
+			"johndoe@gmail.com",
+			test.FormValue{Key: "reassign_tasks", Value: "on"},
+			test.FormValue{Key: "keep_access", Value: "on"},
+		)
+		_, id := incoming(t)
+
+		// only the recipient can accept it
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/project-transfers/%d/accept", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/project-transfers/%d/accept", server.URL, id)),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects/1/edit", res.Header.Get("HX-Redirect"))
+
+		var ownerID int32
+		handler.DB.Get(&ownerID, "select owner_id from projects where id = 1")
+		assert.Equal(int32(2), ownerID)
+
+		// the project moves to the active workspace of the new owner
+		var moved bool
+		handler.DB.Get(&moved, "select organization_id = (select id from organizations where personal_user_id = 2) from projects where id = 1")
+		assert.True(moved)
+
+		// open tasks are reassigned, done ones aren't
+		handler.DB.Get(&ownerID, "select owner_id from tasks where id = 1")
+		assert.Equal(int32(2), ownerID)
+		handler.DB.Get(&ownerID, "select owner_id from tasks where id = 2")
+		assert.Equal(int32(1), ownerID)
+
+		// the previous owner keeps access
+		var count int
+		handler.DB.Get(&count, "select count(*) from projects_users where project_id = 1 and user_id = 1")
+		assert.Equal(1, count)
+
+		// and can't edit the project anymore
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/projects/%d/transfer", server.URL, 1)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res = test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("projects of shared workspaces can't be transferred", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "name", Value: "Acme"}),
+		)
+		test.Do(req)
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Acme site"},
+				test.FormValue{Key: "description", Value: ""},
+			),
+		)
+		test.Do(req)
+		var projectID int32
+		handler.DB.Get(&projectID, "select id from projects where title = 'Acme site'")
+		assert := assert.New(t)
+		assert.NotZero(projectID)
+
+		res := transfer(projectID, "johndoe@gmail.com")
+		doc := test.Doc(res)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("can't be given a project of a shared workspace", doc.Find("#project-transfer .text-red-600").Text())
+		var count int
+		handler.DB.Get(&count, "select count(*) from project_transfers where project_id = $1", projectID)
+		assert.Equal(0, count)
+	})
+}
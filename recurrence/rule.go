@@ -0,0 +1,283 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Frequency is the FREQ part of a Rule.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// MaxInterval is the largest accepted INTERVAL.
+const MaxInterval = 365
+
+// A Rule is a recurrence rule, written as the subset of RFC 5545 RRULE
+// supported by tasks:
+//
+//	FREQ=DAILY;INTERVAL=2                    every 2 days
+//	FREQ=WEEKLY;BYDAY=MO,WE,FR               every week on the given days
+//	FREQ=MONTHLY;BYMONTHDAY=15               every month on day 15
+//	FREQ=DAILY;INTERVAL=3;X-AFTER-COMPLETION=TRUE
+//	                                         3 days after the previous one
+//	                                         was completed
+//
+// Except for rules after completion, the next occurrence is due on the next
+// date matching the rule after the due date of the previous one.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Weekdays are the BYDAY of weekly rules. Without them, a weekly rule
+	// repeats on the weekday of the previous occurrence.
+	Weekdays []time.Weekday
+	// MonthDay is the BYMONTHDAY of monthly rules, from 1 to 31, and falls
+	// on the last day of shorter months. Without it, a monthly rule repeats
+	// on the day of the month of the previous occurrence.
+	MonthDay int
+	// AfterCompletion is set for daily rules that count from the day the
+	// previous occurrence was completed, rather than from its due date.
+	AfterCompletion bool
+}
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Parse returns the Rule written in the given string, with or without the
+// "RRULE:" prefix, and an error if it's outside the supported subset.
+func Parse(s string) (Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, errors.New("recurrence rule is empty")
+	}
+	rule := Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("recurrence rule part %q must be NAME=VALUE", part)
+		}
+		if seen[name] {
+			return Rule{}, fmt.Errorf("recurrence rule has %s more than once", name)
+		}
+		seen[name] = true
+		switch name {
+		case "FREQ":
+			rule.Freq = Frequency(strings.ToUpper(value))
+			if rule.Freq != Daily && rule.Freq != Weekly && rule.Freq != Monthly {
+				return Rule{}, fmt.Errorf("recurrence frequency %q isn't supported", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MaxInterval {
+				return Rule{}, fmt.Errorf("recurrence interval must be between 1 and %d", MaxInterval)
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := ParseWeekday(code)
+				if !ok {
+					return Rule{}, fmt.Errorf("recurrence weekday %q isn't valid", code)
+				}
+				rule.Weekdays = append(rule.Weekdays, day)
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 31 {
+				return Rule{}, errors.New("recurrence day of the month must be between 1 and 31")
+			}
+			rule.MonthDay = n
+		case "X-AFTER-COMPLETION":
+			rule.AfterCompletion = strings.ToUpper(value) == "TRUE"
+		default:
+			return Rule{}, fmt.Errorf("recurrence rule part %s isn't supported", name)
+		}
+	}
+	if rule.Freq == "" {
+		return Rule{}, errors.New("recurrence rule must have a FREQ")
+	}
+	if len(rule.Weekdays) > 0 && rule.Freq != Weekly {
+		return Rule{}, errors.New("recurrence weekdays are only supported on weekly rules")
+	}
+	if rule.MonthDay != 0 && rule.Freq != Monthly {
+		return Rule{}, errors.New("recurrence day of the month is only supported on monthly rules")
+	}
+	if rule.AfterCompletion && rule.Freq != Daily {
+		return Rule{}, errors.New("recurrence after completion is only supported on daily rules")
+	}
+	return rule, nil
+}
+
+// String returns the rule written as an RRULE value, without the "RRULE:"
+// prefix, in the canonical form stored in the database.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.Weekdays) > 0 {
+		codes := []string{}
+		for _, day := range sortedWeekdays(r.Weekdays) {
+			codes = append(codes, weekdayCodes[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.MonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", r.MonthDay))
+	}
+	if r.AfterCompletion {
+		parts = append(parts, "X-AFTER-COMPLETION=TRUE")
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describe returns the rule in words, e.g. "Every 2 weeks on Mon, Fri".
+func (r Rule) Describe() string {
+	var every string
+	switch r.Freq {
+	case Daily:
+		every = plural(r.Interval, "day")
+	case Weekly:
+		every = plural(r.Interval, "week")
+	case Monthly:
+		every = plural(r.Interval, "month")
+	}
+	s := "Every " + every
+	if len(r.Weekdays) > 0 {
+		names := []string{}
+		for _, day := range sortedWeekdays(r.Weekdays) {
+			names = append(names, day.String()[:3])
+		}
+		s += " on " + strings.Join(names, ", ")
+	}
+	if r.MonthDay != 0 {
+		s += fmt.Sprintf(" on day %d", r.MonthDay)
+	}
+	if r.AfterCompletion {
+		s += " after completion"
+	}
+	return s
+}
+
+// Next returns the date of the occurrence after the one on the given date,
+// which is the due date of the previous occurrence, or the day it was
+// completed for rules after completion.
+//
+// Dates are compared in UTC, and the returned time is at midnight UTC.
+func (r Rule) Next(previous time.Time) time.Time {
+	d := date(previous)
+	interval := max(r.Interval, 1)
+	switch r.Freq {
+	case Weekly:
+		weekdays := r.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{d.Weekday()}
+		}
+		// weeks start on Monday, as they do in RFC 5545 by default
+		offset := (int(d.Weekday()) + 6) % 7
+		monday := d.AddDate(0, 0, -offset)
+		for i := offset + 1; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if hasWeekday(weekdays, day.Weekday()) {
+				return day
+			}
+		}
+		monday = monday.AddDate(0, 0, 7*interval)
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if hasWeekday(weekdays, day.Weekday()) {
+				return day
+			}
+		}
+		return monday
+	case Monthly:
+		monthDay := r.MonthDay
+		if monthDay == 0 {
+			monthDay = d.Day()
+		}
+		// the previous occurrence may be earlier in the month than the
+		// rule, e.g. when the rule was just changed
+		if day := onMonthDay(d.Year(), d.Month(), monthDay); day.After(d) {
+			return day
+		}
+		return onMonthDay(d.Year(), d.Month()+time.Month(interval), monthDay)
+	default:
+		return d.AddDate(0, 0, interval)
+	}
+}
+
+// After returns the date of the first occurrence after the one on the given
+// date that isn't before today, skipping the occurrences that were missed.
+func (r Rule) After(previous time.Time, today time.Time) time.Time {
+	next := r.Next(previous)
+	today = date(today)
+	for next.Before(today) {
+		next = r.Next(next)
+	}
+	return next
+}
+
+// date returns the given time truncated to midnight UTC of the same date.
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// onMonthDay returns the given day of the given month, or the last day of
+// the month if it's shorter. The month may overflow into the next years.
+func onMonthDay(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// ParseWeekday returns the weekday of the given BYDAY code, e.g. "MO", and
+// false if it isn't one.
+func ParseWeekday(code string) (time.Weekday, bool) {
+	for i, c := range weekdayCodes {
+		if strings.EqualFold(code, c) {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+// WeekdayCode returns the BYDAY code of the given weekday, e.g. "MO".
+func WeekdayCode(day time.Weekday) string {
+	return weekdayCodes[day]
+}
+
+func hasWeekday(weekdays []time.Weekday, day time.Weekday) bool {
+	for _, d := range weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedWeekdays returns the given weekdays without duplicates, from Monday
+// to Sunday.
+func sortedWeekdays(weekdays []time.Weekday) []time.Weekday {
+	sorted := []time.Weekday{}
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		if hasWeekday(weekdays, day) {
+			sorted = append(sorted, day)
+		}
+	}
+	return sorted
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
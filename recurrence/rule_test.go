@@ -0,0 +1,134 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		want     string
+		describe string
+	}{
+		{"daily", "FREQ=DAILY", "FREQ=DAILY", "Every day"},
+		{"default interval is dropped", "FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", "Every day"},
+		{"prefix and lowercase", "RRULE:freq=weekly;byday=fr,mo", "FREQ=WEEKLY;BYDAY=MO,FR", "Every week on Mon, Fri"},
+		{"weekly with interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,WE,WE", "FREQ=WEEKLY;INTERVAL=2;BYDAY=WE,SU", "Every 2 weeks on Wed, Sun"},
+		{"monthly", "FREQ=MONTHLY;BYMONTHDAY=15", "FREQ=MONTHLY;BYMONTHDAY=15", "Every month on day 15"},
+		{"after completion", "FREQ=DAILY;INTERVAL=3;X-AFTER-COMPLETION=TRUE", "FREQ=DAILY;INTERVAL=3;X-AFTER-COMPLETION=TRUE", "Every 3 days after completion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			assert := assert.New(t)
+			assert.Nil(err)
+			assert.Equal(tt.want, rule.String())
+			assert.Equal(tt.describe, rule.Describe())
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"empty", ""},
+		{"only prefix", "RRULE:"},
+		{"missing value", "FREQ"},
+		{"missing freq", "INTERVAL=2"},
+		{"unsupported freq", "FREQ=YEARLY"},
+		{"unsupported part", "FREQ=DAILY;COUNT=3"},
+		{"repeated part", "FREQ=DAILY;FREQ=WEEKLY"},
+		{"zero interval", "FREQ=DAILY;INTERVAL=0"},
+		{"interval too large", "FREQ=DAILY;INTERVAL=366"},
+		{"interval not a number", "FREQ=DAILY;INTERVAL=two"},
+		{"invalid weekday", "FREQ=WEEKLY;BYDAY=XX"},
+		{"weekdays on daily rule", "FREQ=DAILY;BYDAY=MO"},
+		{"day of the month too large", "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{"day of the month on weekly rule", "FREQ=WEEKLY;BYMONTHDAY=1"},
+		{"after completion on weekly rule", "FREQ=WEEKLY;X-AFTER-COMPLETION=TRUE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.rule)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2026-03-02 is a Monday
+	tests := []struct {
+		name     string
+		rule     string
+		previous string
+		want     string
+	}{
+		{"daily", "FREQ=DAILY", "2026-03-01", "2026-03-02"},
+		{"daily with interval", "FREQ=DAILY;INTERVAL=2", "2026-02-28", "2026-03-02"},
+		{"weekly on the same weekday", "FREQ=WEEKLY", "2026-03-01", "2026-03-08"},
+		{"weekly later in the week", "FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-03-02", "2026-03-04"},
+		{"weekly in the next week", "FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-03-06", "2026-03-09"},
+		{"weekly with interval skips weeks", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2026-03-06", "2026-03-16"},
+		{"weekly with interval in the same week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2026-03-02", "2026-03-06"},
+		{"monthly on the same day", "FREQ=MONTHLY", "2026-03-10", "2026-04-10"},
+		{"monthly with interval", "FREQ=MONTHLY;INTERVAL=3", "2026-03-10", "2026-06-10"},
+		{"monthly across years", "FREQ=MONTHLY", "2026-12-15", "2027-01-15"},
+		{"monthly later in the month", "FREQ=MONTHLY;BYMONTHDAY=15", "2026-03-01", "2026-03-15"},
+		{"monthly on the last day of shorter months", "FREQ=MONTHLY;BYMONTHDAY=31", "2026-01-31", "2026-02-28"},
+		{"monthly back on the day after shorter months", "FREQ=MONTHLY;BYMONTHDAY=31", "2026-02-28", "2026-03-31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, day(tt.want), rule.Next(day(tt.previous)))
+		})
+	}
+}
+
+func TestNextTruncatesTime(t *testing.T) {
+	rule, _ := Parse("FREQ=DAILY")
+	previous := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	assert.Equal(t, day("2026-03-02"), rule.Next(previous))
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		previous string
+		today    string
+		want     string
+	}{
+		{"next isn't missed", "FREQ=DAILY", "2026-03-01", "2026-03-01", "2026-03-02"},
+		{"missed days are skipped", "FREQ=DAILY", "2026-03-01", "2026-03-10", "2026-03-10"},
+		{"missed days with interval", "FREQ=DAILY;INTERVAL=3", "2026-03-01", "2026-03-09", "2026-03-10"},
+		{"missed weeks", "FREQ=WEEKLY;INTERVAL=2", "2026-03-02", "2026-03-17", "2026-03-30"},
+		{"missed months", "FREQ=MONTHLY;BYMONTHDAY=31", "2026-01-31", "2026-04-01", "2026-04-30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, day(tt.want), rule.After(day(tt.previous), day(tt.today)))
+		})
+	}
+}
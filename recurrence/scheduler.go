@@ -0,0 +1,154 @@
+package recurrence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// batchSize is the number of due tasks locked by each transaction of
+// RunOnce.
+const batchSize = 100
+
+// Recur creates the next occurrence of the given task inside the given
+// transaction, and reports false if it has no recurrence rule or its next
+// occurrence was already created.
+//
+// The occurrence is due on the first date matching the rule that isn't
+// before now, counting from the due date of the task, or from now if the
+// task has no due date or the rule is after completion.
+func Recur(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	tasks *database.TaskService,
+	task database.Task,
+	now time.Time,
+) (database.Task, bool, error) {
+	if !task.Recurrence.Valid || task.RecurredAt.Valid {
+		return database.Task{}, false, nil
+	}
+	rule, err := Parse(task.Recurrence.String)
+	if err != nil {
+		return database.Task{}, false, err
+	}
+	previous := now
+	if task.DueDate.Valid && !rule.AfterCompletion {
+		previous = task.DueDate.Time
+	}
+	dueDate := pgtype.Date{Time: rule.After(previous, now), Valid: true}
+	next, err := tasks.RecurWithTx(ctx, tx, task.ID, dueDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Task{}, false, nil
+	}
+	if err != nil {
+		return database.Task{}, false, err
+	}
+	return next, true, nil
+}
+
+// A Scheduler creates the next occurrence of recurring tasks once their due
+// date is reached.
+//
+// It's safe to run a Scheduler on every instance of the app, since due tasks
+// are locked while their occurrence is created, and skipped by the other
+// instances.
+type Scheduler struct {
+	db       *sqlx.DB
+	tasks    *database.TaskService
+	interval time.Duration
+}
+
+// NewScheduler returns a pointer to Scheduler, which looks for due tasks
+// every given interval.
+func NewScheduler(db *sqlx.DB, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		tasks:    database.NewTaskService(db),
+		interval: interval,
+	}
+}
+
+// Run calls RunOnce right away and then every interval, until the given
+// context is done. Errors are logged, and the next run tries again.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.RunOnce(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "recurring tasks failed", "error", err)
+		}
+		if n > 0 {
+			slog.InfoContext(ctx, "recurring tasks created", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce creates the next occurrence of every recurring task due on or
+// before the date of the given time, and returns the number of occurrences
+// created.
+//
+// Tasks are processed in batches, each inside its own transaction.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		n, more, err := s.runBatch(ctx, now)
+		total += n
+		if err != nil || !more {
+			return total, err
+		}
+	}
+}
+
+// runBatch creates the next occurrences of a batch of due tasks, and reports
+// whether there may be more due tasks.
+func (s *Scheduler) runBatch(ctx context.Context, now time.Time) (int, bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+	today := pgtype.Date{Time: date(now), Valid: true}
+	due, err := s.tasks.GetAllRecurringDueWithTx(ctx, tx, today, batchSize)
+	if err != nil {
+		return 0, false, err
+	}
+	n := 0
+	for _, task := range due {
+		// rules are validated when saved, so an invalid rule shouldn't
+		// stop the occurrences of other tasks from being created, and
+		// is removed so that the task isn't due again on the next batch
+		_, err := Parse(task.Recurrence.String)
+		if err != nil {
+			slog.WarnContext(ctx, "removing invalid rule of recurring task", "task_id", task.ID, "rule", task.Recurrence.String, "error", err)
+			err = s.tasks.ClearRecurrenceWithTx(ctx, tx, task.ID)
+			if err != nil {
+				return 0, false, err
+			}
+			continue
+		}
+		_, ok, err := Recur(ctx, tx, s.tasks, task, now)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			n++
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, false, err
+	}
+	return n, len(due) == batchSize, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/recurrence"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestRecurrence(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("edit form saves a weekly rule", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Task 1"},
+				test.FormValue{Key: "due_date", Value: "2026-10-19"},
+				test.FormValue{Key: "repeat", Value: "weekly"},
+				test.FormValue{Key: "interval", Value: "1"},
+				test.FormValue{Key: "weekdays", Value: "MO"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(204, res.StatusCode)
+		var rule string
+		handler.DB.Get(&rule, "select recurrence from tasks where id = 1")
+		assert.Equal("FREQ=WEEKLY;BYDAY=MO", rule)
+	})
+
+	t.Run("edit form rejects invalid rules", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Task 1"},
+				test.FormValue{Key: "repeat", Value: "monthly"},
+				test.FormValue{Key: "interval", Value: "1"},
+				test.FormValue{Key: "month_day", Value: "32"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		form := test.NewForm(doc, "task-form")
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("must be between 1 and 31", form.MustGetFieldByID("month_day").Error)
+	})
+
+	t.Run("completing an occurrence creates the next one once", func(t *testing.T) {
+		complete := func(status string) {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+				test.WithAuthentication(test.Authenticated, cookie),
+				test.WithMethod(test.Patch),
+				test.WithFormValues(
+					test.FormValue{Key: "title", Value: "Task 1"},
+					test.FormValue{Key: "due_date", Value: "2026-10-19"},
+					test.FormValue{Key: "status", Value: status},
+				),
+			)
+			test.Do(req)
+		}
+		complete("done")
+		complete("todo")
+		complete("done")
+		var dueDates []time.Time
+		handler.DB.Select(&dueDates, "select due_date from tasks where title = 'Task 1' and id <> 1")
+		assert := assert.New(t)
+		assert.Len(dueDates, 1)
+		if len(dueDates) == 1 {
+			// the next monday after the due date, or later if it's already past
+			next := time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)
+			assert.False(dueDates[0].Before(next))
+			assert.Equal(time.Monday, dueDates[0].Weekday())
+		}
+	})
+
+	t.Run("scheduler creates occurrences of due tasks once", func(t *testing.T) {
+		_, err := handler.DB.Exec(`
+			update tasks set recurrence = 'FREQ=DAILY;INTERVAL=2', due_date = '2026-03-01' where id = 2;
+			update tasks set recurrence = 'FREQ=DAILY;INTERVAL=2;X-AFTER-COMPLETION=TRUE', due_date = '2026-03-01' where id = 3;
+			update tasks set recurrence = 'FREQ=DAILY', due_date = '2026-03-05' where id = 4;
+		`)
+		if err != nil {
+			t.Errorf("error preparing recurring tasks %s", err)
+			return
+		}
+		now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		// run two schedulers at once, as two instances of the app would
+		var wg sync.WaitGroup
+		counts := make([]int, 2)
+		for i := range counts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				n, err := recurrence.NewScheduler(handler.DB, time.Minute).RunOnce(context.Background(), now)
+				assert.Nil(t, err)
+				counts[i] = n
+			}(i)
+		}
+		wg.Wait()
+		assert := assert.New(t)
+		assert.Equal(1, counts[0]+counts[1])
+		var dueDate time.Time
+		handler.DB.Get(&dueDate, "select due_date from tasks where title = 'Task 2' and id <> 2")
+		assert.Equal("2026-03-03", dueDate.Format(time.DateOnly))
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where title in ('Task 3', 'Task 4')")
+		assert.Equal(2, count)
+
+		n, err := recurrence.NewScheduler(handler.DB, time.Minute).RunOnce(context.Background(), now)
+		assert.Nil(err)
+		assert.Equal(0, n)
+	})
+
+	t.Run("scheduler removes invalid rules", func(t *testing.T) {
+		_, err := handler.DB.Exec("update tasks set recurrence = 'FREQ=SOMETIMES', due_date = '2026-03-01' where id = 5")
+		if err != nil {
+			t.Errorf("error preparing recurring tasks %s", err)
+			return
+		}
+		now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		n, err := recurrence.NewScheduler(handler.DB, time.Minute).RunOnce(context.Background(), now)
+		assert := assert.New(t)
+		assert.Nil(err)
+		assert.Equal(0, n)
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where title = 'Task 5' and recurrence is null")
+		assert.Equal(1, count)
+
+		// the task isn't due again on the next batch
+		n, err = recurrence.NewScheduler(handler.DB, time.Minute).RunOnce(context.Background(), now)
+		assert.Nil(err)
+		assert.Equal(0, n)
+	})
+
+	t.Run("scheduler copies milestones", func(t *testing.T) {
+		_, err := handler.DB.Exec(`
+			insert into milestones (project_id, name, target_date) values (3, 'Launch', '2026-04-01');
+			update tasks set recurrence = 'FREQ=WEEKLY', due_date = '2026-03-01', milestone_id = (select id from milestones where name = 'Launch') where id = 6;
+		`)
+		if err != nil {
+			t.Errorf("error preparing recurring tasks %s", err)
+			return
+		}
+		now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		n, err := recurrence.NewScheduler(handler.DB, time.Minute).RunOnce(context.Background(), now)
+		assert := assert.New(t)
+		assert.Nil(err)
+		assert.Equal(1, n)
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where title = 'Task 6' and id <> 6 and milestone_id = (select id from milestones where name = 'Launch')")
+		assert.Equal(1, count)
+	})
+}
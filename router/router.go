@@ -2,15 +2,25 @@ package router
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/csrf"
+	"github.com/webdevfuel/projectmotor/api"
 	"github.com/webdevfuel/projectmotor/auth"
 	"github.com/webdevfuel/projectmotor/handler"
+	"github.com/webdevfuel/projectmotor/logging"
+	"github.com/webdevfuel/projectmotor/metrics"
+	"github.com/webdevfuel/projectmotor/tracing"
 )
 
 // NewRouter returns a new chi.Mux router with all of the default middleware.
@@ -21,17 +31,46 @@ func NewRouter(h *handler.Handler) *chi.Mux {
 		log.Fatal("CSRF_AUTH_KEY must be present")
 	}
 	csrfMiddleware := csrf.Protect([]byte(csrfAuthKey))
+	r.Use(requestCtx)
+	r.Use(tracing.Middleware)
+	r.Use(requestLogger)
+	r.Use(metrics.Middleware)
+	r.Use(skipCSRF("/github/", api.Prefix+"/"))
 	r.Use(csrfMiddleware)
-	r.Use(middleware.Logger)
 	fs := http.FileServer(http.Dir("./static"))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
+	r.Get("/metrics", h.Metrics)
 	r.Get("/login", h.Login)
 	r.Get("/oauth/github/login", h.OAuthGitHubLogin)
 	r.Get("/oauth/github/callback", h.OAuthGitHubCallback)
+	r.Get("/calendar/{token}/tasks.ics", h.UserCalendar)
+	r.Get("/calendar/{token}/projects/{id}/tasks.ics", h.ProjectCalendar)
+	r.Get("/p/{token}", h.PublicProjectPage)
+	r.Post("/github/projects/{id}/webhook", h.GitHubWebhook)
+	r.Route(api.Prefix, apiRouter(h))
 	r.Group(protectedRouter(h))
 	return r
 }
 
+// Router of the API
+//
+// Add routes here that reply with JSON to requests authenticated with an
+// API token
+func apiRouter(h *handler.Handler) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(apiCtx(h))
+		r.Get("/projects", h.APIGetProjects)
+		r.Post("/projects", h.APICreateProject)
+		r.Post("/projects/{id}/share", h.APIShareProject)
+		r.Get("/tasks", h.APIGetTasks)
+		r.Post("/tasks", h.APICreateTask)
+		r.Get("/tasks/{id}", h.APIGetTask)
+		r.Patch("/tasks/{id}", h.APIUpdateTask)
+	}
+}
+
 // Router with user ensured
 //
 // Add routes here where user has to be logged in
@@ -43,11 +82,41 @@ func protectedRouter(h *handler.Handler) func(chi.Router) {
 		r.Get("/projects", h.GetProjects)
 		r.Post("/projects", h.CreateProject)
 		r.Get("/projects/new", h.NewProject)
+		r.Get("/projects/import", h.ImportProject)
+		r.Post("/projects/import", h.UploadProjectImport)
+		r.Post("/projects/import/preview", h.PreviewProjectImport)
+		r.Post("/projects/import/commit", h.CommitProjectImport)
 		r.Get("/projects/{id}/edit", h.EditProject)
 		r.Patch("/projects/{id}/toggle", h.ToggleProjectPublished)
+		r.Patch("/projects/{id}/archive", h.ArchiveProject)
+		r.Patch("/projects/{id}/restore", h.RestoreProject)
 		r.Patch("/projects/{id}", h.UpdateProject)
 		r.Delete("/projects/{id}", h.DeleteProject)
 		r.Get("/projects/{id}/share", h.ShareProject)
+		r.Get("/projects/{id}/export", h.ExportProject)
+		r.Post("/projects/{id}/duplicate", h.DuplicateProject)
+		r.Post("/projects/{id}/template", h.SaveProjectAsTemplate)
+		r.Get("/projects/{id}/milestones", h.ProjectMilestones)
+		r.Post("/projects/{id}/milestones", h.CreateMilestone)
+		r.Delete("/milestones/{id}", h.DeleteMilestone)
+		r.Get("/projects/{id}/page", h.ProjectPage)
+		r.Post("/projects/{id}/page", h.UpdateProjectPage)
+		r.Post("/projects/{id}/page/token", h.RegenerateProjectPageToken)
+		r.Get("/projects/{id}/webhooks", h.ProjectWebhooks)
+		r.Post("/projects/{id}/webhooks", h.CreateWebhook)
+		r.Get("/projects/{id}/webhooks/deliveries", h.ProjectWebhookDeliveries)
+		r.Delete("/webhooks/{id}", h.DeleteWebhook)
+		r.Post("/webhooks/deliveries/{id}/redeliver", h.RedeliverWebhook)
+		r.Get("/projects/{id}/github", h.ProjectGitHub)
+		r.Post("/projects/{id}/github", h.LinkGitHubRepo)
+		r.Get("/projects/{id}/github/authorize", h.AuthorizeGitHubRepo)
+		r.Delete("/projects/{id}/github", h.UnlinkGitHubRepo)
+		r.Post("/projects/{id}/github/import", h.ImportGitHubIssues)
+		r.Post("/projects/{id}/github/settings", h.UpdateGitHubSettings)
+		r.Post("/projects/{id}/transfer", h.TransferProject)
+		r.Delete("/projects/{id}/transfer", h.CancelProjectTransfer)
+		r.Post("/project-transfers/{id}/accept", h.AcceptProjectTransfer)
+		r.Post("/project-transfers/{id}/decline", h.DeclineProjectTransfer)
 		r.Post("/projects/{id}/share", handler.ErrorWrapper(h.ShareProjectByEmail))
 		r.Delete("/projects/{projectId}/share/{userId}", handler.ErrorWrapper(h.RevokeProjectById))
 		r.Get("/tasks/new", h.NewTask)
@@ -56,11 +125,66 @@ func protectedRouter(h *handler.Handler) func(chi.Router) {
 		r.Get("/tasks/{id}/edit", h.EditTask)
 		r.Patch("/tasks/{id}", h.UpdateTask)
 		r.Get("/tasks/{id}", h.GetTask)
+		r.Delete("/tasks/{id}", h.DeleteTask)
+		r.Post("/tasks/{id}/attachments", h.UploadAttachment)
+		r.Get("/attachments/{id}", h.DownloadAttachment)
+		r.Get("/attachments/{id}/thumbnail", h.GetAttachmentThumbnail)
+		r.Delete("/attachments/{id}", h.DeleteAttachment)
+		r.Post("/tasks/{id}/timer", h.StartTimer)
+		r.Get("/tasks/{id}/time", h.GetTaskTime)
+		r.Post("/tasks/{id}/time", h.CreateTimeEntry)
+		r.Get("/timer", h.GetTimer)
+		r.Delete("/timer", h.StopTimer)
+		r.Get("/time", h.TimeReport)
+		r.Get("/time/export", h.ExportTime)
+		r.Delete("/time/{id}", h.DeleteTimeEntry)
+		r.Post("/markdown/preview", h.PreviewMarkdown)
+		r.Get("/workspaces/switcher", h.WorkspaceSwitcher)
+		r.Post("/workspaces/switch", h.SwitchWorkspace)
+		r.Get("/workspaces/new", h.NewWorkspace)
+		r.Post("/workspaces", h.CreateWorkspace)
+		r.Get("/workspaces/{id}", h.Workspace)
+		r.Patch("/workspaces/{id}", h.UpdateWorkspace)
+		r.Delete("/workspaces/{id}", h.DeleteWorkspace)
+		r.Post("/workspaces/{id}/members", h.AddWorkspaceMember)
+		r.Patch("/workspaces/{id}/members/{userId}", h.SetWorkspaceMemberRole)
+		r.Delete("/workspaces/{id}/members/{userId}", h.RemoveWorkspaceMember)
 		r.Get("/profile", h.Profile)
+		r.Post("/profile", h.UpdateProfile)
+		r.Post("/profile/avatar", h.UploadAvatar)
+		r.Delete("/profile/avatar", h.DeleteAvatar)
+		r.Get("/users/{id}/avatar", h.GetAvatar)
+		r.Post("/profile/calendar", handler.ErrorWrapper(h.RegenerateCalendarToken))
+		r.Post("/profile/tokens", h.CreateAPIToken)
+		r.Delete("/profile/tokens/{id}", h.DeleteAPIToken)
+		r.Get("/profile/exports", h.GetDataExports)
+		r.Post("/profile/exports", h.CreateDataExport)
+		r.Get("/profile/exports/{id}", h.DownloadDataExport)
+		r.Post("/profile/delete", h.ScheduleAccountDeletion)
+		r.Delete("/profile/delete", h.CancelAccountDeletion)
+		r.Route("/admin", adminRouter(h))
 		r.Get("/", h.Dashboard)
 	}
 }
 
+// Router with admin ensured
+//
+// Add routes here where user has to be an admin, which see and manage the
+// accounts and projects of every user
+func adminRouter(h *handler.Handler) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(adminCtx(h))
+		r.Get("/", h.Admin)
+		r.Get("/users", h.AdminUsers)
+		r.Post("/users/{id}/suspend", h.SuspendUser)
+		r.Post("/users/{id}/unsuspend", h.UnsuspendUser)
+		r.Get("/projects", h.AdminProjects)
+		r.Post("/projects/{id}/transfer", h.AdminTransferProject)
+		r.Get("/sessions", h.AdminSessions)
+		r.Delete("/sessions/{id}", h.AdminDeleteSession)
+	}
+}
+
 // Redirect to public auth route
 //
 // Use this when session user doesn't exist
@@ -91,14 +215,162 @@ func protectedCtx(h *handler.Handler) func(next http.Handler) http.Handler {
 				redirectToLogin(w, r)
 				return
 			}
-			user, err := h.UserService.GetUserBySessionToken(tokenStr)
+			user, err := h.UserService.GetUserBySessionToken(r.Context(), tokenStr)
 			if err != nil {
 				redirectToLogin(w, r)
 				return
 			}
+			// suspended users have no sessions, but one may have been
+			// created while they were being suspended
+			if user.Suspended() {
+				redirectToLogin(w, r)
+				return
+			}
+			logging.SetUserID(r.Context(), user.ID)
+			ctx := context.WithValue(r.Context(), auth.UserKey{}, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Admin context
+//
+// Middleware checks if the user within the request context is an admin,
+// and replies with a 404 otherwise, so that the admin area isn't revealed
+func adminCtx(h *handler.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user := h.GetUserFromContext(r.Context())
+			if !user.IsAdmin {
+				h.Error(w, r, errors.New("user isn't an admin"), http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// API context
+//
+// Middleware checks the API token sent as "Authorization: Bearer <token>",
+// and sets its user within the request context
+func apiCtx(h *handler.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				h.JSONError(w, r, errors.New("missing api token"), http.StatusUnauthorized, "Requests must have an API token, sent as \"Authorization: Bearer <token>\".")
+				return
+			}
+			user, found, err := h.UserService.GetUserByAPIToken(r.Context(), auth.HashAPIToken(token))
+			if err != nil {
+				h.JSONError(w, r, err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+			if !found {
+				h.JSONError(w, r, errors.New("unknown api token"), http.StatusUnauthorized, "The API token doesn't exist, or was deleted.")
+				return
+			}
+			if user.Suspended() {
+				h.JSONError(w, r, errors.New("suspended user"), http.StatusForbidden, "The account of the API token is suspended.")
+				return
+			}
+			logging.SetUserID(r.Context(), user.ID)
 			ctx := context.WithValue(r.Context(), auth.UserKey{}, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
+
+// Skip CSRF
+//
+// Middleware lets requests under the given path prefixes through the CSRF
+// middleware, for webhooks that are verified with their signature, and API
+// requests that are authenticated with a token instead of a cookie
+func skipCSRF(prefixes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					r = csrf.UnsafeSkipCheck(r)
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Request context
+//
+// Middleware sets a request id and a request-scoped logger within the
+// request context, and echoes the request id as a response header
+//
+// An incoming "X-Request-Id" header is reused so that ids can be correlated
+// with a proxy in front of the app
+func requestCtx(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", id)
+		ctx := logging.WithRequestID(r.Context(), id)
+		logger := slog.Default().With("method", r.Method, "path", r.URL.Path)
+		ctx = logging.WithLogger(ctx, logger)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Request logger
+//
+// Middleware logs a line for every request after it's served, with the
+// status code, bytes written and duration
+func requestLogger(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			status := ww.Status()
+			// handlers that never write the header respond with 200
+			if status == 0 {
+				status = http.StatusOK
+			}
+			logging.FromContext(r.Context()).InfoContext(
+				r.Context(),
+				"request served",
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}()
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c == '-' || c == '_' || c == '.' || c == '/' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+// Package signature signs the bodies of webhook deliveries with HMAC-SHA256,
+// in the "sha256=<hex>" format of the signature headers of both GitHub and
+// ProjectMotor webhooks.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Tolerance is how far the timestamp of a delivery may be from the time it's
+// verified at, before VerifyTimestamped rejects it as stale.
+const Tolerance = 5 * time.Minute
+
+// Sign returns the signature of the given body with the given secret, e.g.
+// "sha256=1f2e...".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the given signature is the signature of the given
+// body with the given secret, comparing them in constant time.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// SignTimestamped returns the signature of the given timestamp, in seconds
+// since the Unix epoch, and body with the given secret, i.e. the signature of
+// "<timestamp>.<body>", so that a captured delivery can't be replayed later
+// on with another timestamp.
+func SignTimestamped(secret string, timestamp int64, body []byte) string {
+	return Sign(secret, timestamped(timestamp, body))
+}
+
+// VerifyTimestamped reports whether the given signature is the signature of
+// the given timestamp and body with the given secret, as returned by
+// SignTimestamped, and the timestamp is within Tolerance of now.
+func VerifyTimestamped(secret string, timestamp string, body []byte, signature string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > Tolerance || age < -Tolerance {
+		return false
+	}
+	return Verify(secret, timestamped(seconds, body), signature)
+}
+
+func timestamped(timestamp int64, body []byte) []byte {
+	b := strconv.AppendInt(nil, timestamp, 10)
+	b = append(b, '.')
+	return append(b, body...)
+}
@@ -0,0 +1,85 @@
+package signature
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	// the example of the GitHub documentation on validating deliveries
+	got := Sign("It's a Secret to Everybody", []byte("Hello, World!"))
+	assert.Equal(t, "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", got)
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"task.created"}`)
+	signature := Sign("secret", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"matching signature", "secret", body, signature, true},
+		{"other secret", "other", body, signature, false},
+		{"other body", "secret", []byte(`{"event":"task.deleted"}`), signature, false},
+		{"missing prefix", "secret", body, signature[len("sha256="):], false},
+		{"uppercase hex", "secret", body, "sha256=" + upper(signature[len("sha256="):]), false},
+		{"empty signature", "secret", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Verify(tt.secret, tt.body, tt.signature))
+		})
+	}
+}
+
+func TestSignTimestamped(t *testing.T) {
+	body := []byte(`{"event":"task.created"}`)
+	assert.Equal(t, Sign("secret", []byte(`1700000000.{"event":"task.created"}`)), SignTimestamped("secret", 1700000000, body))
+}
+
+func TestVerifyTimestamped(t *testing.T) {
+	body := []byte(`{"event":"task.created"}`)
+	sent := time.Unix(1700000000, 0)
+	signature := SignTimestamped("secret", sent.Unix(), body)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		body      []byte
+		signature string
+		now       time.Time
+		want      bool
+	}{
+		{"matching signature", "1700000000", body, signature, sent, true},
+		{"within tolerance", "1700000000", body, signature, sent.Add(Tolerance), true},
+		{"clock of the receiver behind", "1700000000", body, signature, sent.Add(-Tolerance), true},
+		{"stale", "1700000000", body, signature, sent.Add(Tolerance + time.Second), false},
+		{"from the future", "1700000000", body, signature, sent.Add(-Tolerance - time.Second), false},
+		{"other timestamp", "1700000060", body, signature, sent, false},
+		{"other body", "1700000000", []byte(`{"event":"task.deleted"}`), signature, sent, false},
+		{"signature of the body alone", "1700000000", body, Sign("secret", body), sent, false},
+		{"invalid timestamp", "yesterday", body, signature, sent, false},
+		{"missing timestamp", "", body, signature, sent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, VerifyTimestamped("secret", tt.timestamp, tt.body, tt.signature, tt.now))
+		})
+	}
+}
+
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'f' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
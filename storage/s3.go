@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Options is a representation of the options that should be passed to
+// an S3 when initialized.
+type S3Options struct {
+	// Endpoint is the base url of the service, e.g. "http://localhost:9000"
+	// for MinIO or "https://s3.eu-central-1.amazonaws.com" for AWS.
+	Endpoint string
+	Bucket   string
+	// Region defaults to "us-east-1", which is also what MinIO expects
+	// unless it's configured otherwise.
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Client defaults to a http.Client with a 30 second timeout.
+	Client *http.Client
+}
+
+// An S3 is a Storage that keeps objects in a bucket of an S3-compatible
+// service.
+//
+// Requests use path-style urls ("{endpoint}/{bucket}/{key}"), which every
+// S3-compatible service supports, and are signed with AWS Signature
+// Version 4.
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3 returns a pointer to S3, and an error if the options are incomplete.
+func NewS3(options S3Options) (*S3, error) {
+	if options.Endpoint == "" || options.Bucket == "" {
+		return nil, errors.New("storage: s3 endpoint and bucket must be set")
+	}
+	if options.AccessKey == "" || options.SecretKey == "" {
+		return nil, errors.New("storage: s3 access key and secret key must be set")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(options.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("storage: s3 endpoint %q must be a http or https url", options.Endpoint)
+	}
+	region := options.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	client := options.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    options.Bucket,
+		region:    region,
+		accessKey: options.AccessKey,
+		secretKey: options.SecretKey,
+		client:    client,
+	}, nil
+}
+
+// Put uploads the object with a PUT request.
+//
+// The body is streamed rather than hashed upfront, so the request is signed
+// with an unsigned payload.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
+
+// Get downloads the object with a GET request.
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	return res.Body, nil
+}
+
+// Delete removes the object with a DELETE request.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return responseError(res)
+	}
+	return nil
+}
+
+func (s *S3) newRequest(ctx context.Context, method string, key string, body io.Reader) (*http.Request, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, fmt.Errorf("storage: invalid key %q", key)
+	}
+	u := *s.endpoint
+	u.Path = fmt.Sprintf("%s/%s/%s", s.endpoint.Path, s.bucket, key)
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// emptyPayload is the hex encoded SHA-256 of an empty body.
+	emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// do signs the request with the given payload hash and sends it.
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to the request.
+//
+// Only the host and "x-amz-*" headers are signed, which is the minimum
+// accepted by S3.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// responseError returns an error with the status and, if the body is an S3
+// error document, the error code and message.
+func responseError(res *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(b, &body) == nil && body.Code != "" {
+		return fmt.Errorf("storage: s3 %s %s: %s: %s", res.Request.Method, res.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("storage: s3 %s %s", res.Request.Method, res.Status)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned by Get when no object exists at the given key.
+var ErrNotFound = errors.New("storage: object not found")
+
+// A Storage keeps the contents of uploaded files, addressed by keys like
+// "tasks/12/2b1f...-original".
+//
+// Keys are generated by the app and only contain letters, digits, dashes,
+// dots and slashes.
+type Storage interface {
+	// Put stores the size bytes read from r at the given key, replacing any
+	// existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the contents stored at the given key, or ErrNotFound.
+	// The caller must close the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object at the given key. Deleting a missing
+	// object isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv returns the Storage configured by the environment variable
+// STORAGE_BACKEND, which is either "local" (the default) or "s3".
+//
+// The local backend writes files under STORAGE_DIR, or "./data/attachments"
+// if it isn't set.
+//
+// The s3 backend works with any S3-compatible service, like MinIO, and reads
+// S3_ENDPOINT, S3_BUCKET, S3_REGION, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY.
+func NewFromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "./data/attachments"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,29 @@
+package shared
+
+import (
+	"context"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/auth"
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// Location returns the time zone of the user within the given context, or
+// UTC if there's no user, e.g. on public pages.
+func Location(ctx context.Context) *time.Location {
+	user, ok := ctx.Value(auth.UserKey{}).(database.User)
+	if !ok {
+		return time.UTC
+	}
+	return user.Location()
+}
+
+// FormatTime returns the given time formatted with the given layout, in the
+// time zone of the user within the given context.
+//
+// Timestamps are stored in UTC, so they must go through FormatTime before
+// they're shown. Dates, like due dates, aren't in any time zone, and are
+// formatted as they are.
+func FormatTime(ctx context.Context, t time.Time, layout string) string {
+	return t.In(Location(ctx)).Format(layout)
+}
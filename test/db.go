@@ -1,35 +1,33 @@
 package test
 
 import (
+	"context"
 	"fmt"
-	"io/fs"
 	"os"
-	"sort"
-	"strings"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/database"
 )
 
 // ResetAndSeedDB returns the first encountered error when dropping and creating all
 // database tables.
 //
-// It looks inside the "database/migrations" directory for all ".down." and ".up."
-// files, and runs all statements separated by the separator "--> statement-breakpoint".
-//
-// It runs "down" migrations in desc order and "up" in asc order.
+// It uses the embedded migrations from the database package, reverting all of
+// them in desc order and applying them again in asc order.
 //
 // It runs all statements inside "database/seeds" directory to seed the
 // database for tests.
 func ResetAndSeedDB(db *sqlx.DB) error {
-	entries, err := os.ReadDir("./database/migrations/")
+	migrator, err := database.NewMigrator(db)
 	if err != nil {
 		return err
 	}
-	err = dropAllTables(entries, db)
+	ctx := context.Background()
+	err = migrator.To(ctx, 0)
 	if err != nil {
 		return err
 	}
-	err = createAllTables(entries, db)
+	err = migrator.Up(ctx)
 	if err != nil {
 		return err
 	}
@@ -40,78 +38,17 @@ func ResetAndSeedDB(db *sqlx.DB) error {
 	return nil
 }
 
-func dropAllTables(entries []fs.DirEntry, db *sqlx.DB) error {
-	files := []string{}
-	for _, entry := range entries {
-		if strings.Contains(entry.Name(), ".down.") {
-			files = append(files, entry.Name())
-		}
-	}
-	sort.Sort(sort.Reverse(sort.StringSlice(files)))
-	for _, file := range files {
-		err := runAllStatements(file, migration, db)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func createAllTables(entries []fs.DirEntry, db *sqlx.DB) error {
-	files := []string{}
-	for _, entry := range entries {
-		if strings.Contains(entry.Name(), ".up.") {
-			files = append(files, entry.Name())
-		}
-	}
-	for _, file := range files {
-		err := runAllStatements(file, migration, db)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func seedAllTables(db *sqlx.DB) error {
 	entries, err := os.ReadDir("./database/seeds/")
 	if err != nil {
 		return err
 	}
 	for _, entry := range entries {
-		err := runAllStatements(entry.Name(), seed, db)
+		b, err := os.ReadFile(fmt.Sprintf("./database/seeds/%s", entry.Name()))
 		if err != nil {
 			return err
 		}
-	}
-	return nil
-}
-
-type statetment int
-
-const (
-	migration statetment = iota
-	seed
-)
-
-func getDirectory(statement statetment) string {
-	if statement == migration {
-		return "migrations"
-	}
-	if statement == seed {
-		return "seeds"
-	}
-	return ""
-}
-
-func runAllStatements(file string, statement statetment, db *sqlx.DB) error {
-	b, err := os.ReadFile(fmt.Sprintf("./database/%s/%s", getDirectory(statement), file))
-	if err != nil {
-		return err
-	}
-	statements := strings.Split(string(b), "--> statement-breakpoint")
-	for _, statement := range statements {
-		_, err = db.Exec(statement)
+		_, err = db.Exec(string(b))
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,328 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/webdevfuel/projectmotor/github"
+	"github.com/webdevfuel/projectmotor/handler"
+	"golang.org/x/oauth2"
+)
+
+// GitHub is a fake of the GitHub API and of its OAuth endpoints, served by
+// an httptest.Server.
+//
+// Users are added with AddUser, and log in with the code they're added with.
+// Repositories are added with AddRepo, and can be seen by every user.
+//
+// An example of usage inside a test:
+//
+//	gh := test.NewGitHub()
+//	defer gh.Close()
+//	gh.AddUser("a-code", test.GitHubUser{ID: 3, Email: "jane@example.com", AccessToken: "a-token"})
+//	handler, server := test.NewServer(test.WithGitHub(gh))
+type GitHub struct {
+	Server *httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]GitHubUser
+	codes    map[string]string
+	repos    map[string][]github.Issue
+	updates  []GitHubIssueUpdate
+	failures []gitHubFailure
+	requests int
+}
+
+// A GitHubUser is a user of the fake GitHub, with the access token handed
+// out when they log in.
+type GitHubUser struct {
+	ID          int32
+	Email       string
+	AccessToken string
+	Name        string
+	AvatarURL   string
+	// Scopes are the scopes granted to the access token, which default to
+	// the ones asked for when logging in.
+	Scopes []string
+}
+
+// A GitHubIssueUpdate is an update of an issue received by the fake GitHub.
+type GitHubIssueUpdate struct {
+	Repo          string
+	Number        int32
+	Authorization string
+	Update        github.IssueUpdate
+}
+
+type gitHubFailure struct {
+	status int
+	header http.Header
+}
+
+// NewGitHub returns a pointer to GitHub, with a started server and neither
+// users nor repositories.
+func NewGitHub() *GitHub {
+	g := &GitHub{
+		users: map[string]GitHubUser{},
+		codes: map[string]string{},
+		repos: map[string][]github.Issue{},
+	}
+	r := chi.NewRouter()
+	r.Post("/login/oauth/access_token", g.accessToken)
+	r.Group(func(r chi.Router) {
+		r.Use(g.fail)
+		r.Get("/user", g.user)
+		r.Get("/user/emails", g.emails)
+		r.Get("/repos/{owner}/{name}", g.repo)
+		r.Get("/repos/{owner}/{name}/issues", g.issues)
+		r.Patch("/repos/{owner}/{name}/issues/{number}", g.updateIssue)
+	})
+	g.Server = httptest.NewServer(r)
+	return g
+}
+
+// Close shuts down the server of the fake GitHub.
+func (g *GitHub) Close() {
+	g.Server.Close()
+}
+
+// API returns a pointer to github.API sending requests to the fake GitHub,
+// which retries failed requests right away.
+func (g *GitHub) API() *github.API {
+	return github.NewAPI(
+		github.WithBaseURL(g.Server.URL),
+		github.WithHTTPClient(g.Server.Client()),
+		github.WithBackoff(time.Millisecond),
+	)
+}
+
+// OAuth2Config returns a oauth2 configuration logging in with the fake
+// GitHub.
+func (g *GitHub) OAuth2Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Scopes:       github.Config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   g.Server.URL + "/login/oauth/authorize",
+			TokenURL:  g.Server.URL + "/login/oauth/access_token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// AddUser adds the given user, who logs in with the given code.
+func (g *GitHub) AddUser(code string, user GitHubUser) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.users[user.AccessToken] = user
+	g.codes[code] = user.AccessToken
+}
+
+// AddRepo adds the repository with the given owner and name, and the given
+// issues, which are pull requests when their PullRequest field is set.
+func (g *GitHub) AddRepo(owner string, name string, issues ...github.Issue) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.repos[owner+"/"+name] = issues
+}
+
+// IssueUpdates returns the updates of issues received so far, in order.
+func (g *GitHub) IssueUpdates() []GitHubIssueUpdate {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]GitHubIssueUpdate{}, g.updates...)
+}
+
+// FailNext makes the next n requests to the API, but not to the OAuth
+// endpoints, fail with the given status and headers.
+func (g *GitHub) FailNext(n int, status int, header http.Header) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := 0; i < n; i++ {
+		g.failures = append(g.failures, gitHubFailure{status: status, header: header})
+	}
+}
+
+// Requests returns the number of requests to the API received so far,
+// including failed ones.
+func (g *GitHub) Requests() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.requests
+}
+
+// WithGitHub returns a function that sets the GitHub API and the oauth2
+// configuration of the given fake GitHub on handler.HandlerOptions.
+func WithGitHub(g *GitHub) func(*handler.HandlerOptions) {
+	return func(o *handler.HandlerOptions) {
+		o.GitHubAPI = g.API()
+		o.GitHubOAuth2Config = g.OAuth2Config()
+	}
+}
+
+func (g *GitHub) fail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		g.requests++
+		var failure *gitHubFailure
+		if len(g.failures) > 0 {
+			failure = &g.failures[0]
+			g.failures = g.failures[1:]
+		}
+		g.mu.Unlock()
+		if failure != nil {
+			for key, values := range failure.header {
+				w.Header()[key] = values
+			}
+			writeGitHubError(w, failure.status, http.StatusText(failure.status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// accessToken exchanges a code for an access token, answering unknown codes
+// with an error the way GitHub does, with a 200 status.
+func (g *GitHub) accessToken(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	token, ok := g.codes[r.FormValue("code")]
+	g.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if !ok || r.FormValue("client_id") == "" {
+		json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+		return
+	}
+	g.mu.Lock()
+	scopes := g.users[token].Scopes
+	g.mu.Unlock()
+	if scopes == nil {
+		scopes = github.Config.Scopes
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": token,
+		"token_type":   "bearer",
+		"scope":        strings.Join(scopes, ","),
+	})
+}
+
+// authenticated returns the user of the access token of the given request,
+// and reports whether there's one.
+func (g *GitHub) authenticated(r *http.Request) (GitHubUser, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	user, ok := g.users[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	return user, ok
+}
+
+func (g *GitHub) user(w http.ResponseWriter, r *http.Request) {
+	user, ok := g.authenticated(r)
+	if !ok {
+		writeGitHubError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	json.NewEncoder(w).Encode(github.User{ID: user.ID, Name: user.Name, AvatarURL: user.AvatarURL})
+}
+
+func (g *GitHub) emails(w http.ResponseWriter, r *http.Request) {
+	user, ok := g.authenticated(r)
+	if !ok {
+		writeGitHubError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	json.NewEncoder(w).Encode([]github.Email{
+		{Email: fmt.Sprintf("%d+noreply@users.github.com", user.ID), Verified: true, Visibility: "private"},
+		{Email: user.Email, Primary: true, Verified: true, Visibility: "public"},
+	})
+}
+
+// getRepo returns the issues of the repository of the given request, and
+// reports whether it exists.
+func (g *GitHub) getRepo(r *http.Request) (string, []github.Issue, bool) {
+	fullName := chi.URLParam(r, "owner") + "/" + chi.URLParam(r, "name")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	issues, ok := g.repos[fullName]
+	return fullName, issues, ok
+}
+
+func (g *GitHub) repo(w http.ResponseWriter, r *http.Request) {
+	fullName, _, ok := g.getRepo(r)
+	if !ok {
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var repo github.Repo
+	repo.Name = chi.URLParam(r, "name")
+	repo.FullName = fullName
+	repo.HTMLURL = "https://github.com/" + fullName
+	repo.Owner.Login = chi.URLParam(r, "owner")
+	json.NewEncoder(w).Encode(repo)
+}
+
+// issues serves the open issues of a repository, one page at a time.
+func (g *GitHub) issues(w http.ResponseWriter, r *http.Request) {
+	_, issues, ok := g.getRepo(r)
+	if !ok {
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	open := []github.Issue{}
+	for _, issue := range issues {
+		if issue.State == "" || issue.State == github.IssueOpen {
+			open = append(open, issue)
+		}
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 30
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	start := min((page-1)*perPage, len(open))
+	end := min(start+perPage, len(open))
+	json.NewEncoder(w).Encode(open[start:end])
+}
+
+func (g *GitHub) updateIssue(w http.ResponseWriter, r *http.Request) {
+	fullName, _, ok := g.getRepo(r)
+	number, err := strconv.ParseInt(chi.URLParam(r, "number"), 10, 32)
+	if !ok || err != nil {
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var update github.IssueUpdate
+	err = json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		writeGitHubError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	g.mu.Lock()
+	g.updates = append(g.updates, GitHubIssueUpdate{
+		Repo:          fullName,
+		Number:        int32(number),
+		Authorization: r.Header.Get("Authorization"),
+		Update:        update,
+	})
+	g.mu.Unlock()
+	json.NewEncoder(w).Encode(github.Issue{
+		Number: int32(number),
+		Title:  update.Title,
+		State:  update.State,
+	})
+}
+
+func writeGitHubError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
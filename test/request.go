@@ -1,7 +1,9 @@
 package test
 
 import (
+	"bytes"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
@@ -108,6 +110,8 @@ func NewRequest(options ...func(*TestRequest)) *http.Request {
 	req := &http.Request{}
 	if tr.IsForm {
 		req, _ = http.NewRequest(tr.Method.Build(), tr.URL, strings.NewReader(tr.UrlValues.Encode()))
+	} else if len(tr.Body) > 0 {
+		req, _ = http.NewRequest(tr.Method.Build(), tr.URL, bytes.NewReader(tr.Body))
 	} else {
 		req, _ = http.NewRequest(tr.Method.Build(), tr.URL, nil)
 	}
@@ -131,6 +135,14 @@ func WithBody(body []byte) func(*TestRequest) {
 	}
 }
 
+// WithHeader returns a function that sets a header
+// on a TestRequest.
+func WithHeader(key string, value string) func(*TestRequest) {
+	return func(r *TestRequest) {
+		r.Header.Set(key, value)
+	}
+}
+
 // WithMethod returns a function that sets the method
 // on a TestRequest.
 func WithMethod(method Method) func(*TestRequest) {
@@ -181,6 +193,22 @@ func WithFormValues(values ...FormValue) func(*TestRequest) {
 	}
 }
 
+// WithFile returns a function that sets the body as a multipart form with
+// a single file, and the matching content-type header, on a TestRequest.
+func WithFile(field string, filename string, content []byte) func(*TestRequest) {
+	return func(r *TestRequest) {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile(field, filename)
+		part.Write(content)
+		writer.Close()
+
+		r.Body = buf.Bytes()
+
+		r.Header.Set("content-type", writer.FormDataContentType())
+	}
+}
+
 // Do makes a request with the default http client and
 // returns the response.
 func Do(req *http.Request) *http.Response {
@@ -188,6 +216,18 @@ func Do(req *http.Request) *http.Response {
 	return response
 }
 
+// DoWithoutRedirect does the same as Do, but returns redirect responses
+// instead of following them, to make assertions on where they redirect to.
+func DoWithoutRedirect(req *http.Request) *http.Response {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	response, _ := client.Do(req)
+	return response
+}
+
 // Body reads the body from the provided response
 // and returns the string value.
 func Body(res *http.Response) string {
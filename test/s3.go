@@ -0,0 +1,90 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// S3AccessKey and S3SecretKey are the credentials accepted by the server
+// returned from NewS3Server.
+const (
+	S3AccessKey = "test-access-key"
+	S3SecretKey = "test-secret-key"
+)
+
+// An S3Server is an in-memory stand-in for an S3-compatible service like
+// MinIO, supporting path-style PUT, GET and DELETE of objects.
+//
+// It rejects requests that aren't signed with S3AccessKey, but doesn't
+// verify signatures.
+type S3Server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewS3Server returns a started S3Server. The caller must call Close when
+// finished.
+func NewS3Server() *S3Server {
+	s := &S3Server{objects: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Object returns the contents of the object at the given path, e.g.
+// "/bucket/key", and whether it exists.
+func (s *S3Server) Object(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.objects[path]
+	return b, ok
+}
+
+// Len returns the number of stored objects.
+func (s *S3Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *S3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	credential := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/", S3AccessKey)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), credential) || r.Header.Get("X-Amz-Date") == "" {
+		s3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied.")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.objects[r.URL.Path] = b
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		b, ok := s.objects[r.URL.Path]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Write(b)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed.")
+	}
+}
+
+func s3Error(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+}
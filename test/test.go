@@ -4,11 +4,13 @@ import (
 	"log"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 
 	"github.com/gorilla/sessions"
 	"github.com/webdevfuel/projectmotor/database"
 	"github.com/webdevfuel/projectmotor/handler"
 	"github.com/webdevfuel/projectmotor/router"
+	"github.com/webdevfuel/projectmotor/storage"
 )
 
 var store *sessions.CookieStore = sessions.NewCookieStore([]byte(os.Getenv("SESSION_KEY")))
@@ -19,15 +21,60 @@ var store *sessions.CookieStore = sessions.NewCookieStore([]byte(os.Getenv("SESS
 //
 // We return the handler to aid with doing assertions on the database, since
 // it's easier than creating abstractions just for testing.
-func NewServer() (*handler.Handler, *httptest.Server) {
+//
+// Attachments are stored in a temporary directory, unless WithStorage is
+// given.
+func NewServer(options ...func(*handler.HandlerOptions)) (*handler.Handler, *httptest.Server) {
 	db, err := database.OpenDB()
 	if err != nil {
 		log.Fatal(err)
 	}
-	h := handler.NewHandler(handler.HandlerOptions{
-		DB:    db,
-		Store: store,
-	})
+	files, err := storage.NewLocal(filepath.Join(os.TempDir(), "projectmotor-test-attachments"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ho := handler.HandlerOptions{
+		DB:      db,
+		Store:   store,
+		Storage: files,
+	}
+	for _, o := range options {
+		o(&ho)
+	}
+	h := handler.NewHandler(ho)
 	r := router.NewRouter(h)
 	return h, httptest.NewServer(r)
 }
+
+// WithStorage returns a function that sets the storage of attachments
+// on handler.HandlerOptions.
+func WithStorage(s storage.Storage) func(*handler.HandlerOptions) {
+	return func(o *handler.HandlerOptions) {
+		o.Storage = s
+	}
+}
+
+// WithPrivateWebhooks returns a function that lets webhooks be subscribed to
+// urls of private addresses on handler.HandlerOptions, such as the ones of
+// httptest servers.
+func WithPrivateWebhooks() func(*handler.HandlerOptions) {
+	return func(o *handler.HandlerOptions) {
+		o.AllowPrivateWebhooks = true
+	}
+}
+
+// WithMetricsToken returns a function that sets the bearer token requests to
+// "/metrics" must send on handler.HandlerOptions.
+func WithMetricsToken(token string) func(*handler.HandlerOptions) {
+	return func(o *handler.HandlerOptions) {
+		o.MetricsToken = token
+	}
+}
+
+// WithPublicURL returns a function that sets the url the app is reached at
+// on handler.HandlerOptions.
+func WithPublicURL(url string) func(*handler.HandlerOptions) {
+	return func(o *handler.HandlerOptions) {
+		o.PublicURL = url
+	}
+}
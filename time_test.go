@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestTime(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("starting a timer stops the running one", func(t *testing.T) {
+		for _, id := range []int{1, 2} {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/tasks/%d/timer", server.URL, id)),
+				test.WithAuthentication(test.Authenticated, cookie),
+				test.WithMethod(test.Post),
+			)
+			res := test.Do(req)
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, "time-changed", res.Header.Get("HX-Trigger"))
+		}
+		var running []int
+		handler.DB.Select(&running, "select task_id from time_entries where user_id = 1 and ended_at is null")
+		assert := assert.New(t)
+		assert.Equal([]int{2}, running)
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "timer")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		doc := test.Doc(test.Do(req))
+		assert.Equal("Task 2", doc.Find("#timer-indicator a").Text())
+	})
+
+	t.Run("stopping the timer ends the entry", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "timer")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		var count int
+		handler.DB.Get(&count, "select count(*) from time_entries where ended_at is null")
+		assert.Equal(0, count)
+
+		res = test.Do(req)
+		assert.Equal(404, res.StatusCode)
+	})
+
+	t.Run("timer can't start on tasks the user can't see", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1/timer")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("manual entry is added to the task", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/time")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "date", Value: "2026-03-02"},
+				test.FormValue{Key: "duration", Value: "1:30"},
+				test.FormValue{Key: "note", Value: "Kickoff call"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("1:30", doc.Find("#task-time-total").Text())
+		assert.Contains(doc.Find("li.time-entry").Text(), "Kickoff call")
+	})
+
+	t.Run("manual entry rejects invalid durations", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/3/time")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "date", Value: "2026-03-02"},
+				test.FormValue{Key: "duration", Value: "25:00"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		form := test.NewForm(doc, "time-entry-form")
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("must be between 1m and 24:00", form.MustGetFieldByID("duration").Error)
+	})
+
+	t.Run("report totals entries per project within the range", func(t *testing.T) {
+		// user 2 tracks time on a task of a project owned by user 1
+		_, err := handler.DB.Exec(`
+			insert into time_entries (task_id, user_id, started_at, ended_at)
+			    values (4, 2, '2026-03-03 09:00', '2026-03-03 11:00'),
+			           (4, 2, '2026-04-01 09:00', '2026-04-01 10:00');
+		`)
+		if err != nil {
+			t.Errorf("error inserting time entries %s", err)
+			return
+		}
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "time/export?from=2026-03-01&to=2026-03-31&group=project")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Get),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+		records, err := csv.NewReader(res.Body).ReadAll()
+		assert.Nil(err)
+		assert.Equal([][]string{
+			{"project", "duration", "hours"},
+			{"Project 2", "3:30", "3.50"},
+		}, records)
+	})
+
+	t.Run("report leaves out entries of others on their own tasks", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "time/export?from=2026-03-01&to=2026-03-31&group=member")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Get),
+		)
+		res := test.Do(req)
+		records, err := csv.NewReader(res.Body).ReadAll()
+		assert := assert.New(t)
+		assert.Nil(err)
+		assert.Equal([][]string{
+			{"member", "duration", "hours"},
+			{"John Doe", "2:00", "2.00"},
+		}, records)
+	})
+
+	t.Run("entries can only be deleted by their user", func(t *testing.T) {
+		var id int
+		handler.DB.Get(&id, "select id from time_entries where note = 'Kickoff call'")
+		url := fmt.Sprintf("%s/time/%d", server.URL, id)
+		req := test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(404, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		var count int
+		handler.DB.Get(&count, "select count(*) from time_entries where note = 'Kickoff call'")
+		assert.Equal(0, count)
+	})
+}
@@ -0,0 +1,205 @@
+package timetrack
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// MaxDuration is the longest duration of a manual entry.
+const MaxDuration = 24 * time.Hour
+
+// An Entry is a time entry as it's reported, with the names of its task,
+// project and member.
+type Entry struct {
+	ID        int32
+	Date      time.Time
+	TaskID    int32
+	Task      string
+	ProjectID int32
+	Project   string
+	MemberID  int32
+	Member    string
+	Duration  time.Duration
+	Note      string
+	// Running is set for the entry of a running timer, whose duration is
+	// counted up to when the report was made.
+	Running bool
+}
+
+// NewEntries returns an Entry for each of the given rows, with the duration
+// of running timers counted up to the given time, and dates in its location.
+func NewEntries(rows []database.TimeEntryRow, now time.Time) []Entry {
+	entries := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		member := row.UserName.String
+		if member == "" {
+			member = row.UserEmail
+		}
+		project := row.ProjectTitle.String
+		if !row.ProjectTitle.Valid {
+			project = "No project"
+		}
+		entries = append(entries, Entry{
+			ID:        row.ID,
+			Date:      row.StartedAt.Time.In(now.Location()),
+			TaskID:    row.TaskID,
+			Task:      row.TaskTitle,
+			ProjectID: row.ProjectID.Int32,
+			Project:   project,
+			MemberID:  row.UserID,
+			Member:    member,
+			Duration:  row.Duration(now).Round(time.Second),
+			Note:      row.Note,
+			Running:   !row.EndedAt.Valid,
+		})
+	}
+	return entries
+}
+
+// A Total is the time spent on something, e.g. a project.
+type Total struct {
+	Label    string
+	Duration time.Duration
+}
+
+// Sum returns the total duration of the given entries.
+func Sum(entries []Entry) time.Duration {
+	var d time.Duration
+	for _, entry := range entries {
+		d += entry.Duration
+	}
+	return d
+}
+
+// ByTask returns the totals of the given entries per task.
+func ByTask(entries []Entry) []Total {
+	return totals(entries, func(e Entry) (int32, string) { return e.TaskID, e.Task })
+}
+
+// ByProject returns the totals of the given entries per project.
+func ByProject(entries []Entry) []Total {
+	return totals(entries, func(e Entry) (int32, string) { return e.ProjectID, e.Project })
+}
+
+// ByMember returns the totals of the given entries per member.
+func ByMember(entries []Entry) []Total {
+	return totals(entries, func(e Entry) (int32, string) { return e.MemberID, e.Member })
+}
+
+// totals returns the totals of the given entries grouped by the id returned
+// from the given function, labeled with the name it returns, longest first.
+func totals(entries []Entry, key func(Entry) (int32, string)) []Total {
+	index := map[int32]int{}
+	totals := []Total{}
+	for _, entry := range entries {
+		id, label := key(entry)
+		i, ok := index[id]
+		if !ok {
+			i = len(totals)
+			index[id] = i
+			totals = append(totals, Total{Label: label})
+		}
+		totals[i].Duration += entry.Duration
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].Duration > totals[j].Duration
+	})
+	return totals
+}
+
+// ParseDuration returns the duration written as hours and minutes, e.g.
+// "1:30", or as a Go duration, e.g. "1h30m" or "45m", and an error if it
+// isn't positive or is longer than MaxDuration.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var d time.Duration
+	if hours, minutes, ok := strings.Cut(s, ":"); ok {
+		h, err := strconv.Atoi(hours)
+		if err != nil || h < 0 {
+			return 0, errors.New("must be hours and minutes like 1:30")
+		}
+		m, err := strconv.Atoi(minutes)
+		if err != nil || m < 0 || m > 59 || len(minutes) != 2 {
+			return 0, errors.New("must be hours and minutes like 1:30")
+		}
+		d = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	} else {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.New("must be a duration like 1:30 or 45m")
+		}
+		d = parsed
+	}
+	if d <= 0 || d > MaxDuration {
+		return 0, fmt.Errorf("must be between 1m and %s", FormatDuration(MaxDuration))
+	}
+	return d, nil
+}
+
+// FormatDuration returns the given duration as hours and minutes, e.g.
+// "1:30", rounded down to the minute.
+func FormatDuration(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// Hours returns the given duration as decimal hours with two decimals,
+// e.g. "1.50", which is what invoices usually need.
+func Hours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', 2, 64)
+}
+
+// EntriesCSVHeader is the header row written by WriteEntriesCSV.
+var EntriesCSVHeader = []string{"date", "member", "project", "task", "duration", "hours", "note"}
+
+// WriteEntriesCSV writes the given entries to the given writer as CSV, one
+// row per entry, with the header EntriesCSVHeader.
+func WriteEntriesCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(EntriesCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = writer.Write([]string{
+			entry.Date.Format(time.DateOnly),
+			entry.Member,
+			entry.Project,
+			entry.Task,
+			FormatDuration(entry.Duration),
+			Hours(entry.Duration),
+			entry.Note,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteTotalsCSV writes the given totals to the given writer as CSV, with
+// the given name as the header of the first column.
+func WriteTotalsCSV(w io.Writer, name string, totals []Total) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{name, "duration", "hours"})
+	if err != nil {
+		return err
+	}
+	for _, total := range totals {
+		err = writer.Write([]string{total.Label, FormatDuration(total.Duration), Hours(total.Duration)})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
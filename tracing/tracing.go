@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/webdevfuel/projectmotor"
+
+// Setup returns a function that flushes and stops the exporter, and the
+// first error encountered when creating it.
+//
+// The exporter is chosen by the environment variable OTEL_TRACES_EXPORTER:
+// "otlp" exports over OTLP/HTTP, configured with the standard
+// OTEL_EXPORTER_OTLP_* variables, and "stdout" (or "console") prints spans
+// for local debugging. When it's empty or "none", spans aren't exported.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	var option sdktrace.TracerProviderOption
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		option = sdktrace.WithBatcher(e)
+	case "stdout", "console":
+		e, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		option = sdktrace.WithSyncer(e)
+	default:
+		return nil, fmt.Errorf("environment variable OTEL_TRACES_EXPORTER has unknown exporter %q", exporter)
+	}
+	res, err := resource.New(
+		ctx,
+		resource.WithAttributes(semconv.ServiceName("projectmotor")),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(option, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start returns a copy of the given context with a new span, and the span.
+//
+// It uses the global tracer provider, so spans are dropped unless Setup
+// configured an exporter.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records the given error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request, continuing a trace
+// propagated by the client if there's one.
+//
+// The span is named after the chi route pattern once the request is served,
+// since chi only knows it after routing.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(
+			ctx,
+			r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(fmt.Sprintf("%s %s", r.Method, rctx.RoutePattern()))
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// StartQuery returns a copy of the given context with a new client span for
+// a query made by the given service method, and the span.
+func StartQuery(ctx context.Context, service string, method string) (context.Context, trace.Span) {
+	return Start(
+		ctx,
+		fmt.Sprintf("%s.%s", service, method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+}
+
+// StartRender returns a copy of the given context with a new span for
+// rendering the given component, and the span.
+func StartRender(ctx context.Context, component templ.Component) (context.Context, trace.Span) {
+	name := ComponentName(component)
+	return Start(
+		ctx,
+		fmt.Sprintf("render %s", name),
+		trace.WithAttributes(attribute.String("templ.component", name)),
+	)
+}
+
+// ComponentName returns a readable name for the given component.
+//
+// Components generated by templ are closures, so the name of the function
+// that returned them is used, e.g. "template.ProjectShareForm". Other
+// components are named after their type, e.g. "*shared.Button".
+func ComponentName(component templ.Component) string {
+	v := reflect.ValueOf(component)
+	if v.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", component)
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%T", component)
+	}
+	name := fn.Name()
+	// trim the closure suffix, e.g. ".func1"
+	if i := strings.LastIndex(name, ".func"); i != -1 {
+		name = name[:i]
+	}
+	// trim the package path, keeping the package name
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	return name
+}
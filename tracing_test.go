@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("request span includes query and render spans", func(t *testing.T) {
+		exporter.Reset()
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// span assertions
+		spans := exporter.GetSpans()
+		names := make(map[string]tracetest.SpanStub)
+		for _, span := range spans {
+			names[span.Name] = span
+		}
+		root, ok := names["GET /projects"]
+		if !assert.True(ok, "request span must exist") {
+			return
+		}
+		query, ok := names["ProjectService.GetAll"]
+		if assert.True(ok, "query span must exist") {
+			assert.Equal(root.SpanContext.TraceID(), query.SpanContext.TraceID())
+		}
+		render, ok := names["render template.Projects"]
+		if assert.True(ok, "render span must exist") {
+			assert.Equal(root.SpanContext.TraceID(), render.SpanContext.TraceID())
+		}
+	})
+}
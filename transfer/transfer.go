@@ -0,0 +1,307 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// Version is the version of the JSON format written by WriteJSON.
+const Version = 1
+
+// MaxSize is the largest file, in bytes, accepted by the importer.
+const MaxSize = 1 << 20
+
+// ErrUnsupportedVersion is returned by ReadJSON when the file was written
+// by a newer version of the exporter.
+var ErrUnsupportedVersion = errors.New("unsupported export version")
+
+// A Project is the portable representation of a project, with its tasks and
+// the email addresses of the users it's shared with.
+type Project struct {
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Published   bool      `json:"published"`
+	Tasks       []Task    `json:"tasks"`
+	SharedWith  []string  `json:"shared_with"`
+	ExportedAt  time.Time `json:"exported_at"`
+}
+
+// A Task is the portable representation of a task.
+type Task struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	DueDate     string `json:"due_date,omitempty"`
+}
+
+// NewProject returns a Project from the given project, its tasks and the
+// users it's shared with.
+func NewProject(project database.Project, tasks []database.Task, users []database.User) Project {
+	p := Project{
+		Version:     Version,
+		Title:       project.Title,
+		Description: project.Description.String,
+		Published:   project.Published,
+		Tasks:       []Task{},
+		SharedWith:  []string{},
+		ExportedAt:  time.Now().UTC(),
+	}
+	for _, task := range tasks {
+		p.Tasks = append(p.Tasks, Task{
+			Title:       task.Title,
+			Description: task.Description.String,
+			Status:      string(task.Status),
+			DueDate:     database.DateString(task.DueDate),
+		})
+	}
+	for _, user := range users {
+		p.SharedWith = append(p.SharedWith, user.Email)
+	}
+	return p
+}
+
+// WriteJSON writes the given project to the given writer as indented JSON.
+func WriteJSON(w io.Writer, p Project) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// ReadJSON returns a Project decoded from the given reader, and an error if
+// the JSON is malformed or was written by a newer version.
+func ReadJSON(r io.Reader) (Project, error) {
+	var p Project
+	err := json.NewDecoder(r).Decode(&p)
+	if err != nil {
+		return Project{}, err
+	}
+	if p.Version > Version {
+		return Project{}, ErrUnsupportedVersion
+	}
+	return p, nil
+}
+
+// CSVHeader is the header row written by WriteCSV.
+//
+// The first four columns are the task, and the rest repeat the project on
+// every row, so that the file opens nicely in a spreadsheet and can be
+// imported again by mapping the task columns.
+var CSVHeader = []string{
+	"title",
+	"description",
+	"status",
+	"due_date",
+	"project_title",
+	"project_description",
+	"project_published",
+	"project_shared_with",
+}
+
+// WriteCSV writes the given project to the given writer as CSV, one row per
+// task, with the header CSVHeader.
+//
+// Cells that a spreadsheet would run as a formula, such as a title starting
+// with "=", are quoted with QuoteCell, which Mapping.Tasks undoes.
+func WriteCSV(w io.Writer, p Project) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(CSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, task := range p.Tasks {
+		err = writer.Write([]string{
+			QuoteCell(task.Title),
+			QuoteCell(task.Description),
+			task.Status,
+			task.DueDate,
+			QuoteCell(p.Title),
+			QuoteCell(p.Description),
+			strconv.FormatBool(p.Published),
+			QuoteCell(strings.Join(p.SharedWith, ";")),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// QuoteCell returns the given cell prefixed with "'" if it starts with a
+// character that makes spreadsheets read it as a formula, i.e. "=", "+",
+// "-", "@", a tab or a carriage return, so that it's shown as text instead.
+//
+// Cells that already start with "'" followed by such a cell are quoted too,
+// so that UnquoteCell returns every cell as it was.
+func QuoteCell(s string) string {
+	if needsQuote(s) {
+		return "'" + s
+	}
+	return s
+}
+
+// UnquoteCell returns the given cell without the "'" prefix added by
+// QuoteCell.
+func UnquoteCell(s string) string {
+	if strings.HasPrefix(s, "'") && needsQuote(s[1:]) {
+		return s[1:]
+	}
+	return s
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	case '\'':
+		return needsQuote(s[1:])
+	}
+	return false
+}
+
+// ReadCSV returns the header row and the remaining records read from the
+// given reader, and an error if the CSV is malformed or has no header.
+//
+// Rows may have a different number of fields than the header, and missing
+// fields are treated as empty by Mapping.Tasks.
+func ReadCSV(r io.Reader) ([]string, [][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("csv file must have a header row")
+	}
+	return records[0], records[1:], nil
+}
+
+// A Mapping is the index of the CSV column for each task field, or -1 if the
+// field isn't present in the file.
+type Mapping struct {
+	Title       int
+	Description int
+	Status      int
+	DueDate     int
+}
+
+// GuessMapping returns a Mapping with the columns of the given header whose
+// names match a task field, ignoring case and surrounding whitespace.
+func GuessMapping(header []string) Mapping {
+	m := Mapping{Title: -1, Description: -1, Status: -1, DueDate: -1}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "title", "name", "summary":
+			if m.Title == -1 {
+				m.Title = i
+			}
+		case "description", "body", "notes":
+			if m.Description == -1 {
+				m.Description = i
+			}
+		case "status", "state":
+			if m.Status == -1 {
+				m.Status = i
+			}
+		case "due_date", "due date", "due", "deadline":
+			if m.DueDate == -1 {
+				m.DueDate = i
+			}
+		}
+	}
+	return m
+}
+
+// Tasks returns a Task for each of the given records, with the fields read
+// from the mapped columns.
+//
+// Cells quoted by QuoteCell are unquoted. Statuses are normalized with
+// NormalizeStatus, and a record without a status column gets the status
+// "todo". Due dates are read as written, in the "2006-01-02" format of the
+// exports.
+func (m Mapping) Tasks(records [][]string) []Task {
+	tasks := make([]Task, 0, len(records))
+	for _, record := range records {
+		status := string(database.TaskStatusTodo)
+		if m.Status != -1 {
+			status = NormalizeStatus(field(record, m.Status))
+		}
+		tasks = append(tasks, Task{
+			Title:       strings.TrimSpace(field(record, m.Title)),
+			Description: field(record, m.Description),
+			Status:      status,
+			DueDate:     strings.TrimSpace(field(record, m.DueDate)),
+		})
+	}
+	return tasks
+}
+
+// NormalizeStatus returns the TaskStatus matching the given value, written
+// in the way other trackers usually do, e.g. "In Progress" or "Completed".
+//
+// Empty values are "todo", and unknown values are returned lowercased, so
+// that validation can report them.
+func NormalizeStatus(value string) string {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.NewReplacer(" ", "_", "-", "_").Replace(s)
+	switch s {
+	case "", "todo", "to_do", "open", "backlog", "new":
+		return string(database.TaskStatusTodo)
+	case "in_progress", "doing", "started", "active":
+		return string(database.TaskStatusInProgress)
+	case "done", "closed", "complete", "completed", "resolved":
+		return string(database.TaskStatusDone)
+	}
+	return s
+}
+
+// ValidStatus reports whether the given value is a TaskStatus.
+func ValidStatus(value string) bool {
+	for _, status := range database.TaskStatuses {
+		if string(status) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Filename returns a file name for the export of the given project with the
+// given extension, e.g. "projectmotor-website-redesign.json".
+func Filename(p Project, ext string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(p.Title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		slug = "project"
+	}
+	return fmt.Sprintf("projectmotor-%s.%s", slug, ext)
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return UnquoteCell(record[i])
+}
@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteCell(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want string
+	}{
+		{"plain", "Write docs", "Write docs"},
+		{"empty", "", ""},
+		{"formula", "=HYPERLINK(\"https://example.com\")", "'=HYPERLINK(\"https://example.com\")"},
+		{"plus", "+1", "'+1"},
+		{"minus", "-1+2", "'-1+2"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\t=1", "'\t=1"},
+		{"carriage return", "\r=1", "'\r=1"},
+		{"formula inside", "a=1", "a=1"},
+		{"quote", "'quoted'", "'quoted'"},
+		{"quoted formula", "'=1", "''=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(tt.want, QuoteCell(tt.cell))
+			assert.Equal(tt.cell, UnquoteCell(QuoteCell(tt.cell)))
+		})
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	p := Project{
+		Title:       "=cmd|' /C calc'!A0",
+		Description: "- first\n- second",
+		Tasks: []Task{
+			{Title: "@SUM(1+1)*cmd|' /C calc'!A0", Description: "+1", Status: "todo", DueDate: "2026-03-01"},
+			{Title: "Plain", Status: "done"},
+		},
+		SharedWith: []string{"johndoe@gmail.com"},
+	}
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, p)
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Contains(buf.String(), "'@SUM(1+1)")
+	assert.Contains(buf.String(), "'=cmd")
+
+	header, records, err := ReadCSV(&buf)
+	assert.Nil(err)
+	assert.Equal(CSVHeader, header)
+	tasks := GuessMapping(header).Tasks(records)
+	assert.Equal(p.Tasks, tasks)
+}
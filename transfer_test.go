@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/test"
+	"github.com/webdevfuel/projectmotor/transfer"
+)
+
+func TestTransfer(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	t.Run("export project as json includes tasks", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/export?format=json")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(`attachment; filename="projectmotor-project-1.json"`, res.Header.Get("Content-Disposition"))
+
+		// body assertions
+		var project transfer.Project
+		err := json.NewDecoder(res.Body).Decode(&project)
+		assert.Nil(err)
+		assert.Equal("Project 1", project.Title)
+		assert.Len(project.Tasks, 2)
+		assert.Equal("todo", project.Tasks[0].Status)
+	})
+
+	t.Run("export project as csv has one row per task", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/export?format=csv")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		body := test.Body(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// body assertions
+		assert.Contains(body, "title,description,status,due_date,project_title")
+		assert.Contains(body, "Task 1,,todo,,Project 1")
+		assert.Contains(body, "Task 2,,todo,,Project 1")
+	})
+
+	t.Run("export project of another user is not found", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/3/export")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("preview import shows invalid rows", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/import/preview")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "format", Value: "csv"},
+				test.FormValue{Key: "content", Value: "Name,State\nWrite docs,Done\n,Open\nShip it,Someday\n"},
+				test.FormValue{Key: "title", Value: "Imported"},
+				test.FormValue{Key: "title_column", Value: "0"},
+				test.FormValue{Key: "status_column", Value: "1"},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// preview assertions
+		assert.Equal(3, doc.Find(".import-row").Length())
+		assert.Equal(2, doc.Find(".import-row-invalid").Length())
+		assert.Contains(doc.Find("#import-summary").Text(), "2 rows have errors")
+		assert.Contains(doc.Find(".import-row-invalid").Text(), "Title cannot be blank")
+		assert.Contains(doc.Find(".import-row-invalid").Text(), `Status "someday" is unknown`)
+	})
+
+	t.Run("commit import with invalid rows doesn't create anything", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/import/commit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "format", Value: "csv"},
+				test.FormValue{Key: "content", Value: "Name\nWrite docs\n\"\"\n"},
+				test.FormValue{Key: "title", Value: "Not imported"},
+				test.FormValue{Key: "title_column", Value: "0"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get("HX-Redirect"))
+
+		// database assertions
+		var count int
+		err := handler.DB.Get(&count, "select count(*) from projects where title = 'Not imported'")
+		assert.Nil(err)
+		assert.Equal(0, count)
+	})
+
+	t.Run("commit import creates project, tasks and shares", func(t *testing.T) {
+		content := `{"version":1,"title":"Migrated","description":"From elsewhere","tasks":[{"title":"First","status":"done"},{"title":"Second","status":"in_progress"}],"shared_with":["johndoe@gmail.com","nobody@example.com"]}`
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/import/commit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "format", Value: "json"},
+				test.FormValue{Key: "content", Value: content},
+				test.FormValue{Key: "title", Value: "Migrated"},
+			),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+
+		// status code assertions
+		assert.Equal(200, res.StatusCode)
+
+		// database assertions
+		var project database.Project
+		err := handler.DB.Get(&project, "select * from projects where title = 'Migrated' and owner_id = 1")
+		assert.Nil(err)
+		assert.Equal("From elsewhere", project.Description.String)
+		assert.Equal(fmt.Sprintf("/projects/%d/edit", project.ID), res.Header.Get("HX-Redirect"))
+		var tasks []database.Task
+		err = handler.DB.Select(&tasks, "select * from tasks where project_id = $1 order by id", project.ID)
+		assert.Nil(err)
+		assert.Len(tasks, 2)
+		assert.Equal(database.TaskStatusDone, tasks[0].Status)
+		assert.Equal(database.TaskStatusInProgress, tasks[1].Status)
+		var shares int
+		err = handler.DB.Get(&shares, "select count(*) from projects_users where project_id = $1", project.ID)
+		assert.Nil(err)
+		assert.Equal(1, shares)
+	})
+
+	t.Run("csv export and import keep due dates", func(t *testing.T) {
+		_, err := handler.DB.Exec("update tasks set due_date = '2026-03-01' where title = 'Task 1'")
+		if err != nil {
+			t.Errorf("error setting due date %s", err)
+			return
+		}
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/export?format=csv")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		content := test.Body(test.Do(req))
+		assert := assert.New(t)
+		assert.Contains(content, "Task 1,,todo,2026-03-01,Project 1")
+
+		// the due date column is mapped when uploading the export
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/import")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFile("file", "project-1.csv", []byte(content)),
+		)
+		doc := test.Doc(test.Do(req))
+		selected, _ := doc.Find("#due_date_column option[selected]").Attr("value")
+		assert.Equal("3", selected)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/import/commit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "format", Value: "csv"},
+				test.FormValue{Key: "content", Value: content},
+				test.FormValue{Key: "title", Value: "Round trip"},
+				test.FormValue{Key: "title_column", Value: "0"},
+				test.FormValue{Key: "status_column", Value: "2"},
+				test.FormValue{Key: "due_date_column", Value: "3"},
+			),
+		)
+		test.Do(req)
+		var dueDate string
+		err = handler.DB.Get(&dueDate, "select to_char(tasks.due_date, 'YYYY-MM-DD') from tasks join projects on projects.id = tasks.project_id where projects.title = 'Round trip' and tasks.title = 'Task 1'")
+		assert.Nil(err)
+		assert.Equal("2026-03-01", dueDate)
+	})
+}
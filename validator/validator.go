@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-playground/form"
@@ -118,6 +119,15 @@ func getKeyValue(val reflect.Value, fieldName string, i int) []keyValue {
 			Key:   fieldName,
 			Value: fmt.Sprintf("%t", val.Field(i).Bool()),
 		}}
+	case reflect.Slice:
+		// multiple values of the same field, e.g. checkboxes, are joined
+		// with commas
+		if values, ok := val.Field(i).Interface().([]string); ok {
+			return []keyValue{{
+				Key:   fieldName,
+				Value: strings.Join(values, ","),
+			}}
+		}
 	}
 	return []keyValue{}
 }
@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for urls whose host resolves to an address
+// that isn't reachable from the internet, such as a loopback, private or
+// link-local one, which webhooks aren't sent to so that they can't reach
+// the services next to the app.
+var ErrPrivateAddress = errors.New("webhook: url resolves to a private address")
+
+// reservedNetworks are the ranges that aren't reachable from the internet
+// but which the methods of net.IP don't cover.
+var reservedNetworks = parseCIDRs(
+	"0.0.0.0/8",      // "this network" (RFC 791)
+	"100.64.0.0/10",  // shared address space of carrier-grade NAT (RFC 6598)
+	"192.0.0.0/24",   // IETF protocol assignments (RFC 6890)
+	"198.18.0.0/15",  // benchmarking (RFC 2544)
+	"240.0.0.0/4",    // reserved, including the limited broadcast address
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation (RFC 8215)
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// PublicAddress reports whether the given address is reachable from the
+// internet, i.e. it isn't a loopback, private (RFC 1918 and RFC 4193),
+// link-local, multicast, unspecified or otherwise reserved address, such as
+// one of carrier-grade NAT.
+func PublicAddress(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of the given url, and returns ErrPrivateAddress
+// if any of its addresses isn't public.
+//
+// Since the host may resolve to another address later on, the client
+// returned by NewClient checks the address it connects to again.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !PublicAddress(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// NewClient returns a client with the given timeout to send deliveries
+// with, which refuses to connect to addresses that aren't public and
+// doesn't follow redirects, whose responses are errors like other non-2xx
+// ones.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !PublicAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
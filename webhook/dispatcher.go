@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/webdevfuel/projectmotor/database"
+	"github.com/webdevfuel/projectmotor/signature"
+)
+
+// batchSize is the number of due deliveries claimed by each batch of
+// RunOnce.
+const batchSize = 20
+
+// claimDuration is how long the deliveries claimed by a batch aren't due,
+// which must be longer than sending a whole batch takes. The deliveries of a
+// batch whose attempts weren't recorded, e.g. because the instance stopped,
+// are attempted again after it.
+const claimDuration = 15 * time.Minute
+
+// A Dispatcher attempts the deliveries queued in the "webhook_deliveries"
+// table once they're due, and schedules the next attempt of those that fail
+// with an exponential backoff.
+//
+// It's safe to run a Dispatcher on every instance of the app, since due
+// deliveries are claimed by one instance before they're attempted, and
+// skipped by the other instances.
+type Dispatcher struct {
+	db       *sqlx.DB
+	webhooks *database.WebhookService
+	client   *http.Client
+	interval time.Duration
+}
+
+// NewDispatcher returns a pointer to Dispatcher, which looks for due
+// deliveries every given interval and sends them with the given client.
+func NewDispatcher(db *sqlx.DB, client *http.Client, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		webhooks: database.NewWebhookService(db),
+		client:   client,
+		interval: interval,
+	}
+}
+
+// Run calls RunOnce right away and then every interval, until the given
+// context is done. Errors are logged, and the next run tries again.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		n, err := d.RunOnce(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "webhook deliveries failed", "error", err)
+		}
+		if n > 0 {
+			slog.InfoContext(ctx, "webhook deliveries attempted", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts every pending delivery due at the given time, and returns
+// the number of deliveries attempted, successfully or not.
+//
+// Deliveries are attempted in batches, one after the other.
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		n, more, err := d.runBatch(ctx, now)
+		total += n
+		if err != nil || !more {
+			return total, err
+		}
+	}
+}
+
+// runBatch attempts a batch of due deliveries, and reports whether there may
+// be more due deliveries.
+//
+// The deliveries are claimed before they're sent, and their attempts are
+// recorded once they're all sent, so that no transaction is held open while
+// waiting for receivers, which may take up to the timeout of the client to
+// reply.
+func (d *Dispatcher) runBatch(ctx context.Context, now time.Time) (int, bool, error) {
+	// timestamps are stored without a time zone, in UTC
+	now = now.UTC()
+	due, err := d.webhooks.ClaimDue(
+		ctx,
+		pgtype.Timestamp{Time: now, Valid: true},
+		pgtype.Timestamp{Time: now.Add(claimDuration), Valid: true},
+		batchSize,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	attempts := make([]attempt, len(due))
+	for i, delivery := range due {
+		attempts[i] = d.attempt(ctx, delivery, now)
+	}
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+	for _, a := range attempts {
+		err = d.webhooks.RecordAttemptWithTx(ctx, tx, a.deliveryID, a.status, a.statusCode, a.lastError, a.nextAttemptAt)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, false, err
+	}
+	return len(due), len(due) == batchSize, nil
+}
+
+// An attempt is the outcome of sending a delivery.
+type attempt struct {
+	deliveryID    int32
+	status        database.WebhookDeliveryStatus
+	statusCode    pgtype.Int4
+	lastError     string
+	nextAttemptAt pgtype.Timestamp
+}
+
+// attempt sends the given delivery at the given time, and returns its
+// outcome, which schedules the next attempt after a backoff if it failed and
+// there are attempts left.
+func (d *Dispatcher) attempt(ctx context.Context, delivery database.WebhookDeliveryTarget, now time.Time) attempt {
+	a := attempt{
+		deliveryID:    delivery.ID,
+		status:        database.WebhookDeliveryDelivered,
+		nextAttemptAt: pgtype.Timestamp{Time: now, Valid: true},
+	}
+	statusCode, err := d.send(ctx, delivery, now)
+	a.statusCode = statusCode
+	if err != nil {
+		a.lastError = err.Error()
+		attempts := int(delivery.Attempts) + 1
+		if attempts >= MaxAttempts {
+			a.status = database.WebhookDeliveryFailed
+		} else {
+			a.status = database.WebhookDeliveryPending
+			a.nextAttemptAt.Time = now.Add(Backoff(attempts))
+		}
+	}
+	return a
+}
+
+// send posts the payload of the given delivery to the url of its webhook,
+// timestamped with the given time, and returns the status code of the
+// response, if any. Responses other than 2xx are errors.
+func (d *Dispatcher) send(ctx context.Context, delivery database.WebhookDeliveryTarget, now time.Time) (pgtype.Int4, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return pgtype.Int4{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ProjectMotor-Webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(delivery.ID))
+	timestamp := now.Unix()
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(timestamp))
+	req.Header.Set(HeaderSignature, signature.SignTimestamped(delivery.Secret, timestamp, body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return pgtype.Int4{}, err
+	}
+	defer res.Body.Close()
+	// read some of the body, so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	statusCode := pgtype.Int4{Int32: int32(res.StatusCode), Valid: true}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return statusCode, nil
+}
@@ -0,0 +1,117 @@
+// Package webhook builds and signs the payloads of the events of projects,
+// and delivers them to the urls subscribed to them.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/webdevfuel/projectmotor/database"
+)
+
+// Event types webhooks can subscribe to.
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskDeleted   = "task.deleted"
+	EventProjectShared = "project.shared"
+)
+
+// Events is a slice of all event types, in the order they're displayed.
+var Events = []string{EventTaskCreated, EventTaskUpdated, EventTaskDeleted, EventProjectShared}
+
+// Headers sent along with every delivery. HeaderTimestamp holds the time the
+// delivery was sent at, in seconds since the Unix epoch, and HeaderSignature
+// the signature of the timestamp and body with the secret of the webhook, as
+// returned by signature.SignTimestamped.
+const (
+	HeaderEvent     = "X-ProjectMotor-Event"
+	HeaderDelivery  = "X-ProjectMotor-Delivery"
+	HeaderTimestamp = "X-ProjectMotor-Timestamp"
+	HeaderSignature = "X-ProjectMotor-Signature"
+)
+
+// A Payload is the JSON body of a delivery.
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// A Task is the data of the task events.
+type Task struct {
+	ID          int32   `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	DueDate     *string `json:"due_date"`
+	ProjectID   int32   `json:"project_id"`
+	MilestoneID *int32  `json:"milestone_id"`
+}
+
+// NewTask returns the data of the task events about the given task.
+func NewTask(task database.Task) Task {
+	data := Task{
+		ID:          task.ID,
+		Title:       task.Title,
+		Description: task.Description.String,
+		Status:      string(task.Status),
+		ProjectID:   task.ProjectID.Int32,
+	}
+	if task.DueDate.Valid {
+		dueDate := task.DueDate.Time.Format(time.DateOnly)
+		data.DueDate = &dueDate
+	}
+	if task.MilestoneID.Valid {
+		data.MilestoneID = &task.MilestoneID.Int32
+	}
+	return data
+}
+
+// A Share is the data of the project.shared event.
+type Share struct {
+	ProjectID    int32  `json:"project_id"`
+	ProjectTitle string `json:"project_title"`
+	UserID       int32  `json:"user_id"`
+	Email        string `json:"email"`
+}
+
+// Marshal returns the JSON body of a delivery of the given event type and
+// data, created at the given time.
+func Marshal(event string, data any, now time.Time) ([]byte, error) {
+	return json.Marshal(Payload{
+		Event:     event,
+		CreatedAt: now.UTC(),
+		Data:      data,
+	})
+}
+
+// GenerateSecret returns a random secret to sign payloads with.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// MaxAttempts is the number of times a delivery is attempted before it's
+// marked as failed.
+const MaxAttempts = 8
+
+// Backoff returns how long to wait before attempting a delivery again after
+// the given number of failed attempts: 30 seconds after the first one,
+// doubling after each of the next ones, up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= 6*time.Hour {
+			return 6 * time.Hour
+		}
+	}
+	return d
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/signature"
+	"github.com/webdevfuel/projectmotor/test"
+	"github.com/webdevfuel/projectmotor/webhook"
+)
+
+// receiver is an httptest server that records the webhook deliveries it
+// gets, and replies with the status it's told to.
+type receiver struct {
+	mu         sync.Mutex
+	status     int
+	deliveries []receivedDelivery
+}
+
+type receivedDelivery struct {
+	Header http.Header
+	Body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.deliveries = append(rc.deliveries, receivedDelivery{Header: r.Header, Body: body})
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) reply(status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.status = status
+}
+
+func (rc *receiver) received() []receivedDelivery {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]receivedDelivery{}, rc.deliveries...)
+}
+
+func TestWebhooks(t *testing.T) {
+	handler, server := test.NewServer(test.WithPrivateWebhooks())
+	defer server.Close()
+
+	rc := &receiver{status: http.StatusOK}
+	hooks := httptest.NewServer(rc)
+	defer hooks.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	dispatcher := webhook.NewDispatcher(handler.DB, hooks.Client(), time.Minute)
+	secret := "a-very-secret-signing-key"
+
+	t.Run("create webhook on private addresses", func(t *testing.T) {
+		_, strict := test.NewServer()
+		defer strict.Close()
+		for _, url := range []string{hooks.URL, "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hook"} {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/%s", strict.URL, "projects/1/webhooks")),
+				test.WithAuthentication(test.Authenticated, cookie),
+				test.WithMethod(test.Post),
+				test.WithFormValues(
+					test.FormValue{Key: "url", Value: url},
+					test.FormValue{Key: "events", Value: webhook.EventTaskCreated},
+				),
+			)
+			res := test.Do(req)
+			doc := test.Doc(res)
+			assert := assert.New(t)
+			assert.Equal(200, res.StatusCode)
+			assert.Equal("must not resolve to a private address", doc.Find("#webhook-form .text-red-600").Text())
+			assert.Equal(0, doc.Find("li.webhook").Length())
+		}
+	})
+
+	t.Run("create webhook requires events", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/webhooks")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "url", Value: hooks.URL},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("must have at least one event", doc.Find("#webhook-form fieldset .error").Text())
+	})
+
+	t.Run("create webhook on projects of others", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/webhooks")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "url", Value: hooks.URL},
+				test.FormValue{Key: "events", Value: webhook.EventTaskCreated},
+			),
+		)
+		res := test.Do(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("create webhook", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/webhooks")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "url", Value: hooks.URL},
+				test.FormValue{Key: "secret", Value: secret},
+				test.FormValue{Key: "events", Value: webhook.EventTaskCreated},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(hooks.URL, doc.Find("li.webhook .webhook-url").Text())
+		assert.Equal(webhook.EventTaskCreated, doc.Find("li.webhook .webhook-events").Text())
+	})
+
+	t.Run("subscribed events are delivered signed", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Hooked"},
+				test.FormValue{Key: "project_id", Value: "1"},
+			),
+		)
+		test.Do(req)
+		// task 1 is in project 1, but updates aren't subscribed to
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks/1")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Patch),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Task 1"},
+			),
+		)
+		test.Do(req)
+
+		n, err := dispatcher.RunOnce(context.Background(), time.Now())
+		assert := assert.New(t)
+		assert.Nil(err)
+		assert.Equal(1, n)
+		received := rc.received()
+		if !assert.Len(received, 1) {
+			return
+		}
+		delivery := received[0]
+		assert.Equal(webhook.EventTaskCreated, delivery.Header.Get(webhook.HeaderEvent))
+		timestamp := delivery.Header.Get(webhook.HeaderTimestamp)
+		assert.True(signature.VerifyTimestamped(secret, timestamp, delivery.Body, delivery.Header.Get(webhook.HeaderSignature), time.Now()))
+		// the body alone isn't signed, so a delivery can't be replayed with another timestamp
+		assert.False(signature.Verify(secret, delivery.Body, delivery.Header.Get(webhook.HeaderSignature)))
+		var payload struct {
+			Event string       `json:"event"`
+			Data  webhook.Task `json:"data"`
+		}
+		assert.Nil(json.Unmarshal(delivery.Body, &payload))
+		assert.Equal(webhook.EventTaskCreated, payload.Event)
+		assert.Equal("Hooked", payload.Data.Title)
+		assert.Equal(int32(1), payload.Data.ProjectID)
+
+		var status string
+		handler.DB.Get(&status, "select status from webhook_deliveries order by id limit 1")
+		assert.Equal("delivered", status)
+	})
+
+	t.Run("failed deliveries are retried with backoff", func(t *testing.T) {
+		rc.reply(http.StatusInternalServerError)
+		_, err := handler.DB.Exec(`
+			insert into webhook_deliveries (webhook_id, event, payload)
+			select id, 'task.created', '{"event": "task.created"}' from webhooks
+		`)
+		if err != nil {
+			t.Errorf("error queueing delivery %s", err)
+			return
+		}
+		now := time.Now()
+		assert := assert.New(t)
+		n, err := dispatcher.RunOnce(context.Background(), now)
+		assert.Nil(err)
+		assert.Equal(1, n)
+		var delivery struct {
+			Status         string    `db:"status"`
+			Attempts       int       `db:"attempts"`
+			LastStatusCode int       `db:"last_status_code"`
+			NextAttemptAt  time.Time `db:"next_attempt_at"`
+		}
+		handler.DB.Get(&delivery, "select status, attempts, last_status_code, next_attempt_at from webhook_deliveries order by id desc limit 1")
+		assert.Equal("pending", delivery.Status)
+		assert.Equal(1, delivery.Attempts)
+		assert.Equal(500, delivery.LastStatusCode)
+		assert.WithinDuration(now.Add(webhook.Backoff(1)), delivery.NextAttemptAt, time.Second)
+
+		// the next attempt isn't due yet
+		n, err = dispatcher.RunOnce(context.Background(), now.Add(10*time.Second))
+		assert.Nil(err)
+		assert.Equal(0, n)
+
+		rc.reply(http.StatusNoContent)
+		n, err = dispatcher.RunOnce(context.Background(), now.Add(time.Minute))
+		assert.Nil(err)
+		assert.Equal(1, n)
+		handler.DB.Get(&delivery, "select status, attempts, last_status_code, next_attempt_at from webhook_deliveries order by id desc limit 1")
+		assert.Equal("delivered", delivery.Status)
+		assert.Equal(2, delivery.Attempts)
+	})
+
+	t.Run("claimed deliveries aren't attempted twice", func(t *testing.T) {
+		_, err := handler.DB.Exec(`
+			insert into webhook_deliveries (webhook_id, event, payload)
+			select id, 'task.created', '{"event": "task.created"}' from webhooks
+		`)
+		if err != nil {
+			t.Errorf("error queueing delivery %s", err)
+			return
+		}
+		now := time.Now()
+		assert := assert.New(t)
+		// another instance claimed the delivery, and stopped before
+		// recording its attempt
+		claimed, err := handler.WebhookService.ClaimDue(
+			context.Background(),
+			pgtype.Timestamp{Time: now.UTC(), Valid: true},
+			pgtype.Timestamp{Time: now.UTC().Add(15 * time.Minute), Valid: true},
+			20,
+		)
+		assert.Nil(err)
+		assert.Len(claimed, 1)
+		n, err := dispatcher.RunOnce(context.Background(), now)
+		assert.Nil(err)
+		assert.Equal(0, n)
+
+		n, err = dispatcher.RunOnce(context.Background(), now.Add(16*time.Minute))
+		assert.Nil(err)
+		assert.Equal(1, n)
+	})
+
+	t.Run("redeliver", func(t *testing.T) {
+		var deliveryID int
+		handler.DB.Get(&deliveryID, "select id from webhook_deliveries order by id limit 1")
+		url := fmt.Sprintf("%s/webhooks/deliveries/%d/redeliver", server.URL, deliveryID)
+		req := test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(404, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(url),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		before := len(rc.received())
+		n, err := dispatcher.RunOnce(context.Background(), time.Now())
+		assert.Nil(err)
+		assert.Equal(1, n)
+		received := rc.received()
+		if assert.Len(received, before+1) {
+			assert.Equal(string(received[0].Body), string(received[before].Body))
+		}
+	})
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(30*time.Second, webhook.Backoff(1))
+	assert.Equal(time.Minute, webhook.Backoff(2))
+	assert.Equal(4*time.Minute, webhook.Backoff(4))
+	assert.Equal(6*time.Hour, webhook.Backoff(20))
+}
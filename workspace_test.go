@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/webdevfuel/projectmotor/test"
+)
+
+func TestWorkspaces(t *testing.T) {
+	handler, server := test.NewServer()
+	defer server.Close()
+
+	cookie, err := test.SetUserSession(server, 1)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	otherCookie, err := test.SetUserSession(server, 2)
+	if err != nil {
+		t.Errorf("error setting user test session %s", err)
+		return
+	}
+
+	err = test.ResetAndSeedDB(handler.DB)
+	if err != nil {
+		t.Errorf("error resetting and seeding database %s", err)
+		return
+	}
+
+	projects := func(cookie string) (int, int) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc := test.Doc(test.Do(req))
+		return doc.Find(".project").Length(), doc.Find(".read-only-project").Length()
+	}
+
+	var workspaceID int32
+	var projectID int32
+
+	t.Run("create workspace", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "name", Value: ""}),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal("cannot be blank", doc.Find("#workspace-form .text-red-600").Text())
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "name", Value: "Acme"}),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects", res.Header.Get("Hx-Redirect"))
+
+		// the user is switched to the new workspace, as its owner
+		handler.DB.Get(&workspaceID, "select active_organization_id from users where id = 1")
+		var role string
+		handler.DB.Get(&role, "select role from organization_members where organization_id = $1 and user_id = 1", workspaceID)
+		assert.Equal("owner", role)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces/switcher")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		doc = test.Doc(test.Do(req))
+		assert.Equal(2, doc.Find(".workspace-switcher option").Length())
+		assert.Equal("Acme", doc.Find(".workspace-switcher option[selected]").Text())
+	})
+
+	t.Run("projects are scoped to the active workspace", func(t *testing.T) {
+		assert := assert.New(t)
+		editable, readOnly := projects(cookie)
+		assert.Equal(0, editable)
+		assert.Equal(0, readOnly)
+
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Acme site"},
+				test.FormValue{Key: "description", Value: ""},
+			),
+		)
+		test.Do(req)
+		handler.DB.Get(&projectID, "select id from projects where organization_id = $1", workspaceID)
+		assert.NotZero(projectID)
+		editable, _ = projects(cookie)
+		assert.Equal(1, editable)
+
+		// projects of other workspaces can't be edited
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "projects/1/edit")),
+			test.WithAuthentication(test.Authenticated, cookie),
+		)
+		res := test.Do(req)
+		assert.NotEqual(200, res.StatusCode)
+	})
+
+	t.Run("tasks of a shared workspace need a project", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "tasks")),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(
+				test.FormValue{Key: "title", Value: "Loose task"},
+				test.FormValue{Key: "project_id", Value: ""},
+			),
+		)
+		res := test.Do(req)
+		doc := test.Doc(res)
+		assert := assert.New(t)
+		assert.Equal("is required in a shared workspace", doc.Find("#task-form span.error").Text())
+
+		var count int
+		handler.DB.Get(&count, "select count(*) from tasks where title = 'Loose task'")
+		assert.Equal(0, count)
+	})
+
+	t.Run("add member", func(t *testing.T) {
+		addMember := func(email string) *http.Response {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/workspaces/%d/members", server.URL, workspaceID)),
+				test.WithAuthentication(test.Authenticated, cookie),
+				test.WithMethod(test.Post),
+				test.WithFormValues(
+					test.FormValue{Key: "email", Value: email},
+					test.FormValue{Key: "role", Value: "member"},
+				),
+			)
+			return test.Do(req)
+		}
+		assert := assert.New(t)
+		doc := test.Doc(addMember("nobody@example.com"))
+		assert.Equal("doesn't belong to a ProjectMotor account", doc.Find("#workspace-member-form .text-red-600").Text())
+
+		doc = test.Doc(addMember("johndoe@gmail.com"))
+		assert.Equal(2, doc.Find(".workspace-member").Length())
+		assert.Equal("John Doe", doc.Find(fmt.Sprintf("#workspace-member-%d .workspace-member-name", 2)).Text())
+
+		// members can't switch to workspaces they don't belong to
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces/switch")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "id", Value: "1"}),
+		)
+		res := test.Do(req)
+		assert.Equal(http.StatusNotFound, res.StatusCode)
+
+		req = test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/%s", server.URL, "workspaces/switch")),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Post),
+			test.WithFormValues(test.FormValue{Key: "id", Value: fmt.Sprint(workspaceID)}),
+		)
+		res = test.Do(req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects", res.Header.Get("Hx-Redirect"))
+	})
+
+	t.Run("default access", func(t *testing.T) {
+		setAccess := func(c string, access string) *http.Response {
+			req := test.NewRequest(
+				test.WithUrl(fmt.Sprintf("%s/workspaces/%d", server.URL, workspaceID)),
+				test.WithAuthentication(test.Authenticated, c),
+				test.WithMethod(test.Patch),
+				test.WithFormValues(
+					test.FormValue{Key: "name", Value: "Acme"},
+					test.FormValue{Key: "default_access", Value: access},
+				),
+			)
+			return test.Do(req)
+		}
+		assert := assert.New(t)
+
+		// members see the projects of others by default
+		editable, readOnly := projects(otherCookie)
+		assert.Equal(0, editable)
+		assert.Equal(1, readOnly)
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/projects/%d/edit", server.URL, projectID)),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+		)
+		res := test.Do(req)
+		assert.NotEqual(200, res.StatusCode)
+
+		// only owners and admins can change the default access
+		res = setAccess(otherCookie, "edit")
+		assert.Equal(http.StatusForbidden, res.StatusCode)
+
+		res = setAccess(cookie, "edit")
+		assert.Equal(200, res.StatusCode)
+		editable, readOnly = projects(otherCookie)
+		assert.Equal(1, editable)
+		assert.Equal(0, readOnly)
+
+		setAccess(cookie, "none")
+		editable, readOnly = projects(otherCookie)
+		assert.Equal(0, editable)
+		assert.Equal(0, readOnly)
+	})
+
+	t.Run("last owner can't leave", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/workspaces/%d/members/1", server.URL, workspaceID)),
+			test.WithAuthentication(test.Authenticated, cookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(http.StatusConflict, res.StatusCode)
+
+		var count int
+		handler.DB.Get(&count, "select count(*) from organization_members where organization_id = $1", workspaceID)
+		assert.Equal(2, count)
+	})
+
+	t.Run("leave workspace", func(t *testing.T) {
+		req := test.NewRequest(
+			test.WithUrl(fmt.Sprintf("%s/workspaces/%d/members/2", server.URL, workspaceID)),
+			test.WithAuthentication(test.Authenticated, otherCookie),
+			test.WithMethod(test.Delete),
+		)
+		res := test.Do(req)
+		assert := assert.New(t)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/projects", res.Header.Get("Hx-Redirect"))
+
+		// the member is switched back to their personal workspace
+		editable, readOnly := projects(otherCookie)
+		assert.Equal(2, editable)
+		assert.Equal(0, readOnly)
+	})
+}